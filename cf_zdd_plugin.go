@@ -22,29 +22,49 @@ import (
 	"code.cloudfoundry.org/cli/plugin"
 	"flag"
 	"github.com/comcast/cf-zdd-plugin/commands"
+	"os"
 	"strconv"
+	"time"
 )
 
 // constants
 const (
-	CanaryDeployHelpText  = "Deploys an application with a canary route"
-	CanaryPromoteHelpText = "Performs a promotion on the canary"
-	ZddDeployHelpText     = "ZDD deployment using scale-over plugin"
-	HelpText              = "Help is available for each of the commands in the form 'help <command name>'"
-	BlueGreenHelpText     = "Deploys an application and then flips the route to the new application"
-	PluginName            = "cf-zero-downtime-deployment"
+	CanaryDeployHelpText   = "Deploys an application with a canary route"
+	CanaryPromoteHelpText  = "Performs a promotion on the canary"
+	ZddDeployHelpText      = "ZDD deployment using scale-over plugin"
+	HelpText               = "Help is available for each of the commands in the form 'help <command name>'"
+	BlueGreenHelpText      = "Deploys an application and then flips the route to the new application"
+	RollingDeployHelpText  = "Deploys a new droplet to the existing application using a v3 rolling deployment"
+	PromoteDropletHelpText = "Copies the droplet of an application in another space and scales over to it"
+	RollbackHelpText       = "Restores the previous version of an application retained with -keep-previous"
+	CleanupHelpText        = "Deletes venerable apps, canary apps and canary routes left behind by failed deployments"
+	StatusHelpText         = "Shows the versions of an application and whether a deployment is in progress"
+	UnlockHelpText         = "Removes a stale deployment lock left by a deployment that did not finish"
+	HistoryHelpText        = "Shows the past deployments of an application from audit events and deployment metadata"
+	AnalyzeCanaryHelpText  = "Probes the canary against the live application, then promotes or tears down the canary"
+	AbortCanaryHelpText    = "Removes a canary and its routes, leaving the live application as it is"
+	PluginName             = "cf-zero-downtime-deployment"
 )
 
 // var - exported vars
 var (
-	CanaryDeployCmdName  = commands.CanaryDeployCmdName
-	CanaryPromoteCmdName = commands.CanaryPromoteCmdName
-	ZddDeployCmdName     = commands.ZddDeployCmdName
-	HelpCmdName          = commands.HelpCommandName
-	BlueGreenCmdName     = commands.BlueGreenCmdName
-	Major                string
-	Minor                string
-	Patch                string
+	CanaryDeployCmdName   = commands.CanaryDeployCmdName
+	CanaryPromoteCmdName  = commands.CanaryPromoteCmdName
+	ZddDeployCmdName      = commands.ZddDeployCmdName
+	HelpCmdName           = commands.HelpCommandName
+	BlueGreenCmdName      = commands.BlueGreenCmdName
+	RollingDeployCmdName  = commands.RollingDeployCmdName
+	PromoteDropletCmdName = commands.PromoteDropletCmdName
+	RollbackCmdName       = commands.RollbackCmdName
+	CleanupCmdName        = commands.CleanupCmdName
+	StatusCmdName         = commands.StatusCmdName
+	UnlockCmdName         = commands.UnlockCmdName
+	HistoryCmdName        = commands.HistoryCmdName
+	AnalyzeCanaryCmdName  = commands.AnalyzeCanaryCmdName
+	AbortCanaryCmdName    = commands.AbortCanaryCmdName
+	Major                 string
+	Minor                 string
+	Patch                 string
 )
 
 // CfZddPlugin - struct to initialize.
@@ -83,6 +103,42 @@ func (c *CfZddPlugin) GetMetadata() plugin.PluginMetadata {
 				Name:     BlueGreenCmdName,
 				HelpText: BlueGreenHelpText,
 			},
+			{
+				Name:     RollingDeployCmdName,
+				HelpText: RollingDeployHelpText,
+			},
+			{
+				Name:     PromoteDropletCmdName,
+				HelpText: PromoteDropletHelpText,
+			},
+			{
+				Name:     RollbackCmdName,
+				HelpText: RollbackHelpText,
+			},
+			{
+				Name:     CleanupCmdName,
+				HelpText: CleanupHelpText,
+			},
+			{
+				Name:     StatusCmdName,
+				HelpText: StatusHelpText,
+			},
+			{
+				Name:     UnlockCmdName,
+				HelpText: UnlockHelpText,
+			},
+			{
+				Name:     HistoryCmdName,
+				HelpText: HistoryHelpText,
+			},
+			{
+				Name:     AnalyzeCanaryCmdName,
+				HelpText: AnalyzeCanaryHelpText,
+			},
+			{
+				Name:     AbortCanaryCmdName,
+				HelpText: AbortCanaryHelpText,
+			},
 			{
 				Name:     HelpCmdName,
 				HelpText: HelpText,
@@ -121,22 +177,108 @@ func (c *CfZddPlugin) Run(cliConnection plugin.CliConnection, args []string) {
 	customURLFlag := fs.String("custom-health-url", "", "path to custom healthcheck page")
 	batchSizeFlag := fs.Int("batch-size", 1, "number to restart/deploy at a time")
 	routeCheckFlag := fs.Bool("no-route-check", false, "check to ensure a common route")
+	timeoutFlag := fs.String("timeout", "", "maximum time to wait for a rolling deployment")
+	sourceSpaceFlag := fs.String("source-space", "", "space of the application to promote the droplet from")
+	sourceAppFlag := fs.String("source-app", "", "application to promote the droplet from")
+	failureReportFlag := fs.String("failure-report", "", "file to append diagnostics of a failed deployment to")
+	retriesFlag := fs.Int("retries", commands.DefaultRetryAttempts, "attempts for cloud controller calls failing with transient errors")
+	retryDelayFlag := fs.Duration("retry-delay", commands.DefaultRetryDelay, "initial delay between retried cloud controller calls")
+	keepPreviousFlag := fs.Bool("keep-previous", false, "keep the replaced version stopped and unrouted for a rollback")
+	keepVersionsFlag := fs.Int("keep-versions", 0, "number of previous versions to keep stopped and unrouted, pruning older ones")
+	forceFlag := fs.Bool("force", false, "delete without asking for confirmation")
+	lockTTLFlag := fs.Duration("lock-ttl", commands.DefaultLockTTL, "time after which a deployment lock that was not released is stale")
+	gitSHAFlag := fs.String("git-sha", "", "commit being deployed, recorded on the new version")
+	strategyFlag := fs.String("strategy", "", "rollback strategy, scaleover or blue-green")
+	jsonFlag := fs.Bool("json", false, "print the output as json")
+	resumeFlag := fs.String("resume", "", "continue or rollback an interrupted deployment")
+	canaryInstancesFlag := fs.String("canary-instances", "", "canary instances, a number or a percentage of the live instances")
+	canaryMemoryFlag := fs.String("canary-memory", "", "memory limit of the canary instances")
+	canaryDiskFlag := fs.String("canary-disk", "", "disk limit of the canary instances")
+	canaryHostnameFlag := fs.String("canary-hostname", "", "template of the canary hostname, i.e. {{.BaseName}}-canary")
+	canaryDomainFlag := fs.String("canary-domain", "", "domain of the canary route")
+	canaryLiveTrafficFlag := fs.Bool("canary-live-traffic", false, "also map the live routes to the canary")
+	bakeFlag := fs.Duration("bake", commands.DefaultBakePeriod, "time to probe the canary for before deciding on it")
+	probeIntervalFlag := fs.Duration("probe-interval", commands.DefaultProbeInterval, "time between probes of the canary")
+	minSuccessRateFlag := fs.Float64("min-success-rate", commands.DefaultMinSuccessRate, "percentage of canary probes that must succeed")
+	maxLatencyRatioFlag := fs.Float64("max-latency-ratio", commands.DefaultMaxLatencyRatio, "canary latency percentiles allowed relative to live")
+	maxP95Flag := fs.Duration("max-p95", 0, "p95 latency the canary must stay under")
+	checkStatusFlag := fs.Int("check-status", 0, "status expected from the probes, default is any below 400")
+	checkBodyFlag := fs.String("check-body", "", "text expected in the body of the probes")
+	metricsConfigFlag := fs.String("metrics-config", "", "file of the metrics queries the canary is judged on")
+	captureLogsFlag := fs.Bool("capture-logs", false, "capture the recent logs of the canary before removing it")
+	smokeTestPathFlag := fs.String("smoke-test-path", "", "path requested on a test route of the new version before the routes flip")
+	smokeTestCmdFlag := fs.String("smoke-test-cmd", "", "command run against a test route of the new version before the routes flip")
+	smokeTestTimeoutFlag := fs.Duration("smoke-test-timeout", commands.DefaultSmokeTestTimeout, "time the smoke test may take")
+	keepOldFlag := fs.Duration("keep-old", 0, "time to watch the new version for, flipping the routes back to the old version on failure")
+	keepOldStoppedFlag := fs.Bool("keep-old-stopped", false, "stop the old version during the keep-old window")
+	repairRoutesFlag := fs.Bool("repair-routes", false, "correct the routes when they were not cut over to the new version")
+	hooksFlag := fs.String("hooks", "", "path to a file of commands to run at the stages of the deployment")
+	preCutoverTaskFlag := fs.String("pre-cutover-task", "", "command to run as a task of the new version before the cutover")
+	preCutoverTaskTimeoutFlag := fs.Duration("pre-cutover-task-timeout", commands.DefaultTaskTimeout, "time the pre-cutover task may take")
+	stagingTimeoutFlag := fs.Duration("staging-timeout", commands.DefaultStagingTimeout, "time staging the new version may take")
+	startTimeoutFlag := fs.Duration("start-timeout", commands.DefaultStartTimeout, "time the instances of a started version may take to run")
 
 	fs.Parse(args[1:])
 
+	conn := commands.NewRetryingCliConnection(cliConnection, commands.RetryPolicy{
+		Attempts:  *retriesFlag,
+		BaseDelay: *retryDelayFlag,
+		MaxDelay:  commands.DefaultMaxRetryDelay,
+	})
+
 	c.cmd = &commands.CfZddCmd{
-		OldApp:          *app1Flag,
-		NewApp:          *app2Flag,
-		CmdName:         args[0],
-		Conn:            cliConnection,
-		Duration:        *durationflag,
-		ApplicationPath: *applicationPathflag,
-		ManifestPath:    *manifestPathFlag,
-		CustomURL:       *customURLFlag,
-		BatchSize:       *batchSizeFlag,
-		RouteCheck:      *routeCheckFlag,
-		BaseAppName:     *baseAppName,
-		Commands:        commands.NewCommonCmd(cliConnection),
+		OldApp:            *app1Flag,
+		NewApp:            *app2Flag,
+		CmdName:           args[0],
+		Conn:              conn,
+		Duration:          *durationflag,
+		ApplicationPath:   *applicationPathflag,
+		ManifestPath:      *manifestPathFlag,
+		CustomURL:         *customURLFlag,
+		BatchSize:         *batchSizeFlag,
+		RouteCheck:        *routeCheckFlag,
+		BaseAppName:       *baseAppName,
+		Timeout:           *timeoutFlag,
+		SourceSpace:       *sourceSpaceFlag,
+		SourceApp:         *sourceAppFlag,
+		FailureReport:     *failureReportFlag,
+		KeepPrevious:      *keepPreviousFlag,
+		KeepVersions:      *keepVersionsFlag,
+		Strategy:          *strategyFlag,
+		Force:             *forceFlag,
+		Arguments:         fs.Args(),
+		LockTTL:           *lockTTLFlag,
+		GitSHA:            *gitSHAFlag,
+		StartedAt:         time.Now(),
+		JSONOutput:        *jsonFlag,
+		Resume:            *resumeFlag,
+		CanaryInstances:   *canaryInstancesFlag,
+		CanaryMemory:      *canaryMemoryFlag,
+		CanaryDisk:        *canaryDiskFlag,
+		CanaryHostname:    *canaryHostnameFlag,
+		CanaryDomain:      *canaryDomainFlag,
+		CanaryLiveTraffic: *canaryLiveTrafficFlag,
+		BakePeriod:        *bakeFlag,
+		ProbeInterval:     *probeIntervalFlag,
+		MinSuccessRate:    *minSuccessRateFlag,
+		MaxLatencyRatio:   *maxLatencyRatioFlag,
+		MaxP95:            *maxP95Flag,
+		CheckStatus:       *checkStatusFlag,
+		CheckBody:         *checkBodyFlag,
+		MetricsConfig:     *metricsConfigFlag,
+		CaptureLogs:       *captureLogsFlag,
+		SmokeTestPath:     *smokeTestPathFlag,
+		SmokeTestCmd:      *smokeTestCmdFlag,
+		SmokeTestTimeout:  *smokeTestTimeoutFlag,
+		KeepOld:           *keepOldFlag,
+		KeepOldStopped:    *keepOldStoppedFlag,
+		RepairRoutes:      *repairRoutesFlag,
+		HooksPath:         *hooksFlag,
+		PreCutoverTask:    *preCutoverTaskFlag,
+		TaskTimeout:       *preCutoverTaskTimeoutFlag,
+		StagingTimeout:    *stagingTimeoutFlag,
+		StartTimeout:      *startTimeoutFlag,
+		Commands:          commands.NewCommonCmd(conn),
 	}
 
 	fmt.Println(c.cmd.ManifestPath)
@@ -146,6 +288,9 @@ func (c *CfZddPlugin) Run(cliConnection plugin.CliConnection, args []string) {
 	}
 
 	if pr := c.GetPluginRunnable(); pr != nil {
-		pr.Run()
+		if err := pr.Run(); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
 	}
 }
@@ -18,24 +18,39 @@ package commands
 
 import (
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
+
+	"code.cloudfoundry.org/cli/plugin"
+	"code.cloudfoundry.org/cli/plugin/models"
 )
 
 // BlueGreenDeploy - struct for deployment
 type BlueGreenDeploy struct {
-	args *CfZddCmd
+	args   *CfZddCmd
+	Client clientDoer
 }
 
 const BlueGreenCmdName = "blue-green"
 
+// InstancePollInterval - time between checks on the instances of a version being started
+var InstancePollInterval = 20 * time.Second
+
+// DefaultStartTimeout - time the instances of a started version may take to run
+const DefaultStartTimeout = 5 * time.Minute
+
+// RollbackFailureThreshold - consecutive failed health checks of the new version that flip the routes back during the
+// -keep-old window
+var RollbackFailureThreshold = 3
+
 func init() {
 	Register(BlueGreenCmdName, new(BlueGreenDeploy))
 }
 
 // Run - run method as required by the interface
 func (bg *BlueGreenDeploy) Run() (err error) {
-	err = bg.deploy()
+	err = withDeploymentLock(bg.args, lockFamily(bg.args, bg.args.NewApp), bg.deploy)
 	return
 }
 
@@ -69,43 +84,218 @@ func (bg *BlueGreenDeploy) deploy() (err error) {
 
 	if !isAppDeployed {
 		fmt.Println("Application is not deployed.... pushing.")
-		err = bg.args.Commands.PushApplication(applicationToDeploy, artifactPath, manifestPath, "--no-route")
+		if err = runHooks(bg.args, HookPrePush, applicationToDeploy, ""); err == nil {
+			if err = bg.args.Commands.PushApplication(applicationToDeploy, artifactPath, manifestPath, "--no-route"); err == nil {
+				recordDeployment(bg.args, applicationToDeploy, newDeploymentRecord(bg.args, searchAppName, ""))
+				err = runHooks(bg.args, HookPostPush, applicationToDeploy, "")
+			}
+		}
+		if err != nil {
+			captureFailure(bg.args, applicationToDeploy, "")
+		}
 	} else {
 		fmt.Println("Application is deployed, renaming existing version")
 		venerable := strings.Join([]string{oldAppName, "venerable"}, "-")
+		if err = handleLeftovers(bg.args, searchAppName, oldAppName, venerable, false); err != nil {
+			return
+		}
+		if err = runHooks(bg.args, HookPrePush, applicationToDeploy, oldAppName); err != nil {
+			captureFailure(bg.args, applicationToDeploy, oldAppName)
+			return
+		}
 		if err = bg.args.Commands.RenameApplication(oldAppName, venerable); err != nil {
 			fmt.Println(err.Error())
+			captureFailure(bg.args, applicationToDeploy, oldAppName)
 			return
 		}
 
 		fmt.Printf("Pushing new version with name: %s\n", applicationToDeploy)
 		if err = bg.args.Commands.PushApplication(applicationToDeploy, artifactPath, manifestPath, "--no-route"); err != nil {
 			fmt.Println(err.Error())
+			captureFailure(bg.args, applicationToDeploy, venerable)
+			restoreVenerable(bg.args.Commands, applicationToDeploy, oldAppName, venerable)
 			return
 		}
 
-		for !bg.areAllInstancesStarted(applicationToDeploy) {
-			time.Sleep(20 * time.Second)
+		if err = waitForInstances(bg.args, applicationToDeploy); err != nil {
+			fmt.Println(err.Error())
+			captureFailure(bg.args, applicationToDeploy, venerable)
+			restoreVenerable(bg.args.Commands, applicationToDeploy, oldAppName, venerable)
+			return
+		}
+		if err = runHooks(bg.args, HookPostPush, applicationToDeploy, venerable); err != nil {
+			captureFailure(bg.args, applicationToDeploy, venerable)
+			restoreVenerable(bg.args.Commands, applicationToDeploy, oldAppName, venerable)
+			return
+		}
+		// The live routes only move to the new version once it passed the smoke test on a route of its own
+		if smokeTestEnabled(bg.args) {
+			if bg.Client == nil {
+				bg.Client = &http.Client{Timeout: ProbeTimeout}
+			}
+			if err = smokeTest(bg.args, bg.Client, applicationToDeploy, venerable); err != nil {
+				fmt.Println(err.Error())
+				captureFailure(bg.args, applicationToDeploy, venerable)
+				restoreVenerable(bg.args.Commands, applicationToDeploy, oldAppName, venerable)
+				return
+			}
+		}
+		if err = runHooks(bg.args, HookPreCutover, applicationToDeploy, venerable); err == nil {
+			err = runPreCutoverTask(bg.args, applicationToDeploy)
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+			captureFailure(bg.args, applicationToDeploy, venerable)
+			restoreVenerable(bg.args.Commands, applicationToDeploy, oldAppName, venerable)
+			return
 		}
 		fmt.Println("All instances started, remapping route.")
-		if err = bg.args.Commands.RemapRoutes(applicationToDeploy, venerable); err != nil {
+		var oldRoutes []plugin_models.GetApp_RouteSummary
+		if oldRoutes, err = appRoutes(bg.args, venerable); err != nil {
 			fmt.Println(err.Error())
+			captureFailure(bg.args, applicationToDeploy, venerable)
+			restoreVenerable(bg.args.Commands, applicationToDeploy, oldAppName, venerable)
+			return
 		}
-
-		fmt.Println("Removing old version")
-		if err = bg.args.Commands.RemoveApplication(venerable); err != nil {
+		if err = bg.args.Commands.RemapRoutes(venerable, applicationToDeploy); err != nil {
 			fmt.Println(err.Error())
 		}
+		if err = VerifyCutover(bg.args, oldRoutes, applicationToDeploy, venerable); err != nil {
+			fmt.Println(err.Error())
+			captureFailure(bg.args, applicationToDeploy, venerable)
+			return
+		}
+
+		if bg.args.KeepOld > 0 {
+			if err = bg.watchNewVersion(applicationToDeploy, oldAppName, venerable); err != nil {
+				fmt.Println(err.Error())
+				return
+			}
+		}
+
+		recordDeployment(bg.args, applicationToDeploy, newDeploymentRecord(bg.args, searchAppName, venerable))
+		retireVersion(bg.args, searchAppName, applicationToDeploy, venerable)
+		err = runHooks(bg.args, HookPostCutover, applicationToDeploy, venerable)
 	}
 
 	return
 }
 
-func (bg *BlueGreenDeploy) areAllInstancesStarted(appName string) bool {
-	if output, err := bg.args.Conn.GetApp(appName); err == nil {
+// watchNewVersion - keep the old version unrouted, stopped with -keep-old-stopped, while the health of the new version is
+// checked on its production routes for the -keep-old window. Routes flip back to the old version as soon as an instance
+// of the new version is down or its health check fails repeatedly.
+func (bg *BlueGreenDeploy) watchNewVersion(newApp string, oldAppName string, venerable string) (err error) {
+	if bg.Client == nil {
+		bg.Client = &http.Client{Timeout: ProbeTimeout}
+	}
+	if bg.args.KeepOldStopped {
+		if _, err = bg.args.Conn.CliCommand("stop", venerable); err != nil {
+			fmt.Printf("Unable to stop %s: %s\n", venerable, err.Error())
+		}
+	}
+	interval := bg.args.ProbeInterval
+	if interval <= 0 {
+		interval = DefaultProbeInterval
+	}
+
+	fmt.Printf("Watching %s for %s before removing %s\n", newApp, bg.args.KeepOld, venerable)
+	failures := 0
+	for start := time.Now(); time.Since(start) < bg.args.KeepOld; time.Sleep(interval) {
+		// The window may outlast the lock, which is renewed so no other deployment of the family starts meanwhile
+		if err = extendDeploymentLock(bg.args); err != nil {
+			captureFailure(bg.args, newApp, venerable)
+			return
+		}
+		problem := bg.checkNewVersion(newApp)
+		if problem == "" {
+			failures = 0
+			continue
+		}
+		fmt.Println(problem)
+		if failures++; failures < RollbackFailureThreshold {
+			continue
+		}
+
+		fmt.Printf("Flipping the routes back to %s\n", venerable)
+		captureFailure(bg.args, newApp, venerable)
+		if bg.args.KeepOldStopped {
+			if _, err = bg.args.Conn.CliCommand("start", venerable); err != nil {
+				return fmt.Errorf("unable to start %s to flip the routes back, %s still serves them: %s", venerable, newApp, err.Error())
+			}
+		}
+		var newRoutes []plugin_models.GetApp_RouteSummary
+		if newRoutes, err = appRoutes(bg.args, newApp); err != nil {
+			return fmt.Errorf("unable to flip the routes back to %s, %s still serves them: %s", venerable, newApp, err.Error())
+		}
+		if err = bg.args.Commands.RemapRoutes(newApp, venerable); err != nil {
+			return fmt.Errorf("unable to flip the routes back to %s: %s", venerable, err.Error())
+		}
+		if err = VerifyCutover(bg.args, newRoutes, venerable, newApp); err != nil {
+			return
+		}
+		restoreVenerable(bg.args.Commands, newApp, oldAppName, venerable)
+		runHooks(bg.args, HookOnRollback, oldAppName, newApp)
+		return fmt.Errorf("%s failed its health checks after the flip, the routes are back on %s", newApp, oldAppName)
+	}
+	fmt.Printf("%s stayed healthy for %s\n", newApp, bg.args.KeepOld)
+	return nil
+}
+
+// checkNewVersion - what is wrong with the new version, empty when all of its instances run and its health check
+// passes on its first production route
+func (bg *BlueGreenDeploy) checkNewVersion(newApp string) string {
+	app, err := bg.args.Conn.GetApp(newApp)
+	if err != nil {
+		return fmt.Sprintf("Unable to read %s: %s", newApp, err.Error())
+	}
+	if app.RunningInstances < app.InstanceCount {
+		return fmt.Sprintf("%d of %d instances of %s are running", app.RunningInstances, app.InstanceCount, newApp)
+	}
+	healthURL := routeURL(bg.args, app.Routes, false)
+	if healthURL == "" {
+		return ""
+	}
+	stats := &ProbeStats{URL: healthURL}
+	if probeRoute(bg.Client, bg.args, stats); stats.Successes == 0 {
+		return fmt.Sprintf("Health check of %s failed", healthURL)
+	}
+	return ""
+}
+
+// waitForInstances - wait for every instance of an app to run, renewing the deployment lock meanwhile. A crashed
+// instance, or instances still not running after the start timeout, are an error.
+func waitForInstances(args *CfZddCmd, appName string) error {
+	timeout := args.StartTimeout
+	if timeout <= 0 {
+		timeout = DefaultStartTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		started, err := areAllInstancesStarted(args.Conn, appName)
+		if err != nil || started {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("instances of %s are not running after %s", appName, timeout)
+		}
+		if err = extendDeploymentLock(args); err != nil {
+			return err
+		}
+		time.Sleep(InstancePollInterval)
+	}
+}
+
+// areAllInstancesStarted - check whether every instance is running, returning an error once any instance has crashed
+func areAllInstancesStarted(conn plugin.CliConnection, appName string) (bool, error) {
+	if output, err := conn.GetApp(appName); err == nil {
+		for idx, instance := range output.Instances {
+			if strings.EqualFold(instance.State, "crashed") {
+				return false, fmt.Errorf("instance %d of %s crashed: %s", idx, appName, instance.Details)
+			}
+		}
 		if output.InstanceCount == output.RunningInstances {
-			return true
+			return true, nil
 		}
 	}
-	return false
+	return false, nil
 }
@@ -17,6 +17,9 @@
 package commands_test
 
 import (
+	"errors"
+	"time"
+
 	"code.cloudfoundry.org/cli/plugin/models"
 	"github.com/comcast/cf-zdd-plugin/commands"
 	"github.com/comcast/cf-zdd-plugin/fakes"
@@ -46,8 +49,9 @@ var _ = Describe(".BlueGreenDeploy", func() {
 
 		BeforeEach(func() {
 			fakeConnection = new(fakes.FakeCliConnection)
+			fakeConnection.CliCommandWithoutTerminalOutputStub = httpDomains(nil)
 			fakeCommon = new(fakes.FakeCommonCmd)
-
+			commands.InstancePollInterval = 0
 		})
 		Context("when called with an application not previously deployed", func() {
 			BeforeEach(func() {
@@ -102,6 +106,408 @@ var _ = Describe(".BlueGreenDeploy", func() {
 				err = bgDeploy.Run()
 				Expect(err).ShouldNot(HaveOccurred())
 			})
+			It("should move the routes of the old version to the new version and remove the old version", func() {
+				err = bgDeploy.Run()
+				from, to := fakeCommon.RemapRoutesArgsForCall(0)
+				Expect(from).Should(Equal("myTestApp#1.2.2-abcde-venerable"))
+				Expect(to).Should(Equal("myTestApp#1.2.3-abcde"))
+				Expect(fakeCommon.RemoveApplicationArgsForCall(0)).Should(Equal("myTestApp#1.2.2-abcde-venerable"))
+			})
+			Context("and the previous version is kept", func() {
+				BeforeEach(func() {
+					cfZddCmd.KeepPrevious = true
+					err = bgDeploy.Run()
+				})
+				It("should retain the old version instead of removing it", func() {
+					Expect(err).ShouldNot(HaveOccurred())
+					Expect(fakeCommon.RetainApplicationArgsForCall(0)).Should(Equal("myTestApp#1.2.2-abcde-venerable"))
+					Expect(fakeCommon.RemoveApplicationCallCount()).Should(Equal(0))
+				})
+			})
+		})
+		Context("when a smoke test is configured", func() {
+			var (
+				client    *probeClient
+				table     *routeTable
+				smokeHost = "myTestApp-1-2-3-abcde-smoke.example.com"
+			)
+			BeforeEach(func() {
+				commands.SmokeTestRetryInterval = 0
+				fakeCommon.IsApplicationDeployedReturns("myTestApp#1.2.2-abcde", true)
+				table = newRouteTable(fakeConnection, fakeCommon, &plugin_models.GetAppModel{RunningInstances: 2, InstanceCount: 2})
+				table.routes["myTestApp#1.2.2-abcde-venerable"] = []plugin_models.GetApp_RouteSummary{
+					{Host: "myTestApp", Domain: plugin_models.GetApp_DomainFields{Name: "apps.internal"}},
+					{Host: "", Domain: plugin_models.GetApp_DomainFields{Name: "tcp.example.com"}},
+					{Host: "myTestApp", Domain: plugin_models.GetApp_DomainFields{Name: "example.com"}},
+				}
+				fakeConnection.CliCommandWithoutTerminalOutputStub = curlResponder(map[string]string{
+					"GET /v3/domains?names=apps.internal":   `{"resources": [{"name": "apps.internal", "internal": true}]}`,
+					"GET /v3/domains?names=tcp.example.com": `{"resources": [{"name": "tcp.example.com", "router_group": {"guid": "tcp-group"}}]}`,
+					"GET /v3/domains?names=example.com":     `{"resources": [{"name": "example.com", "internal": false, "router_group": null}]}`,
+				})
+				client = &probeClient{statuses: map[string]int{smokeHost: 200}, body: "healthy"}
+
+				cfZddCmd = &commands.CfZddCmd{
+					CmdName:          commands.BlueGreenCmdName,
+					NewApp:           "myTestApp#1.2.3-abcde",
+					ManifestPath:     "../fixtures/manifest.yml",
+					ApplicationPath:  "application.jar",
+					Conn:             fakeConnection,
+					Commands:         fakeCommon,
+					BaseAppName:      "mytestapp",
+					SmokeTestPath:    "/health",
+					SmokeTestTimeout: time.Second,
+				}
+				bgDeploy = &commands.BlueGreenDeploy{Client: client}
+				bgDeploy.SetArgs(cfZddCmd)
+			})
+			Context("and the smoke test passes", func() {
+				BeforeEach(func() {
+					cfZddCmd.SmokeTestCmd = `test "$SMOKE_TEST_URL" = "https://` + smokeHost + `" && test "$SMOKE_TEST_APP" = "myTestApp#1.2.3-abcde"`
+					err = bgDeploy.Run()
+				})
+				It("should test the new version on a test route before flipping the routes", func() {
+					Expect(err).ShouldNot(HaveOccurred())
+					Expect(client.hosts).Should(Equal([]string{smokeHost}))
+					Expect(fakeConnection.CliCommandArgsForCall(0)).Should(Equal([]string{"map-route", "myTestApp#1.2.3-abcde", "example.com", "-n", "myTestApp-1-2-3-abcde-smoke"}))
+					Expect(fakeCommon.RemapRoutesCallCount()).Should(Equal(1))
+				})
+				It("should delete the test route", func() {
+					Expect(fakeConnection.CliCommandArgsForCall(1)).Should(Equal([]string{"delete-route", "example.com", "-n", "myTestApp-1-2-3-abcde-smoke", "-f"}))
+				})
+			})
+			Context("and the live version only has internal routes", func() {
+				BeforeEach(func() {
+					table.routes["myTestApp#1.2.2-abcde-venerable"] = table.routes["myTestApp#1.2.2-abcde-venerable"][:1]
+					fakeCommon.GetDefaultDomainReturns("example.com")
+					err = bgDeploy.Run()
+				})
+				It("should test the new version on the default domain", func() {
+					Expect(err).ShouldNot(HaveOccurred())
+					Expect(fakeConnection.CliCommandArgsForCall(0)).Should(Equal([]string{"map-route", "myTestApp#1.2.3-abcde", "example.com", "-n", "myTestApp-1-2-3-abcde-smoke"}))
+				})
+			})
+			Context("and the http check fails", func() {
+				BeforeEach(func() {
+					client.statuses[smokeHost] = 500
+					cfZddCmd.SmokeTestTimeout = 10 * time.Millisecond
+					err = bgDeploy.Run()
+				})
+				It("should remove the new version and leave the old one untouched", func() {
+					Expect(err).Should(MatchError(ContainSubstring("smoke test of https://" + smokeHost + "/health failed")))
+					Expect(fakeCommon.RemapRoutesCallCount()).Should(Equal(0))
+					Expect(fakeCommon.RemoveApplicationArgsForCall(0)).Should(Equal("myTestApp#1.2.3-abcde"))
+					from, to := fakeCommon.RenameApplicationArgsForCall(1)
+					Expect(from).Should(Equal("myTestApp#1.2.2-abcde-venerable"))
+					Expect(to).Should(Equal("myTestApp#1.2.2-abcde"))
+				})
+				It("should retry the check until the smoke test timeout", func() {
+					Expect(len(client.hosts)).Should(BeNumerically(">", 1))
+				})
+				It("should delete the test route", func() {
+					Expect(fakeConnection.CliCommandArgsForCall(1)[0]).Should(Equal("delete-route"))
+				})
+			})
+			Context("and the smoke test command fails", func() {
+				BeforeEach(func() {
+					cfZddCmd.SmokeTestPath = ""
+					cfZddCmd.SmokeTestCmd = "exit 3"
+					err = bgDeploy.Run()
+				})
+				It("should not flip the routes", func() {
+					Expect(err).Should(MatchError(ContainSubstring(`smoke test "exit 3" failed`)))
+					Expect(fakeCommon.RemapRoutesCallCount()).Should(Equal(0))
+					Expect(fakeCommon.RemoveApplicationArgsForCall(0)).Should(Equal("myTestApp#1.2.3-abcde"))
+				})
+			})
+			Context("and the smoke test command runs past its timeout", func() {
+				BeforeEach(func() {
+					cfZddCmd.SmokeTestPath = ""
+					cfZddCmd.SmokeTestCmd = "exec sleep 5"
+					cfZddCmd.SmokeTestTimeout = 100 * time.Millisecond
+					err = bgDeploy.Run()
+				})
+				It("should fail the smoke test", func() {
+					Expect(err).Should(MatchError(ContainSubstring("timed out")))
+					Expect(fakeCommon.RemapRoutesCallCount()).Should(Equal(0))
+				})
+			})
+		})
+		Context("when the old version is kept for a window after the flip", func() {
+			var (
+				client  *probeClient
+				newApp  plugin_models.GetAppModel
+				table   *routeTable
+				newHost = "myTestApp.example.com"
+			)
+			BeforeEach(func() {
+				fakeCommon.IsApplicationDeployedReturns("myTestApp#1.2.2-abcde", true)
+				newApp = plugin_models.GetAppModel{RunningInstances: 2, InstanceCount: 2}
+				table = newRouteTable(fakeConnection, fakeCommon, &newApp)
+				table.routes["myTestApp#1.2.2-abcde-venerable"] = []plugin_models.GetApp_RouteSummary{
+					{Host: "myTestApp", Domain: plugin_models.GetApp_DomainFields{Name: "example.com"}},
+				}
+				client = &probeClient{statuses: map[string]int{newHost: 200}}
+
+				cfZddCmd = &commands.CfZddCmd{
+					CmdName:         commands.BlueGreenCmdName,
+					NewApp:          "myTestApp#1.2.3-abcde",
+					ManifestPath:    "../fixtures/manifest.yml",
+					ApplicationPath: "application.jar",
+					Conn:            fakeConnection,
+					Commands:        fakeCommon,
+					BaseAppName:     "mytestapp",
+					CustomURL:       "/health",
+					KeepOld:         20 * time.Millisecond,
+					ProbeInterval:   time.Millisecond,
+				}
+				bgDeploy = &commands.BlueGreenDeploy{Client: client}
+				bgDeploy.SetArgs(cfZddCmd)
+			})
+			Context("and the new version stays healthy", func() {
+				BeforeEach(func() {
+					err = bgDeploy.Run()
+				})
+				It("should check the new version on its production routes", func() {
+					Expect(err).ShouldNot(HaveOccurred())
+					Expect(client.hosts).ShouldNot(BeEmpty())
+					Expect(client.hosts[0]).Should(Equal(newHost))
+				})
+				It("should remove the old version once the window passed", func() {
+					Expect(fakeCommon.RemapRoutesCallCount()).Should(Equal(1))
+					Expect(fakeCommon.RemoveApplicationArgsForCall(0)).Should(Equal("myTestApp#1.2.2-abcde-venerable"))
+				})
+			})
+			Context("and the health check of the new version fails", func() {
+				BeforeEach(func() {
+					client.statuses[newHost] = 500
+					err = bgDeploy.Run()
+				})
+				It("should flip the routes back to the old version", func() {
+					Expect(err).Should(MatchError(ContainSubstring("the routes are back on myTestApp#1.2.2-abcde")))
+					Expect(len(client.hosts)).Should(Equal(commands.RollbackFailureThreshold))
+					from, to := fakeCommon.RemapRoutesArgsForCall(1)
+					Expect(from).Should(Equal("myTestApp#1.2.3-abcde"))
+					Expect(to).Should(Equal("myTestApp#1.2.2-abcde-venerable"))
+				})
+				It("should remove the new version and restore the name of the old one", func() {
+					Expect(fakeCommon.RemoveApplicationCallCount()).Should(Equal(1))
+					Expect(fakeCommon.RemoveApplicationArgsForCall(0)).Should(Equal("myTestApp#1.2.3-abcde"))
+					from, to := fakeCommon.RenameApplicationArgsForCall(1)
+					Expect(from).Should(Equal("myTestApp#1.2.2-abcde-venerable"))
+					Expect(to).Should(Equal("myTestApp#1.2.2-abcde"))
+				})
+			})
+			Context("and instances of the new version go down", func() {
+				BeforeEach(func() {
+					fakeCommon.RemapRoutesStub = func(from string, to string) error {
+						newApp.RunningInstances = 1
+						return table.remap(from, to)
+					}
+					err = bgDeploy.Run()
+				})
+				It("should flip the routes back to the old version", func() {
+					Expect(err).Should(HaveOccurred())
+					Expect(client.hosts).Should(BeEmpty())
+					Expect(fakeCommon.RemapRoutesCallCount()).Should(Equal(2))
+				})
+			})
+			Context("and the routes do not move back", func() {
+				BeforeEach(func() {
+					client.statuses[newHost] = 500
+					fakeCommon.RemapRoutesStub = func(from string, to string) error {
+						if to == "myTestApp#1.2.3-abcde" {
+							return table.remap(from, to)
+						}
+						return nil
+					}
+					err = bgDeploy.Run()
+				})
+				It("should keep the new version and fail", func() {
+					Expect(err).Should(MatchError(ContainSubstring("routes were not cut over")))
+					Expect(fakeCommon.RemoveApplicationCallCount()).Should(Equal(0))
+				})
+			})
+			Context("and the window outlasts the deployment lock", func() {
+				BeforeEach(func() {
+					fakeCommon.AcquireDeploymentLockReturns(true, nil)
+					fakeCommon.ExtendDeploymentLockReturns(time.Now().Add(time.Hour), nil)
+					cfZddCmd.LockTTL = 10 * time.Millisecond
+					err = bgDeploy.Run()
+				})
+				It("should renew the lock while watching the new version", func() {
+					Expect(err).ShouldNot(HaveOccurred())
+					Expect(fakeCommon.ExtendDeploymentLockCallCount()).Should(Equal(1))
+					family, ttl := fakeCommon.ExtendDeploymentLockArgsForCall(0)
+					Expect(family).Should(Equal("mytestapp"))
+					Expect(ttl).Should(Equal(10 * time.Millisecond))
+				})
+			})
+			Context("and the deployment lock cannot be renewed", func() {
+				BeforeEach(func() {
+					fakeCommon.AcquireDeploymentLockReturns(true, nil)
+					fakeCommon.ExtendDeploymentLockReturns(time.Time{}, errors.New("mytestapp is being deployed by pipeline"))
+					cfZddCmd.LockTTL = time.Millisecond
+					err = bgDeploy.Run()
+				})
+				It("should stop watching and keep the old version", func() {
+					Expect(err).Should(MatchError(ContainSubstring("unable to extend the deployment lock of mytestapp")))
+					Expect(fakeCommon.RemoveApplicationCallCount()).Should(Equal(0))
+				})
+			})
+			Context("and the old version is stopped during the window", func() {
+				BeforeEach(func() {
+					cfZddCmd.KeepOldStopped = true
+					client.statuses[newHost] = 500
+					err = bgDeploy.Run()
+				})
+				It("should stop the old version and start it again to flip back", func() {
+					Expect(err).Should(HaveOccurred())
+					Expect(fakeConnection.CliCommandArgsForCall(0)).Should(Equal([]string{"stop", "myTestApp#1.2.2-abcde-venerable"}))
+					Expect(fakeConnection.CliCommandArgsForCall(1)).Should(Equal([]string{"start", "myTestApp#1.2.2-abcde-venerable"}))
+					Expect(fakeCommon.RemapRoutesCallCount()).Should(Equal(2))
+				})
+			})
+		})
+		Context("when the old version keeps a route after the flip", func() {
+			BeforeEach(func() {
+				fakeCommon.IsApplicationDeployedReturns("myTestApp#1.2.2-abcde", true)
+				table := newRouteTable(fakeConnection, fakeCommon, &plugin_models.GetAppModel{RunningInstances: 2, InstanceCount: 2})
+				table.routes["myTestApp#1.2.2-abcde-venerable"] = []plugin_models.GetApp_RouteSummary{
+					{Host: "myTestApp", Domain: plugin_models.GetApp_DomainFields{Name: "example.com"}},
+					{Host: "myTestApp", Domain: plugin_models.GetApp_DomainFields{Name: "example.org"}},
+				}
+				fakeCommon.RemapRoutesStub = func(from string, to string) error {
+					table.routes[to] = table.routes[from][:1]
+					table.routes[from] = table.routes[from][1:]
+					return nil
+				}
+
+				cfZddCmd = &commands.CfZddCmd{
+					CmdName:         commands.BlueGreenCmdName,
+					NewApp:          "myTestApp#1.2.3-abcde",
+					ManifestPath:    "../fixtures/manifest.yml",
+					ApplicationPath: "application.jar",
+					Conn:            fakeConnection,
+					Commands:        fakeCommon,
+					BaseAppName:     "mytestapp",
+				}
+				bgDeploy = new(commands.BlueGreenDeploy)
+				bgDeploy.SetArgs(cfZddCmd)
+				err = bgDeploy.Run()
+			})
+			It("should fail and keep the old version", func() {
+				Expect(err).Should(MatchError(ContainSubstring("routes were not cut over from myTestApp#1.2.2-abcde-venerable to myTestApp#1.2.3-abcde")))
+				Expect(fakeCommon.RemoveApplicationCallCount()).Should(Equal(0))
+				Expect(fakeConnection.CliCommandCallCount()).Should(Equal(0))
+			})
+		})
+		Context("when the routes of the old version cannot be read", func() {
+			BeforeEach(func() {
+				fakeCommon.IsApplicationDeployedReturns("myTestApp#1.2.2-abcde", true)
+				fakeConnection.GetAppStub = func(name string) (plugin_models.GetAppModel, error) {
+					if name == "myTestApp#1.2.2-abcde-venerable" {
+						return plugin_models.GetAppModel{}, errors.New("timeout")
+					}
+					return plugin_models.GetAppModel{Name: name, RunningInstances: 2, InstanceCount: 2}, nil
+				}
+
+				cfZddCmd = &commands.CfZddCmd{
+					CmdName:         commands.BlueGreenCmdName,
+					NewApp:          "myTestApp#1.2.3-abcde",
+					ManifestPath:    "../fixtures/manifest.yml",
+					ApplicationPath: "application.jar",
+					Conn:            fakeConnection,
+					Commands:        fakeCommon,
+					BaseAppName:     "mytestapp",
+				}
+				bgDeploy = new(commands.BlueGreenDeploy)
+				bgDeploy.SetArgs(cfZddCmd)
+				err = bgDeploy.Run()
+			})
+			It("should fail before flipping the routes and restore the old version", func() {
+				Expect(err).Should(MatchError(ContainSubstring("unable to read the routes of myTestApp#1.2.2-abcde-venerable")))
+				Expect(fakeCommon.RemapRoutesCallCount()).Should(Equal(0))
+				Expect(fakeCommon.RemoveApplicationArgsForCall(0)).Should(Equal("myTestApp#1.2.3-abcde"))
+			})
+		})
+		Context("when an instance of the new version crashes", func() {
+			BeforeEach(func() {
+				fakeCommon.IsApplicationDeployedReturns("myTestApp#1.2.2-abcde", true)
+
+				cfZddCmd = &commands.CfZddCmd{
+					CmdName:         commands.BlueGreenCmdName,
+					NewApp:          "myTestApp#1.2.3-abcde",
+					ManifestPath:    "../fixtures/manifest.yml",
+					ApplicationPath: "application.jar",
+					FailureReport:   "report.txt",
+					Conn:            fakeConnection,
+					Commands:        fakeCommon,
+					BaseAppName:     "mytestapp",
+				}
+				bgDeploy = new(commands.BlueGreenDeploy)
+				bgDeploy.SetArgs(cfZddCmd)
+
+				fakeConnection.GetAppReturns(plugin_models.GetAppModel{
+					RunningInstances: 1,
+					InstanceCount:    2,
+					Instances: []plugin_models.GetApp_AppInstanceFields{
+						{State: "running"},
+						{State: "crashed"},
+					},
+				}, nil)
+				err = bgDeploy.Run()
+			})
+			It("should return an error without remapping routes", func() {
+				Expect(err).Should(HaveOccurred())
+				Expect(fakeCommon.RemapRoutesCallCount()).Should(Equal(0))
+			})
+			It("should capture diagnostics of the new version before removing it", func() {
+				appName, reportPath := fakeCommon.CaptureDiagnosticsArgsForCall(0)
+				Expect(appName).Should(Equal("myTestApp#1.2.3-abcde"))
+				Expect(reportPath).Should(Equal("report.txt"))
+				Expect(fakeCommon.RemoveApplicationArgsForCall(0)).Should(Equal("myTestApp#1.2.3-abcde"))
+			})
+			It("should restore the name of the old version", func() {
+				from, to := fakeCommon.RenameApplicationArgsForCall(1)
+				Expect(from).Should(Equal("myTestApp#1.2.2-abcde-venerable"))
+				Expect(to).Should(Equal("myTestApp#1.2.2-abcde"))
+			})
+		})
+		Context("when the instances of the new version do not start", func() {
+			BeforeEach(func() {
+				fakeCommon.IsApplicationDeployedReturns("myTestApp#1.2.2-abcde", true)
+
+				cfZddCmd = &commands.CfZddCmd{
+					CmdName:         commands.BlueGreenCmdName,
+					NewApp:          "myTestApp#1.2.3-abcde",
+					ManifestPath:    "../fixtures/manifest.yml",
+					ApplicationPath: "application.jar",
+					StartTimeout:    50 * time.Millisecond,
+					LockTTL:         time.Hour,
+					LockedFamily:    "mytestapp",
+					LockExpiresAt:   time.Now().Add(time.Minute),
+					Conn:            fakeConnection,
+					Commands:        fakeCommon,
+					BaseAppName:     "mytestapp",
+				}
+				bgDeploy = new(commands.BlueGreenDeploy)
+				bgDeploy.SetArgs(cfZddCmd)
+
+				fakeConnection.GetAppReturns(plugin_models.GetAppModel{RunningInstances: 0, InstanceCount: 2}, nil)
+				fakeCommon.ExtendDeploymentLockReturns(time.Now().Add(time.Minute), nil)
+				err = bgDeploy.Run()
+			})
+			It("should stop waiting after the start timeout and restore the old version", func() {
+				Expect(err).Should(MatchError("instances of myTestApp#1.2.3-abcde are not running after 50ms"))
+				Expect(fakeCommon.RemapRoutesCallCount()).Should(Equal(0))
+				Expect(fakeCommon.RemoveApplicationArgsForCall(0)).Should(Equal("myTestApp#1.2.3-abcde"))
+			})
+			It("should renew the deployment lock while waiting", func() {
+				Expect(fakeCommon.ExtendDeploymentLockCallCount()).Should(BeNumerically(">", 0))
+				family, _ := fakeCommon.ExtendDeploymentLockArgsForCall(0)
+				Expect(family).Should(Equal("mytestapp"))
+			})
 		})
 	})
 })
@@ -0,0 +1,235 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/cli/plugin"
+	"code.cloudfoundry.org/cli/plugin/models"
+)
+
+// CanaryAbort - struct
+type CanaryAbort struct {
+	args *CfZddCmd
+}
+
+// AbortCanaryCmdName - constants
+const (
+	AbortCanaryCmdName = "abort-canary"
+)
+
+func init() {
+	Register(AbortCanaryCmdName, new(CanaryAbort))
+}
+
+// Run - Run method
+func (s *CanaryAbort) Run() (err error) {
+	canaryName := s.canaryName()
+	if canaryName == "" {
+		return errors.New("canary application must be specified")
+	}
+	err = withDeploymentLock(s.args, lockFamily(s.args, canaryName, s.args.OldApp), func() error {
+		return s.abort(canaryName)
+	})
+	return
+}
+
+// SetArgs - set command args
+func (s *CanaryAbort) SetArgs(args *CfZddCmd) {
+	s.args = args
+}
+
+func (s *CanaryAbort) canaryName() string {
+	if s.args.NewApp != "" {
+		return s.args.NewApp
+	}
+	if len(s.args.Arguments) > 0 {
+		return s.args.Arguments[0]
+	}
+	return ""
+}
+
+// abort - remove the canary and its routes, then check the live application still has the routes, state and
+// instances it had before
+func (s *CanaryAbort) abort(canaryName string) (err error) {
+	canary, err := s.args.Conn.GetApp(canaryName)
+	if err != nil {
+		return
+	}
+
+	live := liveVersion(s.args, canaryName)
+	if err = checkCanary(s.args, canary, live); err != nil {
+		return
+	}
+	var before *plugin_models.GetAppModel
+	if live != "" {
+		liveApp, liveErr := s.args.Conn.GetApp(live)
+		if liveErr != nil {
+			return liveErr
+		}
+		before = &liveApp
+	} else {
+		fmt.Printf("No live application found for %s, only canary routes are deleted\n", canaryName)
+	}
+
+	if s.args.CaptureLogs {
+		if diagErr := s.args.Commands.CaptureDiagnostics(canaryName, s.args.FailureReport); diagErr != nil {
+			fmt.Printf("Unable to capture diagnostics for %s: %s\n", canaryName, diagErr.Error())
+		}
+	}
+
+	fmt.Printf("Aborting canary %s\n", canaryName)
+	teardownCanary(s.args, canary, before)
+	if before == nil {
+		return
+	}
+
+	after, err := s.args.Conn.GetApp(live)
+	if err != nil {
+		return fmt.Errorf("unable to verify live application %s: %s", live, err.Error())
+	}
+	if changes := liveChanges(*before, after); len(changes) > 0 {
+		return fmt.Errorf("live application %s changed while aborting the canary: %s", live, strings.Join(changes, ", "))
+	}
+	fmt.Printf("Canary %s aborted, live application %s is unchanged\n", canaryName, live)
+	return
+}
+
+// liveVersion - the live application a canary runs beside, given with -old-app or found by the base name. That is the
+// canary itself when the application given is the live version rather than a canary.
+func liveVersion(args *CfZddCmd, canaryName string) string {
+	if args.OldApp != "" {
+		return args.OldApp
+	}
+	if name, deployed := args.Commands.IsApplicationDeployed(familyName(args, canaryName)); deployed {
+		return name
+	}
+	return ""
+}
+
+// checkCanary - refuse to tear down an application that is not a canary, so that a mistyped name cannot remove the
+// live version or another application of the space
+func checkCanary(args *CfZddCmd, canary plugin_models.GetAppModel, live string) error {
+	if canary.Name == live {
+		return fmt.Errorf("%s is the live application, not a canary", canary.Name)
+	}
+	if !isCanary(args.Conn, canary) {
+		return fmt.Errorf("%s is not a canary, it has neither its canary routes recorded nor a route ending in %s", canary.Name,
+			CanaryRouteSeparator+CanaryRouteSuffix)
+	}
+	return nil
+}
+
+// isCanary - canaries are annotated with the routes deploy-canary created for them, those deployed before the routes
+// were recorded have a canary route
+func isCanary(conn plugin.CliConnection, app plugin_models.GetAppModel) bool {
+	if isCanaryApp(conn, app.Guid) {
+		return true
+	}
+	for _, route := range app.Routes {
+		if isCanaryRoute(route.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+// teardownCanary - delete the canary routes and the canary itself. Other routes of the canary, such as the live routes
+// it shares, are only unmapped from it.
+func teardownCanary(args *CfZddCmd, canary plugin_models.GetAppModel, live *plugin_models.GetAppModel) {
+	own := ownCanaryRoutes(args, canary, live)
+	for _, route := range canary.Routes {
+		cliArgs := []string{"delete-route", route.Domain.Name, "-n", route.Host, "-f"}
+		if !own[routeKey(route)] {
+			cliArgs = []string{"unmap-route", canary.Name, route.Domain.Name, "-n", route.Host}
+		}
+		if route.Path != "" {
+			cliArgs = append(cliArgs, "--path", strings.TrimPrefix(route.Path, "/"))
+		}
+		if _, err := args.Conn.CliCommand(cliArgs...); err != nil {
+			fmt.Printf("Unable to %s %s: %s\n", cliArgs[0], routeKey(route), err.Error())
+		}
+	}
+	if err := args.Commands.RemoveApplication(canary.Name); err != nil {
+		fmt.Printf("Unable to remove canary %s: %s\n", canary.Name, err.Error())
+	}
+}
+
+// ownCanaryRoutes - the routes deploy-canary created for a canary, recorded in its canary routes annotation. Canaries
+// deployed without the annotation own the routes they do not share with the live application, or only their canary
+// routes when there is no live application.
+func ownCanaryRoutes(args *CfZddCmd, canary plugin_models.GetAppModel, live *plugin_models.GetAppModel) map[string]bool {
+	own := make(map[string]bool)
+	if app, err := appMetadata(args.Conn, canary.Guid); err == nil && app.Metadata.Annotations[CanaryRoutesAnnotation] != "" {
+		for _, route := range strings.Split(app.Metadata.Annotations[CanaryRoutesAnnotation], ",") {
+			own[route] = true
+		}
+		return own
+	}
+
+	shared := make(map[string]bool)
+	if live != nil {
+		for _, route := range live.Routes {
+			shared[routeKey(route)] = true
+		}
+	}
+	for _, route := range canary.Routes {
+		if !shared[routeKey(route)] && (live != nil || isCanaryRoute(route.Host)) {
+			own[routeKey(route)] = true
+		}
+	}
+	return own
+}
+
+// routeKey - the url of a route without its scheme
+func routeKey(route plugin_models.GetApp_RouteSummary) string {
+	host := route.Domain.Name
+	if route.Host != "" {
+		host = route.Host + "." + host
+	}
+	return host + route.Path
+}
+
+// liveChanges - what differs in the routes, state and instances of the live application between two reads of it
+func liveChanges(before plugin_models.GetAppModel, after plugin_models.GetAppModel) (changes []string) {
+	if before.State != after.State {
+		changes = append(changes, fmt.Sprintf("state %s is now %s", before.State, after.State))
+	}
+	if before.InstanceCount != after.InstanceCount {
+		changes = append(changes, fmt.Sprintf("%d instances are now %d", before.InstanceCount, after.InstanceCount))
+	}
+	if after.RunningInstances < before.RunningInstances {
+		changes = append(changes, fmt.Sprintf("%d running instances are now %d", before.RunningInstances, after.RunningInstances))
+	}
+	beforeRoutes, afterRoutes := routeKeys(before.Routes), routeKeys(after.Routes)
+	if strings.Join(beforeRoutes, " ") != strings.Join(afterRoutes, " ") {
+		changes = append(changes, fmt.Sprintf("routes %s are now %s", strings.Join(beforeRoutes, " "), strings.Join(afterRoutes, " ")))
+	}
+	return
+}
+
+func routeKeys(routes []plugin_models.GetApp_RouteSummary) (keys []string) {
+	for _, route := range routes {
+		keys = append(keys, routeKey(route))
+	}
+	sort.Strings(keys)
+	return
+}
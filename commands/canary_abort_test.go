@@ -0,0 +1,205 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands_test
+
+import (
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/comcast/cf-zdd-plugin/commands"
+	"github.com/comcast/cf-zdd-plugin/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("abortCanary", func() {
+	Describe(".init", func() {
+		Context("when the package is imported", func() {
+			It("should then be registered with the canary repo", func() {
+				_, ok := commands.GetRegistry()[commands.AbortCanaryCmdName]
+				Expect(ok).Should(BeTrue())
+			})
+		})
+	})
+
+	Describe("given: a run() method on an abortcanary object", func() {
+		var (
+			abort          *commands.CanaryAbort
+			cfZddCmd       *commands.CfZddCmd
+			fakeConnection *fakes.FakeCliConnection
+			fakeCommon     *fakes.FakeCommonCmd
+			liveApp        plugin_models.GetAppModel
+			liveRoute      = plugin_models.GetApp_RouteSummary{Host: "myapp", Domain: plugin_models.GetApp_DomainFields{Name: "example.com"}}
+			canaryRoute    = plugin_models.GetApp_RouteSummary{Host: commands.CreateCanaryRouteName("myapp-1.0.2"), Domain: plugin_models.GetApp_DomainFields{Name: "example.com"}}
+			err            error
+		)
+
+		BeforeEach(func() {
+			fakeConnection = new(fakes.FakeCliConnection)
+			fakeCommon = new(fakes.FakeCommonCmd)
+			fakeCommon.IsApplicationDeployedReturns("myapp-1.0.1", true)
+			liveApp = plugin_models.GetAppModel{Name: "myapp-1.0.1", State: "started", InstanceCount: 4, RunningInstances: 4,
+				Routes: []plugin_models.GetApp_RouteSummary{liveRoute}}
+			fakeConnection.GetAppStub = func(name string) (plugin_models.GetAppModel, error) {
+				if name == "myapp-1.0.2" {
+					return plugin_models.GetAppModel{Name: name, State: "started",
+						Routes: []plugin_models.GetApp_RouteSummary{canaryRoute, liveRoute}}, nil
+				}
+				return liveApp, nil
+			}
+
+			cfZddCmd = &commands.CfZddCmd{
+				CmdName:     commands.AbortCanaryCmdName,
+				BaseAppName: "myapp",
+				Arguments:   []string{"myapp-1.0.2"},
+				Conn:        fakeConnection,
+				Commands:    fakeCommon,
+			}
+			abort = new(commands.CanaryAbort)
+			abort.SetArgs(cfZddCmd)
+		})
+
+		Context("when the canary shares the live routes", func() {
+			BeforeEach(func() {
+				err = abort.Run()
+			})
+			It("should not return an error", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+			It("should delete the canary route and only unmap the live route", func() {
+				Expect(fakeConnection.CliCommandCallCount()).Should(Equal(2))
+				Expect(fakeConnection.CliCommandArgsForCall(0)).Should(Equal([]string{"delete-route", "example.com", "-n", canaryRoute.Host, "-f"}))
+				Expect(fakeConnection.CliCommandArgsForCall(1)).Should(Equal([]string{"unmap-route", "myapp-1.0.2", "example.com", "-n", "myapp"}))
+			})
+			It("should remove the canary", func() {
+				Expect(fakeCommon.RemoveApplicationCallCount()).Should(Equal(1))
+				Expect(fakeCommon.RemoveApplicationArgsForCall(0)).Should(Equal("myapp-1.0.2"))
+			})
+			It("should hold the deployment lock of the family", func() {
+				baseName, _ := fakeCommon.AcquireDeploymentLockArgsForCall(0)
+				Expect(baseName).Should(Equal("myapp"))
+			})
+			It("should not capture the canary logs", func() {
+				Expect(fakeCommon.CaptureDiagnosticsCallCount()).Should(Equal(0))
+			})
+		})
+
+		Context("when asked to capture the canary logs", func() {
+			BeforeEach(func() {
+				cfZddCmd.CaptureLogs = true
+				cfZddCmd.FailureReport = "canary.log"
+				fakeCommon.CaptureDiagnosticsStub = func(string, string) error {
+					Expect(fakeCommon.RemoveApplicationCallCount()).Should(Equal(0))
+					return nil
+				}
+				err = abort.Run()
+			})
+			It("should capture them before removing the canary", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				appName, report := fakeCommon.CaptureDiagnosticsArgsForCall(0)
+				Expect(appName).Should(Equal("myapp-1.0.2"))
+				Expect(report).Should(Equal("canary.log"))
+			})
+		})
+
+		Context("when the live application changes during the abort", func() {
+			BeforeEach(func() {
+				fakeCommon.RemoveApplicationStub = func(string) error {
+					liveApp.Routes = nil
+					return nil
+				}
+				err = abort.Run()
+			})
+			It("should return an error describing the change", func() {
+				Expect(err).Should(MatchError(ContainSubstring("live application myapp-1.0.1 changed")))
+				Expect(err).Should(MatchError(ContainSubstring("routes myapp.example.com are now")))
+			})
+		})
+
+		Context("when there is no live application", func() {
+			BeforeEach(func() {
+				fakeCommon.IsApplicationDeployedReturns("", false)
+				err = abort.Run()
+			})
+			It("should only delete the canary routes", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(fakeConnection.CliCommandArgsForCall(0)[0]).Should(Equal("delete-route"))
+				Expect(fakeConnection.CliCommandArgsForCall(1)[0]).Should(Equal("unmap-route"))
+				Expect(fakeCommon.RemoveApplicationCallCount()).Should(Equal(1))
+			})
+		})
+
+		Context("when the canary has its canary routes recorded", func() {
+			BeforeEach(func() {
+				fakeCommon.IsApplicationDeployedReturns("", false)
+				fakeConnection.GetAppStub = func(name string) (plugin_models.GetAppModel, error) {
+					return plugin_models.GetAppModel{Name: name, Guid: "canary-guid", Routes: []plugin_models.GetApp_RouteSummary{
+						{Host: "myapp-next", Domain: plugin_models.GetApp_DomainFields{Name: "example.com"}},
+						{Host: "myapp-next", Domain: plugin_models.GetApp_DomainFields{Name: "apps.internal"}},
+						{Host: "other", Domain: plugin_models.GetApp_DomainFields{Name: "example.com"}},
+					}}, nil
+				}
+				fakeConnection.CliCommandWithoutTerminalOutputStub = curlResponder(map[string]string{
+					"GET /v3/apps/canary-guid": `{"metadata":{"annotations":{"zdd.comcast.com/canary-routes":"myapp-next.example.com,myapp-next.apps.internal"}}}`,
+				})
+				err = abort.Run()
+			})
+			It("should delete exactly those routes", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(fakeConnection.CliCommandArgsForCall(0)).Should(Equal([]string{"delete-route", "example.com", "-n", "myapp-next", "-f"}))
+				Expect(fakeConnection.CliCommandArgsForCall(1)).Should(Equal([]string{"delete-route", "apps.internal", "-n", "myapp-next", "-f"}))
+				Expect(fakeConnection.CliCommandArgsForCall(2)).Should(Equal([]string{"unmap-route", "myapp-1.0.2", "example.com", "-n", "other"}))
+			})
+		})
+
+		Context("when the application given is the live version", func() {
+			BeforeEach(func() {
+				cfZddCmd.Arguments = []string{"myapp-1.0.1"}
+				err = abort.Run()
+			})
+			It("should refuse to abort it", func() {
+				Expect(err).Should(MatchError("myapp-1.0.1 is the live application, not a canary"))
+				Expect(fakeConnection.CliCommandCallCount()).Should(Equal(0))
+				Expect(fakeCommon.RemoveApplicationCallCount()).Should(Equal(0))
+			})
+		})
+
+		Context("when the application given is not a canary", func() {
+			BeforeEach(func() {
+				fakeCommon.IsApplicationDeployedReturns("", false)
+				fakeConnection.GetAppReturns(plugin_models.GetAppModel{Name: "otherapp", Routes: []plugin_models.GetApp_RouteSummary{liveRoute}}, nil)
+				fakeConnection.GetAppStub = nil
+				cfZddCmd.Arguments = []string{"otherapp"}
+				err = abort.Run()
+			})
+			It("should refuse to abort it", func() {
+				Expect(err).Should(MatchError(ContainSubstring("otherapp is not a canary")))
+				Expect(fakeConnection.CliCommandCallCount()).Should(Equal(0))
+				Expect(fakeCommon.RemoveApplicationCallCount()).Should(Equal(0))
+			})
+		})
+
+		Context("when no canary is given", func() {
+			BeforeEach(func() {
+				cfZddCmd.Arguments = nil
+				err = abort.Run()
+			})
+			It("should return an error", func() {
+				Expect(err).Should(HaveOccurred())
+				Expect(fakeCommon.RemoveApplicationCallCount()).Should(Equal(0))
+			})
+		})
+	})
+})
@@ -0,0 +1,364 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+)
+
+// AnalyzeCanary - struct
+type AnalyzeCanary struct {
+	args          *CfZddCmd
+	Client        clientDoer
+	MetricsClient clientDoer
+	PromoteCmd    CommandRunnable
+}
+
+// AnalyzeCanaryCmdName - constants
+const (
+	AnalyzeCanaryCmdName = "analyze-canary"
+)
+
+// Defaults of the canary analysis
+const (
+	DefaultBakePeriod      = 5 * time.Minute
+	DefaultProbeInterval   = 5 * time.Second
+	DefaultMinSuccessRate  = 99.0
+	DefaultMaxLatencyRatio = 1.2
+)
+
+// ProbeTimeout - time allowed for a single probe request
+var ProbeTimeout = 10 * time.Second
+
+// LatencyNoise - latency differences below it are not held against the canary, as a ratio of very fast responses is
+// mostly jitter
+var LatencyNoise = 5 * time.Millisecond
+
+// ProbeStats - outcome of the probes of one route
+type ProbeStats struct {
+	URL       string          `json:"url"`
+	Requests  int             `json:"requests"`
+	Successes int             `json:"successes"`
+	Latencies []time.Duration `json:"-"`
+}
+
+// SuccessRate - percentage of successful probes
+func (p *ProbeStats) SuccessRate() float64 {
+	if p.Requests == 0 {
+		return 0
+	}
+	return 100 * float64(p.Successes) / float64(p.Requests)
+}
+
+// Percentile - nearest rank percentile of the latencies of the probes answered, zero without any
+func (p *ProbeStats) Percentile(percentile float64) time.Duration {
+	if len(p.Latencies) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), p.Latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := int(math.Ceil(percentile / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// AnalysisThresholds - what the canary must meet to be promoted
+type AnalysisThresholds struct {
+	MinSuccessRate  float64
+	MaxLatencyRatio float64
+	MaxP95          time.Duration
+}
+
+// AnalysisCheck - a line of the analysis report
+type AnalysisCheck struct {
+	Name      string `json:"name"`
+	Canary    string `json:"canary"`
+	Live      string `json:"live"`
+	Threshold string `json:"threshold"`
+	Passed    bool   `json:"passed"`
+}
+
+// AnalysisReport - the checks made and whether the canary passed them all
+type AnalysisReport struct {
+	Canary ProbeStats      `json:"canary"`
+	Live   *ProbeStats     `json:"live,omitempty"`
+	Checks []AnalysisCheck `json:"checks"`
+	Passed bool            `json:"passed"`
+}
+
+func init() {
+	Register(AnalyzeCanaryCmdName, new(AnalyzeCanary))
+}
+
+// Run - Run method
+func (s *AnalyzeCanary) Run() (err error) {
+	err = withDeploymentLock(s.args, lockFamily(s.args, s.args.NewApp, s.args.OldApp), s.analyze)
+	return
+}
+
+// SetArgs - set command args
+func (s *AnalyzeCanary) SetArgs(args *CfZddCmd) {
+	s.args = args
+}
+
+// analyze - probe the canary and live routes for the bake period, then promote the canary when it passed every check
+// or tear it down when it did not
+func (s *AnalyzeCanary) analyze() (err error) {
+	if s.Client == nil {
+		s.Client = &http.Client{Timeout: ProbeTimeout}
+	}
+	if s.MetricsClient == nil {
+		s.MetricsClient = &http.Client{Timeout: ProbeTimeout}
+	}
+	canaryName := s.args.NewApp
+	if canaryName == "" {
+		return errors.New("canary application must be specified with -new-app")
+	}
+	var metrics *MetricsConfig
+	if s.args.MetricsConfig != "" {
+		if metrics, err = LoadMetricsConfig(s.args.MetricsConfig); err != nil {
+			return
+		}
+	}
+
+	canary, err := s.args.Conn.GetApp(canaryName)
+	if err != nil {
+		return
+	}
+	canaryURL := routeURL(s.args, canary.Routes, true)
+	if canaryURL == "" {
+		return fmt.Errorf("%s has no canary route to probe", canaryName)
+	}
+
+	live := liveVersion(s.args, canaryName)
+	if err = checkCanary(s.args, canary, live); err != nil {
+		return
+	}
+	liveURL := ""
+	var liveApp *plugin_models.GetAppModel
+	var baseline *MetricsTarget
+	if live != "" {
+		liveModel, liveErr := s.args.Conn.GetApp(live)
+		if liveErr != nil {
+			return liveErr
+		}
+		liveApp = &liveModel
+		liveURL = routeURL(s.args, liveApp.Routes, false)
+		baseline = &MetricsTarget{App: live, GUID: liveApp.Guid, Window: PromWindow(s.args.BakePeriod)}
+	}
+
+	report, err := s.probe(canaryURL, liveURL)
+	if err != nil {
+		return fmt.Errorf("stopped probing canary %s, leaving it in place: %s", canaryName, err.Error())
+	}
+	report.Checks = CompareCanary(&report.Canary, report.Live, s.thresholds())
+	if metrics != nil {
+		target := MetricsTarget{App: canaryName, GUID: canary.Guid, Window: PromWindow(s.args.BakePeriod)}
+		metricsChecks, metricsErr := EvaluateMetrics(s.MetricsClient, metrics, target, baseline)
+		if metricsErr != nil {
+			return fmt.Errorf("unable to read the metrics of canary %s, leaving it in place: %s", canaryName, metricsErr.Error())
+		}
+		report.Checks = append(report.Checks, metricsChecks...)
+	}
+	report.Passed = true
+	for _, check := range report.Checks {
+		report.Passed = report.Passed && check.Passed
+	}
+	if err = s.printReport(report); err != nil {
+		return
+	}
+
+	if !report.Passed {
+		fmt.Printf("Canary %s failed the analysis, tearing it down\n", canaryName)
+		teardownCanary(s.args, canary, liveApp)
+		return fmt.Errorf("canary %s failed the analysis", canaryName)
+	}
+	if live == "" {
+		fmt.Printf("Canary %s passed the analysis, there is no live application to promote it over\n", canaryName)
+		return
+	}
+
+	fmt.Printf("Canary %s passed the analysis, promoting it over %s\n", canaryName, live)
+	if s.PromoteCmd == nil {
+		s.PromoteCmd = &CanaryPromote{Client: s.Client}
+	}
+	s.args.OldApp = live
+	s.args.NewApp = canaryName
+	s.PromoteCmd.SetArgs(s.args)
+	return s.PromoteCmd.Run()
+}
+
+// routeURL - url probed on the first canary route, or the first live route, of an app that can be requested over http,
+// skipping routes on internal and tcp domains
+func routeURL(args *CfZddCmd, routes []plugin_models.GetApp_RouteSummary, canary bool) string {
+	path := args.CustomURL
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	for _, route := range routes {
+		if isCanaryRoute(route.Host) == canary && probeableDomain(args, route.Domain.Name) {
+			host := route.Domain.Name
+			if route.Host != "" {
+				host = route.Host + "." + host
+			}
+			return "https://" + host + route.Path + path
+		}
+	}
+	return ""
+}
+
+// probe - request the canary and live urls once every probe interval until the bake period is over, renewing the
+// deployment lock in between
+func (s *AnalyzeCanary) probe(canaryURL string, liveURL string) (*AnalysisReport, error) {
+	report := &AnalysisReport{Canary: ProbeStats{URL: canaryURL}}
+	if liveURL != "" {
+		report.Live = &ProbeStats{URL: liveURL}
+	}
+	bake := s.args.BakePeriod
+	fmt.Printf("Probing %s for %s\n", canaryURL, bake)
+
+	for start := time.Now(); ; {
+		probeRoute(s.Client, s.args, &report.Canary)
+		if report.Live != nil {
+			probeRoute(s.Client, s.args, report.Live)
+		}
+		if time.Since(start) >= bake {
+			break
+		}
+		if err := extendDeploymentLock(s.args); err != nil {
+			return nil, err
+		}
+		time.Sleep(s.args.ProbeInterval)
+	}
+	return report, nil
+}
+
+// probeRoute - a probe succeeds when it is answered with the expected status, any status below 400 by default, and a
+// body containing the expected text
+func probeRoute(client clientDoer, args *CfZddCmd, stats *ProbeStats) {
+	stats.Requests++
+	request, err := http.NewRequest("GET", stats.URL, nil)
+	if err != nil {
+		return
+	}
+	started := time.Now()
+	response, err := client.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	stats.Latencies = append(stats.Latencies, time.Since(started))
+	if err != nil {
+		return
+	}
+
+	statusOK := response.StatusCode < 400
+	if args.CheckStatus != 0 {
+		statusOK = response.StatusCode == args.CheckStatus
+	}
+	if statusOK && strings.Contains(string(body), args.CheckBody) {
+		stats.Successes++
+	}
+}
+
+func (s *AnalyzeCanary) thresholds() AnalysisThresholds {
+	thresholds := AnalysisThresholds{
+		MinSuccessRate:  s.args.MinSuccessRate,
+		MaxLatencyRatio: s.args.MaxLatencyRatio,
+		MaxP95:          s.args.MaxP95,
+	}
+	if thresholds.MinSuccessRate == 0 {
+		thresholds.MinSuccessRate = DefaultMinSuccessRate
+	}
+	if thresholds.MaxLatencyRatio == 0 {
+		thresholds.MaxLatencyRatio = DefaultMaxLatencyRatio
+	}
+	return thresholds
+}
+
+func (s *AnalyzeCanary) printReport(report *AnalysisReport) error {
+	if s.args.JSONOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CHECK\tCANARY\tLIVE\tTHRESHOLD\tRESULT")
+	for _, check := range report.Checks {
+		result := "pass"
+		if !check.Passed {
+			result = "FAIL"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", check.Name, check.Canary, orDash(check.Live), check.Threshold, result)
+	}
+	w.Flush()
+	return nil
+}
+
+// CompareCanary - check the success rate of the canary and its latency percentiles against those of the live route.
+// Latencies are only compared when the live route was probed.
+func CompareCanary(canary *ProbeStats, live *ProbeStats, thresholds AnalysisThresholds) (checks []AnalysisCheck) {
+	rate := AnalysisCheck{
+		Name:      "success rate",
+		Canary:    fmt.Sprintf("%.1f%%", canary.SuccessRate()),
+		Threshold: fmt.Sprintf(">= %.1f%%", thresholds.MinSuccessRate),
+		Passed:    canary.Requests > 0 && canary.SuccessRate() >= thresholds.MinSuccessRate,
+	}
+	if live != nil {
+		rate.Live = fmt.Sprintf("%.1f%%", live.SuccessRate())
+	}
+	checks = append(checks, rate)
+
+	if live != nil && len(live.Latencies) > 0 {
+		for _, percentile := range []float64{50, 95, 99} {
+			canaryLatency, liveLatency := canary.Percentile(percentile), live.Percentile(percentile)
+			limit := time.Duration(float64(liveLatency) * thresholds.MaxLatencyRatio)
+			checks = append(checks, AnalysisCheck{
+				Name:      fmt.Sprintf("p%.0f latency", percentile),
+				Canary:    canaryLatency.String(),
+				Live:      liveLatency.String(),
+				Threshold: fmt.Sprintf("<= %.2fx live", thresholds.MaxLatencyRatio),
+				Passed:    len(canary.Latencies) > 0 && (canaryLatency <= limit || canaryLatency-liveLatency <= LatencyNoise),
+			})
+		}
+	}
+
+	if thresholds.MaxP95 > 0 {
+		checks = append(checks, AnalysisCheck{
+			Name:      "p95 latency limit",
+			Canary:    canary.Percentile(95).String(),
+			Threshold: "<= " + thresholds.MaxP95.String(),
+			Passed:    len(canary.Latencies) > 0 && canary.Percentile(95) <= thresholds.MaxP95,
+		})
+	}
+	return
+}
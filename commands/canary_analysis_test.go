@@ -0,0 +1,294 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/comcast/cf-zdd-plugin/commands"
+	"github.com/comcast/cf-zdd-plugin/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// probeClient - answers probes with the status and body set for the host of the request
+type probeClient struct {
+	statuses map[string]int
+	body     string
+	hosts    []string
+}
+
+func (c *probeClient) Do(req *http.Request) (*http.Response, error) {
+	c.hosts = append(c.hosts, req.URL.Host)
+	return &http.Response{
+		StatusCode: c.statuses[req.URL.Host],
+		Body:       ioutil.NopCloser(strings.NewReader(c.body)),
+	}, nil
+}
+
+// httpDomains - serve domain reads through 'cf curl' as http domains reachable from outside the foundation, and the
+// other requests with the responses given
+func httpDomains(responses map[string]string) func(args ...string) ([]string, error) {
+	respond := curlResponder(responses)
+	return func(args ...string) ([]string, error) {
+		if len(args) > 1 && args[0] == "curl" && strings.HasPrefix(args[1], "/v3/domains?names=") {
+			name, _ := url.QueryUnescape(strings.TrimPrefix(args[1], "/v3/domains?names="))
+			if strings.HasSuffix(name, ".internal") {
+				return []string{`{"resources": [{"name": "` + name + `", "internal": true}]}`}, nil
+			}
+			return []string{`{"resources": [{"name": "` + name + `"}]}`}, nil
+		}
+		return respond(args...)
+	}
+}
+
+var _ = Describe("analyzeCanary", func() {
+	Describe(".init", func() {
+		Context("when the package is imported", func() {
+			It("should then be registered with the canary repo", func() {
+				_, ok := commands.GetRegistry()[commands.AnalyzeCanaryCmdName]
+				Expect(ok).Should(BeTrue())
+			})
+		})
+	})
+
+	Describe("given: a run() method on an analyzecanary object", func() {
+		var (
+			analyze        *commands.AnalyzeCanary
+			cfZddCmd       *commands.CfZddCmd
+			fakeConnection *fakes.FakeCliConnection
+			fakeCommon     *fakes.FakeCommonCmd
+			promote        *fakes.FakeCmdRunner
+			client         *probeClient
+			canaryRoute    = commands.CreateCanaryRouteName("myapp-1.0.2")
+			err            error
+		)
+
+		BeforeEach(func() {
+			fakeConnection = new(fakes.FakeCliConnection)
+			fakeConnection.CliCommandWithoutTerminalOutputStub = httpDomains(nil)
+			fakeCommon = new(fakes.FakeCommonCmd)
+			fakeCommon.IsApplicationDeployedReturns("myapp-1.0.1", true)
+			fakeConnection.GetAppStub = func(name string) (plugin_models.GetAppModel, error) {
+				if name == "myapp-1.0.2" {
+					return plugin_models.GetAppModel{Name: name, Routes: []plugin_models.GetApp_RouteSummary{
+						{Host: canaryRoute, Domain: plugin_models.GetApp_DomainFields{Name: "example.com"}},
+					}}, nil
+				}
+				return plugin_models.GetAppModel{Name: name, Routes: []plugin_models.GetApp_RouteSummary{
+					{Host: "myapp", Domain: plugin_models.GetApp_DomainFields{Name: "example.com"}},
+				}}, nil
+			}
+			client = &probeClient{statuses: map[string]int{
+				canaryRoute + ".example.com": 200,
+				"myapp.example.com":          200,
+			}, body: "ok"}
+			promote = new(fakes.FakeCmdRunner)
+
+			cfZddCmd = &commands.CfZddCmd{
+				CmdName:     commands.AnalyzeCanaryCmdName,
+				NewApp:      "myapp-1.0.2",
+				BaseAppName: "myapp",
+				CustomURL:   "/health",
+				Conn:        fakeConnection,
+				Commands:    fakeCommon,
+			}
+			analyze = &commands.AnalyzeCanary{Client: client, PromoteCmd: promote}
+			analyze.SetArgs(cfZddCmd)
+		})
+
+		Context("when the canary answers the probes like the live version", func() {
+			BeforeEach(func() {
+				err = analyze.Run()
+			})
+			It("should probe the canary and live routes", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(client.hosts).Should(ConsistOf(canaryRoute+".example.com", "myapp.example.com"))
+			})
+			It("should promote the canary over the live version", func() {
+				Expect(promote.RunSpy).Should(Equal(1))
+				Expect(promote.ArgsSpy.OldApp).Should(Equal("myapp-1.0.1"))
+				Expect(promote.ArgsSpy.NewApp).Should(Equal("myapp-1.0.2"))
+			})
+			It("should not remove the canary", func() {
+				Expect(fakeCommon.RemoveApplicationCallCount()).Should(Equal(0))
+			})
+		})
+
+		Context("when the canary fails its probes", func() {
+			BeforeEach(func() {
+				client.statuses[canaryRoute+".example.com"] = 500
+				err = analyze.Run()
+			})
+			It("should return an error", func() {
+				Expect(err).Should(HaveOccurred())
+			})
+			It("should not promote the canary", func() {
+				Expect(promote.RunSpy).Should(Equal(0))
+			})
+			It("should delete the canary route and the canary", func() {
+				Expect(fakeConnection.CliCommandArgsForCall(0)).Should(Equal([]string{"delete-route", "example.com", "-n", canaryRoute, "-f"}))
+				Expect(fakeCommon.RemoveApplicationCallCount()).Should(Equal(1))
+				Expect(fakeCommon.RemoveApplicationArgsForCall(0)).Should(Equal("myapp-1.0.2"))
+			})
+		})
+
+		Context("when the body of the probes does not contain the expected text", func() {
+			BeforeEach(func() {
+				cfZddCmd.CheckBody = "healthy"
+				err = analyze.Run()
+			})
+			It("should fail the analysis", func() {
+				Expect(err).Should(HaveOccurred())
+				Expect(promote.RunSpy).Should(Equal(0))
+			})
+		})
+
+		Context("when the first routes of the canary and live version are on an internal domain", func() {
+			BeforeEach(func() {
+				fakeConnection.GetAppStub = func(name string) (plugin_models.GetAppModel, error) {
+					host := "myapp"
+					if name == "myapp-1.0.2" {
+						host = canaryRoute
+					}
+					return plugin_models.GetAppModel{Name: name, Routes: []plugin_models.GetApp_RouteSummary{
+						{Host: host, Domain: plugin_models.GetApp_DomainFields{Name: "apps.internal"}},
+						{Host: host, Domain: plugin_models.GetApp_DomainFields{Name: "example.com"}},
+					}}, nil
+				}
+				err = analyze.Run()
+			})
+			It("should probe the routes reachable over http", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(client.hosts).Should(ConsistOf(canaryRoute+".example.com", "myapp.example.com"))
+			})
+		})
+
+		Context("when the bake period outlasts the deployment lock", func() {
+			BeforeEach(func() {
+				fakeCommon.AcquireDeploymentLockReturns(true, nil)
+				fakeCommon.ExtendDeploymentLockReturns(time.Now().Add(time.Hour), nil)
+				cfZddCmd.LockTTL = time.Millisecond
+				cfZddCmd.BakePeriod = 5 * time.Millisecond
+				cfZddCmd.ProbeInterval = time.Millisecond
+				err = analyze.Run()
+			})
+			It("should renew the lock while probing", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(fakeCommon.ExtendDeploymentLockCallCount()).Should(BeNumerically(">", 0))
+				family, ttl := fakeCommon.ExtendDeploymentLockArgsForCall(0)
+				Expect(family).Should(Equal("myapp"))
+				Expect(ttl).Should(Equal(time.Millisecond))
+			})
+		})
+
+		Context("when the deployment lock cannot be renewed during the bake period", func() {
+			BeforeEach(func() {
+				fakeCommon.AcquireDeploymentLockReturns(true, nil)
+				fakeCommon.ExtendDeploymentLockReturns(time.Time{}, errors.New("myapp is being deployed by pipeline"))
+				cfZddCmd.LockTTL = time.Millisecond
+				cfZddCmd.BakePeriod = 5 * time.Millisecond
+				cfZddCmd.ProbeInterval = time.Millisecond
+				err = analyze.Run()
+			})
+			It("should stop probing and leave the canary in place", func() {
+				Expect(err).Should(MatchError(ContainSubstring("unable to extend the deployment lock of myapp")))
+				Expect(promote.RunSpy).Should(Equal(0))
+				Expect(fakeCommon.RemoveApplicationCallCount()).Should(Equal(0))
+			})
+		})
+
+		Context("when the canary has no canary route", func() {
+			BeforeEach(func() {
+				cfZddCmd.NewApp = "myapp-1.0.1"
+				err = analyze.Run()
+			})
+			It("should return an error without probing", func() {
+				Expect(err).Should(HaveOccurred())
+				Expect(client.hosts).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe(".CompareCanary", func() {
+		var (
+			live       *commands.ProbeStats
+			thresholds = commands.AnalysisThresholds{MinSuccessRate: 99, MaxLatencyRatio: 1.2}
+		)
+
+		BeforeEach(func() {
+			live = &commands.ProbeStats{Requests: 4, Successes: 4,
+				Latencies: []time.Duration{10 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond}}
+		})
+
+		passed := func(checks []commands.AnalysisCheck) bool {
+			for _, check := range checks {
+				if !check.Passed {
+					return false
+				}
+			}
+			return true
+		}
+
+		Context("when the canary is as fast and reliable as the live version", func() {
+			It("should pass every check", func() {
+				canary := &commands.ProbeStats{Requests: 4, Successes: 4, Latencies: live.Latencies}
+				checks := commands.CompareCanary(canary, live, thresholds)
+				Expect(checks).Should(HaveLen(4))
+				Expect(passed(checks)).Should(BeTrue())
+			})
+		})
+		Context("when the success rate of the canary is too low", func() {
+			It("should fail the success rate check", func() {
+				canary := &commands.ProbeStats{Requests: 4, Successes: 3, Latencies: live.Latencies}
+				checks := commands.CompareCanary(canary, live, thresholds)
+				Expect(checks[0].Name).Should(Equal("success rate"))
+				Expect(checks[0].Passed).Should(BeFalse())
+			})
+		})
+		Context("when the canary is slower than the ratio allows", func() {
+			It("should fail the latency checks", func() {
+				canary := &commands.ProbeStats{Requests: 4, Successes: 4,
+					Latencies: []time.Duration{30 * time.Millisecond, 30 * time.Millisecond, 30 * time.Millisecond, 100 * time.Millisecond}}
+				Expect(passed(commands.CompareCanary(canary, live, thresholds))).Should(BeFalse())
+			})
+		})
+		Context("when an absolute p95 limit is set", func() {
+			It("should check the canary p95 against it", func() {
+				canary := &commands.ProbeStats{Requests: 4, Successes: 4, Latencies: live.Latencies}
+				checks := commands.CompareCanary(canary, nil, commands.AnalysisThresholds{MinSuccessRate: 99, MaxP95: 20 * time.Millisecond})
+				Expect(checks).Should(HaveLen(2))
+				Expect(checks[1].Passed).Should(BeFalse())
+			})
+		})
+	})
+
+	Describe(".Percentile", func() {
+		It("should return the nearest rank percentile", func() {
+			stats := &commands.ProbeStats{Latencies: []time.Duration{4, 1, 3, 2}}
+			Expect(stats.Percentile(50)).Should(Equal(time.Duration(2)))
+			Expect(stats.Percentile(99)).Should(Equal(time.Duration(4)))
+			Expect((&commands.ProbeStats{}).Percentile(95)).Should(Equal(time.Duration(0)))
+		})
+	})
+})
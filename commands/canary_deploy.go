@@ -17,10 +17,15 @@
 package commands
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"os"
+	"strconv"
 	"strings"
+	"text/template"
 
 	"gopkg.in/yaml.v2"
 )
@@ -30,9 +35,13 @@ type CanaryDeploy struct {
 	args *CfZddCmd
 }
 
-// DomainList - struct
+// DomainList - the parts of a manifest naming the domains an app is served on, at the top level or for each of its
+// applications. Routes are either "host.domain/path" strings or maps with a route key.
 type DomainList struct {
-	Routes []string `yaml:"routes,omitempty"`
+	Routes       []interface{} `yaml:"routes,omitempty"`
+	Domain       string        `yaml:"domain,omitempty"`
+	Domains      []string      `yaml:"domains,omitempty"`
+	Applications []DomainList  `yaml:"applications,omitempty"`
 }
 
 // CanaryDeployCmdName - constants
@@ -40,13 +49,19 @@ const (
 	CanaryDeployCmdName = "deploy-canary"
 )
 
+// canaryRouteData - fields available to the canary hostname template
+type canaryRouteData struct {
+	App      string
+	BaseName string
+}
+
 func init() {
 	Register(CanaryDeployCmdName, new(CanaryDeploy))
 }
 
 // Run - Run method
 func (s *CanaryDeploy) Run() (err error) {
-	err = s.deploy()
+	err = withDeploymentLock(s.args, lockFamily(s.args, s.args.NewApp), s.deploy)
 	return
 }
 
@@ -58,37 +73,178 @@ func (s *CanaryDeploy) SetArgs(args *CfZddCmd) {
 // DeployCanary - function to create and push a canary deployment
 func (s *CanaryDeploy) deploy() (err error) {
 	appName := s.args.NewApp
+	baseName := familyName(s.args, appName)
+
+	// A canary left by an earlier run is pushed over, unless the name is that of a live version
+	if err = handleLeftovers(s.args, baseName, "", "", true); err != nil {
+		return
+	}
+
+	live := ""
+	if name, deployed := s.args.Commands.IsApplicationDeployed(baseName); deployed && name != appName {
+		live = name
+	} else if strings.HasSuffix(s.args.CanaryInstances, "%") || s.args.CanaryLiveTraffic {
+		return errors.New("sizing the canary after the live application or sharing its traffic requires a live application, set -base-name")
+	}
+	instances, err := s.canaryInstances(live)
+	if err != nil {
+		return
+	}
+	hostname, err := CanaryHostname(s.args.CanaryHostname, appName, baseName)
+	if err != nil {
+		return
+	}
 
 	//Deploy an initial canary version
-	deployArgs := []string{"-i", "1", "--no-route", "--no-start"}
+	deployArgs := []string{"-i", strconv.Itoa(instances), "--no-route", "--no-start"}
+	if s.args.CanaryMemory != "" {
+		deployArgs = append(deployArgs, "-m", s.args.CanaryMemory)
+	}
+	if s.args.CanaryDisk != "" {
+		deployArgs = append(deployArgs, "-k", s.args.CanaryDisk)
+	}
 
+	if err = runHooks(s.args, HookPrePush, appName, live); err != nil {
+		captureFailure(s.args, appName, live)
+		return
+	}
 	fmt.Printf("Calling with deploy args: %v\n", deployArgs)
-	err = s.args.Commands.PushApplication(appName, s.args.ApplicationPath, s.args.ManifestPath, deployArgs...)
+	if err = s.args.Commands.PushApplication(appName, s.args.ApplicationPath, s.args.ManifestPath, deployArgs...); err != nil {
+		captureFailure(s.args, appName, live)
+		return
+	}
 
-	deployArgsMapRoute := []string{"map-route", appName, s.getDomain(), "-n", CreateCanaryRouteName(appName)}
-	fmt.Printf("Calling with deploy args: %v\n", deployArgsMapRoute)
-	_, err = s.args.Conn.CliCommand(deployArgsMapRoute...)
+	// A canary route on every domain the app is served on, so each of them can be tested before the promotion
+	var canaryRoutes []string
+	for _, domain := range s.getDomains(live) {
+		deployArgsMapRoute := []string{"map-route", appName, domain, "-n", hostname}
+		fmt.Printf("Calling with deploy args: %v\n", deployArgsMapRoute)
+		if _, err = s.args.Conn.CliCommand(deployArgsMapRoute...); err != nil {
+			fmt.Println(err.Error())
+			continue
+		}
+		canaryRoutes = append(canaryRoutes, hostname+"."+domain)
+	}
+	recordCanaryRoutes(s.args, appName, baseName, canaryRoutes)
 
-	if err != nil {
-		fmt.Println(err.Error())
+	// Instances only receive traffic once running, the canary takes its share of the live routes as it starts
+	if s.args.CanaryLiveTraffic {
+		fmt.Printf("Mapping the routes of %s to the canary\n", live)
+		if err = s.args.Commands.MapRoutes(live, appName); err != nil {
+			captureFailure(s.args, appName, live)
+			return
+		}
 	}
 
 	startArgs := []string{"start", appName}
-	_, err = s.args.Conn.CliCommand(startArgs...)
-
+	if _, err = s.args.Conn.CliCommand(startArgs...); err != nil {
+		captureFailure(s.args, appName, live)
+		return
+	}
+	if err = runHooks(s.args, HookPostPush, appName, live); err != nil {
+		captureFailure(s.args, appName, live)
+	}
 	return
 }
 
 // CreateCanaryRouteName - function to create a properly formatted routename from an appname.
 func CreateCanaryRouteName(appname string) (routename string) {
-	appname = strings.Replace(appname, ".", CanaryRouteSeparator, -1)
-	appname = strings.Replace(appname, "#", CanaryRouteSeparator, -1)
-	routename = fmt.Sprintf("%s-%s", appname, CanaryRouteSuffix)
+	routename = fmt.Sprintf("%s-%s", routeSafeName(appname), CanaryRouteSuffix)
 	return
 }
 
-func (s *CanaryDeploy) getDomain() (domain string) {
+// CanaryHostname - hostname of the canary route from a template such as "{{.BaseName}}-next-canary", where App is the
+// canary app name and BaseName its base name, both with '.' and '#' replaced. An empty template gives the default
+// canary route name. The hostname must end in the canary suffix the other commands recognise canary routes by.
+func CanaryHostname(hostTemplate string, appName string, baseName string) (string, error) {
+	if hostTemplate == "" {
+		return CreateCanaryRouteName(appName), nil
+	}
+	tmpl, err := template.New("hostname").Option("missingkey=error").Parse(hostTemplate)
+	if err != nil {
+		return "", fmt.Errorf("invalid canary hostname template: %s", err.Error())
+	}
+	hostname := new(bytes.Buffer)
+	if err = tmpl.Execute(hostname, canaryRouteData{App: routeSafeName(appName), BaseName: routeSafeName(baseName)}); err != nil {
+		return "", fmt.Errorf("invalid canary hostname template: %s", err.Error())
+	}
+	if hostname.Len() == 0 {
+		return "", errors.New("canary hostname template gives an empty hostname")
+	}
+	if !isCanaryRoute(hostname.String()) {
+		return "", fmt.Errorf("canary hostname %s must end in %s, the route is otherwise taken for a live route", hostname.String(),
+			CanaryRouteSeparator+CanaryRouteSuffix)
+	}
+	return hostname.String(), nil
+}
+
+// routeSafeName - app names made valid as hostnames
+func routeSafeName(name string) string {
+	name = strings.Replace(name, ".", CanaryRouteSeparator, -1)
+	return strings.Replace(name, "#", CanaryRouteSeparator, -1)
+}
+
+// canaryInstances - an absolute number of instances, or a percentage of the live instances rounded up, default 1
+func (s *CanaryDeploy) canaryInstances(live string) (int, error) {
+	spec := s.args.CanaryInstances
+	if spec == "" {
+		return 1, nil
+	}
+	if strings.HasSuffix(spec, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(spec, "%"), 64)
+		if err != nil || percent <= 0 || percent > 100 {
+			return 0, fmt.Errorf("canary instances %s must be a percentage between 0 and 100", spec)
+		}
+		app, err := s.args.Conn.GetApp(live)
+		if err != nil {
+			return 0, err
+		}
+		instances := int(math.Ceil(float64(app.InstanceCount) * percent / 100))
+		if instances < 1 {
+			instances = 1
+		}
+		fmt.Printf("Sizing the canary at %s of the %d instances of %s: %d\n", spec, app.InstanceCount, live, instances)
+		return instances, nil
+	}
+	instances, err := strconv.Atoi(spec)
+	if err != nil || instances < 1 {
+		return 0, fmt.Errorf("canary instances %s must be a positive number or a percentage", spec)
+	}
+	return instances, nil
+}
+
+// getDomains - the domains of the canary routes: the -canary-domain, or the domains of the manifest routes along with
+// those the live application is served on, including internal domains. The default domain is used when there are none.
+func (s *CanaryDeploy) getDomains(live string) (domains []string) {
+	if s.args.CanaryDomain != "" {
+		return []string{s.args.CanaryDomain}
+	}
 
+	seen := make(map[string]bool)
+	add := func(domain string) {
+		if domain != "" && !seen[domain] {
+			seen[domain] = true
+			domains = append(domains, domain)
+		}
+	}
+	for _, domain := range s.manifestDomains() {
+		add(domain)
+	}
+	if live != "" {
+		if app, err := s.args.Conn.GetApp(live); err == nil {
+			for _, route := range app.Routes {
+				add(route.Domain.Name)
+			}
+		}
+	}
+	if len(domains) == 0 {
+		domains = []string{s.args.Commands.GetDefaultDomain()}
+	}
+	return
+}
+
+// manifestDomains - the domains named by the manifest, read from -f or manifest.yml
+func (s *CanaryDeploy) manifestDomains() (domains []string) {
 	var yamlFile []byte
 	var err error
 
@@ -98,7 +254,6 @@ func (s *CanaryDeploy) getDomain() (domain string) {
 		yamlFile, err = ioutil.ReadFile(s.args.ManifestPath)
 		if err != nil {
 			fmt.Printf("###ERROR reading file: %s\n", err.Error())
-			domain = s.args.Commands.GetDefaultDomain()
 			return
 		}
 	} else if _, err = os.Stat("manifest.yml"); err == nil {
@@ -107,7 +262,6 @@ func (s *CanaryDeploy) getDomain() (domain string) {
 
 		if err != nil {
 			fmt.Printf("###ERROR reading file: %s\n", err.Error())
-			domain = s.args.Commands.GetDefaultDomain()
 			return
 		}
 	}
@@ -117,16 +271,36 @@ func (s *CanaryDeploy) getDomain() (domain string) {
 		err = yaml.Unmarshal(yamlFile, &domainList)
 		if err != nil {
 			fmt.Printf("YAML UNMARSHAL ERROR: %s\n", err.Error())
-			domain = s.args.Commands.GetDefaultDomain()
 			return
 		}
-		if len(domainList.Routes) > 0 {
-			domain = strings.Join(strings.Split(domainList.Routes[0], ".")[1:], ".")
-			return
-		} else {
-			domain = s.args.Commands.GetDefaultDomain()
-			return
+	}
+	return domainList.domains()
+}
+
+func (d DomainList) domains() (domains []string) {
+	for _, route := range d.Routes {
+		if entry, ok := route.(map[interface{}]interface{}); ok {
+			route = entry["route"]
+		}
+		if domain := routeDomain(fmt.Sprint(route)); domain != "" {
+			domains = append(domains, domain)
 		}
 	}
+	if d.Domain != "" {
+		domains = append(domains, d.Domain)
+	}
+	domains = append(domains, d.Domains...)
+	for _, app := range d.Applications {
+		domains = append(domains, app.domains()...)
+	}
 	return
 }
+
+// routeDomain - the domain of a "host.domain/path" manifest route, empty for tcp routes as they take no hostname
+func routeDomain(route string) string {
+	route = strings.SplitN(route, "/", 2)[0]
+	if strings.Contains(route, ":") {
+		return ""
+	}
+	return strings.Join(strings.Split(route, ".")[1:], ".")
+}
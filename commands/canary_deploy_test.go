@@ -17,6 +17,7 @@
 package commands_test
 
 import (
+	"code.cloudfoundry.org/cli/plugin/models"
 	"fmt"
 	"github.com/comcast/cf-zdd-plugin/commands"
 	"github.com/comcast/cf-zdd-plugin/fakes"
@@ -78,19 +79,52 @@ var _ = Describe("canaryDeploy", func() {
 		})
 		Context("when called with a valid connection object and multiple domains defined in the manifest", func() {
 			var err error
-			var ctrlArgsMapRoute []string
 			BeforeEach(func() {
-				ctrlArgsMapRoute = []string{"map-route", ctrlAppName, "mylocaldomain.com", "-n", commands.CreateCanaryRouteName(ctrlAppName)}
 				ctrlManifestPath = "../fixtures/manifest-multidomain.yml"
 				cfZddCmd.ManifestPath = ctrlManifestPath
+				fakeConnection.GetAppReturns(plugin_models.GetAppModel{Guid: "canary-guid"}, nil)
 				err = canaryDeploy.Run()
 			})
 			It("should not return an error", func() {
 				Expect(err).ShouldNot(HaveOccurred())
 			})
-			It("should deploy an application with a canary route", func() {
-				Expect(fakeConnection.CliCommandCallCount()).Should(Equal(2))
-				Expect(fakeConnection.CliCommandArgsForCall(0)).Should(Equal(ctrlArgsMapRoute))
+			It("should deploy an application with a canary route on each domain", func() {
+				Expect(fakeConnection.CliCommandCallCount()).Should(Equal(3))
+				Expect(fakeConnection.CliCommandArgsForCall(0)).Should(Equal([]string{"map-route", ctrlAppName, "mylocaldomain.com", "-n", commands.CreateCanaryRouteName(ctrlAppName)}))
+				Expect(fakeConnection.CliCommandArgsForCall(1)).Should(Equal([]string{"map-route", ctrlAppName, "myseconddomain.com", "-n", commands.CreateCanaryRouteName(ctrlAppName)}))
+			})
+			It("should record the canary routes on the canary", func() {
+				Expect(curlRequests(fakeConnection)).Should(ContainElement("PATCH /v3/apps/canary-guid"))
+				for i := 0; i < fakeConnection.CliCommandWithoutTerminalOutputCallCount(); i++ {
+					args := fakeConnection.CliCommandWithoutTerminalOutputArgsForCall(i)
+					if args[0] == "curl" && args[3] == "PATCH" {
+						Expect(args[5]).Should(ContainSubstring(fmt.Sprintf(`"zdd.comcast.com/canary-routes":"%s.mylocaldomain.com,%s.myseconddomain.com"`,
+							commands.CreateCanaryRouteName(ctrlAppName), commands.CreateCanaryRouteName(ctrlAppName))))
+					}
+				}
+			})
+			It("should label the canary with its base name so it is found among the versions of its family", func() {
+				for i := 0; i < fakeConnection.CliCommandWithoutTerminalOutputCallCount(); i++ {
+					args := fakeConnection.CliCommandWithoutTerminalOutputArgsForCall(i)
+					if args[0] == "curl" && args[3] == "PATCH" {
+						Expect(args[5]).Should(ContainSubstring(`"labels":{"zdd.comcast.com/base-name":"myTestApp1.2.3-abcd"}`))
+					}
+				}
+			})
+		})
+		Context("when the manifest lists its domains under domain and domains", func() {
+			BeforeEach(func() {
+				cfZddCmd.ManifestPath = "../fixtures/manifest-bothdomain.yml"
+				Expect(canaryDeploy.Run()).Should(Succeed())
+			})
+			It("should deploy a canary route on each of them", func() {
+				var domains []string
+				for i := 0; i < fakeConnection.CliCommandCallCount(); i++ {
+					if args := fakeConnection.CliCommandArgsForCall(i); args[0] == "map-route" {
+						domains = append(domains, args[2])
+					}
+				}
+				Expect(domains).Should(Equal([]string{"mydomain.com", "mylocaldomain.com", "myseconddomain.com"}))
 			})
 		})
 		Context("when called with a valid connection object and no domain defined in the manifest", func() {
@@ -113,6 +147,135 @@ var _ = Describe("canaryDeploy", func() {
 			})
 		})
 	})
+	Describe("given canary size and placement options", func() {
+		var (
+			canaryDeploy   *commands.CanaryDeploy
+			cfZddCmd       *commands.CfZddCmd
+			fakeConnection *fakes.FakeCliConnection
+			fakeCommand    *fakes.FakeCommonCmd
+			err            error
+		)
+
+		BeforeEach(func() {
+			fakeConnection = new(fakes.FakeCliConnection)
+			fakeCommand = new(fakes.FakeCommonCmd)
+			fakeCommand.IsApplicationDeployedReturns("myTestApp-1.2.2", true)
+			fakeConnection.GetAppReturns(plugin_models.GetAppModel{InstanceCount: 10}, nil)
+			cfZddCmd = &commands.CfZddCmd{
+				CmdName:      commands.CanaryDeployCmdName,
+				NewApp:       "myTestApp-1.2.3",
+				BaseAppName:  "myTestApp",
+				ManifestPath: "../fixtures/manifest.yml",
+				Conn:         fakeConnection,
+				Commands:     fakeCommand,
+			}
+			canaryDeploy = new(commands.CanaryDeploy)
+			canaryDeploy.SetArgs(cfZddCmd)
+		})
+
+		Context("when sized as a percentage of the live application with resource overrides", func() {
+			BeforeEach(func() {
+				cfZddCmd.CanaryInstances = "25%"
+				cfZddCmd.CanaryMemory = "512M"
+				cfZddCmd.CanaryDisk = "1G"
+				err = canaryDeploy.Run()
+			})
+			It("should push the canary with the live instances rounded up and the overrides", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(fakeConnection.GetAppArgsForCall(0)).Should(Equal("myTestApp-1.2.2"))
+				_, _, _, pushArgs := fakeCommand.PushApplicationArgsForCall(0)
+				Expect(pushArgs).Should(Equal([]string{"-i", "3", "--no-route", "--no-start", "-m", "512M", "-k", "1G"}))
+			})
+		})
+
+		Context("when given an absolute number of instances", func() {
+			It("should push that many instances", func() {
+				cfZddCmd.CanaryInstances = "2"
+				Expect(canaryDeploy.Run()).Should(Succeed())
+				_, _, _, pushArgs := fakeCommand.PushApplicationArgsForCall(0)
+				Expect(pushArgs[:2]).Should(Equal([]string{"-i", "2"}))
+			})
+		})
+
+		Context("when given an invalid number of instances", func() {
+			It("should return an error without pushing", func() {
+				cfZddCmd.CanaryInstances = "0"
+				Expect(canaryDeploy.Run()).ShouldNot(Succeed())
+				Expect(fakeCommand.PushApplicationCallCount()).Should(Equal(0))
+			})
+		})
+
+		Context("when given a hostname template and a domain", func() {
+			BeforeEach(func() {
+				cfZddCmd.CanaryHostname = "{{.BaseName}}-next-canary"
+				cfZddCmd.CanaryDomain = "apps.example.com"
+				err = canaryDeploy.Run()
+			})
+			It("should map the canary route from the template on the domain", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(fakeConnection.CliCommandArgsForCall(0)).Should(Equal([]string{"map-route", "myTestApp-1.2.3", "apps.example.com", "-n", "myTestApp-next-canary"}))
+			})
+		})
+
+		Context("when the live application is served on more domains than the manifest names", func() {
+			BeforeEach(func() {
+				fakeConnection.GetAppReturns(plugin_models.GetAppModel{InstanceCount: 10, Routes: []plugin_models.GetApp_RouteSummary{
+					{Host: "myTestApp", Domain: plugin_models.GetApp_DomainFields{Name: "mylocaldomain.com"}},
+					{Host: "myTestApp", Domain: plugin_models.GetApp_DomainFields{Name: "apps.internal"}},
+				}}, nil)
+				err = canaryDeploy.Run()
+			})
+			It("should also map a canary route on those domains, internal ones included", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(fakeConnection.CliCommandArgsForCall(0)).Should(Equal([]string{"map-route", "myTestApp-1.2.3", "mylocaldomain.com", "-n", "myTestApp-1-2-3-canary"}))
+				Expect(fakeConnection.CliCommandArgsForCall(1)).Should(Equal([]string{"map-route", "myTestApp-1.2.3", "apps.internal", "-n", "myTestApp-1-2-3-canary"}))
+				Expect(fakeConnection.CliCommandArgsForCall(2)).Should(Equal([]string{"start", "myTestApp-1.2.3"}))
+			})
+		})
+
+		Context("when the canary shares the live traffic", func() {
+			BeforeEach(func() {
+				cfZddCmd.CanaryLiveTraffic = true
+				err = canaryDeploy.Run()
+			})
+			It("should also map the live routes to the canary before starting it", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				from, to := fakeCommand.MapRoutesArgsForCall(0)
+				Expect(from).Should(Equal("myTestApp-1.2.2"))
+				Expect(to).Should(Equal("myTestApp-1.2.3"))
+				Expect(fakeConnection.CliCommandArgsForCall(1)).Should(Equal([]string{"start", "myTestApp-1.2.3"}))
+			})
+		})
+
+		Context("when sized after the live application but none is deployed", func() {
+			It("should return an error", func() {
+				fakeCommand.IsApplicationDeployedReturns("", false)
+				cfZddCmd.CanaryInstances = "50%"
+				Expect(canaryDeploy.Run()).ShouldNot(Succeed())
+				Expect(fakeCommand.PushApplicationCallCount()).Should(Equal(0))
+			})
+		})
+	})
+	Describe(".CanaryHostname", func() {
+		It("should default to the canary route name", func() {
+			hostname, err := commands.CanaryHostname("", "myapp-1.2.3", "myapp")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(hostname).Should(Equal(commands.CreateCanaryRouteName("myapp-1.2.3")))
+		})
+		It("should make the app name valid as a hostname", func() {
+			hostname, err := commands.CanaryHostname("{{.App}}-canary", "myapp#1.2.3", "myapp")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(hostname).Should(Equal("myapp-1-2-3-canary"))
+		})
+		It("should reject unknown fields", func() {
+			_, err := commands.CanaryHostname("{{.Version}}-canary", "myapp-1.2.3", "myapp")
+			Expect(err).Should(HaveOccurred())
+		})
+		It("should reject hostnames without the canary suffix", func() {
+			_, err := commands.CanaryHostname("{{.BaseName}}-next", "myapp-1.2.3", "myapp")
+			Expect(err).Should(HaveOccurred())
+		})
+	})
 	Describe(".CreateCanaryRouteName string", func() {
 		Context("when given an appname with dots", func() {
 			var ctrlAppname = "ctrlAppName-1.2.3"
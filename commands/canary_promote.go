@@ -2,7 +2,9 @@ package commands
 
 import (
 	"fmt"
-	"os"
+	"net/http"
+	"strings"
+	"time"
 
 	"code.cloudfoundry.org/cli/plugin/models"
 )
@@ -11,8 +13,12 @@ import (
 type CanaryPromote struct {
 	args         *CfZddCmd
 	ScaleoverCmd ScaleoverCommand
+	Client       clientDoer
 }
 
+// RecentCrashWindow - crashes of the canary within it prevent its promotion
+var RecentCrashWindow = 15 * time.Minute
+
 // CmdRunner - interface type
 type CmdRunner interface {
 	Run() error
@@ -35,7 +41,7 @@ func init() {
 
 // Run method
 func (s *CanaryPromote) Run() (err error) {
-	err = s.promote()
+	err = withDeploymentLock(s.args, lockFamily(s.args, s.args.OldApp, s.args.NewApp), s.promote)
 	return
 }
 
@@ -53,25 +59,52 @@ func (s *CanaryPromote) promote() (err error) {
 	appName := s.args.OldApp
 	canaryAppName := s.args.NewApp
 
-	app, err := s.args.Conn.GetApp(appName)
-	canary, err := s.args.Conn.GetApp(canaryAppName)
+	app, canary, err := s.checkPromotion(appName, canaryAppName)
+	if err != nil {
+		return
+	}
 
-	err = s.UpdateRoutes(app, canary)
+	if err = runHooks(s.args, HookPreCutover, canaryAppName, appName); err != nil {
+		captureFailure(s.args, canaryAppName, appName)
+		return
+	}
+	if err = s.UpdateRoutes(app, canary); err != nil {
+		fmt.Println(err.Error())
+		captureFailure(s.args, canaryAppName, appName)
+		return
+	}
 
 	if err = s.ScaleoverCmd.DoScaleover(); err != nil {
 		fmt.Println(err.Error())
-		os.Exit(1)
+		captureFailure(s.args, canaryAppName, appName)
+		return
+	}
+	// The canary routes stay until the canary took over, so that a failed scaleover leaves the canary as it was
+	if deleteErr := s.DeleteCanaryRoutes(app, canary); deleteErr != nil {
+		fmt.Println(deleteErr.Error())
 	}
 
-	if err = s.args.Commands.RemoveApplication(appName); err != nil {
-		fmt.Printf("Error removing application: %s\n", err.Error())
+	baseName := s.args.BaseAppName
+	if baseName == "" {
+		baseName = appName
+	}
+	// The old version is only retired once every live route is verified to have moved to the canary
+	for _, route := range app.Routes {
+		if _, unmapErr := s.args.Conn.CliCommand(routeCommand("unmap-route", appName, route)...); unmapErr != nil {
+			fmt.Printf("Unable to unmap %s from %s: %s\n", routeKey(route), appName, unmapErr.Error())
+		}
+	}
+	if err = VerifyCutover(s.args, app.Routes, canaryAppName, appName); err != nil {
+		captureFailure(s.args, canaryAppName, appName)
 		return
 	}
-	return
+	recordDeployment(s.args, canaryAppName, newDeploymentRecord(s.args, baseName, appName))
+	retireVersion(s.args, baseName, canaryAppName, appName)
+	return runHooks(s.args, HookPostCutover, canaryAppName, appName)
 }
 
-// UpdateRoutes - function to add or remove routes from the application. Apply the existing application routes to the
-// canary version of the application.
+// UpdateRoutes - function to add routes to the application. Apply the existing application routes to the canary
+// version of the application.
 func (s *CanaryPromote) UpdateRoutes(oldApp plugin_models.GetAppModel, canary plugin_models.GetAppModel) (err error) {
 	var (
 		output  []string
@@ -81,18 +114,175 @@ func (s *CanaryPromote) UpdateRoutes(oldApp plugin_models.GetAppModel, canary pl
 	for _, route := range oldApp.Routes {
 		fmt.Printf("Host: %s, Domain: %s\n ", route.Host, route.Domain.Name)
 
-		cliArgs = []string{"map-route", canary.Name, route.Domain.Name, "-n", route.Host}
+		cliArgs = routeCommand("map-route", canary.Name, route)
 
-		output, err = s.args.Conn.CliCommand(cliArgs...)
+		if output, err = s.args.Conn.CliCommand(cliArgs...); err != nil {
+			return fmt.Errorf("unable to map route %s to %s: %s", routeKey(route), canary.Name, err.Error())
+		}
 		fmt.Printf("Add Routes output: %+v\n", output)
 	}
+	return
+}
 
+// DeleteCanaryRoutes - delete the canary routes of a promoted canary. Only the canary routes are deleted, live routes
+// the canary already shared stay mapped to it.
+func (s *CanaryPromote) DeleteCanaryRoutes(oldApp plugin_models.GetAppModel, canary plugin_models.GetAppModel) (err error) {
+	own := ownCanaryRoutes(s.args, canary, &oldApp)
 	for _, route := range canary.Routes {
+		if !own[routeKey(route)] {
+			continue
+		}
 		fmt.Printf("Host: %s, Domain: %s\n ", route.Host, route.Domain.Name)
-		cliArgs = []string{"delete-route", route.Domain.Name, "-n", route.Host, "-f"}
+		cliArgs := []string{"delete-route", route.Domain.Name, "-n", route.Host, "-f"}
 
-		output, err = s.args.Conn.CliCommand(cliArgs...)
+		output, deleteErr := s.args.Conn.CliCommand(cliArgs...)
+		if deleteErr != nil {
+			err = fmt.Errorf("unable to delete canary route %s: %s", routeKey(route), deleteErr.Error())
+			continue
+		}
 		fmt.Printf("Delete Routes output: %+v\n", output)
 	}
 	return
 }
+
+// checkPromotion - read the live application and the canary and refuse the promotion unless the canary is a canary of
+// the live application with all of its instances running, no recent crashes and a passing health check
+func (s *CanaryPromote) checkPromotion(appName string, canaryAppName string) (app plugin_models.GetAppModel,
+	canary plugin_models.GetAppModel, err error) {
+	if appName == "" || canaryAppName == "" {
+		err = fmt.Errorf("the live application and the canary must both be specified")
+		return
+	}
+	if appName == canaryAppName {
+		err = fmt.Errorf("refusing to promote %s over itself", canaryAppName)
+		return
+	}
+	if app, err = s.args.Conn.GetApp(appName); err != nil {
+		err = fmt.Errorf("unable to find live application %s: %s", appName, err.Error())
+		return
+	}
+	if canary, err = s.args.Conn.GetApp(canaryAppName); err != nil {
+		err = fmt.Errorf("unable to find canary %s: %s", canaryAppName, err.Error())
+		return
+	}
+
+	var problems []string
+	problems = append(problems, s.checkFamily(app, canary)...)
+	problems = append(problems, checkInstances(canary)...)
+	problems = append(problems, s.checkCrashes(canary)...)
+	problems = append(problems, s.checkHealth(canary)...)
+	if len(problems) > 0 {
+		err = fmt.Errorf("refusing to promote %s over %s: %s", canaryAppName, appName, strings.Join(problems, "; "))
+		return
+	}
+	fmt.Printf("Canary %s passed the promotion checks\n", canaryAppName)
+	return
+}
+
+// checkFamily - the canary must carry the base name of the live application, in its name when a base name is given
+// and in its base name label when both apps have one, and be a canary, with its canary routes recorded or a canary
+// route
+func (s *CanaryPromote) checkFamily(app plugin_models.GetAppModel, canary plugin_models.GetAppModel) (problems []string) {
+	if s.args.BaseAppName != "" && !strings.HasPrefix(canary.Name, s.args.BaseAppName) {
+		problems = append(problems, fmt.Sprintf("%s is not named after base name %s", canary.Name, s.args.BaseAppName))
+	}
+
+	appLabel, canaryLabel := baseNameLabel(s.args, app.Name), baseNameLabel(s.args, canary.Name)
+	if appLabel != "" && canaryLabel != "" && appLabel != canaryLabel {
+		problems = append(problems, fmt.Sprintf("%s belongs to %s, not to %s", canary.Name, canaryLabel, appLabel))
+	}
+
+	if !isCanary(s.args.Conn, canary) {
+		problems = append(problems, fmt.Sprintf("%s is not a canary, it has neither its canary routes recorded nor a route ending in %s",
+			canary.Name, CanaryRouteSeparator+CanaryRouteSuffix))
+	}
+	return
+}
+
+// checkInstances - the canary must be started with every instance running
+func checkInstances(canary plugin_models.GetAppModel) (problems []string) {
+	if canary.State != "started" {
+		return []string{fmt.Sprintf("%s is %s", canary.Name, canary.State)}
+	}
+	if canary.InstanceCount == 0 || canary.RunningInstances < canary.InstanceCount {
+		problems = append(problems, fmt.Sprintf("%d of %d instances of %s are running", canary.RunningInstances,
+			canary.InstanceCount, canary.Name))
+	}
+	for idx, instance := range canary.Instances {
+		if !strings.EqualFold(instance.State, "running") {
+			problems = append(problems, fmt.Sprintf("instance %d of %s is %s", idx, canary.Name, strings.ToLower(instance.State)))
+		}
+	}
+	return
+}
+
+// checkCrashes - the canary must not have crashed within the recent crash window. Foundations whose events cannot be
+// read are only warned about.
+func (s *CanaryPromote) checkCrashes(canary plugin_models.GetAppModel) (problems []string) {
+	since := time.Now().Add(-RecentCrashWindow)
+	crashes, err := appCrashes(s.args, canary.Guid, since)
+	if err != nil {
+		fmt.Printf("Unable to read the crash events of %s: %s\n", canary.Name, err.Error())
+		return
+	}
+	if crashes > 0 {
+		problems = append(problems, fmt.Sprintf("%s crashed %d times in the last %s", canary.Name, crashes, RecentCrashWindow))
+	}
+	return
+}
+
+// appCrashes - crashes of an app since a time, from the v3 audit events or the v2 events on older foundations
+func appCrashes(args *CfZddCmd, appGUID string, since time.Time) (crashes int, err error) {
+	v3Events := new(struct {
+		Resources []struct {
+			CreatedAt time.Time `json:"created_at"`
+		} `json:"resources"`
+	})
+	path := "/v3/audit_events?types=audit.app.process.crash&target_guids=" + appGUID + "&order_by=-created_at&per_page=100"
+	if err = CCCurl(args.Conn, "GET", path, nil, v3Events); err == nil {
+		for _, event := range v3Events.Resources {
+			if event.CreatedAt.After(since) {
+				crashes++
+			}
+		}
+		return
+	}
+
+	v2Events := new(struct {
+		Resources []struct {
+			Entity struct {
+				Timestamp time.Time `json:"timestamp"`
+			} `json:"entity"`
+		} `json:"resources"`
+	})
+	path = "/v2/events?q=type:app.crash&q=actee:" + appGUID + "&results-per-page=100&order-direction=desc"
+	if err = CCCurl(args.Conn, "GET", path, nil, v2Events); err != nil {
+		return
+	}
+	for _, event := range v2Events.Resources {
+		if event.Entity.Timestamp.After(since) {
+			crashes++
+		}
+	}
+	return
+}
+
+// checkHealth - the health check, the -custom-health-url path on the first canary route, must pass
+func (s *CanaryPromote) checkHealth(canary plugin_models.GetAppModel) (problems []string) {
+	if s.Client == nil {
+		s.Client = &http.Client{Timeout: ProbeTimeout}
+	}
+	healthURL := routeURL(s.args, canary.Routes, true)
+	if healthURL == "" {
+		healthURL = routeURL(s.args, canary.Routes, false)
+	}
+	if healthURL == "" {
+		return []string{fmt.Sprintf("%s has no route to check its health on", canary.Name)}
+	}
+	stats := &ProbeStats{URL: healthURL}
+	probeRoute(s.Client, s.args, stats)
+	if stats.Successes == 0 {
+		problems = append(problems, fmt.Sprintf("health check of %s failed", healthURL))
+	}
+	return
+}
@@ -1,6 +1,10 @@
 package commands_test
 
 import (
+	"errors"
+	"fmt"
+	"time"
+
 	"code.cloudfoundry.org/cli/plugin/models"
 	"github.com/comcast/cf-zdd-plugin/commands"
 	"github.com/comcast/cf-zdd-plugin/fakes"
@@ -25,33 +29,201 @@ var _ = Describe("canaryPromote", func() {
 			cfZddCmd       *commands.CfZddCmd
 			fakeScaleover  *fakes.FakeScaleoverCommand
 			fakeCommand    *fakes.FakeCommonCmd
+			client         *probeClient
+			canaryApp      plugin_models.GetAppModel
+			responses      map[string]string
+			canaryRoute    = commands.CreateCanaryRouteName("app-1.0.2")
 			err            error
 		)
-		Context("when called with a valid set of args", func() {
-			BeforeEach(func() {
-				fakeConnection = new(fakes.FakeCliConnection)
-				fakeScaleover = new(fakes.FakeScaleoverCommand)
-				fakeCommand = new(fakes.FakeCommonCmd)
+		BeforeEach(func() {
+			fakeConnection = new(fakes.FakeCliConnection)
+			fakeScaleover = new(fakes.FakeScaleoverCommand)
+			fakeCommand = new(fakes.FakeCommonCmd)
 
-				fakeScaleover.DoScaleoverReturns(nil)
+			fakeScaleover.DoScaleoverReturns(nil)
 
-				cfZddCmd = &commands.CfZddCmd{
-					OldApp:   "app1",
-					NewApp:   "canary",
-					Conn:     fakeConnection,
-					Commands: fakeCommand,
+			liveRoute := plugin_models.GetApp_RouteSummary{Host: "app", Domain: plugin_models.GetApp_DomainFields{Name: "cf.app.io"}}
+			liveRoutes := []plugin_models.GetApp_RouteSummary{liveRoute}
+			canaryApp = plugin_models.GetAppModel{
+				Name: "app-1.0.2", Guid: "canary-guid", State: "started", InstanceCount: 2, RunningInstances: 2,
+				Instances: []plugin_models.GetApp_AppInstanceFields{{State: "running"}, {State: "running"}},
+				Routes: []plugin_models.GetApp_RouteSummary{
+					{Host: canaryRoute, Domain: plugin_models.GetApp_DomainFields{Name: "cf.app.io"}},
+				},
+			}
+			fakeConnection.CliCommandStub = func(args ...string) ([]string, error) {
+				switch {
+				case args[0] == "map-route":
+					canaryApp.Routes = append(canaryApp.Routes, plugin_models.GetApp_RouteSummary{Host: args[4], Domain: plugin_models.GetApp_DomainFields{Name: args[2]}})
+				case args[0] == "unmap-route" && args[1] == "app-1.0.1":
+					liveRoutes = nil
 				}
-
-				canaryPromote = &commands.CanaryPromote{
-					ScaleoverCmd: fakeScaleover,
+				return nil, nil
+			}
+			fakeConnection.GetAppStub = func(name string) (plugin_models.GetAppModel, error) {
+				switch {
+				case name == "app-1.0.1" && fakeCommand.RemoveApplicationCallCount() == 0:
+					return plugin_models.GetAppModel{Name: name, Guid: "live-guid", State: "started", InstanceCount: 2,
+						RunningInstances: 2, Routes: liveRoutes}, nil
+				case name == "app-1.0.2":
+					return canaryApp, nil
 				}
+				return plugin_models.GetAppModel{}, errors.New("App " + name + " not found")
+			}
+			responses = map[string]string{
+				"GET /v3/apps/live-guid":   `{"metadata":{"labels":{"zdd.comcast.com/base-name":"app"}}}`,
+				"GET /v3/apps/canary-guid": `{"metadata":{"labels":{}}}`,
+				"GET /v3/audit_events":     `{"resources":[]}`,
+			}
+			fakeConnection.CliCommandWithoutTerminalOutputStub = httpDomains(responses)
+			client = &probeClient{statuses: map[string]int{canaryRoute + ".cf.app.io": 200}}
 
-				canaryPromote.SetArgs(cfZddCmd)
-			})
+			cfZddCmd = &commands.CfZddCmd{
+				OldApp:      "app-1.0.1",
+				NewApp:      "app-1.0.2",
+				BaseAppName: "app",
+				CustomURL:   "/health",
+				Conn:        fakeConnection,
+				Commands:    fakeCommand,
+			}
+
+			canaryPromote = &commands.CanaryPromote{
+				ScaleoverCmd: fakeScaleover,
+				Client:       client,
+			}
+
+			canaryPromote.SetArgs(cfZddCmd)
+		})
+		Context("when called with a valid set of args", func() {
 			It("should execute the promotion of the canary and not return an error", func() {
 				err = canaryPromote.Run()
 				Expect(err).ShouldNot(HaveOccurred())
+				Expect(fakeScaleover.DoScaleoverCallCount()).Should(Equal(1))
+			})
+			It("should check the health of the canary on its canary route", func() {
+				canaryPromote.Run()
+				Expect(client.hosts).Should(Equal([]string{canaryRoute + ".cf.app.io"}))
+			})
+			It("should only delete the canary route once the scaleover succeeded", func() {
+				fakeScaleover.DoScaleoverStub = func() error {
+					for i := 0; i < fakeConnection.CliCommandCallCount(); i++ {
+						Expect(fakeConnection.CliCommandArgsForCall(i)[0]).ShouldNot(Equal("delete-route"))
+					}
+					return nil
+				}
+				Expect(canaryPromote.Run()).Should(Succeed())
+				Expect(fakeConnection.CliCommandArgsForCall(1)).Should(Equal([]string{"delete-route", "cf.app.io", "-n", canaryRoute, "-f"}))
+			})
+		})
+		Context("when the first canary route is on an internal domain", func() {
+			BeforeEach(func() {
+				canaryApp.Routes = append([]plugin_models.GetApp_RouteSummary{
+					{Host: canaryRoute, Domain: plugin_models.GetApp_DomainFields{Name: "apps.internal"}},
+				}, canaryApp.Routes...)
+				err = canaryPromote.Run()
+			})
+			It("should check the health of the canary on the canary route reachable over http", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(client.hosts).Should(Equal([]string{canaryRoute + ".cf.app.io"}))
+			})
+		})
+		Context("when the scaleover fails", func() {
+			BeforeEach(func() {
+				fakeScaleover.DoScaleoverReturns(errors.New("scaleover failed"))
+				err = canaryPromote.Run()
+			})
+			It("should keep the canary route", func() {
+				Expect(err).Should(MatchError("scaleover failed"))
+				for i := 0; i < fakeConnection.CliCommandCallCount(); i++ {
+					Expect(fakeConnection.CliCommandArgsForCall(i)[0]).ShouldNot(Equal("delete-route"))
+				}
+			})
+		})
+		Context("when the canary did not get the live routes", func() {
+			BeforeEach(func() {
+				fakeConnection.CliCommandStub = nil
+				err = canaryPromote.Run()
+			})
+			It("should fail with the commands correcting the routes", func() {
+				Expect(err).Should(MatchError(ContainSubstring("routes were not cut over from app-1.0.1 to app-1.0.2")))
+			})
+			It("should not retire the live application", func() {
+				Expect(fakeCommand.RemoveApplicationCallCount()).Should(Equal(0))
+				Expect(fakeCommand.RetainApplicationCallCount()).Should(Equal(0))
+			})
+		})
+		Context("when a live route cannot be mapped to the canary", func() {
+			BeforeEach(func() {
+				fakeConnection.CliCommandStub = nil
+				fakeConnection.CliCommandReturns(nil, errors.New("not authorized"))
+				err = canaryPromote.Run()
+			})
+			It("should fail before scaling over", func() {
+				Expect(err).Should(MatchError(ContainSubstring("unable to map route app.cf.app.io to app-1.0.2")))
+				Expect(fakeScaleover.DoScaleoverCallCount()).Should(Equal(0))
+			})
+		})
+
+		refused := func(reason string) {
+			It("should refuse to promote the canary", func() {
+				err = canaryPromote.Run()
+				Expect(err).Should(MatchError(ContainSubstring(reason)))
+				Expect(fakeConnection.CliCommandCallCount()).Should(Equal(0))
+				Expect(fakeScaleover.DoScaleoverCallCount()).Should(Equal(0))
+			})
+		}
+
+		Context("when the canary does not exist", func() {
+			BeforeEach(func() {
+				cfZddCmd.NewApp = "app-1.0.3"
 			})
+			refused("unable to find canary app-1.0.3")
+		})
+		Context("when the live application does not exist", func() {
+			BeforeEach(func() {
+				cfZddCmd.OldApp = "app-1.0.0"
+			})
+			refused("unable to find live application app-1.0.0")
+		})
+		Context("when not all instances of the canary are running", func() {
+			BeforeEach(func() {
+				canaryApp.RunningInstances = 1
+				canaryApp.Instances[1].State = "CRASHED"
+			})
+			refused("1 of 2 instances of app-1.0.2 are running; instance 1 of app-1.0.2 is crashed")
+		})
+		Context("when the canary crashed recently", func() {
+			BeforeEach(func() {
+				responses["GET /v3/audit_events"] = fmt.Sprintf(`{"resources":[{"created_at":%q},{"created_at":"2016-01-01T00:00:00Z"}]}`,
+					time.Now().Add(-time.Minute).UTC().Format(time.RFC3339))
+			})
+			refused("app-1.0.2 crashed 1 times")
+		})
+		Context("when the health check of the canary fails", func() {
+			BeforeEach(func() {
+				client.statuses[canaryRoute+".cf.app.io"] = 503
+			})
+			refused("health check of https://" + canaryRoute + ".cf.app.io/health failed")
+		})
+		Context("when the canary belongs to another application", func() {
+			BeforeEach(func() {
+				responses["GET /v3/apps/canary-guid"] = `{"metadata":{"labels":{"zdd.comcast.com/base-name":"other"}}}`
+			})
+			refused("app-1.0.2 belongs to other, not to app")
+		})
+		Context("when the canary is not named after the base name", func() {
+			BeforeEach(func() {
+				cfZddCmd.BaseAppName = "other"
+			})
+			refused("app-1.0.2 is not named after base name other")
+		})
+		Context("when the application given as the canary is not a canary", func() {
+			BeforeEach(func() {
+				canaryApp.Routes = []plugin_models.GetApp_RouteSummary{
+					{Host: "app-next", Domain: plugin_models.GetApp_DomainFields{Name: "cf.app.io"}},
+				}
+			})
+			refused("app-1.0.2 is not a canary")
 		})
 	})
 	Describe(".UpdateRoutes", func() {
@@ -101,7 +273,23 @@ var _ = Describe("canaryPromote", func() {
 			It("map route should map app1 routes to app2", func() {
 				err := canaryPromote.UpdateRoutes(app1, app2)
 				Expect(err).ShouldNot(HaveOccurred())
-				Expect(fakeConnection.CliCommandCallCount()).Should(Equal(2))
+				Expect(fakeConnection.CliCommandCallCount()).Should(Equal(1))
+				Expect(fakeConnection.CliCommandArgsForCall(0)).Should(Equal([]string{"map-route", "app2", "cf.app.io", "-n", "app1"}))
+			})
+			It("should map a path route with its path", func() {
+				app1.Routes[0].Path = "/api"
+				Expect(canaryPromote.UpdateRoutes(app1, app2)).Should(Succeed())
+				Expect(fakeConnection.CliCommandArgsForCall(0)).Should(Equal([]string{"map-route", "app2", "cf.app.io", "-n", "app1", "--path", "api"}))
+			})
+			It("should not delete the canary routes", func() {
+				Expect(canaryPromote.UpdateRoutes(app1, app2)).Should(Succeed())
+				Expect(fakeConnection.CliCommandArgsForCall(0)[0]).ShouldNot(Equal("delete-route"))
+			})
+			It("should only delete the canary routes, not the live routes the canary already shares", func() {
+				app2.Routes = append(app2.Routes, app1.Routes...)
+				Expect(canaryPromote.DeleteCanaryRoutes(app1, app2)).Should(Succeed())
+				Expect(fakeConnection.CliCommandCallCount()).Should(Equal(1))
+				Expect(fakeConnection.CliCommandArgsForCall(0)).Should(Equal([]string{"delete-route", "cf.app.io", "-n", "app2", "-f"}))
 			})
 		})
 	})
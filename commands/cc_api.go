@@ -0,0 +1,116 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"code.cloudfoundry.org/cli/plugin"
+)
+
+// CCError - a single error entry returned by the cloud controller
+type CCError struct {
+	Code   int    `json:"code"`
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+}
+
+// CCErrors - error returned when the cloud controller responds with an errors document
+type CCErrors struct {
+	Errors []CCError `json:"errors"`
+}
+
+// ccErrorResponse - the errors document of the v3 api, or the single error of the v2 api that cloud controllers
+// predating an endpoint answer with
+type ccErrorResponse struct {
+	CCErrors
+	Code        int    `json:"code"`
+	ErrorCode   string `json:"error_code"`
+	Description string `json:"description"`
+}
+
+func (e *CCErrors) Error() string {
+	messages := make([]string, len(e.Errors))
+	for idx, ccErr := range e.Errors {
+		messages[idx] = fmt.Sprintf("%s: %s", ccErr.Title, ccErr.Detail)
+	}
+	return strings.Join(messages, ", ")
+}
+
+// HasTitle - true when any of the returned errors carries the given title, i.e. CF-ResourceNotFound
+func (e *CCErrors) HasTitle(title string) bool {
+	for _, ccErr := range e.Errors {
+		if ccErr.Title == title {
+			return true
+		}
+	}
+	return false
+}
+
+// CCCurl - issue a request against the cloud controller api through 'cf curl' and decode the json response into
+// result. A nil body sends no data and a nil result discards the response. Error documents of either api version are
+// returned as CCErrors.
+func CCCurl(conn plugin.CliConnection, method string, path string, body interface{}, result interface{}) (err error) {
+	curlArgs := []string{"curl", path, "-X", method}
+
+	if body != nil {
+		var bodyBytes []byte
+		if bodyBytes, err = json.Marshal(body); err != nil {
+			return
+		}
+		curlArgs = append(curlArgs, "-d", string(bodyBytes))
+	}
+
+	output, err := conn.CliCommandWithoutTerminalOutput(curlArgs...)
+	if err != nil {
+		return
+	}
+
+	response := []byte(strings.TrimSpace(strings.Join(output, "\n")))
+	if len(response) == 0 {
+		return
+	}
+
+	ccErrors := new(ccErrorResponse)
+	if err = json.Unmarshal(response, ccErrors); err != nil {
+		return fmt.Errorf("unexpected response from %s %s: %s", method, path, string(response))
+	}
+	if ccErrors.ErrorCode != "" {
+		ccErrors.Errors = append(ccErrors.Errors, CCError{Code: ccErrors.Code, Title: ccErrors.ErrorCode, Detail: ccErrors.Description})
+	}
+	if len(ccErrors.Errors) > 0 {
+		return &ccErrors.CCErrors
+	}
+
+	if result != nil {
+		err = json.Unmarshal(response, result)
+	}
+	return
+}
+
+// ccResource - the fields shared by the v3 resources the plugin inspects
+type ccResource struct {
+	GUID  string `json:"guid"`
+	State string `json:"state"`
+}
+
+// ccResourceList - a page of v3 resources
+type ccResourceList struct {
+	Resources []ccResource `json:"resources"`
+}
@@ -0,0 +1,125 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands_test
+
+import (
+	"strings"
+
+	"github.com/comcast/cf-zdd-plugin/commands"
+	"github.com/comcast/cf-zdd-plugin/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// curlResponder - stub for 'cf curl' calls returning the response of the longest matching "METHOD path" prefix
+func curlResponder(responses map[string]string) func(args ...string) ([]string, error) {
+	return func(args ...string) ([]string, error) {
+		if len(args) < 4 || args[0] != "curl" {
+			return nil, nil
+		}
+		request := args[3] + " " + args[1]
+		match := ""
+		for prefix := range responses {
+			if strings.HasPrefix(request, prefix) && len(prefix) > len(match) {
+				match = prefix
+			}
+		}
+		if match == "" {
+			return []string{}, nil
+		}
+		return []string{responses[match]}, nil
+	}
+}
+
+// curlRequests - the "METHOD path" of every 'cf curl' call made on the connection
+func curlRequests(conn *fakes.FakeCliConnection) (requests []string) {
+	for i := 0; i < conn.CliCommandWithoutTerminalOutputCallCount(); i++ {
+		args := conn.CliCommandWithoutTerminalOutputArgsForCall(i)
+		if len(args) >= 4 && args[0] == "curl" {
+			requests = append(requests, args[3]+" "+args[1])
+		}
+	}
+	return
+}
+
+var _ = Describe(".CCCurl", func() {
+	var (
+		fakeConnection *fakes.FakeCliConnection
+		result         map[string]interface{}
+		err            error
+	)
+
+	BeforeEach(func() {
+		fakeConnection = new(fakes.FakeCliConnection)
+		result = make(map[string]interface{})
+	})
+
+	Context("when the cloud controller returns a resource", func() {
+		BeforeEach(func() {
+			fakeConnection.CliCommandWithoutTerminalOutputReturns([]string{`{"guid": "app-guid"}`}, nil)
+			err = commands.CCCurl(fakeConnection, "POST", "/v3/apps", map[string]string{"name": "app"}, &result)
+		})
+		It("should decode the response", func() {
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(result["guid"]).Should(Equal("app-guid"))
+		})
+		It("should send the method and body", func() {
+			Expect(fakeConnection.CliCommandWithoutTerminalOutputArgsForCall(0)).Should(Equal(
+				[]string{"curl", "/v3/apps", "-X", "POST", "-d", `{"name":"app"}`}))
+		})
+	})
+
+	Context("when the cloud controller returns errors", func() {
+		BeforeEach(func() {
+			fakeConnection.CliCommandWithoutTerminalOutputReturns([]string{
+				`{"errors": [{"code": 10010, "title": "CF-ResourceNotFound", "detail": "App not found"}]}`}, nil)
+			err = commands.CCCurl(fakeConnection, "GET", "/v3/apps/missing", nil, &result)
+		})
+		It("should return the cloud controller errors", func() {
+			Expect(err).Should(HaveOccurred())
+			ccErrors, ok := err.(*commands.CCErrors)
+			Expect(ok).Should(BeTrue())
+			Expect(ccErrors.HasTitle("CF-ResourceNotFound")).Should(BeTrue())
+			Expect(err.Error()).Should(Equal("CF-ResourceNotFound: App not found"))
+		})
+	})
+
+	Context("when a cloud controller without the endpoint returns a v2 error", func() {
+		BeforeEach(func() {
+			fakeConnection.CliCommandWithoutTerminalOutputReturns([]string{
+				`{"code": 10000, "description": "Unknown request", "error_code": "CF-NotFound"}`}, nil)
+			err = commands.CCCurl(fakeConnection, "GET", "/v3/deployments", nil, &result)
+		})
+		It("should return it as a cloud controller error", func() {
+			ccErrors, ok := err.(*commands.CCErrors)
+			Expect(ok).Should(BeTrue())
+			Expect(ccErrors.HasTitle("CF-NotFound")).Should(BeTrue())
+			Expect(err.Error()).Should(Equal("CF-NotFound: Unknown request"))
+			Expect(result).Should(BeEmpty())
+		})
+	})
+
+	Context("when the response is not json", func() {
+		BeforeEach(func() {
+			fakeConnection.CliCommandWithoutTerminalOutputReturns([]string{"<html>502 Bad Gateway</html>"}, nil)
+			err = commands.CCCurl(fakeConnection, "GET", "/v3/apps", nil, &result)
+		})
+		It("should return an error", func() {
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+})
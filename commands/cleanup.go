@@ -0,0 +1,346 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Cleanup - struct
+type Cleanup struct {
+	args *CfZddCmd
+}
+
+// CleanupCmdName - constants
+const (
+	CleanupCmdName = "zdd-cleanup"
+)
+
+// ConfirmInput - where confirmation of destructive commands is read from
+var ConfirmInput io.Reader = os.Stdin
+
+// Kinds of artifacts left behind by failed deployments
+const (
+	venerableArtifact   = "venerable app"
+	canaryAppArtifact   = "canary app"
+	canaryRouteArtifact = "canary route"
+)
+
+// cleanupArtifact - an app or route found by the cleanup
+type cleanupArtifact struct {
+	Kind   string
+	Name   string
+	State  string
+	Age    time.Duration
+	family string
+	host   string
+	domain string
+}
+
+// ccRoute - v3 route resource with the apps it is mapped to
+type ccRoute struct {
+	GUID         string    `json:"guid"`
+	Host         string    `json:"host"`
+	URL          string    `json:"url"`
+	CreatedAt    time.Time `json:"created_at"`
+	Destinations []struct {
+		App struct {
+			GUID string `json:"guid"`
+		} `json:"app"`
+	} `json:"destinations"`
+}
+
+func init() {
+	Register(CleanupCmdName, new(Cleanup))
+}
+
+// Run - Run method
+func (s *Cleanup) Run() (err error) {
+	err = withDeploymentLock(s.args, lockFamily(s.args, s.args.NewApp), s.cleanup)
+	return
+}
+
+// SetArgs - set command args
+func (s *Cleanup) SetArgs(args *CfZddCmd) {
+	s.args = args
+}
+
+func (s *Cleanup) cleanup() (err error) {
+	baseName := familyName(s.args, s.args.NewApp)
+	if baseName == "" {
+		fmt.Println("Searching the whole space for deployment artifacts")
+	} else {
+		fmt.Printf("Searching for deployment artifacts of %s\n", baseName)
+	}
+
+	artifacts, err := s.findArtifacts(baseName)
+	if err != nil {
+		return
+	}
+	if len(artifacts) == 0 {
+		fmt.Println("Nothing to clean up")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TYPE\tNAME\tSTATE\tAGE")
+	for _, artifact := range artifacts {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", artifact.Kind, artifact.Name, artifact.State, formatAge(artifact.Age))
+	}
+	w.Flush()
+
+	if !s.args.Force && !confirm(fmt.Sprintf("Delete these %d artifacts?", len(artifacts))) {
+		fmt.Println("Nothing deleted")
+		return
+	}
+
+	var failed int
+	if baseName != "" {
+		// The lock of the family is already held
+		failed = s.deleteArtifacts(artifacts)
+	} else {
+		failed = s.deleteByFamily(artifacts)
+	}
+	if failed > 0 {
+		err = fmt.Errorf("%d of %d artifacts could not be deleted", failed, len(artifacts))
+	}
+	return
+}
+
+// deleteByFamily - delete the artifacts of each family holding its deployment lock, so that no deployment of the family
+// runs meanwhile. Only the artifacts still found once the lock is held are deleted, a deployment may have changed them
+// since they were listed. Artifacts of a family whose lock cannot be taken are left in place.
+func (s *Cleanup) deleteByFamily(artifacts []cleanupArtifact) (failed int) {
+	var families []string
+	byFamily := make(map[string][]cleanupArtifact)
+	for _, artifact := range artifacts {
+		if _, ok := byFamily[artifact.family]; !ok {
+			families = append(families, artifact.family)
+		}
+		byFamily[artifact.family] = append(byFamily[artifact.family], artifact)
+	}
+
+	for _, family := range families {
+		group := byFamily[family]
+		err := withDeploymentLock(s.args, family, func() error {
+			current, err := s.findArtifacts("")
+			if err != nil {
+				return err
+			}
+			found := make(map[string]bool)
+			for _, artifact := range current {
+				found[artifact.Kind+" "+artifact.Name] = true
+			}
+			var still []cleanupArtifact
+			for _, artifact := range group {
+				if found[artifact.Kind+" "+artifact.Name] {
+					still = append(still, artifact)
+				} else {
+					fmt.Printf("Leaving %s %s, it changed since it was listed\n", artifact.Kind, artifact.Name)
+				}
+			}
+			failed += s.deleteArtifacts(still)
+			return nil
+		})
+		if err != nil {
+			fmt.Printf("Unable to clean up %s: %s\n", family, err.Error())
+			failed += len(group)
+		}
+	}
+	return
+}
+
+// deleteArtifacts - delete apps and canary routes, returning the number that could not be deleted
+func (s *Cleanup) deleteArtifacts(artifacts []cleanupArtifact) (failed int) {
+	for _, artifact := range artifacts {
+		fmt.Printf("Deleting %s %s\n", artifact.Kind, artifact.Name)
+		var deleteErr error
+		if artifact.Kind == canaryRouteArtifact {
+			_, deleteErr = s.args.Conn.CliCommand("delete-route", artifact.domain, "-n", artifact.host, "-f")
+		} else {
+			deleteErr = s.args.Commands.RemoveApplication(artifact.Name)
+		}
+		if deleteErr != nil {
+			fmt.Printf("Unable to delete %s %s: %s\n", artifact.Kind, artifact.Name, deleteErr.Error())
+			failed++
+		}
+	}
+	return
+}
+
+// findArtifacts - venerable apps, canary apps only reachable through canary routes and canary routes not mapped to any
+// other app. Apps with a route other than a canary route are serving traffic and never returned, nor are started
+// canaries with their canary routes recorded, as those are canaries still to be promoted or aborted.
+func (s *Cleanup) findArtifacts(baseName string) (artifacts []cleanupArtifact, err error) {
+	space, err := s.args.Conn.GetCurrentSpace()
+	if err != nil {
+		return
+	}
+
+	apps := new(struct {
+		Resources []ccApp `json:"resources"`
+	})
+	if err = CCCurl(s.args.Conn, "GET", "/v3/apps?space_guids="+space.Guid+"&per_page=5000", nil, apps); err != nil {
+		return
+	}
+	routes := new(struct {
+		Resources []ccRoute `json:"resources"`
+	})
+	if err = CCCurl(s.args.Conn, "GET", "/v3/routes?space_guids="+space.Guid+"&per_page=5000", nil, routes); err != nil {
+		return
+	}
+
+	appRoutes := make(map[string][]ccRoute)
+	for _, route := range routes.Resources {
+		for _, destination := range route.Destinations {
+			appRoutes[destination.App.GUID] = append(appRoutes[destination.App.GUID], route)
+		}
+	}
+
+	var venerables []ccApp
+	removed := make(map[string]bool)
+	families := make(map[string]string)
+	for _, app := range apps.Resources {
+		if !strings.HasPrefix(app.Name, baseName) {
+			continue
+		}
+		families[app.GUID] = artifactFamily(app)
+		routed, canary := false, false
+		for _, route := range appRoutes[app.GUID] {
+			if isCanaryRoute(route.Host) {
+				canary = true
+			} else {
+				routed = true
+			}
+		}
+		switch {
+		case routed:
+			continue
+		case strings.Contains(app.Name, "-venerable"):
+			venerables = append(venerables, app)
+		case canary && strings.EqualFold(app.State, "started") && app.Metadata.Annotations[CanaryRoutesAnnotation] != "":
+			continue
+		case canary:
+			artifacts = append(artifacts, appArtifact(canaryAppArtifact, app))
+			removed[app.GUID] = true
+		}
+	}
+
+	for _, app := range s.spareRetained(venerables, appRoutes) {
+		artifacts = append(artifacts, appArtifact(venerableArtifact, app))
+		removed[app.GUID] = true
+	}
+
+	routePrefix := strings.TrimSuffix(CreateCanaryRouteName(baseName), CanaryRouteSeparator+CanaryRouteSuffix)
+	for _, route := range routes.Resources {
+		if !isCanaryRoute(route.Host) || !strings.HasPrefix(route.Host, routePrefix) {
+			continue
+		}
+		orphaned, family := true, ""
+		for _, destination := range route.Destinations {
+			orphaned = orphaned && removed[destination.App.GUID]
+			if family == "" {
+				family = families[destination.App.GUID]
+			}
+		}
+		if orphaned {
+			artifacts = append(artifacts, cleanupArtifact{
+				Kind:   canaryRouteArtifact,
+				Name:   route.URL,
+				State:  fmt.Sprintf("%d apps", len(route.Destinations)),
+				Age:    time.Since(route.CreatedAt),
+				family: family,
+				host:   route.Host,
+				domain: strings.TrimPrefix(route.URL, route.Host+"."),
+			})
+		}
+	}
+	return
+}
+
+// spareRetained - with -keep-previous or -keep-versions the most recently deployed venerable apps retained stopped and
+// unrouted for a rollback are kept, per base name
+func (s *Cleanup) spareRetained(venerables []ccApp, appRoutes map[string][]ccRoute) (orphans []ccApp) {
+	keep := versionsToKeep(s.args)
+	sort.SliceStable(venerables, func(i, j int) bool {
+		return venerables[i].deployedAt().After(venerables[j].deployedAt())
+	})
+	retained := make(map[string]int)
+	for _, app := range venerables {
+		if strings.EqualFold(app.State, "stopped") && len(appRoutes[app.GUID]) == 0 {
+			family := app.Metadata.Labels[BaseNameLabel]
+			if retained[family]++; retained[family] <= keep {
+				continue
+			}
+		}
+		orphans = append(orphans, app)
+	}
+	return
+}
+
+func appArtifact(kind string, app ccApp) cleanupArtifact {
+	return cleanupArtifact{
+		Kind:   kind,
+		Name:   app.Name,
+		State:  strings.ToLower(app.State),
+		Age:    time.Since(app.UpdatedAt),
+		family: artifactFamily(app),
+	}
+}
+
+// artifactFamily - the family whose deployment lock covers an app: its base name label, otherwise the name of the
+// version a venerable app was moved aside from, or the name of the app itself
+func artifactFamily(app ccApp) string {
+	if family := app.Metadata.Labels[BaseNameLabel]; family != "" {
+		return family
+	}
+	if idx := strings.Index(app.Name, "-venerable"); idx > 0 {
+		return app.Name[:idx]
+	}
+	return app.Name
+}
+
+func isCanaryRoute(host string) bool {
+	return strings.HasSuffix(host, CanaryRouteSeparator+CanaryRouteSuffix)
+}
+
+// formatAge - age rounded to days, hours or minutes
+func formatAge(age time.Duration) string {
+	switch {
+	case age >= 24*time.Hour:
+		return fmt.Sprintf("%dd%dh", int(age.Hours())/24, int(age.Hours())%24)
+	case age >= time.Hour:
+		return fmt.Sprintf("%dh%dm", int(age.Hours()), int(age.Minutes())%60)
+	default:
+		return fmt.Sprintf("%dm", int(age.Minutes()))
+	}
+}
+
+// confirm - ask a yes or no question on ConfirmInput, anything but yes is a no
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(ConfirmInput).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
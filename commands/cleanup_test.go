@@ -0,0 +1,179 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands_test
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/comcast/cf-zdd-plugin/commands"
+	"github.com/comcast/cf-zdd-plugin/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("zdd-cleanup", func() {
+
+	Describe(".init", func() {
+		Context("when the package is imported", func() {
+			It("should then be registered with the command repo", func() {
+				_, ok := commands.GetRegistry()[commands.CleanupCmdName]
+				Expect(ok).Should(BeTrue())
+			})
+		})
+	})
+
+	Describe("with a valid arg and run method", func() {
+		var (
+			err            error
+			cleanup        *commands.Cleanup
+			cfZddCmd       *commands.CfZddCmd
+			fakeConnection *fakes.FakeCliConnection
+			fakeCommon     *fakes.FakeCommonCmd
+		)
+
+		BeforeEach(func() {
+			fakeConnection = new(fakes.FakeCliConnection)
+			fakeCommon = new(fakes.FakeCommonCmd)
+			fakeConnection.GetCurrentSpaceReturns(plugin_models.Space{SpaceFields: plugin_models.SpaceFields{Guid: "space-guid"}}, nil)
+			fakeConnection.CliCommandWithoutTerminalOutputStub = curlResponder(map[string]string{
+				"GET /v3/apps": `{"resources": [
+					{"guid": "live", "name": "myapp-1.0.3", "state": "STARTED", "updated_at": "2019-01-03T00:00:00Z"},
+					{"guid": "scaling", "name": "myapp-1.0.2-venerable", "state": "STARTED", "updated_at": "2019-01-02T00:00:00Z"},
+					{"guid": "venerable", "name": "myapp-1.0.1-venerable", "state": "STOPPED", "updated_at": "2019-01-01T00:00:00Z",
+					 "metadata": {"labels": {"zdd.comcast.com/base-name": "myapp"}}},
+					{"guid": "canary", "name": "myapp-1.0.4", "state": "STARTED", "updated_at": "2019-01-04T00:00:00Z"},
+					{"guid": "other", "name": "otherapp-venerable", "state": "STOPPED", "updated_at": "2019-01-01T00:00:00Z"},
+					{"guid": "active", "name": "myapp-1.0.5", "state": "STARTED", "updated_at": "2019-01-05T00:00:00Z",
+					 "metadata": {"labels": {"zdd.comcast.com/base-name": "myapp"},
+					 "annotations": {"zdd.comcast.com/canary-routes": "[\"myapp-1-0-5-canary.example.com\"]"}}}
+				]}`,
+				"GET /v3/routes": `{"resources": [
+					{"guid": "r1", "host": "myapp", "url": "myapp.example.com", "destinations": [{"app": {"guid": "live"}}, {"app": {"guid": "scaling"}}]},
+					{"guid": "r2", "host": "myapp-1-0-4-canary", "url": "myapp-1-0-4-canary.example.com", "destinations": [{"app": {"guid": "canary"}}]},
+					{"guid": "r3", "host": "myapp-1-0-0-canary", "url": "myapp-1-0-0-canary.example.com", "destinations": []},
+					{"guid": "r4", "host": "myapp-1-0-3-canary", "url": "myapp-1-0-3-canary.example.com", "destinations": [{"app": {"guid": "live"}}]},
+					{"guid": "r5", "host": "myapp-1-0-5-canary", "url": "myapp-1-0-5-canary.example.com", "destinations": [{"app": {"guid": "active"}}]}
+				]}`,
+			})
+
+			cfZddCmd = &commands.CfZddCmd{
+				CmdName:     commands.CleanupCmdName,
+				BaseAppName: "myapp",
+				Conn:        fakeConnection,
+				Commands:    fakeCommon,
+			}
+			cleanup = new(commands.Cleanup)
+			cleanup.SetArgs(cfZddCmd)
+		})
+
+		removedApps := func() (apps []string) {
+			for i := 0; i < fakeCommon.RemoveApplicationCallCount(); i++ {
+				apps = append(apps, fakeCommon.RemoveApplicationArgsForCall(i))
+			}
+			return
+		}
+
+		Context("when forced", func() {
+			BeforeEach(func() {
+				cfZddCmd.Force = true
+				err = cleanup.Run()
+			})
+			It("should delete the venerable and canary apps of the base name", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(removedApps()).Should(ConsistOf("myapp-1.0.4", "myapp-1.0.1-venerable"))
+			})
+			It("should leave a started canary that is still to be promoted or aborted", func() {
+				Expect(removedApps()).ShouldNot(ContainElement("myapp-1.0.5"))
+				for i := 0; i < fakeConnection.CliCommandCallCount(); i++ {
+					Expect(fakeConnection.CliCommandArgsForCall(i)).ShouldNot(ContainElement("myapp-1-0-5-canary"))
+				}
+			})
+			It("should delete the canary routes not mapped to a live app", func() {
+				Expect(fakeConnection.CliCommandCallCount()).Should(Equal(2))
+				Expect(fakeConnection.CliCommandArgsForCall(0)).Should(Equal([]string{"delete-route", "example.com", "-n", "myapp-1-0-4-canary", "-f"}))
+				Expect(fakeConnection.CliCommandArgsForCall(1)).Should(Equal([]string{"delete-route", "example.com", "-n", "myapp-1-0-0-canary", "-f"}))
+			})
+		})
+
+		Context("when a previous version is kept", func() {
+			BeforeEach(func() {
+				cfZddCmd.Force = true
+				cfZddCmd.KeepPrevious = true
+				err = cleanup.Run()
+			})
+			It("should spare the venerable app retained for a rollback", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(removedApps()).Should(ConsistOf("myapp-1.0.4"))
+			})
+		})
+
+		Context("when the deletion is not confirmed", func() {
+			BeforeEach(func() {
+				commands.ConfirmInput = strings.NewReader("n\n")
+				err = cleanup.Run()
+			})
+			It("should not delete anything", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(fakeCommon.RemoveApplicationCallCount()).Should(Equal(0))
+				Expect(fakeConnection.CliCommandCallCount()).Should(Equal(0))
+			})
+		})
+
+		Context("when the deletion is confirmed for the whole space", func() {
+			BeforeEach(func() {
+				cfZddCmd.BaseAppName = ""
+				commands.ConfirmInput = strings.NewReader("yes\n")
+				err = cleanup.Run()
+			})
+			It("should delete the artifacts of every app", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(removedApps()).Should(ConsistOf("myapp-1.0.4", "myapp-1.0.1-venerable", "otherapp-venerable"))
+			})
+			It("should take the lock of each family while deleting its artifacts", func() {
+				var locked []string
+				for i := 0; i < fakeCommon.AcquireDeploymentLockCallCount(); i++ {
+					family, _ := fakeCommon.AcquireDeploymentLockArgsForCall(i)
+					locked = append(locked, family)
+				}
+				// The canary app has no base name label, its name is its family
+				Expect(locked).Should(ConsistOf("myapp-1.0.4", "myapp", "otherapp"))
+			})
+		})
+
+		Context("when a family is being deployed during a cleanup of the whole space", func() {
+			BeforeEach(func() {
+				cfZddCmd.BaseAppName = ""
+				cfZddCmd.Force = true
+				fakeCommon.AcquireDeploymentLockStub = func(family string, ttl time.Duration) (bool, error) {
+					if family == "otherapp" {
+						return false, errors.New("otherapp is being deployed by pipeline")
+					}
+					return true, nil
+				}
+				err = cleanup.Run()
+			})
+			It("should leave the artifacts of that family and clean up the others", func() {
+				Expect(err).Should(MatchError("1 of 5 artifacts could not be deleted"))
+				Expect(removedApps()).Should(ConsistOf("myapp-1.0.4", "myapp-1.0.1-venerable"))
+				Expect(fakeCommon.ReleaseDeploymentLockCallCount()).Should(Equal(2))
+			})
+		})
+	})
+})
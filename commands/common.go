@@ -17,18 +17,34 @@
 package commands
 
 import (
+	"code.cloudfoundry.org/cli/plugin/models"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/cloudfoundry/cli/plugin"
 	"strings"
+	"time"
 )
 
 type CommonCmd interface {
 	IsApplicationDeployed(string) (string, bool)
+	ListApplications(string) ([]plugin_models.GetAppsModel, error)
 	PushApplication(string, string, string, ...string) error
 	RenameApplication(string, string) error
 	RemapRoutes(string, string) error
+	MapRoutes(string, string) error
+	StageApplication(string, time.Duration) error
+	CaptureDiagnostics(string, string) error
+	RetainApplication(string) error
+	RecordDeployment(string, DeploymentRecord) error
+	RecordFailure(string, DeploymentRecord) error
+	ListVersions(string) ([]AppVersion, error)
+	GetDeploymentLock(string) (*DeploymentLock, error)
+	AcquireDeploymentLock(string, time.Duration) (bool, error)
+	ReleaseDeploymentLock(string, bool) error
+	ExtendDeploymentLock(string, time.Duration) (time.Time, error)
+	GetDeploymentProgress(string) (*DeploymentProgress, error)
+	SaveDeploymentProgress(string, *DeploymentProgress) error
 	RemoveApplication(string) error
 	GetDefaultDomain() string
 }
@@ -67,17 +83,48 @@ func (c *commonCmd) GetDefaultDomain() (domain string) {
 }
 
 func (c *commonCmd) IsApplicationDeployed(appName string) (string, bool) {
-	if output, err := c.cli.GetApps(); err == nil {
-		for _, app := range output {
-			if strings.HasPrefix(app.Name, appName) {
-				fmt.Println("Application is deployed")
+	if apps, err := c.ListApplications(appName); err == nil && len(apps) > 0 {
+		fmt.Println("Application is deployed")
+		// Previous versions retained for a rollback are stopped, the live version is the started one serving the live
+		// routes, rather than a version left started by a failed deployment or a canary taking live traffic
+		var versions []plugin_models.GetAppsModel
+		for _, app := range apps {
+			if app.State != "started" || !isCanaryApp(c.cli, app.Guid) {
+				versions = append(versions, app)
+			}
+		}
+		if len(versions) == 0 {
+			versions = apps
+		}
+		for _, app := range versions {
+			if servesLiveRoutes(app) {
+				return app.Name, true
+			}
+		}
+		for _, app := range versions {
+			if app.State == "started" {
 				return app.Name, true
 			}
 		}
+		return versions[0].Name, true
 	}
 	return "", false
 }
 
+// ListApplications - list the applications in the space whose name starts with the base application name
+func (c *commonCmd) ListApplications(baseName string) (apps []plugin_models.GetAppsModel, err error) {
+	output, err := c.cli.GetApps()
+	if err != nil {
+		return
+	}
+	for _, app := range output {
+		if strings.HasPrefix(app.Name, baseName) {
+			apps = append(apps, app)
+		}
+	}
+	return
+}
+
 func (c *commonCmd) PushApplication(appName string, artifactPath string, manifestPath string, extraArgs ...string) error {
 
 	if appName == "" {
@@ -124,15 +171,13 @@ func (c *commonCmd) RemapRoutes(from string, to string) error {
 	}
 	// Map the routes to the new application version
 	for _, r := range fromModel.Routes {
-		mapArgs := []string{"map-route", to, r.Domain.Name, "-n", r.Host}
-		if _, err = c.cli.CliCommand(mapArgs...); err != nil {
+		if _, err = c.cli.CliCommand(routeCommand("map-route", to, r)...); err != nil {
 			fmt.Println(err.Error())
 		}
 	}
 	// Remove the route from the old app version
 	for _, r := range fromModel.Routes {
-		unmapArgs := []string{"unmap-route", from, r.Domain.Name, "-n", r.Host}
-		if _, err = c.cli.CliCommand(unmapArgs...); err != nil {
+		if _, err = c.cli.CliCommand(routeCommand("unmap-route", from, r)...); err != nil {
 			fmt.Println(err.Error())
 		}
 	}
@@ -140,6 +185,55 @@ func (c *commonCmd) RemapRoutes(from string, to string) error {
 	return err
 }
 
+// MapRoutes - map the routes of one application to another, leaving them mapped to the original application
+func (c *commonCmd) MapRoutes(from string, to string) error {
+	fromModel, err := c.cli.GetApp(from)
+
+	if err != nil {
+		return err
+	}
+	for _, r := range fromModel.Routes {
+		if _, err = c.cli.CliCommand(routeCommand("map-route", to, r)...); err != nil {
+			fmt.Println(err.Error())
+			return err
+		}
+	}
+	return nil
+}
+
+// RetainApplication - stop an application and unmap all of its routes, keeping it available for a rollback
+func (c *commonCmd) RetainApplication(appName string) error {
+	appModel, err := c.cli.GetApp(appName)
+
+	if err != nil {
+		return err
+	}
+	for _, r := range appModel.Routes {
+		if _, err = c.cli.CliCommand(routeCommand("unmap-route", appName, r)...); err != nil {
+			fmt.Println(err.Error())
+			return err
+		}
+	}
+	if _, err = c.cli.CliCommand("stop", appName); err != nil {
+		fmt.Println(err.Error())
+	}
+	return err
+}
+
+// restoreVenerable - remove a new version that failed before cutover and return the venerable version to its
+// original name
+func restoreVenerable(commands CommonCmd, newApp string, oldApp string, venerable string) {
+	fmt.Printf("Removing failed version: %s\n", newApp)
+	if err := commands.RemoveApplication(newApp); err != nil {
+		fmt.Printf("Unable to remove failed application: %s, error: %s\n", newApp, err.Error())
+	}
+	if venerable != oldApp {
+		if err := commands.RenameApplication(venerable, oldApp); err != nil {
+			fmt.Printf("Unable to rename %s back to %s, error: %s\n", venerable, oldApp, err.Error())
+		}
+	}
+}
+
 func (c *commonCmd) RenameApplication(from string, to string) (err error) {
 	if from == "" || to == "" {
 		return errors.New("appname and new appname must be specified")
@@ -90,6 +90,78 @@ var _ = Describe("common command", func() {
 				Expect(dep).Should(BeFalse())
 			})
 		})
+		Context("when a previous version is retained next to the live version", func() {
+			BeforeEach(func() {
+				fakeCliConnection.GetAppsReturns([]plugin_models.GetAppsModel{{
+					Name:  "demoApp-1.2.2",
+					State: "stopped",
+				}, {
+					Name:  ctrlAppName,
+					State: "started",
+				}}, nil)
+			})
+			It("should return the started version", func() {
+				app, dep := cmd.IsApplicationDeployed(baseAppName)
+				Expect(app).Should(Equal(ctrlAppName))
+				Expect(dep).Should(BeTrue())
+			})
+		})
+		Context("when a failed deployment left a version started without routes", func() {
+			BeforeEach(func() {
+				fakeCliConnection.GetAppsReturns([]plugin_models.GetAppsModel{{
+					Name:  "demoApp-1.2.4",
+					State: "started",
+				}, {
+					Name:   ctrlAppName,
+					State:  "started",
+					Routes: []plugin_models.GetAppsRouteSummary{{Host: "demoApp"}},
+				}}, nil)
+			})
+			It("should return the version serving the live routes", func() {
+				app, _ := cmd.IsApplicationDeployed(baseAppName)
+				Expect(app).Should(Equal(ctrlAppName))
+			})
+		})
+		Context("when a canary takes a share of the live traffic", func() {
+			BeforeEach(func() {
+				fakeCliConnection.GetAppsReturns([]plugin_models.GetAppsModel{{
+					Name:   "demoApp-1.2.4",
+					Guid:   "canary-guid",
+					State:  "started",
+					Routes: []plugin_models.GetAppsRouteSummary{{Host: "demoApp-1-2-4-canary"}, {Host: "demoApp"}},
+				}, {
+					Name:   ctrlAppName,
+					Guid:   "live-guid",
+					State:  "started",
+					Routes: []plugin_models.GetAppsRouteSummary{{Host: "demoApp"}},
+				}}, nil)
+				fakeCliConnection.CliCommandWithoutTerminalOutputStub = curlResponder(map[string]string{
+					"GET /v3/apps/canary-guid": `{"guid": "canary-guid", "metadata": {"annotations": {"zdd.comcast.com/canary-routes": "demoApp-1-2-4-canary.cloud.net"}}}`,
+					"GET /v3/apps/live-guid":   `{"guid": "live-guid", "metadata": {}}`,
+				})
+			})
+			It("should return the live version rather than the canary", func() {
+				app, _ := cmd.IsApplicationDeployed(baseAppName)
+				Expect(app).Should(Equal(ctrlAppName))
+			})
+		})
+	})
+
+	Describe(".ListApplications", func() {
+		BeforeEach(func() {
+			fakeCliConnection.GetAppsReturns([]plugin_models.GetAppsModel{
+				{Name: "demoApp-1.2.2"},
+				{Name: "someOtherApp"},
+				{Name: "demoApp-1.2.3"},
+			}, nil)
+		})
+		It("should return the applications starting with the base name", func() {
+			apps, err := cmd.ListApplications("demoApp")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(apps).Should(HaveLen(2))
+			Expect(apps[0].Name).Should(Equal("demoApp-1.2.2"))
+			Expect(apps[1].Name).Should(Equal("demoApp-1.2.3"))
+		})
 	})
 
 	Describe(".PushApplication", func() {
@@ -211,5 +283,76 @@ var _ = Describe("common command", func() {
 				Expect(err).ShouldNot(HaveOccurred())
 			})
 		})
+
+		Context("when the application has a path route", func() {
+			BeforeEach(func() {
+				fakeCliConnection.GetAppReturns(plugin_models.GetAppModel{
+					Routes: []plugin_models.GetApp_RouteSummary{
+						{Host: "myapp", Domain: plugin_models.GetApp_DomainFields{Name: "adomain.com"}, Path: "/api"},
+					},
+				}, nil)
+			})
+
+			It("should move the route with its path", func() {
+				Expect(cmd.RemapRoutes("oldApp", "newApp")).Should(Succeed())
+				Expect(fakeCliConnection.CliCommandArgsForCall(0)).Should(Equal([]string{"map-route", "newApp", "adomain.com", "-n", "myapp", "--path", "api"}))
+				Expect(fakeCliConnection.CliCommandArgsForCall(1)).Should(Equal([]string{"unmap-route", "oldApp", "adomain.com", "-n", "myapp", "--path", "api"}))
+			})
+		})
+	})
+
+	Describe(".MapRoutes", func() {
+		Context("when called with a valid application", func() {
+			var (
+				err error
+			)
+			BeforeEach(func() {
+				fakeCliConnection.GetAppReturns(plugin_models.GetAppModel{
+					Routes: []plugin_models.GetApp_RouteSummary{
+						{
+							Domain: plugin_models.GetApp_DomainFields{
+								Name: "adomain.com",
+							},
+							Host: "myapp",
+						},
+					},
+				}, nil)
+			})
+
+			It("should map the routes without unmapping them", func() {
+				err = cmd.MapRoutes("oldApp", "newApp")
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(fakeCliConnection.CliCommandCallCount()).Should(Equal(1))
+				Expect(fakeCliConnection.CliCommandArgsForCall(0)).Should(Equal([]string{"map-route", "newApp", "adomain.com", "-n", "myapp"}))
+			})
+		})
+	})
+
+	Describe(".RetainApplication", func() {
+		Context("when called with a valid application", func() {
+			var (
+				err error
+			)
+			BeforeEach(func() {
+				fakeCliConnection.GetAppReturns(plugin_models.GetAppModel{
+					Routes: []plugin_models.GetApp_RouteSummary{
+						{
+							Domain: plugin_models.GetApp_DomainFields{
+								Name: "adomain.com",
+							},
+							Host: "myapp",
+						},
+					},
+				}, nil)
+				err = cmd.RetainApplication("oldApp")
+			})
+
+			It("should unmap the routes and stop the application", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(fakeCliConnection.CliCommandCallCount()).Should(Equal(2))
+				Expect(fakeCliConnection.CliCommandArgsForCall(0)).Should(Equal([]string{"unmap-route", "oldApp", "adomain.com", "-n", "myapp"}))
+				Expect(fakeCliConnection.CliCommandArgsForCall(1)).Should(Equal([]string{"stop", "oldApp"}))
+			})
+		})
 	})
 })
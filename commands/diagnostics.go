@@ -0,0 +1,90 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// CaptureDiagnostics - collect the instance states, recent events and recent logs of an application, print them and
+// append them to the report file when a path is given
+func (c *commonCmd) CaptureDiagnostics(appName string, reportPath string) (err error) {
+	if appName == "" {
+		return errors.New("appname must be specified")
+	}
+
+	var report bytes.Buffer
+	fmt.Fprintf(&report, "=== Diagnostics for %s captured at %s ===\n", appName, time.Now().UTC().Format(time.RFC3339))
+
+	if app, appErr := c.cli.GetApp(appName); appErr != nil {
+		fmt.Fprintf(&report, "Unable to read application: %s\n", appErr.Error())
+	} else {
+		fmt.Fprintf(&report, "\n--- Instances: %d of %d running, state %s ---\n", app.RunningInstances, app.InstanceCount, app.State)
+		for idx, instance := range app.Instances {
+			fmt.Fprintf(&report, "#%d %s since %s %s\n", idx, instance.State, instance.Since.Format(time.RFC3339), instance.Details)
+		}
+	}
+
+	c.appendCommandOutput(&report, "Recent events", "events", appName)
+	c.appendCommandOutput(&report, "Recent logs", "logs", appName, "--recent")
+
+	fmt.Print(report.String())
+
+	if reportPath == "" {
+		return
+	}
+	reportFile, err := os.OpenFile(reportPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer reportFile.Close()
+	if _, err = reportFile.Write(report.Bytes()); err == nil {
+		fmt.Printf("Diagnostics written to %s\n", reportPath)
+	}
+	return
+}
+
+func (c *commonCmd) appendCommandOutput(report *bytes.Buffer, title string, args ...string) {
+	fmt.Fprintf(report, "\n--- %s ---\n", title)
+	output, err := c.cli.CliCommandWithoutTerminalOutput(args...)
+	if err != nil {
+		fmt.Fprintf(report, "Unable to run cf %s: %s\n", strings.Join(args, " "), err.Error())
+		return
+	}
+	for _, line := range output {
+		fmt.Fprintln(report, line)
+	}
+}
+
+// captureFailure - capture the diagnostics of a failed version before it is rolled back or removed, and run the
+// on-failure hooks. The old version is the one the failed version was to replace, under the name it has at the failure.
+func captureFailure(args *CfZddCmd, appName string, oldApp string) {
+	runHooks(args, HookOnFailure, appName, oldApp)
+	if err := args.Commands.CaptureDiagnostics(appName, args.FailureReport); err != nil {
+		fmt.Printf("Unable to capture diagnostics for %s: %s\n", appName, err.Error())
+	}
+	record := newDeploymentRecord(args, familyName(args, args.NewApp), oldApp)
+	record.Outcome = OutcomeFailed
+	if err := args.Commands.RecordFailure(appName, record); err != nil {
+		fmt.Printf("Unable to record the failed deployment of %s: %s\n", appName, err.Error())
+	}
+}
@@ -0,0 +1,93 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/comcast/cf-zdd-plugin/commands"
+	"github.com/comcast/cf-zdd-plugin/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe(".CaptureDiagnostics", func() {
+	var (
+		fakeCliConnection *fakes.FakeCliConnection
+		cmd               commands.CommonCmd
+		reportDir         string
+		err               error
+	)
+
+	BeforeEach(func() {
+		fakeCliConnection = new(fakes.FakeCliConnection)
+		fakeCliConnection.GetAppReturns(plugin_models.GetAppModel{
+			InstanceCount:    2,
+			RunningInstances: 1,
+			State:            "started",
+			Instances: []plugin_models.GetApp_AppInstanceFields{
+				{State: "running"},
+				{State: "crashed", Details: "exited with status 1"},
+			},
+		}, nil)
+		fakeCliConnection.CliCommandWithoutTerminalOutputStub = func(args ...string) ([]string, error) {
+			if args[0] == "events" {
+				return []string{"app.crash   index: 1, reason: CRASHED"}, nil
+			}
+			return []string{"[APP/PROC/WEB/1] ERR panic: cannot connect to database"}, nil
+		}
+		cmd = commands.NewCommonCmd(fakeCliConnection)
+
+		reportDir, err = ioutil.TempDir("", "diagnostics")
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(reportDir)
+	})
+
+	Context("when called with a report path", func() {
+		var reportPath string
+		BeforeEach(func() {
+			reportPath = filepath.Join(reportDir, "report.txt")
+			err = cmd.CaptureDiagnostics("myapp", reportPath)
+		})
+		It("should read the events and recent logs of the application", func() {
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(fakeCliConnection.CliCommandWithoutTerminalOutputArgsForCall(0)).Should(Equal([]string{"events", "myapp"}))
+			Expect(fakeCliConnection.CliCommandWithoutTerminalOutputArgsForCall(1)).Should(Equal([]string{"logs", "myapp", "--recent"}))
+		})
+		It("should write the instance states, events and logs to the report", func() {
+			report, readErr := ioutil.ReadFile(reportPath)
+			Expect(readErr).ShouldNot(HaveOccurred())
+			Expect(string(report)).Should(ContainSubstring("1 of 2 running"))
+			Expect(string(report)).Should(ContainSubstring("crashed since"))
+			Expect(string(report)).Should(ContainSubstring("app.crash"))
+			Expect(string(report)).Should(ContainSubstring("cannot connect to database"))
+		})
+	})
+
+	Context("when called without an application name", func() {
+		It("should return an error", func() {
+			err = cmd.CaptureDiagnostics("", "")
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+})
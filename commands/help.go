@@ -35,26 +35,142 @@ func (h *HelpCmd) help() (err error) {
 			"\n\t--newapp = The name of the new application" +
 			"\n\t--duration = The time for scaling over the application, default is 480s" +
 			"\n\t--p = The path to the application file" +
-			"\n\t--f = The path to the application manifest"
+			"\n\t--f = The path to the application manifest" +
+			"\n\t--failure-report = File to append diagnostics of the new version to when the deployment fails" +
+			"\n\t--keep-previous = Keep the old version stopped and unrouted so it can be restored with rollback" +
+			"\n\t--keep-versions = Number of previous versions to keep stopped and unrouted, the oldest beyond it are removed" +
+			"\n\t--git-sha = The commit being deployed, recorded on the new version, default is $GIT_COMMIT, $GITHUB_SHA or $CI_COMMIT_SHA" +
+			"\n\t--resume = continue or rollback a deployment that was interrupted, from where it stopped" +
+			"\n\t--staging-timeout = The time staging the new version may take, default is 15m" +
+			"\n\t--repair-routes = Map and unmap the routes the cutover left on the wrong version instead of only printing the commands" +
+			"\n\t--hooks = A file of commands to run before and after the push and the cutover, on failure and on rollback" +
+			"\n\t--pre-cutover-task = A command to run as a task of the new version before the cutover, a failed task aborts the deployment" +
+			"\n\t--pre-cutover-task-timeout = The time the pre-cutover task may take, default is 30m"
 	case CanaryDeployCmdName:
 		helpString = "deploy-canary help" +
 			"\n\t--newapp = The name of the new application" +
 			"\n\t--p = The path to the application file" +
-			"\n\t--f = The path to the application manifest"
+			"\n\t--f = The path to the application manifest" +
+			"\n\t--canary-instances = Instances of the canary, a number or a percentage of the live instances, default is 1" +
+			"\n\t--canary-memory = Memory limit of the canary instances, default is the manifest" +
+			"\n\t--canary-disk = Disk limit of the canary instances, default is the manifest" +
+			"\n\t--canary-hostname = Template of the canary hostname using {{.App}} and {{.BaseName}}, default is {{.App}}-canary, must end in -canary" +
+			"\n\t--canary-domain = Domain of the canary route, default is the domain of the first manifest route" +
+			"\n\t--canary-live-traffic = Also map the live routes to the canary so it takes a share of the live traffic" +
+			"\n\t--hooks = A file of commands to run before and after the push and the cutover, on failure and on rollback"
 	case CanaryPromoteCmdName:
 		helpString = "promote-canary help" +
 			"\n\t--oldapp = The name of the existing application" +
 			"\n\t--newapp = The name of the new application" +
 			"\n\t--duration = The time for scaling over the application, default is 480s" +
 			"\n\t--p = The path to the application file" +
-			"\n\t--f = The path to the application manifest"
+			"\n\t--f = The path to the application manifest" +
+			"\n\t--failure-report = File to append diagnostics of the new version to when the deployment fails" +
+			"\n\t--keep-previous = Keep the old version stopped and unrouted so it can be restored with rollback" +
+			"\n\t--keep-versions = Number of previous versions to keep stopped and unrouted, the oldest beyond it are removed" +
+			"\n\t--git-sha = The commit being deployed, recorded on the new version, default is $GIT_COMMIT, $GITHUB_SHA or $CI_COMMIT_SHA" +
+			"\n\t--custom-health-url = The path of the health check the canary must pass before it is promoted, default is /" +
+			"\n\t--check-status = The status the health check must return, default is any status below 400" +
+			"\n\t--check-body = Text the body of the health check must contain" +
+			"\n\t--repair-routes = Map and unmap the routes the cutover left on the wrong version instead of only printing the commands" +
+			"\n\t--hooks = A file of commands to run before and after the push and the cutover, on failure and on rollback"
 	case BlueGreenCmdName:
 		helpString = "blue-green help" +
 			"\n\t--newapp = The name of the new application" +
 			"\n\t--p = The path to the application file" +
-			"\n\t--f = The path to the application manifest"
+			"\n\t--f = The path to the application manifest" +
+			"\n\t--failure-report = File to append diagnostics of the new version to when the deployment fails" +
+			"\n\t--keep-previous = Keep the old version stopped and unrouted so it can be restored with rollback" +
+			"\n\t--keep-versions = Number of previous versions to keep stopped and unrouted, the oldest beyond it are removed" +
+			"\n\t--git-sha = The commit being deployed, recorded on the new version, default is $GIT_COMMIT, $GITHUB_SHA or $CI_COMMIT_SHA" +
+			"\n\t--smoke-test-path = A path that must pass --check-status and --check-body on a test route of the new version before the routes flip" +
+			"\n\t--smoke-test-cmd = A command that must succeed before the routes flip, given the test route in $SMOKE_TEST_URL" +
+			"\n\t--smoke-test-timeout = The time the smoke test may take, default is 5m" +
+			"\n\t--keep-old = Keep the old version unrouted for this long after the flip, flipping the routes back if the new version fails its health checks" +
+			"\n\t--keep-old-stopped = Stop the old version during the --keep-old window, it is started again to flip back" +
+			"\n\t--probe-interval = The time between health checks during the --keep-old window, default is 5s" +
+			"\n\t--custom-health-url = The path of the health check on the production routes, default is /" +
+			"\n\t--start-timeout = The time every instance of the started version may take to run, default is 5m" +
+			"\n\t--repair-routes = Map and unmap the routes the cutover left on the wrong version instead of only printing the commands" +
+			"\n\t--hooks = A file of commands to run before and after the push and the cutover, on failure and on rollback" +
+			"\n\t--pre-cutover-task = A command to run as a task of the new version before the cutover, a failed task aborts the deployment" +
+			"\n\t--pre-cutover-task-timeout = The time the pre-cutover task may take, default is 30m"
+	case RollingDeployCmdName:
+		helpString = "deploy-rolling help" +
+			"\n\t--newapp = The name of the new application" +
+			"\n\t--base-name = The base name of the application if using versioned application names" +
+			"\n\t--timeout = The maximum time to wait for the deployment, default is 10m" +
+			"\n\t--p = The path to the application file" +
+			"\n\t--f = The path to the application manifest, only used on the initial push and the fallback to deploy-zdd" +
+			"\n\t--failure-report = File to append diagnostics of the new version to when the deployment fails" +
+			"\n\t--git-sha = The commit being deployed, recorded on the new version, default is $GIT_COMMIT, $GITHUB_SHA or $CI_COMMIT_SHA" +
+			"\n\t--hooks = A file of commands to run before and after the push and the cutover, on failure and on rollback"
+	case PromoteDropletCmdName:
+		helpString = "promote-droplet help" +
+			"\n\t--newapp = The name of the new application" +
+			"\n\t--base-name = The base name of the application if using versioned application names" +
+			"\n\t--source-space = The space of the application to copy the droplet from" +
+			"\n\t--source-app = The application to copy the droplet from, default is the new application name" +
+			"\n\t--duration = The time for scaling over the application, default is 480s" +
+			"\n\t--failure-report = File to append diagnostics of the new version to when the deployment fails" +
+			"\n\t--git-sha = The commit being deployed, recorded on the new version, default is $GIT_COMMIT, $GITHUB_SHA or $CI_COMMIT_SHA" +
+			"\n\t--repair-routes = Map and unmap the routes the cutover left on the wrong version instead of only printing the commands" +
+			"\n\t--hooks = A file of commands to run before and after the push and the cutover, on failure and on rollback"
+	case RollbackCmdName:
+		helpString = "rollback help" +
+			"\n\t--newapp = The name of the live application" +
+			"\n\t--base-name = The base name of versioned application names" +
+			"\n\t--oldapp = The version to restore, default is the version retained with --keep-previous" +
+			"\n\t--strategy = scaleover or blue-green, default is scaleover" +
+			"\n\t--duration = The time for scaling over the application, default is 480s" +
+			"\n\t--start-timeout = The time every instance of the started version may take to run, default is 5m" +
+			"\n\t--failure-report = File to append diagnostics of the restored version to when the rollback fails" +
+			"\n\t--repair-routes = Map and unmap the routes the cutover left on the wrong version instead of only printing the commands" +
+			"\n\t--hooks = A file of commands to run before and after the push and the cutover, on failure and on rollback"
+	case CleanupCmdName:
+		helpString = "zdd-cleanup help" +
+			"\n\t--base-name = The base name of the application to clean up, default is the whole space" +
+			"\n\t--keep-previous = Keep the most recent venerable app retained for a rollback" +
+			"\n\t--keep-versions = Number of venerable apps retained for a rollback to keep" +
+			"\n\t--force = Delete without asking for confirmation"
+	case StatusCmdName:
+		helpString = "zdd-status help" +
+			"\n\tzdd-status <base name> = Show the live, canary, venerable and retained versions of the application," +
+			" their instances and routes, and whether a deployment is in progress or was interrupted"
+	case UnlockCmdName:
+		helpString = "zdd-unlock help" +
+			"\n\tzdd-unlock <base name> = Remove the deployment lock of the application" +
+			"\n\t--force = Remove a lock that has not expired without asking for confirmation"
+	case HistoryCmdName:
+		helpString = "zdd-history help" +
+			"\n\tzdd-history <base name> = Show the past deployments of the application with their version, strategy," +
+			" start and finish time, outcome and actor" +
+			"\n\t--json = Print the deployments as json"
+	case AnalyzeCanaryCmdName:
+		helpString = "analyze-canary help" +
+			"\n\t--newapp = The name of the canary application" +
+			"\n\t--oldapp = The name of the live application, default is the live version of the base name" +
+			"\n\t--base-name = The base name of the application if using versioned application names" +
+			"\n\t--bake = The time to probe the canary for, default is 5m" +
+			"\n\t--probe-interval = The time between probes, default is 5s" +
+			"\n\t--custom-health-url = The path probed on the canary and live routes, default is /" +
+			"\n\t--check-status = The status the probes must return, default is any status below 400" +
+			"\n\t--check-body = Text the body of the probes must contain" +
+			"\n\t--min-success-rate = The percentage of canary probes that must succeed, default is 99" +
+			"\n\t--max-latency-ratio = The p50, p95 and p99 latencies of the canary allowed relative to the live route, default is 1.2" +
+			"\n\t--max-p95 = The p95 latency the canary must stay under" +
+			"\n\t--metrics-config = A file of PromQL queries and the criteria the canary must meet on them" +
+			"\n\t--duration = The scaleover duration used when promoting the canary" +
+			"\n\t--json = Print the analysis report as json"
+	case AbortCanaryCmdName:
+		helpString = "abort-canary help" +
+			"\n\tabort-canary <canary> = Delete the canary routes and the canary, unmapping the live routes it shares" +
+			"\n\t--old-app = The name of the live application, default is the live version of the base name" +
+			"\n\t--base-name = The base name of the application if using versioned application names" +
+			"\n\t--capture-logs = Capture the recent logs and events of the canary before removing it" +
+			"\n\t--failure-report = A file to append the captured logs to"
 	default:
-		helpString = "Help is available for the deployment types: \n\t - deploy-canary \n\t - promote-canary \n\t - blue-green \n\t - deploy-zdd \nUse the command help <deploy command> for command specific help"
+		helpString = "Help is available for the deployment types: \n\t - deploy-canary \n\t - promote-canary \n\t - blue-green \n\t - deploy-zdd \n\t - deploy-rolling \n\t - promote-droplet \n\t - rollback \n\t - zdd-cleanup \n\t - zdd-status \n\t - zdd-unlock \n\t - zdd-history \n\t - analyze-canary \n\t - abort-canary \nUse the command help <deploy command> for command specific help"
 	}
 
 	fmt.Println(helpString)
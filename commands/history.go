@@ -0,0 +1,390 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// History - struct
+type History struct {
+	args *CfZddCmd
+}
+
+// HistoryCmdName - constants
+const (
+	HistoryCmdName = "zdd-history"
+)
+
+// HistoryOutput - where the deployment history is written
+var HistoryOutput io.Writer = os.Stdout
+
+// historyEventTypes - audit events marking the creation, start, routing and deletion of a version
+var historyEventTypes = []string{"audit.app.create", "audit.app.start", "audit.app.map-route", "audit.app.delete-request"}
+
+// Deployment - a past deployment of an application family
+type Deployment struct {
+	Version         string    `json:"version"`
+	GUID            string    `json:"guid"`
+	Strategy        string    `json:"strategy,omitempty"`
+	StartedAt       time.Time `json:"started_at"`
+	FinishedAt      time.Time `json:"finished_at"`
+	Outcome         string    `json:"outcome,omitempty"`
+	Actor           string    `json:"actor,omitempty"`
+	GitSHA          string    `json:"git_sha,omitempty"`
+	Checksum        string    `json:"artifact_checksum,omitempty"`
+	PreviousVersion string    `json:"previous_version,omitempty"`
+	Droplet         string    `json:"droplet,omitempty"`
+	Deleted         bool      `json:"deleted"`
+}
+
+// auditEvent - an app audit event read from either version of the cloud controller api
+type auditEvent struct {
+	Type    string
+	Time    time.Time
+	Actor   string
+	AppGUID string
+	AppName string
+}
+
+func init() {
+	Register(HistoryCmdName, new(History))
+}
+
+// Run - Run method
+func (s *History) Run() (err error) {
+	err = s.history()
+	return
+}
+
+// SetArgs - set command args
+func (s *History) SetArgs(args *CfZddCmd) {
+	s.args = args
+}
+
+func (s *History) history() (err error) {
+	baseName := s.args.BaseAppName
+	if baseName == "" && len(s.args.Arguments) > 0 {
+		baseName = s.args.Arguments[0]
+	}
+	if baseName == "" {
+		return errors.New("base name must be specified")
+	}
+
+	events, err := s.auditEvents()
+	if err != nil {
+		// Deployments recorded on versions still in the space are reported without the audit trail
+		fmt.Fprintf(os.Stderr, "Unable to read audit events: %s\n", err.Error())
+	}
+	apps, err := familyApps(s.args.Conn, baseName)
+	if err != nil {
+		return
+	}
+	deployments := familyDeployments(baseName, events, apps)
+
+	if s.args.JSONOutput {
+		if deployments == nil {
+			deployments = []Deployment{}
+		}
+		encoder := json.NewEncoder(HistoryOutput)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(deployments)
+	}
+
+	if len(deployments) == 0 {
+		fmt.Fprintf(HistoryOutput, "No deployments of %s found\n", baseName)
+		return
+	}
+	w := tabwriter.NewWriter(HistoryOutput, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tSTRATEGY\tSTARTED\tFINISHED\tOUTCOME\tACTOR")
+	for _, deployment := range deployments {
+		version := deployment.Version
+		if deployment.Deleted {
+			version += " (deleted)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", version, orDash(deployment.Strategy), formatTime(deployment.StartedAt),
+			formatTime(deployment.FinishedAt), orDash(deployment.Outcome), orDash(deployment.Actor))
+	}
+	w.Flush()
+	return
+}
+
+// auditEvents - app events of the current space from the v3 audit events, or the v2 events on older foundations
+func (s *History) auditEvents() (events []auditEvent, err error) {
+	space, err := s.args.Conn.GetCurrentSpace()
+	if err != nil {
+		return
+	}
+
+	// Most recent first, following the pages so that no version is missed in spaces with many events
+	path := "/v3/audit_events?types=" + strings.Join(historyEventTypes, ",") + "&space_guids=" + space.Guid +
+		"&order_by=-created_at&per_page=5000"
+	for page := 1; ; page++ {
+		v3Events := new(struct {
+			Pagination struct {
+				Next struct {
+					Href string `json:"href"`
+				} `json:"next"`
+			} `json:"pagination"`
+			Resources []struct {
+				CreatedAt time.Time `json:"created_at"`
+				Type      string    `json:"type"`
+				Actor     struct {
+					Name string `json:"name"`
+				} `json:"actor"`
+				Target struct {
+					GUID string `json:"guid"`
+					Name string `json:"name"`
+				} `json:"target"`
+			} `json:"resources"`
+		})
+		if err = CCCurl(s.args.Conn, "GET", path, nil, v3Events); err != nil {
+			if page == 1 {
+				break
+			}
+			return
+		}
+		for _, event := range v3Events.Resources {
+			events = append(events, auditEvent{
+				Type:    event.Type,
+				Time:    event.CreatedAt,
+				Actor:   event.Actor.Name,
+				AppGUID: event.Target.GUID,
+				AppName: event.Target.Name,
+			})
+		}
+		path = nextPagePath(v3Events.Pagination.Next.Href)
+		if path == "" {
+			return
+		}
+	}
+
+	path = "/v2/events?q=" + url.QueryEscape("space_guid:"+space.Guid) +
+		"&q=" + url.QueryEscape("type IN "+strings.Join(historyEventTypes, ",")) + "&results-per-page=100&order-direction=desc"
+	for path != "" {
+		v2Events := new(struct {
+			NextURL   string `json:"next_url"`
+			Resources []struct {
+				Entity struct {
+					Type      string    `json:"type"`
+					Timestamp time.Time `json:"timestamp"`
+					ActorName string    `json:"actor_name"`
+					Actee     string    `json:"actee"`
+					ActeeName string    `json:"actee_name"`
+				} `json:"entity"`
+			} `json:"resources"`
+		})
+		if err = CCCurl(s.args.Conn, "GET", path, nil, v2Events); err != nil {
+			return
+		}
+		for _, event := range v2Events.Resources {
+			events = append(events, auditEvent{
+				Type:    event.Entity.Type,
+				Time:    event.Entity.Timestamp,
+				Actor:   event.Entity.ActorName,
+				AppGUID: event.Entity.Actee,
+				AppName: event.Entity.ActeeName,
+			})
+		}
+		path = nextPagePath(v2Events.NextURL)
+	}
+	return
+}
+
+// nextPagePath - the path of the next page of a listing, given as a full url by v3 and as a path by v2, empty on the
+// last page
+func nextPagePath(next string) string {
+	if next == "" {
+		return ""
+	}
+	nextURL, err := url.Parse(next)
+	if err != nil {
+		return ""
+	}
+	return nextURL.RequestURI()
+}
+
+// familyDeployments - the deployments of the family, most recent first. Audit events give the versions created,
+// including those since deleted, and the last time they were started or routed. The metadata recorded on the versions
+// still in the space takes precedence, as it holds the strategy and outcome the events cannot tell. The earliest
+// deployment listed on a version completes it, and the later ones, such as the rolling deployments of new droplets to
+// the same version, are reported on their own. Versions recorded before the list was kept have their single record
+// applied instead. A failed deployment completes the version it failed on when that has no outcome recorded, and is
+// reported on its own otherwise, as when a rolling deployment of the live version failed.
+func familyDeployments(baseName string, events []auditEvent, apps []ccApp) (deployments []Deployment) {
+	byGUID := make(map[string]*Deployment)
+	var order []string
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.Before(events[j].Time)
+	})
+	for _, event := range events {
+		deployment, found := byGUID[event.AppGUID]
+		if !found {
+			if event.Type != "audit.app.create" || !strings.HasPrefix(event.AppName, baseName) {
+				continue
+			}
+			deployment = &Deployment{Version: event.AppName, GUID: event.AppGUID, StartedAt: event.Time, Actor: event.Actor}
+			byGUID[event.AppGUID] = deployment
+			order = append(order, event.AppGUID)
+			continue
+		}
+		switch event.Type {
+		case "audit.app.start", "audit.app.map-route":
+			deployment.FinishedAt = event.Time
+		case "audit.app.delete-request":
+			deployment.Deleted = true
+		}
+	}
+
+	var failures, separate []Deployment
+	for _, app := range apps {
+		var succeeded []Deployment
+		for _, recorded := range recordedDeployments(&app) {
+			if recorded.Outcome == OutcomeFailed {
+				failures = append(failures, recorded)
+			} else {
+				succeeded = append(succeeded, recorded)
+			}
+		}
+		deployment, found := byGUID[app.GUID]
+		if !found {
+			deployment = &Deployment{Version: app.Name, GUID: app.GUID, StartedAt: app.CreatedAt}
+			byGUID[app.GUID] = deployment
+			order = append(order, app.GUID)
+		}
+		deployment.Deleted = false
+		if len(succeeded) == 0 {
+			applyDeploymentRecord(deployment, app.Metadata.Labels, app.Metadata.Annotations)
+			continue
+		}
+		sort.SliceStable(succeeded, func(i, j int) bool {
+			return succeeded[i].StartedAt.Before(succeeded[j].StartedAt)
+		})
+		applyRecorded(deployment, &succeeded[0])
+		separate = append(separate, succeeded[1:]...)
+	}
+
+	for i := range failures {
+		failure := &failures[i]
+		deployment, found := byGUID[failure.GUID]
+		if found && deployment.Outcome == "" {
+			applyFailure(deployment, failure)
+			continue
+		}
+		failure.Deleted = !found || deployment.Deleted
+		separate = append(separate, *failure)
+	}
+
+	for _, guid := range order {
+		deployments = append(deployments, *byGUID[guid])
+	}
+	deployments = append(deployments, separate...)
+	sort.SliceStable(deployments, func(i, j int) bool {
+		return deployments[i].StartedAt.After(deployments[j].StartedAt)
+	})
+	return
+}
+
+// applyDeploymentRecord - overlay the deployment record annotations written by RecordDeployment
+func applyDeploymentRecord(deployment *Deployment, labels map[string]string, annotations map[string]string) {
+	if outcome := labels[OutcomeLabel]; outcome != "" {
+		deployment.Outcome = outcome
+	}
+	if startedAt, err := time.Parse(time.RFC3339Nano, annotations[StartedAtAnnotation]); err == nil {
+		deployment.StartedAt = startedAt
+	}
+	if finishedAt, err := time.Parse(time.RFC3339Nano, annotations[FinishedAtAnnotation]); err == nil {
+		deployment.FinishedAt = finishedAt
+	}
+	apply := func(field *string, annotation string) {
+		if value := annotations[annotation]; value != "" {
+			*field = value
+		}
+	}
+	apply(&deployment.Strategy, StrategyAnnotation)
+	apply(&deployment.Actor, DeployerAnnotation)
+	apply(&deployment.GitSHA, GitSHAAnnotation)
+	apply(&deployment.Checksum, ChecksumAnnotation)
+	apply(&deployment.PreviousVersion, PreviousVersionAnnotation)
+}
+
+// applyRecorded - overlay a deployment listed on the version, keeping what the events tell of fields it has not recorded
+func applyRecorded(deployment *Deployment, recorded *Deployment) {
+	deployment.Outcome = recorded.Outcome
+	if !recorded.StartedAt.IsZero() {
+		deployment.StartedAt = recorded.StartedAt
+	}
+	if !recorded.FinishedAt.IsZero() {
+		deployment.FinishedAt = recorded.FinishedAt
+	}
+	apply := func(field *string, value string) {
+		if value != "" {
+			*field = value
+		}
+	}
+	apply(&deployment.Strategy, recorded.Strategy)
+	apply(&deployment.Actor, recorded.Actor)
+	apply(&deployment.GitSHA, recorded.GitSHA)
+	apply(&deployment.Checksum, recorded.Checksum)
+	apply(&deployment.PreviousVersion, recorded.PreviousVersion)
+	apply(&deployment.Droplet, recorded.Droplet)
+}
+
+// applyFailure - mark a version as the failed deployment, keeping what the events and metadata already tell of it
+func applyFailure(deployment *Deployment, failure *Deployment) {
+	deployment.Outcome = OutcomeFailed
+	if !failure.StartedAt.IsZero() {
+		deployment.StartedAt = failure.StartedAt
+	}
+	if !failure.FinishedAt.IsZero() {
+		deployment.FinishedAt = failure.FinishedAt
+	}
+	apply := func(field *string, value string) {
+		if *field == "" {
+			*field = value
+		}
+	}
+	apply(&deployment.Strategy, failure.Strategy)
+	apply(&deployment.Actor, failure.Actor)
+	apply(&deployment.GitSHA, failure.GitSHA)
+	apply(&deployment.Checksum, failure.Checksum)
+	apply(&deployment.PreviousVersion, failure.PreviousVersion)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,261 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/comcast/cf-zdd-plugin/commands"
+	"github.com/comcast/cf-zdd-plugin/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("zdd-history", func() {
+
+	Describe(".init", func() {
+		Context("when the package is imported", func() {
+			It("should then be registered with the command repo", func() {
+				_, ok := commands.GetRegistry()[commands.HistoryCmdName]
+				Expect(ok).Should(BeTrue())
+			})
+		})
+	})
+
+	Describe("with a valid arg and run method", func() {
+		var (
+			err            error
+			history        *commands.History
+			cfZddCmd       *commands.CfZddCmd
+			fakeConnection *fakes.FakeCliConnection
+			responses      map[string]string
+			output         *bytes.Buffer
+			deployments    []commands.Deployment
+		)
+
+		BeforeEach(func() {
+			fakeConnection = new(fakes.FakeCliConnection)
+			fakeConnection.GetCurrentSpaceReturns(plugin_models.Space{SpaceFields: plugin_models.SpaceFields{Guid: "space-guid"}}, nil)
+			responses = map[string]string{
+				"GET /v3/audit_events": `{"resources": [
+					{"created_at": "2019-01-01T10:00:00Z", "type": "audit.app.create", "actor": {"name": "alice"}, "target": {"guid": "guid-1", "name": "myapp-1.0.1"}},
+					{"created_at": "2019-01-01T10:05:00Z", "type": "audit.app.start", "actor": {"name": "alice"}, "target": {"guid": "guid-1", "name": "myapp-1.0.1"}},
+					{"created_at": "2019-01-02T10:00:00Z", "type": "audit.app.delete-request", "actor": {"name": "bob"}, "target": {"guid": "guid-1", "name": "myapp-1.0.1-venerable"}},
+					{"created_at": "2019-01-02T09:00:00Z", "type": "audit.app.create", "actor": {"name": "bob"}, "target": {"guid": "guid-2", "name": "myapp-1.0.2"}},
+					{"created_at": "2019-01-02T09:00:00Z", "type": "audit.app.create", "actor": {"name": "bob"}, "target": {"guid": "guid-9", "name": "otherapp"}}
+				]}`,
+				"GET /v3/apps": `{"resources": [
+					{"guid": "guid-2", "name": "myapp-1.0.2", "state": "STARTED", "created_at": "2019-01-02T09:00:00Z",
+					 "metadata": {"labels": {"zdd.comcast.com/base-name": "myapp", "zdd.comcast.com/outcome": "succeeded"},
+					  "annotations": {"zdd.comcast.com/strategy": "deploy-zdd", "zdd.comcast.com/deployer": "pipeline",
+					   "zdd.comcast.com/started-at": "2019-01-02T08:59:00Z", "zdd.comcast.com/finished-at": "2019-01-02T09:10:00Z"}}}
+				]}`,
+			}
+			fakeConnection.CliCommandWithoutTerminalOutputStub = curlResponder(responses)
+
+			output = new(bytes.Buffer)
+			commands.HistoryOutput = output
+			cfZddCmd = &commands.CfZddCmd{
+				CmdName:    commands.HistoryCmdName,
+				Arguments:  []string{"myapp"},
+				JSONOutput: true,
+				Conn:       fakeConnection,
+			}
+			history = new(commands.History)
+			history.SetArgs(cfZddCmd)
+		})
+
+		AfterEach(func() {
+			commands.HistoryOutput = os.Stdout
+		})
+
+		runHistory := func() {
+			err = history.Run()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(json.Unmarshal(output.Bytes(), &deployments)).Should(Succeed())
+		}
+
+		Context("when the audit events and deployment metadata are available", func() {
+			BeforeEach(runHistory)
+
+			It("should report the deployments of the family, most recent first", func() {
+				Expect(deployments).Should(HaveLen(2))
+				Expect(deployments[0].Version).Should(Equal("myapp-1.0.2"))
+				Expect(deployments[1].Version).Should(Equal("myapp-1.0.1"))
+			})
+			It("should take the strategy, times, outcome and actor from the deployment metadata", func() {
+				Expect(deployments[0].Strategy).Should(Equal(commands.ZddDeployCmdName))
+				Expect(deployments[0].Outcome).Should(Equal(commands.OutcomeSucceeded))
+				Expect(deployments[0].Actor).Should(Equal("pipeline"))
+				Expect(deployments[0].StartedAt.Format("15:04")).Should(Equal("08:59"))
+				Expect(deployments[0].FinishedAt.Format("15:04")).Should(Equal("09:10"))
+			})
+			It("should reconstruct deleted versions from the audit events", func() {
+				Expect(deployments[1].Deleted).Should(BeTrue())
+				Expect(deployments[1].Actor).Should(Equal("alice"))
+				Expect(deployments[1].FinishedAt.Format("15:04")).Should(Equal("10:05"))
+				Expect(deployments[1].Outcome).Should(BeEmpty())
+			})
+		})
+
+		// recordOnLiveVersion - the live version with the given deployments recorded in its annotation
+		recordOnLiveVersion := func(deployments string) {
+			value, _ := json.Marshal(deployments)
+			responses["GET /v3/apps"] = `{"resources": [
+				{"guid": "guid-2", "name": "myapp-1.0.2", "state": "STARTED", "created_at": "2019-01-02T09:00:00Z",
+				 "metadata": {"labels": {"zdd.comcast.com/base-name": "myapp", "zdd.comcast.com/outcome": "succeeded"},
+				  "annotations": {"zdd.comcast.com/strategy": "deploy-zdd", "zdd.comcast.com/deployer": "pipeline",
+				   "zdd.comcast.com/started-at": "2019-01-02T08:59:00Z", "zdd.comcast.com/finished-at": "2019-01-02T09:10:00Z",
+				   "zdd.comcast.com/deployments": ` + string(value) + `}}}
+			]}`
+		}
+
+		Context("when a deployment failed and its version was removed", func() {
+			BeforeEach(func() {
+				recordOnLiveVersion(`[{"version": "myapp-1.0.1", "guid": "guid-1", "strategy": "blue-green", "outcome": "failed", "actor": "pipeline"}]`)
+				runHistory()
+			})
+			It("should report the version as failed", func() {
+				Expect(deployments).Should(HaveLen(2))
+				Expect(deployments[1].Version).Should(Equal("myapp-1.0.1"))
+				Expect(deployments[1].Outcome).Should(Equal(commands.OutcomeFailed))
+				Expect(deployments[1].Strategy).Should(Equal(commands.BlueGreenCmdName))
+				Expect(deployments[1].Actor).Should(Equal("alice"))
+				Expect(deployments[1].Deleted).Should(BeTrue())
+			})
+		})
+
+		Context("when deployments onto a version with an outcome failed", func() {
+			BeforeEach(func() {
+				recordOnLiveVersion(`[
+					{"version": "myapp-1.0.2", "guid": "guid-2", "strategy": "deploy-rolling", "outcome": "failed", "started_at": "2019-01-03T09:00:00Z"},
+					{"version": "myapp-1.0.2", "guid": "guid-2", "strategy": "deploy-rolling", "outcome": "failed", "started_at": "2019-01-04T09:00:00Z"}]`)
+				runHistory()
+			})
+			It("should report each failure on its own and keep the version as it was", func() {
+				Expect(deployments).Should(HaveLen(4))
+				Expect(deployments[0].Version).Should(Equal("myapp-1.0.2"))
+				Expect(deployments[0].Outcome).Should(Equal(commands.OutcomeFailed))
+				Expect(deployments[0].StartedAt.Format("2006-01-02")).Should(Equal("2019-01-04"))
+				Expect(deployments[0].Deleted).Should(BeFalse())
+				Expect(deployments[1].Outcome).Should(Equal(commands.OutcomeFailed))
+				Expect(deployments[2].Outcome).Should(Equal(commands.OutcomeSucceeded))
+			})
+		})
+
+		Context("when new droplets were deployed to the live version", func() {
+			BeforeEach(func() {
+				recordOnLiveVersion(`[
+					{"version": "myapp-1.0.2", "guid": "guid-2", "droplet": "droplet-3", "strategy": "deploy-rolling", "outcome": "succeeded", "started_at": "2019-01-04T09:00:00Z"},
+					{"version": "myapp-1.0.2", "guid": "guid-2", "droplet": "droplet-2", "strategy": "deploy-zdd", "outcome": "succeeded", "actor": "pipeline", "started_at": "2019-01-02T08:59:00Z"}]`)
+				runHistory()
+			})
+			It("should report each deployment of the version", func() {
+				Expect(deployments).Should(HaveLen(3))
+				Expect(deployments[0].Droplet).Should(Equal("droplet-3"))
+				Expect(deployments[0].Strategy).Should(Equal(commands.RollingDeployCmdName))
+				Expect(deployments[1].Droplet).Should(Equal("droplet-2"))
+				Expect(deployments[1].Strategy).Should(Equal(commands.ZddDeployCmdName))
+				Expect(deployments[1].Version).Should(Equal("myapp-1.0.2"))
+				Expect(deployments[2].Version).Should(Equal("myapp-1.0.1"))
+			})
+		})
+
+		Context("when versions were deployed before they were labelled", func() {
+			BeforeEach(func() {
+				responses["GET /v3/apps?label_selector=%21"] = `{"resources": [
+					{"guid": "guid-0", "name": "myapp-1.0.0", "state": "STOPPED", "created_at": "2018-12-01T09:00:00Z", "metadata": {"labels": {}}},
+					{"guid": "guid-8", "name": "otherapp", "state": "STOPPED", "created_at": "2018-12-01T09:00:00Z", "metadata": {"labels": {}}}
+				]}`
+				runHistory()
+			})
+			It("should report the unlabelled versions of the family", func() {
+				Expect(deployments).Should(HaveLen(3))
+				Expect(deployments[2].Version).Should(Equal("myapp-1.0.0"))
+				Expect(deployments[2].Deleted).Should(BeFalse())
+			})
+		})
+
+		Context("when the audit events span several pages", func() {
+			BeforeEach(func() {
+				responses["GET /v3/audit_events"] = `{"pagination": {"next": {"href": "https://api.example.com/v3/audit_events?page=2&per_page=5000"}},
+					"resources": [
+					{"created_at": "2019-01-02T09:00:00Z", "type": "audit.app.create", "actor": {"name": "bob"}, "target": {"guid": "guid-2", "name": "myapp-1.0.2"}}
+				]}`
+				responses["GET /v3/audit_events?page=2"] = `{"pagination": {"next": null}, "resources": [
+					{"created_at": "2019-01-01T10:00:00Z", "type": "audit.app.create", "actor": {"name": "alice"}, "target": {"guid": "guid-1", "name": "myapp-1.0.1"}}
+				]}`
+				runHistory()
+			})
+			It("should read the events most recent first", func() {
+				Expect(curlRequests(fakeConnection)[0]).Should(ContainSubstring("order_by=-created_at"))
+			})
+			It("should follow the pages", func() {
+				Expect(curlRequests(fakeConnection)).Should(ContainElement("GET /v3/audit_events?page=2&per_page=5000"))
+				Expect(deployments).Should(HaveLen(2))
+				Expect(deployments[1].Version).Should(Equal("myapp-1.0.1"))
+			})
+		})
+
+		Context("when the foundation has no v3 audit events", func() {
+			BeforeEach(func() {
+				responses["GET /v3/audit_events"] = `{"errors": [{"code": 10000, "title": "CF-NotFound", "detail": "Unknown request"}]}`
+				responses["GET /v2/events"] = `{"resources": [
+					{"entity": {"type": "audit.app.create", "timestamp": "2019-01-01T10:00:00Z", "actor_name": "alice", "actee": "guid-1", "actee_name": "myapp-1.0.1"}}
+				]}`
+				runHistory()
+			})
+			It("should read the v2 events", func() {
+				Expect(curlRequests(fakeConnection)).Should(ContainElement(HavePrefix("GET /v2/events?q=space_guid%3Aspace-guid")))
+				Expect(deployments).Should(HaveLen(2))
+				Expect(deployments[1].Version).Should(Equal("myapp-1.0.1"))
+			})
+		})
+
+		Context("when the cloud controller answers the v3 audit events with a v2 error", func() {
+			BeforeEach(func() {
+				responses["GET /v3/audit_events"] = `{"code": 10000, "description": "Unknown request", "error_code": "CF-NotFound"}`
+				responses["GET /v2/events"] = `{"next_url": "/v2/events?page=2", "resources": [
+					{"entity": {"type": "audit.app.create", "timestamp": "2019-01-02T09:00:00Z", "actor_name": "bob", "actee": "guid-2", "actee_name": "myapp-1.0.2"}}
+				]}`
+				responses["GET /v2/events?page=2"] = `{"next_url": null, "resources": [
+					{"entity": {"type": "audit.app.create", "timestamp": "2019-01-01T10:00:00Z", "actor_name": "alice", "actee": "guid-1", "actee_name": "myapp-1.0.1"}},
+					{"entity": {"type": "audit.app.delete-request", "timestamp": "2019-01-02T10:00:00Z", "actor_name": "bob", "actee": "guid-1", "actee_name": "myapp-1.0.1-venerable"}}
+				]}`
+				runHistory()
+			})
+			It("should fall back to the pages of v2 events", func() {
+				Expect(curlRequests(fakeConnection)).Should(ContainElement("GET /v2/events?page=2"))
+				Expect(deployments).Should(HaveLen(2))
+				Expect(deployments[1].Version).Should(Equal("myapp-1.0.1"))
+				Expect(deployments[1].Actor).Should(Equal("alice"))
+				Expect(deployments[1].Deleted).Should(BeTrue())
+			})
+		})
+
+		Context("when called without a base name", func() {
+			It("should return an error", func() {
+				cfZddCmd.Arguments = nil
+				err = history.Run()
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+	})
+})
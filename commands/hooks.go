@@ -0,0 +1,182 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Deployment stages hooks run at
+const (
+	HookPrePush     = "pre-push"
+	HookPostPush    = "post-push"
+	HookPreCutover  = "pre-cutover"
+	HookPostCutover = "post-cutover"
+	HookOnFailure   = "on-failure"
+	HookOnRollback  = "on-rollback"
+)
+
+// Policies of a hook that fails
+const (
+	HookPolicyFail   = "fail"
+	HookPolicyIgnore = "ignore"
+)
+
+// DefaultHookTimeout - time a hook may take when it sets no timeout
+const DefaultHookTimeout = 5 * time.Minute
+
+var hookStages = []string{HookPrePush, HookPostPush, HookPreCutover, HookPostCutover, HookOnFailure, HookOnRollback}
+
+// errCommandTimeout - a local command still ran at its deadline and was killed
+var errCommandTimeout = errors.New("timed out")
+
+// HookConfig - the hooks of each stage, read from the -hooks file
+type HookConfig map[string][]Hook
+
+// Hook - a local command run with sh -c at a stage of the deployment. A hook with the fail policy that fails stops
+// the deployment, one with the ignore policy only has its failure printed.
+type Hook struct {
+	Name      string `yaml:"name"`
+	Command   string `yaml:"command"`
+	Timeout   string `yaml:"timeout,omitempty"`
+	OnFailure string `yaml:"on_failure,omitempty"`
+
+	timeout time.Duration
+}
+
+// LoadHooks - read and check a hooks file
+func LoadHooks(path string) (config HookConfig, err error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if err = yaml.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("unable to parse hooks %s: %s", path, err.Error())
+	}
+	for stage, hooks := range config {
+		if !knownStage(stage) {
+			return nil, fmt.Errorf("unknown hook stage %s in %s, expected one of %v", stage, path, hookStages)
+		}
+		for i := range hooks {
+			hook := &hooks[i]
+			if hook.Name == "" {
+				hook.Name = fmt.Sprintf("%s %d", stage, i+1)
+			}
+			if hook.Command == "" {
+				return nil, fmt.Errorf("hook %s of %s has no command", hook.Name, path)
+			}
+			switch hook.OnFailure {
+			case "":
+				hook.OnFailure = HookPolicyFail
+			case HookPolicyFail, HookPolicyIgnore:
+			default:
+				return nil, fmt.Errorf("hook %s of %s has on_failure %s, expected %s or %s", hook.Name, path, hook.OnFailure, HookPolicyFail, HookPolicyIgnore)
+			}
+			hook.timeout = DefaultHookTimeout
+			if hook.Timeout != "" {
+				if hook.timeout, err = time.ParseDuration(hook.Timeout); err != nil || hook.timeout <= 0 {
+					return nil, fmt.Errorf("hook %s of %s has an invalid timeout %s", hook.Name, path, hook.Timeout)
+				}
+			}
+		}
+	}
+	return
+}
+
+func knownStage(stage string) bool {
+	for _, known := range hookStages {
+		if stage == known {
+			return true
+		}
+	}
+	return false
+}
+
+// runHooks - run the hooks of a stage in order with the deployment in their environment. The first hook with the fail
+// policy that fails stops the stage and its error is returned.
+func runHooks(args *CfZddCmd, stage string, newApp string, oldApp string) error {
+	if args.HooksPath == "" {
+		return nil
+	}
+	config, err := LoadHooks(args.HooksPath)
+	if err != nil {
+		return err
+	}
+
+	for _, hook := range config[stage] {
+		fmt.Printf("Running %s hook %s: %s\n", stage, hook.Name, hook.Command)
+		env := []string{
+			"ZDD_HOOK_STAGE=" + stage,
+			"ZDD_HOOK_NAME=" + hook.Name,
+			"ZDD_COMMAND=" + args.CmdName,
+			"ZDD_APP=" + newApp,
+			"ZDD_OLD_APP=" + oldApp,
+			"ZDD_BASE_NAME=" + familyName(args, newApp),
+			"ZDD_GIT_SHA=" + gitSHA(args),
+		}
+		err = runLocalCommand(hook.Command, env, time.Now().Add(hook.timeout))
+		if err == nil {
+			continue
+		}
+		err = fmt.Errorf("%s hook %s failed: %s", stage, hook.Name, err.Error())
+		if hook.OnFailure == HookPolicyIgnore {
+			fmt.Printf("%s, ignoring it\n", err.Error())
+			continue
+		}
+		fmt.Println(err.Error())
+		return err
+	}
+	return nil
+}
+
+// runLocalCommand - run a command with sh -c and the extra environment, killing it along with the processes it started
+// when it still runs at the deadline
+func runLocalCommand(command string, env []string, deadline time.Time) error {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	startProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// Waiting on the shell alone, as processes it started may outlive it
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		if err := killProcessGroup(cmd); err != nil {
+			fmt.Printf("Unable to kill %s: %s\n", command, err.Error())
+		}
+		return errCommandTimeout
+	}
+}
@@ -0,0 +1,229 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/comcast/cf-zdd-plugin/commands"
+	"github.com/comcast/cf-zdd-plugin/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("hooks", func() {
+	var (
+		dir   string
+		hooks string
+		err   error
+	)
+
+	BeforeEach(func() {
+		dir, err = ioutil.TempDir("", "hooks")
+		Expect(err).ShouldNot(HaveOccurred())
+		hooks = filepath.Join(dir, "hooks.yml")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	writeHooks := func(content string) {
+		Expect(ioutil.WriteFile(hooks, []byte(content), 0644)).Should(Succeed())
+	}
+
+	Describe(".LoadHooks", func() {
+		It("should read the hooks of each stage with their defaults", func() {
+			config, err := commands.LoadHooks("../fixtures/hooks.yml")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(config[commands.HookPreCutover]).Should(HaveLen(1))
+			Expect(config[commands.HookPreCutover][0].Name).Should(Equal("migrate"))
+			Expect(config[commands.HookPreCutover][0].OnFailure).Should(Equal(commands.HookPolicyFail))
+			Expect(config[commands.HookPostPush][0].OnFailure).Should(Equal(commands.HookPolicyIgnore))
+			Expect(config[commands.HookPostCutover][0].Name).Should(Equal("post-cutover 1"))
+		})
+		It("should reject an unknown stage", func() {
+			writeHooks("pre-deploy:\n- command: true\n")
+			_, err = commands.LoadHooks(hooks)
+			Expect(err).Should(MatchError(ContainSubstring("unknown hook stage pre-deploy")))
+		})
+		It("should reject an unknown failure policy", func() {
+			writeHooks("pre-push:\n- command: true\n  on_failure: retry\n")
+			_, err = commands.LoadHooks(hooks)
+			Expect(err).Should(HaveOccurred())
+		})
+		It("should reject an invalid timeout", func() {
+			writeHooks("pre-push:\n- command: true\n  timeout: soon\n")
+			_, err = commands.LoadHooks(hooks)
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("a blue-green deployment with hooks", func() {
+		var (
+			log            string
+			cfZddCmd       *commands.CfZddCmd
+			fakeConnection *fakes.FakeCliConnection
+			fakeCommon     *fakes.FakeCommonCmd
+			bgDeploy       *commands.BlueGreenDeploy
+		)
+
+		// logHook - a hook appending its stage and the apps in its environment to the log
+		logHook := func(stage string) string {
+			return stage + ":\n- command: echo \"$ZDD_HOOK_STAGE $ZDD_APP $ZDD_OLD_APP $ZDD_BASE_NAME\" >> " + log + "\n"
+		}
+		logged := func() []string {
+			content, _ := ioutil.ReadFile(log)
+			return strings.Split(strings.TrimSpace(string(content)), "\n")
+		}
+
+		BeforeEach(func() {
+			log = filepath.Join(dir, "hooks.log")
+			commands.InstancePollInterval = 0
+			fakeConnection = new(fakes.FakeCliConnection)
+			fakeCommon = new(fakes.FakeCommonCmd)
+			fakeCommon.IsApplicationDeployedReturns("myapp-1", true)
+			table := newRouteTable(fakeConnection, fakeCommon, &plugin_models.GetAppModel{RunningInstances: 1, InstanceCount: 1})
+			table.routes["myapp-1-venerable"] = []plugin_models.GetApp_RouteSummary{
+				{Host: "myapp", Domain: plugin_models.GetApp_DomainFields{Name: "example.com"}},
+			}
+			cfZddCmd = &commands.CfZddCmd{
+				CmdName:     commands.BlueGreenCmdName,
+				NewApp:      "myapp-2",
+				BaseAppName: "myapp",
+				HooksPath:   hooks,
+				Conn:        fakeConnection,
+				Commands:    fakeCommon,
+			}
+			bgDeploy = new(commands.BlueGreenDeploy)
+			bgDeploy.SetArgs(cfZddCmd)
+		})
+
+		Context("when every hook passes", func() {
+			BeforeEach(func() {
+				writeHooks(logHook("post-cutover") + logHook("pre-push") + logHook("pre-cutover") + logHook("post-push") + logHook("on-failure"))
+				err = bgDeploy.Run()
+			})
+			It("should run the stages in order with the deployment in the environment", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(logged()).Should(Equal([]string{
+					"pre-push myapp-2 myapp-1 myapp",
+					"post-push myapp-2 myapp-1-venerable myapp",
+					"pre-cutover myapp-2 myapp-1-venerable myapp",
+					"post-cutover myapp-2 myapp-1-venerable myapp",
+				}))
+			})
+		})
+
+		Context("when a pre-cutover hook fails", func() {
+			BeforeEach(func() {
+				writeHooks("pre-cutover:\n- name: migrate\n  command: exit 1\n" + logHook("on-failure") + logHook("post-cutover"))
+				err = bgDeploy.Run()
+			})
+			It("should not flip the routes", func() {
+				Expect(err).Should(MatchError(ContainSubstring("pre-cutover hook migrate failed")))
+				Expect(fakeCommon.RemapRoutesCallCount()).Should(Equal(0))
+				Expect(fakeCommon.RemoveApplicationArgsForCall(0)).Should(Equal("myapp-2"))
+			})
+			It("should run the on-failure hooks", func() {
+				Expect(logged()).Should(Equal([]string{"on-failure myapp-2 myapp-1-venerable myapp"}))
+			})
+		})
+
+		Context("when the commit is only known from the CI environment", func() {
+			BeforeEach(func() {
+				os.Setenv("GIT_COMMIT", "abc123")
+				writeHooks("pre-push:\n- command: echo \"$ZDD_GIT_SHA\" >> " + log + "\n")
+				err = bgDeploy.Run()
+			})
+			AfterEach(func() {
+				os.Unsetenv("GIT_COMMIT")
+			})
+			It("should pass it to the hooks", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(logged()).Should(Equal([]string{"abc123"}))
+			})
+		})
+
+		Context("when the routes were not cut over", func() {
+			BeforeEach(func() {
+				fakeCommon.RemapRoutesReturns(nil)
+				fakeCommon.RemapRoutesStub = nil
+				writeHooks(logHook("on-failure") + logHook("post-cutover"))
+				err = bgDeploy.Run()
+			})
+			It("should run the on-failure hooks and record the failure", func() {
+				Expect(err).Should(MatchError(ContainSubstring("routes were not cut over")))
+				Expect(logged()).Should(Equal([]string{"on-failure myapp-2 myapp-1-venerable myapp"}))
+				Expect(fakeCommon.CaptureDiagnosticsCallCount()).Should(Equal(1))
+				Expect(fakeCommon.RecordFailureCallCount()).Should(Equal(1))
+			})
+		})
+
+		Context("when a failing hook is ignored", func() {
+			BeforeEach(func() {
+				writeHooks("pre-cutover:\n- command: exit 1\n  on_failure: ignore\n" + logHook("pre-cutover"))
+				err = bgDeploy.Run()
+			})
+			It("should run the next hooks and complete the deployment", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(logged()).Should(Equal([]string{"pre-cutover myapp-2 myapp-1-venerable myapp"}))
+				Expect(fakeCommon.RemapRoutesCallCount()).Should(Equal(1))
+			})
+		})
+
+		Context("when a hook runs past its timeout", func() {
+			BeforeEach(func() {
+				writeHooks("pre-push:\n- name: slow\n  command: exec sleep 5\n  timeout: 50ms\n")
+				err = bgDeploy.Run()
+			})
+			It("should fail before anything is pushed", func() {
+				Expect(err).Should(MatchError(ContainSubstring("pre-push hook slow failed: timed out")))
+				Expect(fakeCommon.RenameApplicationCallCount()).Should(Equal(0))
+				Expect(fakeCommon.PushApplicationCallCount()).Should(Equal(0))
+			})
+		})
+
+		Context("when a hook that started processes of its own runs past its timeout", func() {
+			var pidFile string
+
+			BeforeEach(func() {
+				pidFile = filepath.Join(dir, "sleep.pid")
+				writeHooks("pre-push:\n- name: slow\n  command: sleep 5 & echo $! > " + pidFile + "; wait\n  timeout: 200ms\n")
+				err = bgDeploy.Run()
+			})
+			It("should kill them along with the hook", func() {
+				Expect(err).Should(MatchError(ContainSubstring("timed out")))
+				pid, readErr := ioutil.ReadFile(pidFile)
+				Expect(readErr).ShouldNot(HaveOccurred())
+				// A killed process no longer runs, though it is left a zombie until its new parent reaps it
+				Eventually(func() string {
+					stat, _ := ioutil.ReadFile("/proc/" + strings.TrimSpace(string(pid)) + "/stat")
+					fields := strings.Fields(string(stat))
+					if len(fields) < 3 {
+						return "gone"
+					}
+					return fields[2]
+				}).Should(Or(Equal("gone"), Equal("Z")))
+			})
+		})
+	})
+})
@@ -0,0 +1,131 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands
+
+import (
+	"fmt"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+)
+
+// Decisions taken on the apps an earlier deployment left in the way of the next one
+const (
+	LeftoverReuse   = "reuse"
+	LeftoverReplace = "replace"
+	LeftoverAbort   = "abort"
+)
+
+// Leftover - an app left behind by an earlier deployment, what is done with it and why
+type Leftover struct {
+	Name     string
+	Decision string
+	Reason   string
+}
+
+// LeftoverError - returned when a leftover can be neither reused nor replaced safely
+type LeftoverError struct {
+	Leftover Leftover
+}
+
+func (e *LeftoverError) Error() string {
+	return fmt.Sprintf("%s %s, not deploying over it; check it with %s", e.Leftover.Name, e.Leftover.Reason, StatusCmdName)
+}
+
+// handleLeftovers - look for apps of the family holding the name the new version is pushed under or the name the live
+// version is moved aside to, and reuse, replace or abort on each. Apps serving the live routes are never replaced.
+// An empty venerable name skips the check of the venerable name, as when the live version keeps its name.
+func handleLeftovers(args *CfZddCmd, baseName string, live string, venerable string, reuseNew bool) error {
+	apps, err := args.Commands.ListApplications(baseName)
+	if err != nil {
+		return err
+	}
+
+	for _, app := range apps {
+		var leftover Leftover
+		switch {
+		case app.Name == live:
+			continue
+		case app.Name == args.NewApp:
+			leftover = newVersionLeftover(app, reuseNew)
+		case venerable != "" && app.Name == venerable:
+			leftover = venerableLeftover(app)
+		default:
+			continue
+		}
+
+		fmt.Printf("Found %s left by an earlier deployment, %s: %s\n", leftover.Name, leftover.Decision, leftover.Reason)
+		switch leftover.Decision {
+		case LeftoverAbort:
+			return &LeftoverError{Leftover: leftover}
+		case LeftoverReplace:
+			if app.Name == venerable && isRetained(app) {
+				clearVenerableName(args, venerable)
+			} else if err = args.Commands.RemoveApplication(app.Name); err != nil {
+				return fmt.Errorf("unable to remove %s: %s", app.Name, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// newVersionLeftover - an app already holding the name of the new version is replaced, or reused when the push
+// updates it in place, unless it serves the live routes
+func newVersionLeftover(app plugin_models.GetAppsModel, reuse bool) Leftover {
+	switch {
+	case servesLiveRoutes(app):
+		return Leftover{Name: app.Name, Decision: LeftoverAbort,
+			Reason: "already serves the live routes, a deployment may still be in progress"}
+	case reuse:
+		return Leftover{Name: app.Name, Decision: LeftoverReuse,
+			Reason: "it only serves canary routes and is updated in place"}
+	}
+	return Leftover{Name: app.Name, Decision: LeftoverReplace,
+		Reason: "it does not serve the live routes and is removed before the new version is pushed"}
+}
+
+// venerableLeftover - an app already holding the name the live version is renamed to is a version retained for a
+// rollback, or the old version of a deployment that failed part way
+func venerableLeftover(app plugin_models.GetAppsModel) Leftover {
+	switch {
+	case servesLiveRoutes(app):
+		return Leftover{Name: app.Name, Decision: LeftoverAbort,
+			Reason: "still serves the live routes, a deployment may still be in progress"}
+	case isRetained(app):
+		return Leftover{Name: app.Name, Decision: LeftoverReplace,
+			Reason: "it was retained for a rollback and makes room for the live version"}
+	}
+	return Leftover{Name: app.Name, Decision: LeftoverReplace,
+		Reason: "it was left running without live routes and is removed"}
+}
+
+// servesLiveRoutes - true when the app is started and mapped to a route other than a canary route
+func servesLiveRoutes(app plugin_models.GetAppsModel) bool {
+	if app.State != "started" {
+		return false
+	}
+	for _, route := range app.Routes {
+		if !isCanaryRoute(route.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRetained - versions retained for a rollback are stopped and unrouted
+func isRetained(app plugin_models.GetAppsModel) bool {
+	return app.State == "stopped" && len(app.Routes) == 0
+}
@@ -0,0 +1,170 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands_test
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/comcast/cf-zdd-plugin/commands"
+	"github.com/comcast/cf-zdd-plugin/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("leftovers of earlier deployments", func() {
+	var (
+		err            error
+		fakeConnection *fakes.FakeCliConnection
+		fakeCommands   *fakes.FakeCommonCmd
+		fakeScaleover  *fakes.FakeScaleoverCommand
+		cfZddCmd       *commands.CfZddCmd
+		liveRoutes     = []plugin_models.GetAppsRouteSummary{{Host: "myapp"}}
+		canaryRoutes   = []plugin_models.GetAppsRouteSummary{{Host: "myapp-1-0-3-canary"}}
+	)
+
+	BeforeEach(func() {
+		commands.InstancePollInterval = 0
+		fakeConnection = new(fakes.FakeCliConnection)
+		fakeCommands = new(fakes.FakeCommonCmd)
+		fakeScaleover = new(fakes.FakeScaleoverCommand)
+		cfZddCmd = &commands.CfZddCmd{
+			NewApp:      "myapp-1.0.3",
+			BaseAppName: "myapp",
+			Conn:        fakeConnection,
+			Commands:    fakeCommands,
+		}
+	})
+
+	AfterEach(func() {
+		commands.InstancePollInterval = 20 * time.Second
+	})
+
+	Describe("deploy-zdd", func() {
+		var zddDeploy *commands.ZddDeploy
+
+		BeforeEach(func() {
+			cfZddCmd.CmdName = commands.ZddDeployCmdName
+			zddDeploy = new(commands.ZddDeploy)
+			zddDeploy.SetArgs(cfZddCmd)
+			zddDeploy.ScalerOverCmd = fakeScaleover
+		})
+
+		Context("when a failed deployment left the new version behind", func() {
+			BeforeEach(func() {
+				fakeCommands.IsApplicationDeployedReturns("myapp-1.0.2", true)
+				fakeCommands.ListApplicationsReturns([]plugin_models.GetAppsModel{
+					{Name: "myapp-1.0.2", State: "started", Routes: liveRoutes},
+					{Name: "myapp-1.0.3", State: "started"},
+				}, nil)
+				err = zddDeploy.Run()
+			})
+			It("should replace it", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(fakeCommands.RemoveApplicationArgsForCall(0)).Should(Equal("myapp-1.0.3"))
+				Expect(fakeCommands.PushApplicationCallCount()).Should(Equal(1))
+				Expect(fakeScaleover.DoScaleoverCallCount()).Should(Equal(1))
+			})
+		})
+
+		Context("when the venerable name is held by a version serving the live routes", func() {
+			BeforeEach(func() {
+				cfZddCmd.NewApp = "myapp-1.0.2"
+				fakeCommands.IsApplicationDeployedReturns("myapp-1.0.2", true)
+				fakeCommands.ListApplicationsReturns([]plugin_models.GetAppsModel{
+					{Name: "myapp-1.0.2", State: "started", Routes: liveRoutes},
+					{Name: "myapp-1.0.2-venerable", State: "started", Routes: liveRoutes},
+				}, nil)
+				err = zddDeploy.Run()
+			})
+			It("should abort without changing anything", func() {
+				Expect(err).Should(BeAssignableToTypeOf(&commands.LeftoverError{}))
+				Expect(err.Error()).Should(ContainSubstring("myapp-1.0.2-venerable"))
+				Expect(fakeCommands.RemoveApplicationCallCount()).Should(Equal(0))
+				Expect(fakeCommands.RenameApplicationCallCount()).Should(Equal(0))
+				Expect(fakeCommands.PushApplicationCallCount()).Should(Equal(0))
+			})
+		})
+	})
+
+	Describe("blue-green", func() {
+		var blueGreen *commands.BlueGreenDeploy
+
+		BeforeEach(func() {
+			cfZddCmd.CmdName = commands.BlueGreenCmdName
+			blueGreen = new(commands.BlueGreenDeploy)
+			blueGreen.SetArgs(cfZddCmd)
+			fakeConnection.GetAppReturns(plugin_models.GetAppModel{InstanceCount: 1, RunningInstances: 1}, nil)
+		})
+
+		Context("when a failed deployment left the venerable version running without routes", func() {
+			BeforeEach(func() {
+				fakeCommands.IsApplicationDeployedReturns("myapp-1.0.2", true)
+				fakeCommands.ListApplicationsReturns([]plugin_models.GetAppsModel{
+					{Name: "myapp-1.0.2", State: "started", Routes: liveRoutes},
+					{Name: "myapp-1.0.2-venerable", State: "started"},
+				}, nil)
+				err = blueGreen.Run()
+			})
+			It("should remove it before renaming the live version", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(fakeCommands.RemoveApplicationArgsForCall(0)).Should(Equal("myapp-1.0.2-venerable"))
+				from, to := fakeCommands.RenameApplicationArgsForCall(0)
+				Expect(from).Should(Equal("myapp-1.0.2"))
+				Expect(to).Should(Equal("myapp-1.0.2-venerable"))
+			})
+		})
+	})
+
+	Describe("deploy-canary", func() {
+		var canaryDeploy *commands.CanaryDeploy
+
+		BeforeEach(func() {
+			cfZddCmd.CmdName = commands.CanaryDeployCmdName
+			canaryDeploy = new(commands.CanaryDeploy)
+			canaryDeploy.SetArgs(cfZddCmd)
+		})
+
+		Context("when the canary of an earlier run is still deployed", func() {
+			BeforeEach(func() {
+				fakeCommands.ListApplicationsReturns([]plugin_models.GetAppsModel{
+					{Name: "myapp-1.0.2", State: "started", Routes: liveRoutes},
+					{Name: "myapp-1.0.3", State: "started", Routes: canaryRoutes},
+				}, nil)
+				err = canaryDeploy.Run()
+			})
+			It("should push over it", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(fakeCommands.RemoveApplicationCallCount()).Should(Equal(0))
+				Expect(fakeCommands.PushApplicationCallCount()).Should(Equal(1))
+			})
+		})
+
+		Context("when the canary name is that of the live version", func() {
+			BeforeEach(func() {
+				fakeCommands.ListApplicationsReturns([]plugin_models.GetAppsModel{
+					{Name: "myapp-1.0.3", State: "started", Routes: liveRoutes},
+				}, nil)
+				err = canaryDeploy.Run()
+			})
+			It("should abort rather than scale the live version down to a canary", func() {
+				Expect(err).Should(BeAssignableToTypeOf(&commands.LeftoverError{}))
+				Expect(fakeCommands.PushApplicationCallCount()).Should(Equal(0))
+			})
+		})
+	})
+})
@@ -0,0 +1,341 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// DefaultLockTTL - time after which a deployment lock that was not released is considered stale
+const DefaultLockTTL = 30 * time.Minute
+
+// DeploymentLock - holder of the deployment lock of an application family
+type DeploymentLock struct {
+	Owner      string    `json:"owner"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Expired - true once the lock outlived its time to live
+func (l *DeploymentLock) Expired() bool {
+	return time.Now().After(l.ExpiresAt)
+}
+
+// LockedError - returned when another deployment holds the lock
+type LockedError struct {
+	BaseName string
+	Lock     *DeploymentLock
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%s is being deployed by %s since %s, the lock expires at %s, use %s to remove a stale lock",
+		e.BaseName, e.Lock.Owner, e.Lock.AcquiredAt.Format(time.RFC3339), e.Lock.ExpiresAt.Format(time.RFC3339), UnlockCmdName)
+}
+
+// LockUnavailableError - returned when the foundation cannot hold deployment locks, as when its cloud controller
+// predates the v3 api or the user may not create the marker app. Deployments then run without the lock.
+type LockUnavailableError struct {
+	BaseName string
+	Err      error
+}
+
+func (e *LockUnavailableError) Error() string {
+	return fmt.Sprintf("unable to lock %s: %s", e.BaseName, e.Err.Error())
+}
+
+// Deployment locks are marker apps of the space, one per application family. The cloud controller refuses a second app
+// of the same name in a space, so of two deployments creating the marker at once only one succeeds, and creating apps
+// only takes the space developer role deployments need anyway. The marker is never started and has no package.
+const (
+	LockAppPrefix  = "zdd-lock-"
+	LockLabel      = "zdd.comcast.com/lock"
+	LockAnnotation = "zdd.comcast.com/lock"
+)
+
+// LockPollInterval - time between checks on an expired lock being removed before it is taken over
+var LockPollInterval = time.Second
+
+// lockRemovalTimeout - time the cloud controller may take to remove the marker of an expired lock
+const lockRemovalTimeout = time.Minute
+
+// lockAppName - name of the marker app locking an application family
+func lockAppName(baseName string) string {
+	return LockAppPrefix + baseName
+}
+
+// lockOwner - the user, host and process holding a lock
+func (c *commonCmd) lockOwner() string {
+	user, _ := c.cli.Username()
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s@%s pid %d", user, host, os.Getpid())
+}
+
+// lockApp - the marker app locking an application family and the lock it records, nil when it is not locked. A marker
+// without a readable lock is held until the default time to live after it was created.
+func (c *commonCmd) lockApp(baseName string) (app *ccApp, lock *DeploymentLock, err error) {
+	if app, err = appByName(c.cli, lockAppName(baseName)); err != nil || app == nil {
+		return
+	}
+	lock = new(DeploymentLock)
+	if json.Unmarshal([]byte(app.Metadata.Annotations[LockAnnotation]), lock) != nil || lock.ExpiresAt.IsZero() {
+		lock = &DeploymentLock{Owner: "unknown", AcquiredAt: app.CreatedAt, ExpiresAt: app.CreatedAt.Add(DefaultLockTTL)}
+	}
+	return
+}
+
+// GetDeploymentLock - the lock held on an application family, nil when it is not locked
+func (c *commonCmd) GetDeploymentLock(baseName string) (lock *DeploymentLock, err error) {
+	_, lock, err = c.lockApp(baseName)
+	return
+}
+
+// AcquireDeploymentLock - lock an application family for the time to live by creating its marker app, taking over
+// expired locks. Acquired is false when this process already holds the lock. A deployment that loses the race to
+// create the marker finds the lock of the winner.
+func (c *commonCmd) AcquireDeploymentLock(baseName string, ttl time.Duration) (acquired bool, err error) {
+	owner := c.lockOwner()
+
+	for attempt := 0; attempt < 2; attempt++ {
+		app, lock, readErr := c.lockApp(baseName)
+		if readErr != nil {
+			return false, lockError(baseName, readErr)
+		}
+		if app != nil {
+			switch {
+			case lock.Owner == owner:
+				return false, nil
+			case !lock.Expired() || attempt > 0:
+				return false, &LockedError{BaseName: baseName, Lock: lock}
+			}
+			fmt.Printf("Taking over expired deployment lock of %s held by %s\n", baseName, lock.Owner)
+			if err = c.removeLockApp(app.GUID); err != nil {
+				return
+			}
+		}
+
+		now := time.Now().UTC()
+		lock = &DeploymentLock{Owner: owner, AcquiredAt: now, ExpiresAt: now.Add(ttl)}
+		if err = c.createLockApp(baseName, lock); err == nil {
+			fmt.Printf("Acquired deployment lock of %s until %s\n", baseName, lock.ExpiresAt.Format(time.RFC3339))
+			return true, nil
+		}
+	}
+	return false, lockError(baseName, err)
+}
+
+// lockError - foundations whose cloud controller predates the v3 api, or that do not let the user create the marker,
+// cannot hold the lock
+func lockError(baseName string, err error) error {
+	if ccErrors, ok := err.(*CCErrors); ok && (ccErrors.HasTitle("CF-NotFound") || ccErrors.HasTitle("CF-NotAuthorized")) {
+		return &LockUnavailableError{BaseName: baseName, Err: err}
+	}
+	return err
+}
+
+// createLockApp - create the marker app of a family recording the lock, failing when it already exists
+func (c *commonCmd) createLockApp(baseName string, lock *DeploymentLock) (err error) {
+	space, err := c.cli.GetCurrentSpace()
+	if err != nil {
+		return
+	}
+	value, err := json.Marshal(lock)
+	if err != nil {
+		return
+	}
+	body := map[string]interface{}{
+		"name": lockAppName(baseName),
+		"relationships": map[string]interface{}{
+			"space": map[string]interface{}{"data": map[string]string{"guid": space.Guid}},
+		},
+		"metadata": map[string]interface{}{
+			"labels":      map[string]string{LockLabel: labelValue(baseName)},
+			"annotations": map[string]string{LockAnnotation: string(value)},
+		},
+	}
+	return CCCurl(c.cli, "POST", "/v3/apps", body, nil)
+}
+
+// removeLockApp - delete the marker app of an expired lock and wait until its name is free again. Deleting by guid
+// never removes the marker another deployment created meanwhile.
+func (c *commonCmd) removeLockApp(appGUID string) (err error) {
+	err = CCCurl(c.cli, "DELETE", "/v3/apps/"+appGUID, nil, nil)
+	for deadline := time.Now().Add(lockRemovalTimeout); ; time.Sleep(LockPollInterval) {
+		if ccErrors, ok := err.(*CCErrors); ok && ccErrors.HasTitle("CF-ResourceNotFound") {
+			return nil
+		}
+		if err != nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("expired deployment lock %s was not removed within %s", appGUID, lockRemovalTimeout)
+		}
+		err = CCCurl(c.cli, "GET", "/v3/apps/"+appGUID, nil, nil)
+	}
+}
+
+// setLock - record the lock on its marker app
+func (c *commonCmd) setLock(appGUID string, lock *DeploymentLock) error {
+	value, err := json.Marshal(lock)
+	if err != nil {
+		return err
+	}
+	return setAppMetadata(c.cli, appGUID, nil, map[string]interface{}{LockAnnotation: string(value)})
+}
+
+// ExtendDeploymentLock - push the expiry of a lock held by this process to the time to live from now. An error is
+// returned when the lock was taken over or removed.
+func (c *commonCmd) ExtendDeploymentLock(baseName string, ttl time.Duration) (expiresAt time.Time, err error) {
+	app, lock, err := c.lockApp(baseName)
+	if err != nil {
+		return
+	}
+	if app == nil {
+		return expiresAt, fmt.Errorf("deployment lock of %s was removed", baseName)
+	}
+	if lock.Owner != c.lockOwner() {
+		return expiresAt, &LockedError{BaseName: baseName, Lock: lock}
+	}
+	lock.ExpiresAt = time.Now().UTC().Add(ttl)
+	if err = c.setLock(app.GUID, lock); err != nil {
+		return
+	}
+	return lock.ExpiresAt, nil
+}
+
+// ReleaseDeploymentLock - remove the lock of an application family if held by this process, or whoever holds it when
+// forced. The lock is marked expired before its marker is deleted, so a deployment finding the marker while the
+// cloud controller still deletes it takes the lock over rather than failing.
+func (c *commonCmd) ReleaseDeploymentLock(baseName string, force bool) (err error) {
+	app, lock, err := c.lockApp(baseName)
+	if err != nil || app == nil {
+		return
+	}
+	if !force && lock.Owner != c.lockOwner() {
+		return fmt.Errorf("deployment lock of %s is held by %s", baseName, lock.Owner)
+	}
+	lock.ExpiresAt = time.Now().UTC()
+	if err = c.setLock(app.GUID, lock); err != nil {
+		return
+	}
+	return CCCurl(c.cli, "DELETE", "/v3/apps/"+app.GUID, nil, nil)
+}
+
+// withDeploymentLock - run a deployment step holding the lock of the application family, releasing it afterwards.
+// Steps working on the whole space run without a lock, as do deployments to foundations that cannot hold one.
+func withDeploymentLock(args *CfZddCmd, baseName string, step func() error) (err error) {
+	if baseName == "" {
+		return step()
+	}
+	ttl := args.LockTTL
+	if ttl <= 0 {
+		ttl = DefaultLockTTL
+	}
+	acquired, err := args.Commands.AcquireDeploymentLock(baseName, ttl)
+	if unavailable, ok := err.(*LockUnavailableError); ok {
+		fmt.Printf("Deploying without a lock, %s\n", unavailable.Error())
+		return step()
+	}
+	if err != nil {
+		return
+	}
+	if acquired {
+		args.LockedFamily, args.LockExpiresAt = baseName, time.Now().Add(ttl)
+		defer func() {
+			args.LockedFamily = ""
+			if releaseErr := args.Commands.ReleaseDeploymentLock(baseName, false); releaseErr != nil {
+				fmt.Printf("Unable to release deployment lock of %s: %s\n", baseName, releaseErr.Error())
+			}
+		}()
+	}
+	return step()
+}
+
+// extendDeploymentLock - renew the lock held by this process once half of its time to live passed, so that steps
+// running longer than the time to live keep other deployments of the family out
+func extendDeploymentLock(args *CfZddCmd) (err error) {
+	if args.LockedFamily == "" {
+		return nil
+	}
+	ttl := args.LockTTL
+	if ttl <= 0 {
+		ttl = DefaultLockTTL
+	}
+	if time.Until(args.LockExpiresAt) > ttl/2 {
+		return nil
+	}
+	expiresAt, err := args.Commands.ExtendDeploymentLock(args.LockedFamily, ttl)
+	if err != nil {
+		return fmt.Errorf("unable to extend the deployment lock of %s: %s", args.LockedFamily, err.Error())
+	}
+	args.LockExpiresAt = expiresAt
+	return nil
+}
+
+// familyName - the base name of the application family a command works on
+func familyName(args *CfZddCmd, appName string) string {
+	if args.BaseAppName != "" {
+		return args.BaseAppName
+	}
+	return appName
+}
+
+// lockFamily - the family a deployment lock is taken on, so that every command working on a family takes the same
+// lock whichever of its versions it was given: the base name when one is given, otherwise the base name label of the
+// first of the applications that has one, or of the live version found by its name, and the name itself at last
+func lockFamily(args *CfZddCmd, appNames ...string) string {
+	if args.BaseAppName != "" {
+		return args.BaseAppName
+	}
+	for _, appName := range appNames {
+		if appName == "" {
+			continue
+		}
+		if label := baseNameLabel(args, appName); label != "" {
+			return label
+		}
+		if live, deployed := args.Commands.IsApplicationDeployed(appName); deployed && live != appName {
+			if label := baseNameLabel(args, live); label != "" {
+				return label
+			}
+		}
+	}
+	for _, appName := range appNames {
+		if appName != "" {
+			return appName
+		}
+	}
+	return ""
+}
+
+// baseNameLabel - the base name label of an application, empty when it has none or it cannot be read
+func baseNameLabel(args *CfZddCmd, appName string) string {
+	if appName == "" {
+		return ""
+	}
+	app, err := args.Conn.GetApp(appName)
+	if err != nil || app.Guid == "" {
+		return ""
+	}
+	resource, err := appMetadata(args.Conn, app.Guid)
+	if err != nil {
+		return ""
+	}
+	return resource.Metadata.Labels[BaseNameLabel]
+}
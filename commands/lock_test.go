@@ -0,0 +1,394 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/comcast/cf-zdd-plugin/commands"
+	"github.com/comcast/cf-zdd-plugin/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// spaceApp - an app of the fake space served by spaceApps
+type spaceApp struct {
+	GUID      string    `json:"guid"`
+	Name      string    `json:"name"`
+	State     string    `json:"state"`
+	CreatedAt time.Time `json:"created_at"`
+	Metadata  struct {
+		Labels      map[string]string `json:"labels"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+}
+
+// spaceApps - the v3 apps of a space served through 'cf curl': created with unique names, listed by name or label,
+// read, patched and deleted as the cloud controller does. Other requests get an empty response.
+type spaceApps struct {
+	apps    map[string]*spaceApp
+	created int
+}
+
+func newSpaceApps() *spaceApps {
+	return &spaceApps{apps: map[string]*spaceApp{}}
+}
+
+// add - an app of the space with the given guid and annotations
+func (s *spaceApps) add(guid string, name string, annotations map[string]string) *spaceApp {
+	app := &spaceApp{GUID: guid, Name: name, State: "STOPPED", CreatedAt: time.Now()}
+	app.Metadata.Labels = map[string]string{}
+	app.Metadata.Annotations = map[string]string{}
+	for key, value := range annotations {
+		app.Metadata.Annotations[key] = value
+	}
+	s.apps[guid] = app
+	return app
+}
+
+func (s *spaceApps) byName(name string) *spaceApp {
+	for _, app := range s.apps {
+		if app.Name == name {
+			return app
+		}
+	}
+	return nil
+}
+
+func (s *spaceApps) respond(args ...string) ([]string, error) {
+	if len(args) < 4 || args[0] != "curl" || !strings.HasPrefix(args[1], "/v3/apps") {
+		return []string{}, nil
+	}
+	path, method := args[1], args[3]
+	notFound := []string{`{"errors": [{"code": 10010, "title": "CF-ResourceNotFound", "detail": "App not found"}]}`}
+	reply := func(value interface{}) ([]string, error) {
+		response, err := json.Marshal(value)
+		return []string{string(response)}, err
+	}
+
+	switch {
+	case method == "POST" && path == "/v3/apps":
+		body := new(spaceApp)
+		if err := json.Unmarshal([]byte(args[5]), body); err != nil {
+			return nil, err
+		}
+		if s.byName(body.Name) != nil {
+			return []string{`{"errors": [{"code": 10016, "title": "CF-UniquenessError", "detail": "App with the name '` + body.Name + `' already exists."}]}`}, nil
+		}
+		s.created++
+		app := s.add(fmt.Sprintf("created-guid-%d", s.created), body.Name, body.Metadata.Annotations)
+		for key, value := range body.Metadata.Labels {
+			app.Metadata.Labels[key] = value
+		}
+		return reply(app)
+	case method == "GET" && strings.HasPrefix(path, "/v3/apps?"):
+		query, _ := url.ParseQuery(strings.SplitN(path, "?", 2)[1])
+		resources := []*spaceApp{}
+		for _, app := range s.apps {
+			if names := query.Get("names"); names != "" && names != app.Name {
+				continue
+			}
+			if selector := query.Get("label_selector"); selector != "" {
+				pair := strings.SplitN(selector, "=", 2)
+				if value, found := app.Metadata.Labels[pair[0]]; !found || (len(pair) == 2 && value != pair[1]) {
+					continue
+				}
+			}
+			resources = append(resources, app)
+		}
+		return reply(map[string]interface{}{"resources": resources})
+	}
+
+	app := s.apps[strings.TrimPrefix(path, "/v3/apps/")]
+	if app == nil {
+		return notFound, nil
+	}
+	switch method {
+	case "PATCH":
+		body := new(struct {
+			Metadata struct {
+				Labels      map[string]*string `json:"labels"`
+				Annotations map[string]*string `json:"annotations"`
+			} `json:"metadata"`
+		})
+		if err := json.Unmarshal([]byte(args[5]), body); err != nil {
+			return nil, err
+		}
+		apply := func(values map[string]string, changes map[string]*string) {
+			for key, value := range changes {
+				if value == nil {
+					delete(values, key)
+				} else {
+					values[key] = *value
+				}
+			}
+		}
+		apply(app.Metadata.Labels, body.Metadata.Labels)
+		apply(app.Metadata.Annotations, body.Metadata.Annotations)
+	case "DELETE":
+		delete(s.apps, app.GUID)
+		return []string{}, nil
+	}
+	return reply(app)
+}
+
+var _ = Describe("deployment lock", func() {
+	var (
+		fakeConnection *fakes.FakeCliConnection
+		cmd            commands.CommonCmd
+		apps           *spaceApps
+		acquired       bool
+		err            error
+	)
+
+	BeforeEach(func() {
+		commands.LockPollInterval = 0
+		fakeConnection = new(fakes.FakeCliConnection)
+		fakeConnection.GetCurrentSpaceReturns(plugin_models.Space{SpaceFields: plugin_models.SpaceFields{Guid: "space-guid"}}, nil)
+		fakeConnection.UsernameReturns("deployer", nil)
+		apps = newSpaceApps()
+		fakeConnection.CliCommandWithoutTerminalOutputStub = apps.respond
+		cmd = commands.NewCommonCmd(fakeConnection)
+	})
+
+	holdLock := func(owner string, expiresAt time.Time) {
+		lock, _ := json.Marshal(commands.DeploymentLock{Owner: owner, AcquiredAt: time.Now(), ExpiresAt: expiresAt})
+		apps.add("held-guid", "zdd-lock-myapp", map[string]string{commands.LockAnnotation: string(lock)})
+	}
+
+	Describe(".AcquireDeploymentLock", func() {
+		Context("when the application is not locked", func() {
+			BeforeEach(func() {
+				acquired, err = cmd.AcquireDeploymentLock("myapp", time.Hour)
+			})
+			It("should create the marker app of the family recording the lock", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(acquired).Should(BeTrue())
+				Expect(apps.byName("zdd-lock-myapp")).ShouldNot(BeNil())
+				Expect(apps.byName("zdd-lock-myapp").Metadata.Labels[commands.LockLabel]).Should(Equal("myapp"))
+				lock, lockErr := cmd.GetDeploymentLock("myapp")
+				Expect(lockErr).ShouldNot(HaveOccurred())
+				Expect(lock.Owner).Should(HavePrefix("deployer@"))
+				Expect(lock.ExpiresAt).Should(BeTemporally("~", time.Now().Add(time.Hour), time.Minute))
+			})
+			It("should not acquire it again for the same owner", func() {
+				acquired, err = cmd.AcquireDeploymentLock("myapp", time.Hour)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(acquired).Should(BeFalse())
+			})
+		})
+
+		Context("when another deployment holds the lock", func() {
+			BeforeEach(func() {
+				holdLock("pipeline@build-7 pid 42", time.Now().Add(time.Hour))
+				acquired, err = cmd.AcquireDeploymentLock("myapp", time.Hour)
+			})
+			It("should return an error naming the holder", func() {
+				Expect(acquired).Should(BeFalse())
+				Expect(err).Should(BeAssignableToTypeOf(&commands.LockedError{}))
+				Expect(err.Error()).Should(ContainSubstring("pipeline@build-7 pid 42"))
+			})
+		})
+
+		Context("when another deployment creates the marker first", func() {
+			BeforeEach(func() {
+				// The lock reads as free, the other deployment creates the marker before this one does
+				reads := 0
+				fakeConnection.CliCommandWithoutTerminalOutputStub = func(args ...string) ([]string, error) {
+					if args[3] == "GET" && strings.HasPrefix(args[1], "/v3/apps?names=") {
+						if reads++; reads == 1 {
+							defer holdLock("pipeline@build-7 pid 42", time.Now().Add(time.Hour))
+							return []string{`{"resources": []}`}, nil
+						}
+					}
+					return apps.respond(args...)
+				}
+				acquired, err = cmd.AcquireDeploymentLock("myapp", time.Hour)
+			})
+			It("should lose the race and name the winner", func() {
+				Expect(acquired).Should(BeFalse())
+				Expect(err).Should(BeAssignableToTypeOf(&commands.LockedError{}))
+				Expect(err.Error()).Should(ContainSubstring("pipeline@build-7 pid 42"))
+				Expect(apps.apps).Should(HaveLen(1))
+			})
+		})
+
+		Context("when the lock of another deployment expired", func() {
+			BeforeEach(func() {
+				holdLock("pipeline@build-7 pid 42", time.Now().Add(-time.Minute))
+				acquired, err = cmd.AcquireDeploymentLock("myapp", time.Hour)
+			})
+			It("should remove the expired marker and take the lock over", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(acquired).Should(BeTrue())
+				Expect(apps.apps).ShouldNot(HaveKey("held-guid"))
+				Expect(curlRequests(fakeConnection)).Should(ContainElement("DELETE /v3/apps/held-guid"))
+			})
+		})
+
+		Context("when the user may not create the marker", func() {
+			BeforeEach(func() {
+				fakeConnection.CliCommandWithoutTerminalOutputStub = curlResponder(map[string]string{
+					"GET /v3/apps":  `{"resources": []}`,
+					"POST /v3/apps": `{"errors": [{"code": 10003, "title": "CF-NotAuthorized", "detail": "You are not authorized to perform the requested action"}]}`,
+				})
+				acquired, err = cmd.AcquireDeploymentLock("myapp", time.Hour)
+			})
+			It("should report the lock unavailable", func() {
+				Expect(acquired).Should(BeFalse())
+				Expect(err).Should(BeAssignableToTypeOf(&commands.LockUnavailableError{}))
+			})
+		})
+	})
+
+	Describe(".ReleaseDeploymentLock", func() {
+		BeforeEach(func() {
+			holdLock("pipeline@build-7 pid 42", time.Now().Add(time.Hour))
+		})
+		It("should not release a lock held by another deployment", func() {
+			Expect(cmd.ReleaseDeploymentLock("myapp", false)).ShouldNot(Succeed())
+			Expect(apps.apps).Should(HaveKey("held-guid"))
+		})
+		It("should delete the marker of any lock when forced", func() {
+			Expect(cmd.ReleaseDeploymentLock("myapp", true)).Should(Succeed())
+			Expect(apps.apps).ShouldNot(HaveKey("held-guid"))
+		})
+	})
+
+	Describe(".ExtendDeploymentLock", func() {
+		It("should push the expiry of a lock held by this process", func() {
+			_, err = cmd.AcquireDeploymentLock("myapp", time.Minute)
+			Expect(err).ShouldNot(HaveOccurred())
+			expiresAt, err := cmd.ExtendDeploymentLock("myapp", time.Hour)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(expiresAt).Should(BeTemporally("~", time.Now().Add(time.Hour), time.Minute))
+			lock, _ := cmd.GetDeploymentLock("myapp")
+			Expect(lock.ExpiresAt).Should(BeTemporally("~", expiresAt, time.Second))
+		})
+		It("should fail when another deployment took the lock over", func() {
+			holdLock("pipeline@build-7 pid 42", time.Now().Add(time.Hour))
+			_, err = cmd.ExtendDeploymentLock("myapp", time.Hour)
+			Expect(err).Should(BeAssignableToTypeOf(&commands.LockedError{}))
+		})
+	})
+
+	Describe("a deployment command", func() {
+		var (
+			fakeCommon    *fakes.FakeCommonCmd
+			fakeScaleover *fakes.FakeScaleoverCommand
+			zddDeploy     *commands.ZddDeploy
+		)
+
+		BeforeEach(func() {
+			fakeCommon = new(fakes.FakeCommonCmd)
+			fakeScaleover = new(fakes.FakeScaleoverCommand)
+			zddDeploy = new(commands.ZddDeploy)
+			zddDeploy.SetArgs(&commands.CfZddCmd{
+				CmdName:     commands.ZddDeployCmdName,
+				NewApp:      "myapp-1.0.1",
+				BaseAppName: "myapp",
+				LockTTL:     time.Hour,
+				Conn:        fakeConnection,
+				Commands:    fakeCommon,
+			})
+			zddDeploy.ScalerOverCmd = fakeScaleover
+		})
+
+		Context("when the application is locked", func() {
+			BeforeEach(func() {
+				fakeCommon.AcquireDeploymentLockReturns(false, errors.New("myapp is being deployed by pipeline@build-7 pid 42"))
+				err = zddDeploy.Run()
+			})
+			It("should fail before changing anything", func() {
+				Expect(err).Should(HaveOccurred())
+				Expect(fakeCommon.IsApplicationDeployedCallCount()).Should(Equal(0))
+				Expect(fakeCommon.PushApplicationCallCount()).Should(Equal(0))
+			})
+		})
+
+		Context("when the lock is acquired", func() {
+			BeforeEach(func() {
+				fakeCommon.AcquireDeploymentLockReturns(true, nil)
+				err = zddDeploy.Run()
+			})
+			It("should lock the base name for the time to live and release it afterwards", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				baseName, ttl := fakeCommon.AcquireDeploymentLockArgsForCall(0)
+				Expect(baseName).Should(Equal("myapp"))
+				Expect(ttl).Should(Equal(time.Hour))
+				releasedName, force := fakeCommon.ReleaseDeploymentLockArgsForCall(0)
+				Expect(releasedName).Should(Equal("myapp"))
+				Expect(force).Should(BeFalse())
+			})
+		})
+
+		Context("when no base name is given", func() {
+			BeforeEach(func() {
+				fakeCommon.AcquireDeploymentLockReturns(true, nil)
+				zddDeploy.SetArgs(&commands.CfZddCmd{
+					CmdName:  commands.ZddDeployCmdName,
+					NewApp:   "myapp-1.0.1",
+					LockTTL:  time.Hour,
+					Conn:     fakeConnection,
+					Commands: fakeCommon,
+				})
+				fakeConnection.GetAppStub = func(name string) (plugin_models.GetAppModel, error) {
+					if name == "myapp-1.0.1" {
+						return plugin_models.GetAppModel{Name: name}, nil
+					}
+					if name != "myapp-1.0.0" {
+						return plugin_models.GetAppModel{}, errors.New("App " + name + " not found")
+					}
+					return plugin_models.GetAppModel{Name: name, Guid: "live-guid"}, nil
+				}
+				fakeConnection.CliCommandWithoutTerminalOutputStub = curlResponder(map[string]string{
+					"GET /v3/apps/live-guid": `{"guid":"live-guid","metadata":{"labels":{"zdd.comcast.com/base-name":"myapp"}}}`,
+				})
+			})
+			It("should lock the family of the live version", func() {
+				fakeCommon.IsApplicationDeployedReturns("myapp-1.0.0", true)
+				Expect(zddDeploy.Run()).Should(Succeed())
+				baseName, _ := fakeCommon.AcquireDeploymentLockArgsForCall(0)
+				Expect(baseName).Should(Equal("myapp"))
+			})
+			It("should lock the application name when it has no family", func() {
+				Expect(zddDeploy.Run()).Should(Succeed())
+				baseName, _ := fakeCommon.AcquireDeploymentLockArgsForCall(0)
+				Expect(baseName).Should(Equal("myapp-1.0.1"))
+			})
+		})
+
+		Context("when the scaleover fails", func() {
+			BeforeEach(func() {
+				fakeCommon.AcquireDeploymentLockReturns(true, nil)
+				fakeCommon.IsApplicationDeployedReturns("myapp-1.0.0", true)
+				fakeScaleover.DoScaleoverReturns(errors.New("App myapp-1.0.0 not found"))
+				err = zddDeploy.Run()
+			})
+			It("should return the error and release the lock", func() {
+				Expect(err).Should(MatchError("App myapp-1.0.0 not found"))
+				Expect(fakeCommon.ReleaseDeploymentLockCallCount()).Should(Equal(1))
+			})
+		})
+	})
+})
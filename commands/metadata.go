@@ -0,0 +1,469 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/cli/plugin"
+)
+
+// Deployment metadata keys set on the applications deployed by the plugin
+const (
+	BaseNameLabel             = "zdd.comcast.com/base-name"
+	OutcomeLabel              = "zdd.comcast.com/outcome"
+	DeployedAtAnnotation      = "zdd.comcast.com/deployed-at"
+	StartedAtAnnotation       = "zdd.comcast.com/started-at"
+	FinishedAtAnnotation      = "zdd.comcast.com/finished-at"
+	StrategyAnnotation        = "zdd.comcast.com/strategy"
+	ChecksumAnnotation        = "zdd.comcast.com/artifact-checksum"
+	GitSHAAnnotation          = "zdd.comcast.com/git-sha"
+	DeployerAnnotation        = "zdd.comcast.com/deployer"
+	PreviousVersionAnnotation = "zdd.comcast.com/previous-version"
+	CanaryRoutesAnnotation    = "zdd.comcast.com/canary-routes"
+	DeploymentsAnnotation     = "zdd.comcast.com/deployments"
+	OutcomeSucceeded          = "succeeded"
+	OutcomeFailed             = "failed"
+)
+
+// Bounds of the list of deployments annotated on an application, annotation values being limited to 5000 bytes
+const (
+	maxRecordedDeployments = 10
+	maxAnnotationLength    = 5000
+)
+
+// gitSHAEnvVars - environment variables CI systems set to the commit being built
+var gitSHAEnvVars = []string{"GIT_COMMIT", "GITHUB_SHA", "CI_COMMIT_SHA"}
+
+// DeploymentRecord - what was deployed, how, by whom and with which outcome
+type DeploymentRecord struct {
+	BaseName        string
+	Strategy        string
+	Checksum        string
+	GitSHA          string
+	Deployer        string
+	StartedAt       time.Time
+	FinishedAt      time.Time
+	PreviousVersion string
+	Outcome         string
+}
+
+// invalidLabelChars - label values are limited to 63 alphanumeric, '-', '_' or '.' characters
+var invalidLabelChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// AppVersion - a deployed version of an application, identified by its base name label
+type AppVersion struct {
+	Name       string
+	GUID       string
+	State      string
+	DeployedAt time.Time
+}
+
+// ccApp - v3 app resource with its metadata
+type ccApp struct {
+	GUID      string    `json:"guid"`
+	Name      string    `json:"name"`
+	State     string    `json:"state"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Metadata  struct {
+		Labels      map[string]string `json:"labels"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+}
+
+// deployedAt - time recorded when the app was deployed, or the time it was created for apps deployed without metadata
+func (a *ccApp) deployedAt() time.Time {
+	if deployedAt, err := time.Parse(time.RFC3339Nano, a.Metadata.Annotations[DeployedAtAnnotation]); err == nil {
+		return deployedAt
+	}
+	return a.CreatedAt
+}
+
+// labelValue - the base name made valid as a label value
+func labelValue(value string) string {
+	value = strings.Trim(invalidLabelChars.ReplaceAllString(value, "-"), "-_.")
+	if len(value) > 63 {
+		value = strings.TrimRight(value[:63], "-_.")
+	}
+	return value
+}
+
+// RecordDeployment - label the application with its base name and the outcome of its deployment and annotate it with
+// the rest of the record, so the versions of an application can be found, ordered and audited without relying on their
+// names. Only successful deployments set the deployed-at time the versions are ordered by. The record is also added to
+// the list of deployments annotated on the application, one per droplet, so that the history keeps each deployment of
+// a version updated in place, as by deploy-rolling.
+func (c *commonCmd) RecordDeployment(appName string, record DeploymentRecord) error {
+	cliApp, err := c.cli.GetApp(appName)
+	if err != nil {
+		return err
+	}
+	app, err := appMetadata(c.cli, cliApp.Guid)
+	if err != nil {
+		return err
+	}
+	if record.Deployer == "" {
+		record.Deployer, _ = c.cli.Username()
+	}
+	if record.FinishedAt.IsZero() {
+		record.FinishedAt = time.Now()
+	}
+
+	labels := map[string]string{
+		BaseNameLabel: labelValue(record.BaseName),
+		OutcomeLabel:  record.Outcome,
+	}
+	annotations := map[string]string{
+		FinishedAtAnnotation:      record.FinishedAt.UTC().Format(time.RFC3339Nano),
+		StrategyAnnotation:        record.Strategy,
+		ChecksumAnnotation:        record.Checksum,
+		GitSHAAnnotation:          record.GitSHA,
+		DeployerAnnotation:        record.Deployer,
+		PreviousVersionAnnotation: record.PreviousVersion,
+	}
+	if !record.StartedAt.IsZero() {
+		annotations[StartedAtAnnotation] = record.StartedAt.UTC().Format(time.RFC3339Nano)
+	}
+	if record.Outcome == OutcomeSucceeded {
+		annotations[DeployedAtAnnotation] = annotations[FinishedAtAnnotation]
+	}
+	deployment := record.deployment(app.Name)
+	deployment.GUID = app.GUID
+	deployment.Droplet = currentDroplet(c.cli, app.GUID)
+	if annotations[DeploymentsAnnotation], err = deploymentsAnnotation(app, deployment); err != nil {
+		return err
+	}
+	// Fields left empty remove the annotation of an earlier deployment of the same app
+	values := make(map[string]interface{})
+	for key, value := range annotations {
+		if value == "" {
+			values[key] = nil
+		} else {
+			values[key] = value
+		}
+	}
+	return setAppMetadata(c.cli, app.GUID, labels, values)
+}
+
+// deployment - the record as a deployment of the application in the history
+func (r DeploymentRecord) deployment(appName string) Deployment {
+	return Deployment{
+		Version:         appName,
+		Strategy:        r.Strategy,
+		StartedAt:       r.StartedAt,
+		FinishedAt:      r.FinishedAt,
+		Outcome:         r.Outcome,
+		Actor:           r.Deployer,
+		GitSHA:          r.GitSHA,
+		Checksum:        r.Checksum,
+		PreviousVersion: r.PreviousVersion,
+	}
+}
+
+// currentDroplet - guid of the droplet an application runs, empty when it cannot be read
+func currentDroplet(conn plugin.CliConnection, appGUID string) string {
+	droplet := new(struct {
+		GUID string `json:"guid"`
+	})
+	if err := CCCurl(conn, "GET", "/v3/apps/"+appGUID+"/droplets/current", nil, droplet); err != nil {
+		return ""
+	}
+	return droplet.GUID
+}
+
+// RecordFailure - record a failed deployment in the list of deployments annotated on the version it was to replace,
+// which survives the rollback, or on the failed application when there is no previous version. The failed version is
+// often rolled back or removed, and the record of the live version must stay as it is, so neither its labels nor its
+// deployment record are changed. zdd-history reports each failure recorded on the versions of the family.
+func (c *commonCmd) RecordFailure(appName string, record DeploymentRecord) error {
+	if record.Deployer == "" {
+		record.Deployer, _ = c.cli.Username()
+	}
+	if record.FinishedAt.IsZero() {
+		record.FinishedAt = time.Now()
+	}
+	record.Outcome = OutcomeFailed
+	failure := record.deployment(appName)
+	failed, err := appByName(c.cli, appName)
+	if err != nil {
+		return err
+	}
+	if failed != nil {
+		failure.GUID = failed.GUID
+	}
+
+	holder := failed
+	if record.PreviousVersion != "" && record.PreviousVersion != appName {
+		previous, err := appByName(c.cli, record.PreviousVersion)
+		if err != nil {
+			return err
+		}
+		if previous != nil {
+			holder = previous
+		}
+	}
+	if holder == nil {
+		return fmt.Errorf("neither %s nor its previous version found to record the failure on", appName)
+	}
+	return appendDeployment(c.cli, holder, failure)
+}
+
+// recordedDeployments - the deployments listed in the annotation of an application, oldest first
+func recordedDeployments(app *ccApp) (deployments []Deployment) {
+	if value := app.Metadata.Annotations[DeploymentsAnnotation]; value != "" {
+		if err := json.Unmarshal([]byte(value), &deployments); err != nil {
+			fmt.Printf("Unreadable deployments recorded on %s: %s\n", app.Name, err.Error())
+			return nil
+		}
+	}
+	return
+}
+
+// appendDeployment - add a deployment to the list annotated on an application
+func appendDeployment(conn plugin.CliConnection, app *ccApp, deployment Deployment) error {
+	value, err := deploymentsAnnotation(app, deployment)
+	if err != nil {
+		return err
+	}
+	return setAppMetadata(conn, app.GUID, nil, map[string]interface{}{DeploymentsAnnotation: value})
+}
+
+// deploymentsAnnotation - the list of deployments of an application with a deployment added, replacing an earlier
+// deployment of the same droplet and dropping the oldest beyond the number kept or the size an annotation holds
+func deploymentsAnnotation(app *ccApp, deployment Deployment) (string, error) {
+	var deployments []Deployment
+	for _, recorded := range recordedDeployments(app) {
+		if deployment.Droplet == "" || recorded.Droplet != deployment.Droplet {
+			deployments = append(deployments, recorded)
+		}
+	}
+	deployments = append(deployments, deployment)
+	if len(deployments) > maxRecordedDeployments {
+		deployments = deployments[len(deployments)-maxRecordedDeployments:]
+	}
+	value, err := json.Marshal(deployments)
+	for err == nil && len(value) > maxAnnotationLength && len(deployments) > 1 {
+		deployments = deployments[1:]
+		value, err = json.Marshal(deployments)
+	}
+	return string(value), err
+}
+
+// ListVersions - the versions of an application in the current space, most recently deployed first
+func (c *commonCmd) ListVersions(baseName string) (versions []AppVersion, err error) {
+	apps, err := familyApps(c.cli, baseName)
+	if err != nil {
+		return
+	}
+
+	for _, app := range apps {
+		versions = append(versions, AppVersion{
+			Name:       app.Name,
+			GUID:       app.GUID,
+			State:      app.State,
+			DeployedAt: app.deployedAt(),
+		})
+	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].DeployedAt.After(versions[j].DeployedAt)
+	})
+	return
+}
+
+// familyApps - the applications of the current space labelled with the base name, with their metadata. Versions
+// deployed before the plugin labelled them are those without a base name label whose name starts with the base name.
+func familyApps(conn plugin.CliConnection, baseName string) ([]ccApp, error) {
+	space, err := conn.GetCurrentSpace()
+	if err != nil {
+		return nil, err
+	}
+
+	var family []ccApp
+	seen := make(map[string]bool)
+	for _, selector := range []string{BaseNameLabel + "=" + labelValue(baseName), "!" + BaseNameLabel} {
+		apps := new(struct {
+			Resources []ccApp `json:"resources"`
+		})
+		path := "/v3/apps?label_selector=" + url.QueryEscape(selector) + "&space_guids=" + space.Guid + "&per_page=5000"
+		if err = CCCurl(conn, "GET", path, nil, apps); err != nil {
+			return nil, err
+		}
+		legacy := strings.HasPrefix(selector, "!")
+		for _, app := range apps.Resources {
+			_, labelled := app.Metadata.Labels[BaseNameLabel]
+			if seen[app.GUID] || (legacy && (labelled || !strings.HasPrefix(app.Name, baseName))) {
+				continue
+			}
+			seen[app.GUID] = true
+			family = append(family, app)
+		}
+	}
+	return family, nil
+}
+
+// appByName - an application of the current space with its metadata, nil when there is none of that name
+func appByName(conn plugin.CliConnection, name string) (*ccApp, error) {
+	space, err := conn.GetCurrentSpace()
+	if err != nil {
+		return nil, err
+	}
+	apps := new(struct {
+		Resources []ccApp `json:"resources"`
+	})
+	if err = CCCurl(conn, "GET", "/v3/apps?names="+url.QueryEscape(name)+"&space_guids="+space.Guid, nil, apps); err != nil {
+		return nil, err
+	}
+	if len(apps.Resources) == 0 {
+		return nil, nil
+	}
+	return &apps.Resources[0], nil
+}
+
+// appMetadata - an application with its metadata
+func appMetadata(conn plugin.CliConnection, appGUID string) (*ccApp, error) {
+	app := new(ccApp)
+	err := CCCurl(conn, "GET", "/v3/apps/"+appGUID, nil, app)
+	return app, err
+}
+
+// setAppMetadata - add labels and annotations to an application, leaving its other metadata untouched
+func setAppMetadata(conn plugin.CliConnection, appGUID string, labels map[string]string, annotations map[string]interface{}) error {
+	metadata := map[string]interface{}{}
+	if len(labels) > 0 {
+		metadata["labels"] = labels
+	}
+	if len(annotations) > 0 {
+		metadata["annotations"] = annotations
+	}
+	return CCCurl(conn, "PATCH", "/v3/apps/"+appGUID, map[string]interface{}{"metadata": metadata}, nil)
+}
+
+// versionsToKeep - number of previous versions kept stopped and unrouted, -keep-previous keeping one
+func versionsToKeep(args *CfZddCmd) int {
+	if args.KeepVersions > 0 {
+		return args.KeepVersions
+	}
+	if args.KeepPrevious {
+		return 1
+	}
+	return 0
+}
+
+// newDeploymentRecord - record of a successful deployment by the command being run
+func newDeploymentRecord(args *CfZddCmd, baseName string, previous string) DeploymentRecord {
+	return DeploymentRecord{
+		BaseName:        baseName,
+		Strategy:        args.CmdName,
+		Checksum:        artifactChecksum(args.ApplicationPath),
+		GitSHA:          gitSHA(args),
+		StartedAt:       args.StartedAt,
+		PreviousVersion: previous,
+		Outcome:         OutcomeSucceeded,
+	}
+}
+
+// recordCanaryRoutes - label a canary with its base name and annotate it with the routes created for it, so it is
+// found among the versions of its family and exactly those routes are removed once it is promoted or aborted
+func recordCanaryRoutes(args *CfZddCmd, appName string, baseName string, routes []string) {
+	app, err := args.Conn.GetApp(appName)
+	if err == nil {
+		err = setAppMetadata(args.Conn, app.Guid, map[string]string{BaseNameLabel: labelValue(baseName)},
+			map[string]interface{}{CanaryRoutesAnnotation: strings.Join(routes, ",")})
+	}
+	if err != nil {
+		fmt.Printf("Unable to record the canary routes of %s: %s\n", appName, err.Error())
+	}
+}
+
+// isCanaryApp - canaries are annotated with the routes created for them, they may also serve the live routes when
+// deployed with -canary-live-traffic
+func isCanaryApp(conn plugin.CliConnection, appGUID string) bool {
+	app, err := appMetadata(conn, appGUID)
+	return err == nil && app.Metadata.Annotations[CanaryRoutesAnnotation] != ""
+}
+
+// recordDeployment - failing to record the metadata only affects the ordering and auditing of versions
+func recordDeployment(args *CfZddCmd, appName string, record DeploymentRecord) {
+	if err := args.Commands.RecordDeployment(appName, record); err != nil {
+		fmt.Printf("Unable to record deployment metadata on %s: %s\n", appName, err.Error())
+	}
+}
+
+// gitSHA - the commit given with -git-sha, or the one set by the CI system running the deployment
+func gitSHA(args *CfZddCmd) string {
+	if args.GitSHA != "" {
+		return args.GitSHA
+	}
+	for _, name := range gitSHAEnvVars {
+		if sha := os.Getenv(name); sha != "" {
+			return sha
+		}
+	}
+	return ""
+}
+
+// artifactChecksum - sha256 of the artifact file, empty for directories and unreadable paths
+func artifactChecksum(path string) string {
+	if path == "" {
+		return ""
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	if info, statErr := file.Stat(); statErr != nil || info.IsDir() {
+		return ""
+	}
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return ""
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil))
+}
+
+// pruneVersions - remove the oldest previous versions beyond the number to keep
+func pruneVersions(args *CfZddCmd, baseName string, live string, keep int) {
+	versions, err := args.Commands.ListVersions(baseName)
+	if err != nil {
+		fmt.Printf("Unable to list versions of %s: %s\n", baseName, err.Error())
+		return
+	}
+	retained := 0
+	for _, version := range versions {
+		if version.Name == live || strings.EqualFold(version.State, "started") {
+			continue
+		}
+		if retained++; retained > keep {
+			fmt.Printf("Pruning old version: %s\n", version.Name)
+			if err = args.Commands.RemoveApplication(version.Name); err != nil {
+				fmt.Printf("Unable to remove old application: %s, error: %s\n", version.Name, err.Error())
+			}
+		}
+	}
+}
@@ -0,0 +1,279 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands_test
+
+import (
+	"encoding/json"
+	"net/url"
+	"time"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/comcast/cf-zdd-plugin/commands"
+	"github.com/comcast/cf-zdd-plugin/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("deployment metadata", func() {
+	var (
+		fakeConnection *fakes.FakeCliConnection
+		cmd            commands.CommonCmd
+		err            error
+	)
+
+	BeforeEach(func() {
+		fakeConnection = new(fakes.FakeCliConnection)
+		cmd = commands.NewCommonCmd(fakeConnection)
+	})
+
+	Describe(".RecordDeployment", func() {
+		var (
+			apps    *spaceApps
+			app     *spaceApp
+			droplet string
+			record  commands.DeploymentRecord
+		)
+
+		BeforeEach(func() {
+			fakeConnection.GetAppReturns(plugin_models.GetAppModel{Guid: "app-guid"}, nil)
+			fakeConnection.UsernameReturns("deployer", nil)
+			apps = newSpaceApps()
+			app = apps.add("app-guid", "myTestApp#1.2.3-abcde", map[string]string{commands.GitSHAAnnotation: "earlier"})
+			droplet = "droplet-1"
+			fakeConnection.CliCommandWithoutTerminalOutputStub = func(args ...string) ([]string, error) {
+				if len(args) > 1 && args[1] == "/v3/apps/app-guid/droplets/current" {
+					return []string{`{"guid": "` + droplet + `"}`}, nil
+				}
+				return apps.respond(args...)
+			}
+			record = commands.DeploymentRecord{
+				BaseName:        "myTestApp#1.2.3-abcde",
+				Strategy:        commands.ZddDeployCmdName,
+				Checksum:        "sha256:abc",
+				GitSHA:          "0123abcd",
+				StartedAt:       time.Date(2019, 1, 1, 10, 0, 0, 0, time.UTC),
+				PreviousVersion: "myTestApp#1.2.2-abcde",
+				Outcome:         commands.OutcomeSucceeded,
+			}
+		})
+
+		recordDeployment := func() {
+			err = cmd.RecordDeployment("myTestApp#1.2.3-abcde", record)
+		}
+		recorded := func() (deployments []commands.Deployment) {
+			Expect(json.Unmarshal([]byte(app.Metadata.Annotations[commands.DeploymentsAnnotation]), &deployments)).Should(Succeed())
+			return
+		}
+
+		Context("when the deployment succeeded", func() {
+			BeforeEach(recordDeployment)
+
+			It("should label the application with a valid base name label and the outcome", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(app.Metadata.Labels[commands.BaseNameLabel]).Should(Equal("myTestApp-1.2.3-abcde"))
+				Expect(app.Metadata.Labels[commands.OutcomeLabel]).Should(Equal(commands.OutcomeSucceeded))
+			})
+			It("should annotate the application with the deployment record", func() {
+				annotations := app.Metadata.Annotations
+				Expect(annotations[commands.StrategyAnnotation]).Should(Equal("deploy-zdd"))
+				Expect(annotations[commands.ChecksumAnnotation]).Should(Equal("sha256:abc"))
+				Expect(annotations[commands.GitSHAAnnotation]).Should(Equal("0123abcd"))
+				Expect(annotations[commands.DeployerAnnotation]).Should(Equal("deployer"))
+				Expect(annotations[commands.PreviousVersionAnnotation]).Should(Equal("myTestApp#1.2.2-abcde"))
+				Expect(annotations[commands.StartedAtAnnotation]).Should(Equal("2019-01-01T10:00:00Z"))
+				Expect(annotations).Should(HaveKey(commands.FinishedAtAnnotation))
+				Expect(annotations[commands.DeployedAtAnnotation]).Should(Equal(annotations[commands.FinishedAtAnnotation]))
+			})
+			It("should list the deployment with the droplet it deployed", func() {
+				deployments := recorded()
+				Expect(deployments).Should(HaveLen(1))
+				Expect(deployments[0].Version).Should(Equal("myTestApp#1.2.3-abcde"))
+				Expect(deployments[0].GUID).Should(Equal("app-guid"))
+				Expect(deployments[0].Droplet).Should(Equal("droplet-1"))
+				Expect(deployments[0].Outcome).Should(Equal(commands.OutcomeSucceeded))
+				Expect(deployments[0].Strategy).Should(Equal(commands.ZddDeployCmdName))
+			})
+		})
+
+		Context("when a new droplet is deployed to the same application", func() {
+			BeforeEach(func() {
+				recordDeployment()
+				droplet = "droplet-2"
+				record.Strategy = commands.RollingDeployCmdName
+				recordDeployment()
+			})
+			It("should keep the earlier deployment in the list", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				deployments := recorded()
+				Expect(deployments).Should(HaveLen(2))
+				Expect(deployments[0].Droplet).Should(Equal("droplet-1"))
+				Expect(deployments[1].Droplet).Should(Equal("droplet-2"))
+				Expect(deployments[1].Strategy).Should(Equal(commands.RollingDeployCmdName))
+			})
+		})
+
+		Context("when the same droplet is recorded again", func() {
+			BeforeEach(func() {
+				recordDeployment()
+				record.GitSHA = "4567cdef"
+				recordDeployment()
+			})
+			It("should replace its deployment in the list", func() {
+				deployments := recorded()
+				Expect(deployments).Should(HaveLen(1))
+				Expect(deployments[0].GitSHA).Should(Equal("4567cdef"))
+			})
+		})
+
+		Context("when the deployment failed", func() {
+			BeforeEach(func() {
+				record.Outcome = commands.OutcomeFailed
+				record.GitSHA = ""
+				recordDeployment()
+			})
+			It("should not set the deployment time the versions are ordered by", func() {
+				Expect(app.Metadata.Labels[commands.OutcomeLabel]).Should(Equal(commands.OutcomeFailed))
+				Expect(app.Metadata.Annotations).ShouldNot(HaveKey(commands.DeployedAtAnnotation))
+			})
+			It("should remove annotations left by an earlier deployment for fields not recorded", func() {
+				Expect(app.Metadata.Annotations).ShouldNot(HaveKey(commands.GitSHAAnnotation))
+			})
+		})
+	})
+
+	Describe(".RecordFailure", func() {
+		var (
+			apps     *spaceApps
+			previous *spaceApp
+			failed   *spaceApp
+		)
+
+		BeforeEach(func() {
+			fakeConnection.GetCurrentSpaceReturns(plugin_models.Space{SpaceFields: plugin_models.SpaceFields{Guid: "space-guid"}}, nil)
+			fakeConnection.UsernameReturns("deployer", nil)
+			apps = newSpaceApps()
+			previous = apps.add("previous-guid", "myapp-1.0.0", map[string]string{commands.StrategyAnnotation: "deploy-zdd"})
+			previous.Metadata.Labels[commands.OutcomeLabel] = commands.OutcomeSucceeded
+			failed = apps.add("failed-guid", "myapp-1.0.1", nil)
+			fakeConnection.CliCommandWithoutTerminalOutputStub = apps.respond
+		})
+
+		recordFailure := func(appName string) {
+			err = cmd.RecordFailure(appName, commands.DeploymentRecord{
+				BaseName:        "myapp",
+				Strategy:        commands.BlueGreenCmdName,
+				PreviousVersion: "myapp-1.0.0",
+				Outcome:         commands.OutcomeFailed,
+			})
+		}
+		recorded := func(app *spaceApp) (deployments []commands.Deployment) {
+			Expect(json.Unmarshal([]byte(app.Metadata.Annotations[commands.DeploymentsAnnotation]), &deployments)).Should(Succeed())
+			return
+		}
+
+		Context("when the previous version is still in the space", func() {
+			BeforeEach(func() {
+				recordFailure("myapp-1.0.1")
+			})
+			It("should add the failure to the deployments recorded on the previous version", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				deployments := recorded(previous)
+				Expect(deployments).Should(HaveLen(1))
+				Expect(deployments[0].Version).Should(Equal("myapp-1.0.1"))
+				Expect(deployments[0].GUID).Should(Equal("failed-guid"))
+				Expect(deployments[0].Outcome).Should(Equal(commands.OutcomeFailed))
+				Expect(deployments[0].Strategy).Should(Equal(commands.BlueGreenCmdName))
+				Expect(deployments[0].Actor).Should(Equal("deployer"))
+				Expect(deployments[0].PreviousVersion).Should(Equal("myapp-1.0.0"))
+			})
+			It("should leave the record and outcome of the previous version as they are", func() {
+				Expect(previous.Metadata.Labels[commands.OutcomeLabel]).Should(Equal(commands.OutcomeSucceeded))
+				Expect(previous.Metadata.Annotations[commands.StrategyAnnotation]).Should(Equal("deploy-zdd"))
+			})
+			It("should not record anything on the space", func() {
+				Expect(curlRequests(fakeConnection)).ShouldNot(ContainElement(ContainSubstring("/v3/spaces")))
+			})
+		})
+
+		Context("when several deployments failed", func() {
+			BeforeEach(func() {
+				for i := 0; i < 12; i++ {
+					recordFailure("myapp-1.0.1")
+				}
+			})
+			It("should keep the most recent failures of each version", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(recorded(previous)).Should(HaveLen(10))
+			})
+		})
+
+		Context("when there is no previous version", func() {
+			BeforeEach(func() {
+				delete(apps.apps, previous.GUID)
+				recordFailure("myapp-1.0.1")
+			})
+			It("should record the failure on the failed version", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(recorded(failed)[0].Version).Should(Equal("myapp-1.0.1"))
+			})
+		})
+
+		Context("when neither version is in the space", func() {
+			BeforeEach(func() {
+				apps.apps = map[string]*spaceApp{}
+				recordFailure("myapp-1.0.1")
+			})
+			It("should return an error", func() {
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+	})
+
+	Describe(".ListVersions", func() {
+		var versions []commands.AppVersion
+
+		BeforeEach(func() {
+			fakeConnection.GetCurrentSpaceReturns(plugin_models.Space{SpaceFields: plugin_models.SpaceFields{Guid: "space-guid"}}, nil)
+			fakeConnection.CliCommandWithoutTerminalOutputStub = curlResponder(map[string]string{
+				"GET /v3/apps": `{"resources": [
+					{"guid": "guid-1", "name": "myapp-1.0.1", "state": "STOPPED", "created_at": "2019-01-01T00:00:00Z",
+					 "metadata": {"annotations": {"zdd.comcast.com/deployed-at": "2019-01-01T10:00:00Z"}}},
+					{"guid": "guid-3", "name": "myapp-1.0.3", "state": "STARTED", "created_at": "2019-01-01T00:00:00Z",
+					 "metadata": {"annotations": {"zdd.comcast.com/deployed-at": "2019-01-03T10:00:00Z"}}},
+					{"guid": "guid-2", "name": "myapp-1.0.2", "state": "STOPPED", "created_at": "2019-01-02T00:00:00Z",
+					 "metadata": {"annotations": {}}}
+				]}`,
+			})
+			versions, err = cmd.ListVersions("myapp")
+		})
+		It("should select the applications by their base name label in the current space", func() {
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(curlRequests(fakeConnection)[0]).Should(Equal("GET /v3/apps?label_selector=" +
+				url.QueryEscape(commands.BaseNameLabel+"=myapp") + "&space_guids=space-guid&per_page=5000"))
+		})
+		It("should also select the unlabelled applications deployed before the versions were labelled", func() {
+			Expect(curlRequests(fakeConnection)[1]).Should(Equal("GET /v3/apps?label_selector=" +
+				url.QueryEscape("!"+commands.BaseNameLabel) + "&space_guids=space-guid&per_page=5000"))
+		})
+		It("should order the versions by deployment time, most recent first", func() {
+			Expect(versions).Should(HaveLen(3))
+			Expect(versions[0].Name).Should(Equal("myapp-1.0.3"))
+			Expect(versions[1].Name).Should(Equal("myapp-1.0.2"))
+			Expect(versions[2].Name).Should(Equal("myapp-1.0.1"))
+		})
+	})
+})
@@ -0,0 +1,236 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// MetricsConfig - the metrics server and the queries the canary is judged on, read from the -metrics-config file
+type MetricsConfig struct {
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+	Queries []MetricsQuery    `yaml:"queries"`
+}
+
+// MetricsQuery - a PromQL query templated with the app it is run for, and the criteria its canary value must meet.
+// The query should aggregate to a single series; only the first one returned is evaluated.
+type MetricsQuery struct {
+	Name     string   `yaml:"name"`
+	Query    string   `yaml:"query"`
+	Min      *float64 `yaml:"min,omitempty"`
+	Max      *float64 `yaml:"max,omitempty"`
+	MaxRatio *float64 `yaml:"max_ratio,omitempty"`
+}
+
+// MetricsTarget - the app a query is run for, available to the query template as {{.App}} and {{.GUID}} along with
+// the bake period as {{.Window}}
+type MetricsTarget struct {
+	App    string
+	GUID   string
+	Window string
+}
+
+// LoadMetricsConfig - read and check a metrics config file
+func LoadMetricsConfig(path string) (config *MetricsConfig, err error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	config = new(MetricsConfig)
+	if err = yaml.Unmarshal(content, config); err != nil {
+		return nil, fmt.Errorf("unable to parse metrics config %s: %s", path, err.Error())
+	}
+	if config.URL == "" {
+		return nil, fmt.Errorf("metrics config %s has no url", path)
+	}
+	for i, query := range config.Queries {
+		if query.Query == "" {
+			return nil, fmt.Errorf("metrics query %d of %s has no query", i+1, path)
+		}
+		if query.Min == nil && query.Max == nil && query.MaxRatio == nil {
+			return nil, fmt.Errorf("metrics query %s of %s has no min, max or max_ratio", query.Name, path)
+		}
+		if query.Name == "" {
+			config.Queries[i].Name = fmt.Sprintf("query %d", i+1)
+		}
+	}
+	return
+}
+
+// PromWindow - a duration in the range selector syntax of PromQL, in whole seconds
+func PromWindow(d time.Duration) string {
+	seconds := int64(math.Ceil(d.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.FormatInt(seconds, 10) + "s"
+}
+
+// promResponse - the parts of a response of the Prometheus instant query API that are used
+type promResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// QueryMetric - run an instant query against the metrics server, found is false when the query returned no sample or
+// a sample that is not a number
+func QueryMetric(client clientDoer, config *MetricsConfig, query string) (value float64, found bool, err error) {
+	request, err := http.NewRequest("GET", strings.TrimSuffix(config.URL, "/")+"/api/v1/query?query="+url.QueryEscape(query), nil)
+	if err != nil {
+		return
+	}
+	for name, header := range config.Headers {
+		request.Header.Set(name, header)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return
+	}
+
+	var result promResponse
+	if err = json.Unmarshal(body, &result); err != nil {
+		return 0, false, fmt.Errorf("unexpected response from %s, status %d", config.URL, response.StatusCode)
+	}
+	if result.Status != "success" {
+		return 0, false, fmt.Errorf("query %q failed: %s %s", query, result.ErrorType, result.Error)
+	}
+
+	var sample []interface{}
+	switch result.Data.ResultType {
+	case "vector":
+		var vector []struct {
+			Value []interface{} `json:"value"`
+		}
+		if err = json.Unmarshal(result.Data.Result, &vector); err != nil {
+			return
+		}
+		if len(vector) == 0 {
+			return
+		}
+		sample = vector[0].Value
+	case "scalar":
+		if err = json.Unmarshal(result.Data.Result, &sample); err != nil {
+			return
+		}
+	default:
+		return 0, false, fmt.Errorf("query %q returned a %s, expected a vector or scalar", query, result.Data.ResultType)
+	}
+
+	if len(sample) != 2 {
+		return
+	}
+	text, _ := sample[1].(string)
+	value, parseErr := strconv.ParseFloat(text, 64)
+	if parseErr != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, false, nil
+	}
+	return value, true, nil
+}
+
+// EvaluateMetrics - run each query for the canary, and for the baseline when there is one, and check the canary value
+// against the criteria of the query. A query without a canary value fails, a ratio without a baseline value is skipped.
+func EvaluateMetrics(client clientDoer, config *MetricsConfig, canary MetricsTarget, baseline *MetricsTarget) (checks []AnalysisCheck, err error) {
+	for _, query := range config.Queries {
+		tmpl, parseErr := template.New(query.Name).Option("missingkey=error").Parse(query.Query)
+		if parseErr != nil {
+			return nil, fmt.Errorf("invalid metrics query %s: %s", query.Name, parseErr.Error())
+		}
+
+		canaryValue, canaryFound, queryErr := runMetricsQuery(client, config, tmpl, canary)
+		if queryErr != nil {
+			return nil, queryErr
+		}
+		check := AnalysisCheck{Name: query.Name, Canary: "no data", Threshold: metricsThreshold(query)}
+		if canaryFound {
+			check.Canary = formatMetric(canaryValue)
+		}
+
+		var baselineValue float64
+		baselineFound := false
+		if baseline != nil {
+			if baselineValue, baselineFound, queryErr = runMetricsQuery(client, config, tmpl, *baseline); queryErr != nil {
+				return nil, queryErr
+			}
+			check.Live = "no data"
+			if baselineFound {
+				check.Live = formatMetric(baselineValue)
+			}
+		}
+
+		check.Passed = canaryFound
+		if canaryFound && query.Min != nil {
+			check.Passed = check.Passed && canaryValue >= *query.Min
+		}
+		if canaryFound && query.Max != nil {
+			check.Passed = check.Passed && canaryValue <= *query.Max
+		}
+		if canaryFound && query.MaxRatio != nil && baselineFound {
+			check.Passed = check.Passed && canaryValue <= baselineValue**query.MaxRatio
+		}
+		checks = append(checks, check)
+	}
+	return
+}
+
+func runMetricsQuery(client clientDoer, config *MetricsConfig, tmpl *template.Template, target MetricsTarget) (float64, bool, error) {
+	var query bytes.Buffer
+	if err := tmpl.Execute(&query, target); err != nil {
+		return 0, false, fmt.Errorf("invalid metrics query %s: %s", tmpl.Name(), err.Error())
+	}
+	return QueryMetric(client, config, query.String())
+}
+
+func metricsThreshold(query MetricsQuery) string {
+	var criteria []string
+	if query.Min != nil {
+		criteria = append(criteria, ">= "+formatMetric(*query.Min))
+	}
+	if query.Max != nil {
+		criteria = append(criteria, "<= "+formatMetric(*query.Max))
+	}
+	if query.MaxRatio != nil {
+		criteria = append(criteria, fmt.Sprintf("<= %.2fx live", *query.MaxRatio))
+	}
+	return strings.Join(criteria, ", ")
+}
+
+func formatMetric(value float64) string {
+	return strconv.FormatFloat(value, 'g', 4, 64)
+}
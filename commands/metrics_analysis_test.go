@@ -0,0 +1,288 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/comcast/cf-zdd-plugin/commands"
+	"github.com/comcast/cf-zdd-plugin/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// promServer - a stand-in of the Prometheus instant query API answering each query with the value set for the first
+// key it contains, and no sample when none matches
+func promServer(values map[string]string, queries *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("query")
+		*queries = append(*queries, query)
+		if r.URL.Path != "/api/v1/query" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if strings.Contains(query, "invalid") {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"status":"error","errorType":"bad_data","error":"parse error"}`)
+			return
+		}
+		result := "[]"
+		for key, value := range values {
+			if strings.Contains(query, key) {
+				result = fmt.Sprintf(`[{"metric":{},"value":[1600000000.000,"%s"]}]`, value)
+			}
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":%s}}`, result)
+	}))
+}
+
+func floatRef(value float64) *float64 {
+	return &value
+}
+
+var _ = Describe("metrics analysis", func() {
+	var (
+		server  *httptest.Server
+		values  map[string]string
+		queries []string
+		config  *commands.MetricsConfig
+		canary  = commands.MetricsTarget{App: "myapp-1.0.2", GUID: "canary-guid", Window: "300s"}
+		live    = &commands.MetricsTarget{App: "myapp-1.0.1", GUID: "live-guid", Window: "300s"}
+	)
+
+	BeforeEach(func() {
+		queries = nil
+		values = map[string]string{}
+		server = promServer(values, &queries)
+		config = &commands.MetricsConfig{
+			URL: server.URL,
+			Queries: []commands.MetricsQuery{
+				{Name: "error rate", Query: `errors{app="{{.App}}"}[{{.Window}}]`, Max: floatRef(0.01), MaxRatio: floatRef(1.5)},
+				{Name: "p99 latency", Query: `p99{app_guid="{{.GUID}}"}`, MaxRatio: floatRef(1.2)},
+			},
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe(".LoadMetricsConfig", func() {
+		It("should read the queries and their criteria", func() {
+			loaded, err := commands.LoadMetricsConfig("../fixtures/canary-metrics.yml")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(loaded.URL).Should(Equal("http://prometheus.example.com"))
+			Expect(loaded.Headers).Should(HaveKeyWithValue("Authorization", "Bearer token"))
+			Expect(loaded.Queries).Should(HaveLen(2))
+			Expect(*loaded.Queries[0].Max).Should(Equal(0.01))
+			Expect(loaded.Queries[1].Max).Should(BeNil())
+			Expect(*loaded.Queries[1].MaxRatio).Should(Equal(1.2))
+		})
+		It("should reject a query without criteria", func() {
+			dir, err := ioutil.TempDir("", "metrics")
+			Expect(err).ShouldNot(HaveOccurred())
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "metrics.yml")
+			Expect(ioutil.WriteFile(path, []byte("url: http://prometheus\nqueries:\n- query: up\n"), 0644)).Should(Succeed())
+			_, err = commands.LoadMetricsConfig(path)
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe(".PromWindow", func() {
+		It("should express the bake period in whole seconds", func() {
+			Expect(commands.PromWindow(5 * time.Minute)).Should(Equal("300s"))
+			Expect(commands.PromWindow(1500 * time.Millisecond)).Should(Equal("2s"))
+			Expect(commands.PromWindow(0)).Should(Equal("1s"))
+		})
+	})
+
+	Describe(".EvaluateMetrics", func() {
+		Context("when the canary metrics are within the criteria", func() {
+			BeforeEach(func() {
+				values[`errors{app="myapp-1.0.2"}`] = "0.005"
+				values[`errors{app="myapp-1.0.1"}`] = "0.004"
+				values[`p99{app_guid="canary-guid"}`] = "0.2"
+				values[`p99{app_guid="live-guid"}`] = "0.19"
+			})
+			It("should pass every check", func() {
+				checks, err := commands.EvaluateMetrics(http.DefaultClient, config, canary, live)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(checks).Should(HaveLen(2))
+				Expect(checks[0].Passed).Should(BeTrue())
+				Expect(checks[0].Canary).Should(Equal("0.005"))
+				Expect(checks[0].Live).Should(Equal("0.004"))
+				Expect(checks[1].Passed).Should(BeTrue())
+			})
+			It("should query the canary and the baseline by name, guid and window", func() {
+				commands.EvaluateMetrics(http.DefaultClient, config, canary, live)
+				Expect(queries).Should(Equal([]string{
+					`errors{app="myapp-1.0.2"}[300s]`,
+					`errors{app="myapp-1.0.1"}[300s]`,
+					`p99{app_guid="canary-guid"}`,
+					`p99{app_guid="live-guid"}`,
+				}))
+			})
+		})
+		Context("when a canary metric exceeds its absolute limit", func() {
+			BeforeEach(func() {
+				values[`errors{app="myapp-1.0.2"}`] = "0.02"
+				values[`errors{app="myapp-1.0.1"}`] = "0.02"
+			})
+			It("should fail the check", func() {
+				checks, err := commands.EvaluateMetrics(http.DefaultClient, config, canary, live)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(checks[0].Passed).Should(BeFalse())
+			})
+		})
+		Context("when a canary metric is worse than the baseline allows", func() {
+			BeforeEach(func() {
+				values[`p99{app_guid="canary-guid"}`] = "0.5"
+				values[`p99{app_guid="live-guid"}`] = "0.2"
+			})
+			It("should fail the check", func() {
+				checks, err := commands.EvaluateMetrics(http.DefaultClient, config, canary, live)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(checks[1].Passed).Should(BeFalse())
+			})
+		})
+		Context("when there is no canary data", func() {
+			It("should fail the check", func() {
+				checks, err := commands.EvaluateMetrics(http.DefaultClient, config, canary, live)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(checks[1].Canary).Should(Equal("no data"))
+				Expect(checks[1].Passed).Should(BeFalse())
+			})
+		})
+		Context("when there is no baseline", func() {
+			BeforeEach(func() {
+				values[`p99{app_guid="canary-guid"}`] = "0.5"
+			})
+			It("should skip the ratio", func() {
+				checks, err := commands.EvaluateMetrics(http.DefaultClient, config, canary, nil)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(checks[1].Passed).Should(BeTrue())
+			})
+		})
+		Context("when the metrics server rejects a query", func() {
+			BeforeEach(func() {
+				config.Queries[0].Query = "invalid"
+			})
+			It("should return an error", func() {
+				_, err := commands.EvaluateMetrics(http.DefaultClient, config, canary, live)
+				Expect(err).Should(MatchError(ContainSubstring("parse error")))
+			})
+		})
+	})
+
+	Describe("analyze-canary with a metrics config", func() {
+		var (
+			dir            string
+			cfZddCmd       *commands.CfZddCmd
+			fakeConnection *fakes.FakeCliConnection
+			fakeCommon     *fakes.FakeCommonCmd
+			promote        *fakes.FakeCmdRunner
+			analyze        *commands.AnalyzeCanary
+			canaryRoute    = commands.CreateCanaryRouteName("myapp-1.0.2")
+			err            error
+		)
+
+		BeforeEach(func() {
+			dir, err = ioutil.TempDir("", "metrics")
+			Expect(err).ShouldNot(HaveOccurred())
+			path := filepath.Join(dir, "metrics.yml")
+			Expect(ioutil.WriteFile(path, []byte(fmt.Sprintf(`url: %s
+queries:
+- name: error rate
+  query: errors{app="{{.App}}"}
+  max: 0.01
+`, server.URL)), 0644)).Should(Succeed())
+
+			fakeConnection = new(fakes.FakeCliConnection)
+			fakeConnection.CliCommandWithoutTerminalOutputStub = httpDomains(nil)
+			fakeConnection.GetAppStub = func(name string) (plugin_models.GetAppModel, error) {
+				host := "myapp"
+				if name == "myapp-1.0.2" {
+					host = canaryRoute
+				}
+				return plugin_models.GetAppModel{Name: name, Routes: []plugin_models.GetApp_RouteSummary{
+					{Host: host, Domain: plugin_models.GetApp_DomainFields{Name: "example.com"}},
+				}}, nil
+			}
+			fakeCommon = new(fakes.FakeCommonCmd)
+			promote = new(fakes.FakeCmdRunner)
+			cfZddCmd = &commands.CfZddCmd{
+				CmdName:       commands.AnalyzeCanaryCmdName,
+				NewApp:        "myapp-1.0.2",
+				OldApp:        "myapp-1.0.1",
+				MetricsConfig: path,
+				Conn:          fakeConnection,
+				Commands:      fakeCommon,
+			}
+			analyze = &commands.AnalyzeCanary{
+				Client:     &probeClient{statuses: map[string]int{canaryRoute + ".example.com": 200, "myapp.example.com": 200}},
+				PromoteCmd: promote,
+			}
+			analyze.SetArgs(cfZddCmd)
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		Context("when the canary metrics pass", func() {
+			BeforeEach(func() {
+				values[`errors{app="myapp-1.0.2"}`] = "0"
+				err = analyze.Run()
+			})
+			It("should promote the canary", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(promote.RunSpy).Should(Equal(1))
+			})
+		})
+		Context("when the canary metrics fail", func() {
+			BeforeEach(func() {
+				values[`errors{app="myapp-1.0.2"}`] = "0.5"
+				err = analyze.Run()
+			})
+			It("should tear the canary down", func() {
+				Expect(err).Should(HaveOccurred())
+				Expect(promote.RunSpy).Should(Equal(0))
+				Expect(fakeCommon.RemoveApplicationArgsForCall(0)).Should(Equal("myapp-1.0.2"))
+			})
+		})
+		Context("when the metrics server cannot be read", func() {
+			BeforeEach(func() {
+				server.Close()
+				err = analyze.Run()
+			})
+			It("should leave the canary in place", func() {
+				Expect(err).Should(HaveOccurred())
+				Expect(promote.RunSpy).Should(Equal(0))
+				Expect(fakeCommon.RemoveApplicationCallCount()).Should(Equal(0))
+			})
+		})
+	})
+})
@@ -1,22 +1,69 @@
 package commands
 
-import "code.cloudfoundry.org/cli/plugin"
+import (
+	"time"
+
+	"code.cloudfoundry.org/cli/plugin"
+)
 
 // CfZddCmd - struct to initialize.
 type CfZddCmd struct {
-	Conn            plugin.CliConnection
-	CmdName         string
-	OldApp          string
-	NewApp          string
-	ManifestPath    string
-	ApplicationPath string
-	Duration        string
-	CustomURL       string
-	BatchSize       int
-	RouteCheck      bool
-	HelpTopic       string
-	BaseAppName     string
-	Commands        CommonCmd
+	Conn              plugin.CliConnection
+	CmdName           string
+	OldApp            string
+	NewApp            string
+	ManifestPath      string
+	ApplicationPath   string
+	Duration          string
+	CustomURL         string
+	BatchSize         int
+	RouteCheck        bool
+	HelpTopic         string
+	BaseAppName       string
+	Timeout           string
+	SourceSpace       string
+	SourceApp         string
+	FailureReport     string
+	KeepPrevious      bool
+	KeepVersions      int
+	Strategy          string
+	Force             bool
+	Arguments         []string
+	LockTTL           time.Duration
+	LockedFamily      string
+	LockExpiresAt     time.Time
+	GitSHA            string
+	StartedAt         time.Time
+	JSONOutput        bool
+	Resume            string
+	ScaleoverStep     func(oldApp *AppStatus, newApp *AppStatus)
+	CanaryInstances   string
+	CanaryMemory      string
+	CanaryDisk        string
+	CanaryHostname    string
+	CanaryDomain      string
+	CanaryLiveTraffic bool
+	BakePeriod        time.Duration
+	ProbeInterval     time.Duration
+	MinSuccessRate    float64
+	MaxLatencyRatio   float64
+	MaxP95            time.Duration
+	CheckStatus       int
+	CheckBody         string
+	MetricsConfig     string
+	CaptureLogs       bool
+	SmokeTestPath     string
+	SmokeTestCmd      string
+	SmokeTestTimeout  time.Duration
+	KeepOld           time.Duration
+	KeepOldStopped    bool
+	RepairRoutes      bool
+	HooksPath         string
+	PreCutoverTask    string
+	TaskTimeout       time.Duration
+	StagingTimeout    time.Duration
+	StartTimeout      time.Duration
+	Commands          CommonCmd
 }
 
 // const - exported constants
@@ -0,0 +1,194 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/cli/plugin"
+)
+
+// PackagePollInterval - time between checks on an uploaded package being processed
+var PackagePollInterval = 2 * time.Second
+
+// uploadClient - http client uploading to the cloud controller, honouring the ssl validation the cli was targeted with
+func uploadClient(conn plugin.CliConnection) clientDoer {
+	skipSSL, _ := conn.IsSSLDisabled()
+	return &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: skipSSL},
+	}}
+}
+
+// uploadPackage - create a bits package of an application from the artifact and wait until the cloud controller has
+// processed it. A directory is zipped, an archive such as a jar, war or zip is uploaded as it is. 'cf curl' cannot send
+// the multipart upload, the bits go to the cloud controller directly with the token of the cli.
+func uploadPackage(conn plugin.CliConnection, client clientDoer, appName string, appGUID string, path string,
+	timeout time.Duration) (packageGUID string, err error) {
+	if timeout <= 0 {
+		timeout = DefaultStagingTimeout
+	}
+	bits, err := packageBits(path)
+	if err != nil {
+		return
+	}
+
+	pkg := new(ccResource)
+	packageBody := map[string]interface{}{
+		"type": "bits",
+		"relationships": map[string]interface{}{
+			"app": map[string]interface{}{"data": map[string]string{"guid": appGUID}},
+		},
+	}
+	if err = CCCurl(conn, "POST", "/v3/packages", packageBody, pkg); err != nil {
+		return
+	}
+	if pkg.GUID == "" {
+		return "", fmt.Errorf("no package was created for %s", appName)
+	}
+
+	fmt.Printf("Uploading %d bytes to package %s of %s\n", len(bits), pkg.GUID, appName)
+	if err = uploadBits(conn, client, "/v3/packages/"+pkg.GUID+"/upload", bits); err != nil {
+		return "", fmt.Errorf("unable to upload the bits of %s: %s", appName, err.Error())
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		if err = CCCurl(conn, "GET", "/v3/packages/"+pkg.GUID, nil, pkg); err != nil {
+			return
+		}
+		switch pkg.State {
+		case "READY":
+			return pkg.GUID, nil
+		case "FAILED", "EXPIRED":
+			return "", fmt.Errorf("package %s of %s is %s", pkg.GUID, appName, pkg.State)
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("package %s of %s was not processed within %s", pkg.GUID, appName, timeout)
+		}
+		time.Sleep(PackagePollInterval)
+	}
+}
+
+// uploadBits - post the zipped bits as the multipart form the package upload endpoint takes
+func uploadBits(conn plugin.CliConnection, client clientDoer, path string, bits []byte) (err error) {
+	endpoint, err := conn.ApiEndpoint()
+	if err != nil {
+		return
+	}
+	token, err := conn.AccessToken()
+	if err != nil {
+		return
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("bits", "application.zip")
+	if err != nil {
+		return
+	}
+	if _, err = part.Write(bits); err != nil {
+		return
+	}
+	if err = form.Close(); err != nil {
+		return
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimRight(endpoint, "/")+path, &body)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Authorization", token)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		response, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(response)))
+	}
+	return nil
+}
+
+// packageBits - the zip archive uploaded for an artifact, the current directory when none is given
+func packageBits(path string) ([]byte, error) {
+	if path == "" {
+		path = "."
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		bits, err := ioutil.ReadFile(path)
+		if err == nil && !bytes.HasPrefix(bits, []byte("PK")) {
+			err = fmt.Errorf("%s is neither a directory nor a zip archive", path)
+		}
+		return bits, err
+	}
+
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+	err = filepath.Walk(path, func(file string, info os.FileInfo, walkErr error) error {
+		if walkErr != nil || file == path {
+			return walkErr
+		}
+		name, err := filepath.Rel(path, file)
+		if err != nil {
+			return err
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+		if info.IsDir() {
+			header.Name += "/"
+			_, err = writer.CreateHeader(header)
+			return err
+		}
+		header.Method = zip.Deflate
+		entry, err := writer.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		content, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer content.Close()
+		_, err = io.Copy(entry, content)
+		return err
+	})
+	if err == nil {
+		err = writer.Close()
+	}
+	return archive.Bytes(), err
+}
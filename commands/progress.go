@@ -0,0 +1,162 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"code.cloudfoundry.org/cli/plugin"
+)
+
+// Phases of a deployment, in the order they are passed
+const (
+	PhasePushing   = "pushing"
+	PhaseStaging   = "staging"
+	PhaseScaling   = "scaling"
+	PhaseFinishing = "finishing"
+)
+
+// Ways to resume an interrupted deployment
+const (
+	ResumeContinue = "continue"
+	ResumeRollback = "rollback"
+)
+
+// DeploymentProgress - how far a deployment got, persisted so an interrupted deployment can be continued or rolled
+// back from where it stopped
+type DeploymentProgress struct {
+	Strategy     string    `json:"strategy"`
+	Phase        string    `json:"phase"`
+	OldApp       string    `json:"old_app"`
+	Venerable    string    `json:"venerable"`
+	NewApp       string    `json:"new_app"`
+	OldInstances int       `json:"old_instances"`
+	NewInstances int       `json:"new_instances"`
+	Routes       []string  `json:"routes,omitempty"`
+	StartedAt    time.Time `json:"started_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// InterruptedError - returned when a deployment finds an earlier deployment of the family that did not finish
+type InterruptedError struct {
+	BaseName string
+	Progress *DeploymentProgress
+}
+
+func (e *InterruptedError) Error() string {
+	return fmt.Sprintf("deployment of %s over %s was interrupted while %s at %s, rerun with -resume %s or -resume %s",
+		e.Progress.NewApp, e.Progress.Venerable, e.Progress.Phase, e.Progress.UpdatedAt.Format(time.RFC3339),
+		ResumeContinue, ResumeRollback)
+}
+
+// The progress of a deployment is an annotation of the version it started from, labelled so it is found again by its
+// family. The version keeps its guid through the renames of the deployment, and annotating apps only takes the space
+// developer role the deployment needs anyway.
+const (
+	ProgressLabel      = "zdd.comcast.com/in-progress"
+	ProgressAnnotation = "zdd.comcast.com/progress"
+)
+
+// progressApp - the version holding the progress of a deployment of an application family, nil when there is none
+func progressApp(conn plugin.CliConnection, baseName string) (*ccApp, error) {
+	space, err := conn.GetCurrentSpace()
+	if err != nil {
+		return nil, err
+	}
+	apps := new(struct {
+		Resources []ccApp `json:"resources"`
+	})
+	selector := url.QueryEscape(ProgressLabel + "=" + labelValue(baseName))
+	if err = CCCurl(conn, "GET", "/v3/apps?label_selector="+selector+"&space_guids="+space.Guid, nil, apps); err != nil {
+		return nil, err
+	}
+	if len(apps.Resources) == 0 {
+		return nil, nil
+	}
+	return &apps.Resources[0], nil
+}
+
+// GetDeploymentProgress - progress of an unfinished deployment of an application family, nil when there is none
+func (c *commonCmd) GetDeploymentProgress(baseName string) (progress *DeploymentProgress, err error) {
+	app, err := progressApp(c.cli, baseName)
+	if err != nil || app == nil {
+		return
+	}
+	progress = new(DeploymentProgress)
+	if err = json.Unmarshal([]byte(app.Metadata.Annotations[ProgressAnnotation]), progress); err != nil {
+		return nil, fmt.Errorf("unreadable deployment progress of %s on %s: %s", baseName, app.Name, err.Error())
+	}
+	return
+}
+
+// SaveDeploymentProgress - persist the progress of a deployment on the version it started from, nil once it finished
+// or was rolled back
+func (c *commonCmd) SaveDeploymentProgress(baseName string, progress *DeploymentProgress) (err error) {
+	app, err := progressApp(c.cli, baseName)
+	if err != nil {
+		return
+	}
+	if progress == nil {
+		if app == nil {
+			return nil
+		}
+		return setProgress(c.cli, app.GUID, nil, nil)
+	}
+
+	if app == nil {
+		// Saved first before the old version is renamed, found by the venerable name when resuming after the rename
+		for _, name := range []string{progress.OldApp, progress.Venerable} {
+			if app, err = appByName(c.cli, name); err != nil || app != nil {
+				break
+			}
+		}
+		if err != nil {
+			return
+		}
+		if app == nil {
+			return fmt.Errorf("neither %s nor %s found to record the progress on", progress.OldApp, progress.Venerable)
+		}
+	}
+	progress.UpdatedAt = time.Now().UTC()
+	value, err := json.Marshal(progress)
+	if err != nil {
+		return
+	}
+	label, annotation := labelValue(baseName), string(value)
+	return setProgress(c.cli, app.GUID, &label, &annotation)
+}
+
+// setProgress - label and annotate the version holding the progress, nil values remove both
+func setProgress(conn plugin.CliConnection, appGUID string, label *string, annotation *string) error {
+	body := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels":      map[string]*string{ProgressLabel: label},
+			"annotations": map[string]*string{ProgressAnnotation: annotation},
+		},
+	}
+	return CCCurl(conn, "PATCH", "/v3/apps/"+appGUID, body, nil)
+}
+
+// saveProgress - a deployment carries on when its progress cannot be saved, it only becomes harder to resume
+func saveProgress(args *CfZddCmd, baseName string, progress *DeploymentProgress) {
+	if err := args.Commands.SaveDeploymentProgress(baseName, progress); err != nil {
+		fmt.Printf("Unable to save deployment progress of %s: %s\n", baseName, err.Error())
+	}
+}
@@ -0,0 +1,92 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands_test
+
+import (
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/comcast/cf-zdd-plugin/commands"
+	"github.com/comcast/cf-zdd-plugin/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("deployment progress", func() {
+	var (
+		fakeConnection *fakes.FakeCliConnection
+		cmd            commands.CommonCmd
+		apps           *spaceApps
+	)
+
+	BeforeEach(func() {
+		fakeConnection = new(fakes.FakeCliConnection)
+		fakeConnection.GetCurrentSpaceReturns(plugin_models.Space{SpaceFields: plugin_models.SpaceFields{Guid: "space-guid"}}, nil)
+		apps = newSpaceApps()
+		apps.add("old-guid", "myapp-1.0.1", nil)
+		fakeConnection.CliCommandWithoutTerminalOutputStub = apps.respond
+		cmd = commands.NewCommonCmd(fakeConnection)
+	})
+
+	Context("when no deployment is in progress", func() {
+		It("should return no progress", func() {
+			progress, err := cmd.GetDeploymentProgress("myapp")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(progress).Should(BeNil())
+		})
+	})
+
+	Context("when the progress of a deployment is saved", func() {
+		var progress *commands.DeploymentProgress
+
+		BeforeEach(func() {
+			progress = &commands.DeploymentProgress{
+				Strategy:  commands.ZddDeployCmdName,
+				Phase:     commands.PhasePushing,
+				OldApp:    "myapp-1.0.1",
+				Venerable: "myapp-1.0.1-venerable",
+				NewApp:    "myapp-1.0.2",
+			}
+			Expect(cmd.SaveDeploymentProgress("myapp", progress)).Should(Succeed())
+		})
+		It("should be kept as an annotation of the version the deployment started from", func() {
+			Expect(apps.apps["old-guid"].Metadata.Labels).Should(HaveKeyWithValue(commands.ProgressLabel, "myapp"))
+			Expect(apps.apps["old-guid"].Metadata.Annotations).Should(HaveKey(commands.ProgressAnnotation))
+			saved, err := cmd.GetDeploymentProgress("myapp")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(saved.Phase).Should(Equal(commands.PhasePushing))
+			Expect(saved.NewApp).Should(Equal("myapp-1.0.2"))
+			Expect(saved.UpdatedAt.IsZero()).Should(BeFalse())
+		})
+		It("should follow the version once it is renamed", func() {
+			apps.apps["old-guid"].Name = "myapp-1.0.1-venerable"
+			progress.Phase, progress.OldInstances, progress.NewInstances = commands.PhaseScaling, 2, 1
+			Expect(cmd.SaveDeploymentProgress("myapp", progress)).Should(Succeed())
+			saved, err := cmd.GetDeploymentProgress("myapp")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(saved.Phase).Should(Equal(commands.PhaseScaling))
+			Expect(saved.OldInstances).Should(Equal(2))
+			Expect(apps.apps).Should(HaveLen(1))
+		})
+		It("should be removed once the deployment finished", func() {
+			Expect(cmd.SaveDeploymentProgress("myapp", nil)).Should(Succeed())
+			Expect(apps.apps["old-guid"].Metadata.Labels).ShouldNot(HaveKey(commands.ProgressLabel))
+			Expect(apps.apps["old-guid"].Metadata.Annotations).ShouldNot(HaveKey(commands.ProgressAnnotation))
+			progress, err := cmd.GetDeploymentProgress("myapp")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(progress).Should(BeNil())
+		})
+	})
+})
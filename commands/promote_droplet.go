@@ -0,0 +1,308 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// PromoteDroplet - struct
+type PromoteDroplet struct {
+	args         *CfZddCmd
+	ScaleoverCmd ScaleoverCommand
+}
+
+// PromoteDropletCmdName - constants
+const (
+	PromoteDropletCmdName = "promote-droplet"
+)
+
+// DropletPollInterval - time between checks on the state of a droplet being copied
+var DropletPollInterval = 2 * time.Second
+
+// ccDroplet - v3 droplet resource
+type ccDroplet struct {
+	GUID     string `json:"guid"`
+	State    string `json:"state"`
+	Error    string `json:"error"`
+	Checksum struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	} `json:"checksum"`
+}
+
+// ccProcess - the start command and health check of the web process of a v3 app. A null command is the one the
+// buildpack detected.
+type ccProcess struct {
+	Command     *string `json:"command"`
+	HealthCheck struct {
+		Type string `json:"type"`
+		Data struct {
+			Endpoint          *string `json:"endpoint,omitempty"`
+			Timeout           *int    `json:"timeout,omitempty"`
+			InvocationTimeout *int    `json:"invocation_timeout,omitempty"`
+		} `json:"data"`
+	} `json:"health_check"`
+}
+
+func init() {
+	Register(PromoteDropletCmdName, new(PromoteDroplet))
+}
+
+// Run - Run method
+func (s *PromoteDroplet) Run() (err error) {
+	err = withDeploymentLock(s.args, lockFamily(s.args, s.args.NewApp), s.promote)
+	return
+}
+
+// SetArgs - set command args
+func (s *PromoteDroplet) SetArgs(args *CfZddCmd) {
+	s.args = args
+}
+
+func (s *PromoteDroplet) promote() (err error) {
+	var (
+		searchAppName string
+		venerable     string
+	)
+
+	if s.ScaleoverCmd == nil {
+		s.ScaleoverCmd = NewScaleoverCmd(s.args)
+	}
+
+	applicationToDeploy := s.args.NewApp
+	sourceApp := s.args.SourceApp
+	if sourceApp == "" {
+		sourceApp = applicationToDeploy
+	}
+
+	if s.args.SourceSpace == "" {
+		return errors.New("source space must be specified")
+	}
+	if s.args.Duration == "" {
+		s.args.Duration = DefaultDuration
+	}
+
+	fmt.Printf("Calling promote-droplet with args: Application=%s, sourceApp=%s, sourceSpace=%s\n", applicationToDeploy, sourceApp, s.args.SourceSpace)
+
+	source, err := s.currentDroplet(sourceApp, s.args.SourceSpace)
+	if err != nil {
+		return
+	}
+
+	if s.args.BaseAppName != "" {
+		searchAppName = s.args.BaseAppName
+	} else {
+		searchAppName = applicationToDeploy
+	}
+
+	oldApplication, isAppDeployed := s.args.Commands.IsApplicationDeployed(searchAppName)
+	if !isAppDeployed {
+		return fmt.Errorf("no live version of %s in the target space, deploy it with %s before promoting droplets", searchAppName, ZddDeployCmdName)
+	}
+
+	oldApp, err := s.args.Conn.GetApp(oldApplication)
+	if err != nil {
+		return
+	}
+
+	if oldApplication == applicationToDeploy {
+		venerable = oldApplication + "-venerable"
+		err = handleLeftovers(s.args, searchAppName, oldApplication, venerable, false)
+	} else {
+		venerable = oldApplication
+		err = handleLeftovers(s.args, searchAppName, oldApplication, "", false)
+	}
+	if err != nil {
+		return
+	}
+	if err = runHooks(s.args, HookPrePush, applicationToDeploy, oldApplication); err != nil {
+		captureFailure(s.args, applicationToDeploy, oldApplication)
+		return
+	}
+	if venerable != oldApplication {
+		if err = s.args.Commands.RenameApplication(oldApplication, venerable); err != nil {
+			captureFailure(s.args, applicationToDeploy, oldApplication)
+			return
+		}
+	}
+	fmt.Printf("Venerable version assigned to %s\n", venerable)
+
+	if err = s.createApplication(applicationToDeploy, venerable, oldApp.Guid, source); err != nil {
+		fmt.Println(err.Error())
+		captureFailure(s.args, applicationToDeploy, venerable)
+		restoreVenerable(s.args.Commands, applicationToDeploy, oldApplication, venerable)
+		return
+	}
+	for _, stage := range []string{HookPostPush, HookPreCutover} {
+		if err = runHooks(s.args, stage, applicationToDeploy, venerable); err != nil {
+			captureFailure(s.args, applicationToDeploy, venerable)
+			restoreVenerable(s.args.Commands, applicationToDeploy, oldApplication, venerable)
+			return
+		}
+	}
+
+	// Do the scaleover
+	s.args.OldApp = venerable
+
+	if err = s.ScaleoverCmd.DoScaleover(); err != nil {
+		fmt.Println(err.Error())
+		captureFailure(s.args, applicationToDeploy, venerable)
+		return
+	}
+
+	record := newDeploymentRecord(s.args, searchAppName, venerable)
+	record.Checksum = source.Checksum.Type + ":" + source.Checksum.Value
+	recordDeployment(s.args, applicationToDeploy, record)
+
+	fmt.Printf("Removing app: %s\n", venerable)
+	if err = s.args.Commands.RemoveApplication(venerable); err != nil {
+		fmt.Printf("Unable to remove old application: %s, error: %s\n", venerable, err.Error())
+		return
+	}
+	// The new version is to serve every route the old version had
+	if err = VerifyCutover(s.args, oldApp.Routes, applicationToDeploy, venerable); err != nil {
+		fmt.Println(err.Error())
+		captureFailure(s.args, applicationToDeploy, venerable)
+		return
+	}
+	return runHooks(s.args, HookPostCutover, applicationToDeploy, venerable)
+}
+
+// currentDroplet - find the droplet currently used by an application in another space
+func (s *PromoteDroplet) currentDroplet(appName string, spaceName string) (droplet *ccDroplet, err error) {
+	space, err := s.args.Conn.GetSpace(spaceName)
+	if err != nil {
+		return
+	}
+
+	apps := new(ccResourceList)
+	if err = CCCurl(s.args.Conn, "GET", "/v3/apps?names="+url.QueryEscape(appName)+"&space_guids="+space.Guid, nil, apps); err != nil {
+		return
+	}
+	if len(apps.Resources) == 0 {
+		return nil, fmt.Errorf("application %s not found in space %s", appName, spaceName)
+	}
+
+	droplet = new(ccDroplet)
+	err = CCCurl(s.args.Conn, "GET", "/v3/apps/"+apps.Resources[0].GUID+"/droplets/current", nil, droplet)
+	return
+}
+
+// createApplication - create the new application stopped and without instances, running a copy of the source
+// droplet with the configuration, services and routes of the live version
+func (s *PromoteDroplet) createApplication(appName string, liveApp string, liveAppGUID string, source *ccDroplet) (err error) {
+	space, err := s.args.Conn.GetCurrentSpace()
+	if err != nil {
+		return
+	}
+
+	app := new(ccResource)
+	appBody := map[string]interface{}{
+		"name": appName,
+		"relationships": map[string]interface{}{
+			"space": map[string]interface{}{"data": map[string]string{"guid": space.Guid}},
+		},
+	}
+	if err = CCCurl(s.args.Conn, "POST", "/v3/apps", appBody, app); err != nil {
+		return
+	}
+
+	copied, err := s.copyDroplet(source, app.GUID)
+	if err != nil {
+		return
+	}
+	currentDropletBody := map[string]interface{}{"data": map[string]string{"guid": copied.GUID}}
+	if err = CCCurl(s.args.Conn, "PATCH", "/v3/apps/"+app.GUID+"/relationships/current_droplet", currentDropletBody, nil); err != nil {
+		return
+	}
+
+	if err = s.copyConfiguration(liveApp, liveAppGUID, appName, app.GUID); err != nil {
+		return
+	}
+	return s.args.Commands.MapRoutes(liveApp, appName)
+}
+
+// copyDroplet - copy the droplet to the application and wait for the copy to complete
+func (s *PromoteDroplet) copyDroplet(source *ccDroplet, appGUID string) (droplet *ccDroplet, err error) {
+	droplet = new(ccDroplet)
+	copyBody := map[string]interface{}{
+		"relationships": map[string]interface{}{
+			"app": map[string]interface{}{"data": map[string]string{"guid": appGUID}},
+		},
+	}
+	if err = CCCurl(s.args.Conn, "POST", "/v3/droplets?source_guid="+source.GUID, copyBody, droplet); err != nil {
+		return
+	}
+
+	for droplet.State != "STAGED" {
+		switch droplet.State {
+		case "FAILED", "EXPIRED":
+			return nil, fmt.Errorf("copy of droplet %s %s: %s", source.GUID, droplet.State, droplet.Error)
+		}
+		time.Sleep(DropletPollInterval)
+		if err = CCCurl(s.args.Conn, "GET", "/v3/droplets/"+droplet.GUID, nil, droplet); err != nil {
+			return
+		}
+	}
+
+	if droplet.Checksum.Value != source.Checksum.Value {
+		return nil, fmt.Errorf("checksum of droplet %s does not match source droplet %s", droplet.GUID, source.GUID)
+	}
+	fmt.Printf("Copied droplet %s, %s checksum %s\n", droplet.GUID, droplet.Checksum.Type, droplet.Checksum.Value)
+	return
+}
+
+// copyConfiguration - apply the environment, service bindings, memory and disk limits, start command and health check
+// of the live version
+func (s *PromoteDroplet) copyConfiguration(liveApp string, liveAppGUID string, appName string, appGUID string) (err error) {
+	env := make(map[string]interface{})
+	if err = CCCurl(s.args.Conn, "GET", "/v3/apps/"+liveAppGUID+"/environment_variables", nil, &env); err != nil {
+		return
+	}
+	if vars, ok := env["var"].(map[string]interface{}); ok && len(vars) > 0 {
+		if err = CCCurl(s.args.Conn, "PATCH", "/v3/apps/"+appGUID+"/environment_variables", map[string]interface{}{"var": vars}, nil); err != nil {
+			return
+		}
+	}
+
+	live, err := s.args.Conn.GetApp(liveApp)
+	if err != nil {
+		return
+	}
+	for _, service := range live.Services {
+		if _, err = s.args.Conn.CliCommand("bind-service", appName, service.Name); err != nil {
+			return
+		}
+	}
+
+	scaleArgs := []string{"scale", appName, "-m", strconv.FormatInt(live.Memory, 10) + "M", "-k", strconv.FormatInt(live.DiskQuota, 10) + "M", "-f"}
+	if _, err = s.args.Conn.CliCommand(scaleArgs...); err != nil {
+		return
+	}
+
+	// The start command and health check of the live version may differ from those the droplet was staged with
+	process := new(ccProcess)
+	if err = CCCurl(s.args.Conn, "GET", "/v3/apps/"+liveAppGUID+"/processes/web", nil, process); err != nil {
+		return
+	}
+	return CCCurl(s.args.Conn, "PATCH", "/v3/apps/"+appGUID+"/processes/web", process, nil)
+}
@@ -0,0 +1,234 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands_test
+
+import (
+	"errors"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/comcast/cf-zdd-plugin/commands"
+	"github.com/comcast/cf-zdd-plugin/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("promoteDroplet", func() {
+
+	Describe(".init", func() {
+		Context("when the package is imported", func() {
+			It("should then be registered with the command repo", func() {
+				_, ok := commands.GetRegistry()[commands.PromoteDropletCmdName]
+				Expect(ok).Should(BeTrue())
+			})
+		})
+	})
+
+	Describe("with a valid arg and run method", func() {
+		var (
+			err            error
+			promoteDroplet *commands.PromoteDroplet
+			cfZddCmd       *commands.CfZddCmd
+			fakeConnection *fakes.FakeCliConnection
+			fakeCommon     *fakes.FakeCommonCmd
+			fakeScaleover  *fakes.FakeScaleoverCommand
+			responses      map[string]string
+		)
+
+		BeforeEach(func() {
+			commands.DropletPollInterval = 0
+
+			fakeConnection = new(fakes.FakeCliConnection)
+			fakeCommon = new(fakes.FakeCommonCmd)
+			fakeScaleover = new(fakes.FakeScaleoverCommand)
+
+			fakeCommon.IsApplicationDeployedReturns("myTestApp#1.2.2-abcde", true)
+			fakeConnection.GetSpaceReturns(plugin_models.GetSpace_Model{
+				GetSpaces_Model: plugin_models.GetSpaces_Model{Guid: "staging-guid", Name: "staging"},
+			}, nil)
+			fakeConnection.GetCurrentSpaceReturns(plugin_models.Space{
+				SpaceFields: plugin_models.SpaceFields{Guid: "prod-guid", Name: "prod"},
+			}, nil)
+			fakeConnection.GetAppReturns(plugin_models.GetAppModel{
+				Guid:      "live-guid",
+				Memory:    512,
+				DiskQuota: 1024,
+				Services:  []plugin_models.GetApp_ServiceSummary{{Name: "mydb"}},
+			}, nil)
+
+			responses = map[string]string{
+				"GET /v3/apps?names=myTestApp%231.2.3-abcde&space_guids=staging-guid": `{"resources": [{"guid": "source-guid"}]}`,
+				"GET /v3/apps/source-guid/droplets/current":                          `{"guid": "source-droplet", "state": "STAGED", "checksum": {"type": "sha256", "value": "abc123"}}`,
+				"POST /v3/apps":                                                       `{"guid": "new-guid"}`,
+				"POST /v3/droplets?source_guid=source-droplet":                        `{"guid": "copied-droplet", "state": "COPYING"}`,
+				"GET /v3/droplets/copied-droplet":                                     `{"guid": "copied-droplet", "state": "STAGED", "checksum": {"type": "sha256", "value": "abc123"}}`,
+				"GET /v3/apps/live-guid/environment_variables":                        `{"var": {"LOG_LEVEL": "info"}}`,
+				"GET /v3/apps/live-guid/processes/web":                               `{"command": "bin/start", "health_check": {"type": "http", "data": {"endpoint": "/health", "timeout": 60}}}`,
+			}
+			fakeConnection.CliCommandWithoutTerminalOutputStub = curlResponder(responses)
+
+			cfZddCmd = &commands.CfZddCmd{
+				CmdName:     commands.PromoteDropletCmdName,
+				NewApp:      "myTestApp#1.2.3-abcde",
+				BaseAppName: "myTestApp",
+				SourceSpace: "staging",
+				Conn:        fakeConnection,
+				Commands:    fakeCommon,
+			}
+
+			promoteDroplet = &commands.PromoteDroplet{ScaleoverCmd: fakeScaleover}
+			promoteDroplet.SetArgs(cfZddCmd)
+		})
+
+		Context("when called without a source space", func() {
+			BeforeEach(func() {
+				cfZddCmd.SourceSpace = ""
+				err = promoteDroplet.Run()
+			})
+			It("should return an error", func() {
+				Expect(err).Should(HaveOccurred())
+				Expect(fakeCommon.IsApplicationDeployedCallCount()).Should(Equal(0))
+			})
+		})
+
+		Context("when the application is not deployed in the targeted space", func() {
+			BeforeEach(func() {
+				fakeCommon.IsApplicationDeployedReturns("", false)
+				err = promoteDroplet.Run()
+			})
+			It("should return an error without creating an application", func() {
+				Expect(err).Should(HaveOccurred())
+				Expect(curlRequests(fakeConnection)).ShouldNot(ContainElement("POST /v3/apps"))
+			})
+		})
+
+		Context("when the droplet is copied", func() {
+			BeforeEach(func() {
+				err = promoteDroplet.Run()
+			})
+			It("should not return an error", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+			It("should run the copied droplet in the new application", func() {
+				Expect(curlRequests(fakeConnection)).Should(ContainElement("PATCH /v3/apps/new-guid/relationships/current_droplet"))
+			})
+			It("should copy the configuration of the live version", func() {
+				Expect(curlRequests(fakeConnection)).Should(ContainElement("PATCH /v3/apps/new-guid/environment_variables"))
+				Expect(fakeConnection.CliCommandArgsForCall(0)).Should(Equal([]string{"bind-service", "myTestApp#1.2.3-abcde", "mydb"}))
+				Expect(fakeConnection.CliCommandArgsForCall(1)).Should(Equal([]string{"scale", "myTestApp#1.2.3-abcde", "-m", "512M", "-k", "1024M", "-f"}))
+			})
+			It("should copy the start command and health check of the live version", func() {
+				var patch []string
+				for i := 0; i < fakeConnection.CliCommandWithoutTerminalOutputCallCount(); i++ {
+					if args := fakeConnection.CliCommandWithoutTerminalOutputArgsForCall(i); args[1] == "/v3/apps/new-guid/processes/web" {
+						patch = args
+					}
+				}
+				Expect(patch).Should(Equal([]string{"curl", "/v3/apps/new-guid/processes/web", "-X", "PATCH", "-d",
+					`{"command":"bin/start","health_check":{"type":"http","data":{"endpoint":"/health","timeout":60}}}`}))
+			})
+			It("should map the live routes to the new application", func() {
+				Expect(fakeCommon.MapRoutesCallCount()).Should(Equal(1))
+				from, to := fakeCommon.MapRoutesArgsForCall(0)
+				Expect(from).Should(Equal("myTestApp#1.2.2-abcde"))
+				Expect(to).Should(Equal("myTestApp#1.2.3-abcde"))
+			})
+			It("should scale over and remove the old version", func() {
+				Expect(fakeScaleover.DoScaleoverCallCount()).Should(Equal(1))
+				Expect(cfZddCmd.OldApp).Should(Equal("myTestApp#1.2.2-abcde"))
+				Expect(fakeCommon.RemoveApplicationArgsForCall(0)).Should(Equal("myTestApp#1.2.2-abcde"))
+			})
+		})
+
+		Context("when the routes are checked after the cutover", func() {
+			www := plugin_models.GetApp_RouteSummary{Host: "www", Domain: plugin_models.GetApp_DomainFields{Name: "example.com"}}
+
+			BeforeEach(func() {
+				fakeConnection.GetAppReturns(plugin_models.GetAppModel{Guid: "live-guid", Routes: []plugin_models.GetApp_RouteSummary{www}}, nil)
+			})
+			It("should pass once the old version is removed and the new one serves its routes", func() {
+				fakeConnection.GetAppStub = func(name string) (plugin_models.GetAppModel, error) {
+					if name == "myTestApp#1.2.2-abcde" && fakeCommon.RemoveApplicationCallCount() > 0 {
+						return plugin_models.GetAppModel{}, errors.New("App " + name + " not found")
+					}
+					return plugin_models.GetAppModel{Guid: "live-guid", Routes: []plugin_models.GetApp_RouteSummary{www}}, nil
+				}
+				Expect(promoteDroplet.Run()).Should(Succeed())
+			})
+			It("should fail and record the failure when the old version still serves a route", func() {
+				err = promoteDroplet.Run()
+				Expect(err).Should(MatchError(ContainSubstring("routes were not cut over from myTestApp#1.2.2-abcde to myTestApp#1.2.3-abcde")))
+				Expect(fakeCommon.RecordFailureCallCount()).Should(Equal(1))
+			})
+		})
+
+		Context("when an earlier promotion left the new version behind", func() {
+			BeforeEach(func() {
+				fakeCommon.ListApplicationsReturns([]plugin_models.GetAppsModel{
+					{Name: "myTestApp#1.2.2-abcde", State: "started", Routes: []plugin_models.GetAppsRouteSummary{{Host: "myapp"}}},
+					{Name: "myTestApp#1.2.3-abcde", State: "stopped"},
+				}, nil)
+				err = promoteDroplet.Run()
+			})
+			It("should remove it before creating the new application", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(fakeCommon.ListApplicationsArgsForCall(0)).Should(Equal("myTestApp"))
+				Expect(fakeCommon.RemoveApplicationArgsForCall(0)).Should(Equal("myTestApp#1.2.3-abcde"))
+			})
+		})
+
+		Context("when the new version name already serves the live routes", func() {
+			BeforeEach(func() {
+				fakeCommon.ListApplicationsReturns([]plugin_models.GetAppsModel{
+					{Name: "myTestApp#1.2.3-abcde", State: "started", Routes: []plugin_models.GetAppsRouteSummary{{Host: "myapp"}}},
+				}, nil)
+				err = promoteDroplet.Run()
+			})
+			It("should refuse to promote over it", func() {
+				Expect(err).Should(BeAssignableToTypeOf(&commands.LeftoverError{}))
+				Expect(curlRequests(fakeConnection)).ShouldNot(ContainElement("POST /v3/apps"))
+				Expect(fakeCommon.RemoveApplicationCallCount()).Should(Equal(0))
+			})
+		})
+
+		Context("when the copied droplet does not match the source", func() {
+			BeforeEach(func() {
+				responses["GET /v3/droplets/copied-droplet"] = `{"guid": "copied-droplet", "state": "STAGED", "checksum": {"type": "sha256", "value": "def456"}}`
+				err = promoteDroplet.Run()
+			})
+			It("should remove the new application and not scale over", func() {
+				Expect(err).Should(HaveOccurred())
+				Expect(fakeScaleover.DoScaleoverCallCount()).Should(Equal(0))
+				Expect(fakeCommon.RemoveApplicationArgsForCall(0)).Should(Equal("myTestApp#1.2.3-abcde"))
+			})
+		})
+
+		Context("when redeploying the live version name", func() {
+			BeforeEach(func() {
+				fakeCommon.IsApplicationDeployedReturns("myTestApp#1.2.3-abcde", true)
+				responses["GET /v3/droplets/copied-droplet"] = `{"guid": "copied-droplet", "state": "FAILED", "error": "copy failed"}`
+				err = promoteDroplet.Run()
+			})
+			It("should restore the venerable version when the copy fails", func() {
+				Expect(err).Should(HaveOccurred())
+				Expect(fakeCommon.RenameApplicationCallCount()).Should(Equal(2))
+				from, to := fakeCommon.RenameApplicationArgsForCall(1)
+				Expect(from).Should(Equal("myTestApp#1.2.3-abcde-venerable"))
+				Expect(to).Should(Equal("myTestApp#1.2.3-abcde"))
+			})
+		})
+	})
+})
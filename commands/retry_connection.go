@@ -0,0 +1,254 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/cli/plugin"
+	"code.cloudfoundry.org/cli/plugin/models"
+)
+
+// Retry defaults
+const (
+	DefaultRetryAttempts = 3
+	DefaultRetryDelay    = 2 * time.Second
+	DefaultMaxRetryDelay = 30 * time.Second
+)
+
+// permanentErrors - failures that retrying will not fix
+var permanentErrors = []string{
+	"not found",
+	"does not exist",
+	"unauthorized",
+	"not authorized",
+	"forbidden",
+	"not logged in",
+	"quota",
+	"already exists",
+	"already taken",
+	"invalid",
+}
+
+// transientCCErrors - cloud controller error titles returned for failures expected to clear on their own
+var transientCCErrors = []string{
+	"UnknownError",
+	"CF-ServiceUnavailable",
+	"CF-RateLimitExceeded",
+}
+
+// readCommands - cf commands only reading from the cloud controller, repeated after a failure. The cli reports every
+// failure of a command alike, so one changing the space, such as push, rename or delete, is never repeated when the
+// outcome of the first attempt is unknown.
+var readCommands = []string{"app", "apps", "routes", "domains", "events", "space", "spaces"}
+
+// stateCommands - cf commands setting an app to a given state, which repeating leaves as one attempt would
+var stateCommands = []string{"start", "stop"}
+
+// RetryPolicy - number of attempts and the exponential backoff between them
+type RetryPolicy struct {
+	Attempts  int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// Backoff - delay before the next attempt, doubling with each attempt up to the maximum with half of it jittered
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << uint(attempt-1)
+	if delay > p.MaxDelay || delay <= 0 {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := int64(delay) / 2
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// IsRetryableError - true for failures that are expected to be transient, false for permanent failures such as an
+// application not being found, the user not being authorized or a quota being exceeded
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	message := strings.ToLower(err.Error())
+	for _, permanent := range permanentErrors {
+		if strings.Contains(message, permanent) {
+			return false
+		}
+	}
+	return true
+}
+
+// transientResponseError - a cf curl response from the router or cloud controller reporting a transient failure
+type transientResponseError struct {
+	response string
+}
+
+func (e *transientResponseError) Error() string {
+	return "transient cloud controller response: " + e.response
+}
+
+// retryingCliConnection - plugin.CliConnection decorator retrying the calls that reach the cloud controller
+type retryingCliConnection struct {
+	plugin.CliConnection
+	policy RetryPolicy
+	sleep  func(time.Duration)
+}
+
+// NewRetryingCliConnection - wrap a connection so transient failures are retried according to the policy
+func NewRetryingCliConnection(conn plugin.CliConnection, policy RetryPolicy) plugin.CliConnection {
+	if policy.Attempts < 1 {
+		policy.Attempts = 1
+	}
+	return &retryingCliConnection{
+		CliConnection: conn,
+		policy:        policy,
+		sleep:         time.Sleep,
+	}
+}
+
+// do - run the call until it succeeds, fails permanently or runs out of attempts
+func (c *retryingCliConnection) do(description string, call func() error) (err error) {
+	for attempt := 1; ; attempt++ {
+		if err = call(); err == nil || !IsRetryableError(err) || attempt >= c.policy.Attempts {
+			return
+		}
+		delay := c.policy.Backoff(attempt)
+		fmt.Printf("%s failed (attempt %d of %d): %s, retrying in %s\n", description, attempt, c.policy.Attempts, err.Error(), delay)
+		c.sleep(delay)
+	}
+}
+
+func (c *retryingCliConnection) CliCommandWithoutTerminalOutput(args ...string) (output []string, err error) {
+	if !isIdempotent(args) {
+		return c.CliConnection.CliCommandWithoutTerminalOutput(args...)
+	}
+	err = c.do("cf "+strings.Join(args, " "), func() (callErr error) {
+		if output, callErr = c.CliConnection.CliCommandWithoutTerminalOutput(args...); callErr == nil {
+			callErr = checkCurlResponse(args, output)
+		}
+		return
+	})
+	// The last response is handed back as is so the caller reports what the cloud controller returned
+	if _, ok := err.(*transientResponseError); ok {
+		err = nil
+	}
+	return
+}
+
+func (c *retryingCliConnection) CliCommand(args ...string) (output []string, err error) {
+	if !isIdempotent(args) {
+		return c.CliConnection.CliCommand(args...)
+	}
+	err = c.do("cf "+strings.Join(args, " "), func() (callErr error) {
+		output, callErr = c.CliConnection.CliCommand(args...)
+		return
+	})
+	return
+}
+
+func (c *retryingCliConnection) GetApp(appName string) (app plugin_models.GetAppModel, err error) {
+	err = c.do("get app "+appName, func() (callErr error) {
+		app, callErr = c.CliConnection.GetApp(appName)
+		return
+	})
+	return
+}
+
+func (c *retryingCliConnection) GetApps() (apps []plugin_models.GetAppsModel, err error) {
+	err = c.do("get apps", func() (callErr error) {
+		apps, callErr = c.CliConnection.GetApps()
+		return
+	})
+	return
+}
+
+func (c *retryingCliConnection) GetSpace(spaceName string) (space plugin_models.GetSpace_Model, err error) {
+	err = c.do("get space "+spaceName, func() (callErr error) {
+		space, callErr = c.CliConnection.GetSpace(spaceName)
+		return
+	})
+	return
+}
+
+// isIdempotent - only reads can safely be repeated, curl requests are reads unless they set a method other than GET
+func isIdempotent(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	if args[0] == "curl" {
+		for idx, arg := range args[:len(args)-1] {
+			if arg == "-X" && !strings.EqualFold(args[idx+1], "GET") {
+				return false
+			}
+		}
+		return true
+	}
+	for _, command := range append(readCommands, stateCommands...) {
+		if args[0] == command {
+			return true
+		}
+	}
+	return isInstanceScale(args)
+}
+
+// isInstanceScale - 'scale -i N app' sets the number of instances, changing the memory or disk restarts the app
+func isInstanceScale(args []string) bool {
+	if args[0] != "scale" {
+		return false
+	}
+	instances := false
+	for idx := 1; idx < len(args); idx++ {
+		switch {
+		case args[idx] == "-i" && idx+1 < len(args):
+			instances = true
+			idx++
+		case strings.HasPrefix(args[idx], "-"):
+			return false
+		}
+	}
+	return instances
+}
+
+// checkCurlResponse - gateway errors come back as html or plain text and overloaded cloud controllers report specific
+// error titles, both of which are worth retrying
+func checkCurlResponse(args []string, output []string) error {
+	if args[0] != "curl" {
+		return nil
+	}
+	response := strings.TrimSpace(strings.Join(output, "\n"))
+	if response == "" {
+		return nil
+	}
+	if !strings.HasPrefix(response, "{") && !strings.HasPrefix(response, "[") {
+		return &transientResponseError{response: response}
+	}
+	ccErrors := new(CCErrors)
+	if err := json.Unmarshal([]byte(response), ccErrors); err == nil {
+		for _, title := range transientCCErrors {
+			if ccErrors.HasTitle(title) {
+				return &transientResponseError{response: ccErrors.Error()}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands_test
+
+import (
+	"errors"
+	"time"
+
+	"code.cloudfoundry.org/cli/plugin"
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/comcast/cf-zdd-plugin/commands"
+	"github.com/comcast/cf-zdd-plugin/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("retryingCliConnection", func() {
+	var (
+		fakeConnection *fakes.FakeCliConnection
+		conn           plugin.CliConnection
+		err            error
+	)
+
+	BeforeEach(func() {
+		fakeConnection = new(fakes.FakeCliConnection)
+		conn = commands.NewRetryingCliConnection(fakeConnection, commands.RetryPolicy{Attempts: 3})
+	})
+
+	Describe(".GetApp", func() {
+		Context("when the first call fails with a transient error", func() {
+			BeforeEach(func() {
+				fakeConnection.GetAppReturnsOnCall(0, plugin_models.GetAppModel{}, errors.New("502 Bad Gateway"))
+				fakeConnection.GetAppReturnsOnCall(1, plugin_models.GetAppModel{Name: "myapp"}, nil)
+			})
+			It("should retry and return the application", func() {
+				app, err := conn.GetApp("myapp")
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(app.Name).Should(Equal("myapp"))
+				Expect(fakeConnection.GetAppCallCount()).Should(Equal(2))
+			})
+		})
+		Context("when every call fails with a transient error", func() {
+			BeforeEach(func() {
+				fakeConnection.GetAppReturns(plugin_models.GetAppModel{}, errors.New("503 Service Unavailable"))
+				_, err = conn.GetApp("myapp")
+			})
+			It("should give up after the configured attempts", func() {
+				Expect(err).Should(HaveOccurred())
+				Expect(fakeConnection.GetAppCallCount()).Should(Equal(3))
+			})
+		})
+		Context("when the application is not found", func() {
+			BeforeEach(func() {
+				fakeConnection.GetAppReturns(plugin_models.GetAppModel{}, errors.New("App myapp not found"))
+				_, err = conn.GetApp("myapp")
+			})
+			It("should not retry", func() {
+				Expect(err).Should(HaveOccurred())
+				Expect(fakeConnection.GetAppCallCount()).Should(Equal(1))
+			})
+		})
+	})
+
+	Describe(".CliCommandWithoutTerminalOutput", func() {
+		Context("when a curl request gets a gateway error page", func() {
+			BeforeEach(func() {
+				fakeConnection.CliCommandWithoutTerminalOutputReturnsOnCall(0, []string{"<html><body>502 Bad Gateway</body></html>"}, nil)
+				fakeConnection.CliCommandWithoutTerminalOutputReturnsOnCall(1, []string{`{"guid": "app-guid"}`}, nil)
+			})
+			It("should retry the request", func() {
+				output, err := conn.CliCommandWithoutTerminalOutput("curl", "/v3/apps/app-guid", "-X", "GET")
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(output).Should(Equal([]string{`{"guid": "app-guid"}`}))
+				Expect(fakeConnection.CliCommandWithoutTerminalOutputCallCount()).Should(Equal(2))
+			})
+		})
+		Context("when a curl request keeps getting an unavailable cloud controller", func() {
+			var output []string
+			BeforeEach(func() {
+				fakeConnection.CliCommandWithoutTerminalOutputReturns([]string{
+					`{"errors": [{"code": 10015, "title": "CF-ServiceUnavailable", "detail": "Service unavailable"}]}`}, nil)
+				output, err = conn.CliCommandWithoutTerminalOutput("curl", "/v3/apps/app-guid", "-X", "GET")
+			})
+			It("should hand back the last response after the configured attempts", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(output[0]).Should(ContainSubstring("CF-ServiceUnavailable"))
+				Expect(fakeConnection.CliCommandWithoutTerminalOutputCallCount()).Should(Equal(3))
+			})
+		})
+		Context("when a curl request returns a permanent cloud controller error", func() {
+			BeforeEach(func() {
+				fakeConnection.CliCommandWithoutTerminalOutputReturns([]string{
+					`{"errors": [{"code": 10010, "title": "CF-ResourceNotFound", "detail": "App not found"}]}`}, nil)
+				_, err = conn.CliCommandWithoutTerminalOutput("curl", "/v3/apps/app-guid", "-X", "GET")
+			})
+			It("should not retry", func() {
+				Expect(fakeConnection.CliCommandWithoutTerminalOutputCallCount()).Should(Equal(1))
+			})
+		})
+		Context("when a curl request creating a resource gets a gateway error page", func() {
+			BeforeEach(func() {
+				fakeConnection.CliCommandWithoutTerminalOutputReturns([]string{"502 Bad Gateway"}, nil)
+				_, err = conn.CliCommandWithoutTerminalOutput("curl", "/v3/deployments", "-X", "POST", "-d", "{}")
+			})
+			It("should not repeat the request", func() {
+				Expect(fakeConnection.CliCommandWithoutTerminalOutputCallCount()).Should(Equal(1))
+			})
+		})
+		Context("when a curl request changing a resource gets a gateway error page", func() {
+			BeforeEach(func() {
+				fakeConnection.CliCommandWithoutTerminalOutputReturns([]string{"502 Bad Gateway"}, nil)
+				_, err = conn.CliCommandWithoutTerminalOutput("curl", "/v3/apps/app-guid", "-X", "PATCH", "-d", "{}")
+			})
+			It("should not repeat the request", func() {
+				Expect(fakeConnection.CliCommandWithoutTerminalOutputCallCount()).Should(Equal(1))
+			})
+		})
+	})
+
+	Describe(".CliCommand", func() {
+		Context("when a command fails with a transient error", func() {
+			BeforeEach(func() {
+				fakeConnection.CliCommandReturnsOnCall(0, nil, errors.New("Error executing cli core command"))
+				_, err = conn.CliCommand("app", "myapp")
+			})
+			It("should retry the command", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(fakeConnection.CliCommandCallCount()).Should(Equal(2))
+			})
+		})
+		Context("when a command changing the space fails", func() {
+			BeforeEach(func() {
+				fakeConnection.CliCommandReturns(nil, errors.New("Error executing cli core command"))
+			})
+			It("should not repeat it", func() {
+				for _, command := range [][]string{
+					{"rename", "myapp", "myapp-venerable"},
+					{"push", "myapp", "-f", "manifest.yml"},
+					{"map-route", "myapp", "example.com", "-n", "myapp"},
+					{"scale", "myapp", "-i", "4", "-m", "1G"},
+					{"delete", "myapp", "-f"},
+				} {
+					_, err = conn.CliCommand(command...)
+					Expect(err).Should(HaveOccurred())
+				}
+				Expect(fakeConnection.CliCommandCallCount()).Should(Equal(5))
+			})
+		})
+		Context("when a command setting the instances or state of an app fails with a transient error", func() {
+			BeforeEach(func() {
+				fakeConnection.CliCommandStub = func(args ...string) ([]string, error) {
+					if fakeConnection.CliCommandCallCount()%2 == 1 {
+						return nil, errors.New("Error executing cli core command")
+					}
+					return nil, nil
+				}
+			})
+			It("should repeat it, as repeating it leaves the app as one attempt would", func() {
+				for _, command := range [][]string{
+					{"scale", "-i", "4", "myapp"},
+					{"start", "myapp"},
+					{"stop", "myapp"},
+				} {
+					_, err = conn.CliCommand(command...)
+					Expect(err).ShouldNot(HaveOccurred())
+				}
+				Expect(fakeConnection.CliCommandCallCount()).Should(Equal(6))
+			})
+		})
+	})
+
+	Describe(".IsRetryableError", func() {
+		It("should classify transient and permanent errors", func() {
+			Expect(commands.IsRetryableError(nil)).Should(BeFalse())
+			Expect(commands.IsRetryableError(errors.New("connection reset by peer"))).Should(BeTrue())
+			Expect(commands.IsRetryableError(errors.New("App myapp not found"))).Should(BeFalse())
+			Expect(commands.IsRetryableError(errors.New("You are not authorized to perform the requested action"))).Should(BeFalse())
+			Expect(commands.IsRetryableError(errors.New("You have exceeded your organization's memory limit: app requested more memory than available (quota)"))).Should(BeFalse())
+		})
+	})
+
+	Describe(".Backoff", func() {
+		It("should grow exponentially up to the maximum delay", func() {
+			policy := commands.RetryPolicy{Attempts: 5, BaseDelay: time.Second, MaxDelay: 3 * time.Second}
+			Expect(policy.Backoff(1)).Should(BeNumerically("~", 750*time.Millisecond, 250*time.Millisecond))
+			Expect(policy.Backoff(2)).Should(BeNumerically("~", 1500*time.Millisecond, 500*time.Millisecond))
+			Expect(policy.Backoff(4)).Should(BeNumerically("~", 2250*time.Millisecond, 750*time.Millisecond))
+		})
+	})
+})
@@ -0,0 +1,248 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+)
+
+// Rollback - struct
+type Rollback struct {
+	args         *CfZddCmd
+	ScaleoverCmd ScaleoverCommand
+}
+
+// RollbackCmdName - constants
+const (
+	RollbackCmdName           = "rollback"
+	RollbackStrategyScaleover = "scaleover"
+	RollbackStrategyBlueGreen = "blue-green"
+)
+
+func init() {
+	Register(RollbackCmdName, new(Rollback))
+}
+
+// Run - Run method
+func (s *Rollback) Run() (err error) {
+	err = withDeploymentLock(s.args, lockFamily(s.args, s.args.NewApp), s.rollback)
+	return
+}
+
+// SetArgs - set command args
+func (s *Rollback) SetArgs(args *CfZddCmd) {
+	s.args = args
+}
+
+func (s *Rollback) rollback() (err error) {
+	var searchAppName string
+
+	if s.ScaleoverCmd == nil {
+		s.ScaleoverCmd = NewScaleoverCmd(s.args)
+	}
+
+	if s.args.BaseAppName != "" {
+		searchAppName = s.args.BaseAppName
+	} else {
+		searchAppName = s.args.NewApp
+	}
+	if searchAppName == "" {
+		return errors.New("application name must be specified")
+	}
+
+	if s.args.Strategy == "" {
+		s.args.Strategy = RollbackStrategyScaleover
+	}
+	if s.args.Strategy != RollbackStrategyScaleover && s.args.Strategy != RollbackStrategyBlueGreen {
+		return fmt.Errorf("unknown rollback strategy %s, expected %s or %s", s.args.Strategy, RollbackStrategyScaleover, RollbackStrategyBlueGreen)
+	}
+
+	apps, err := s.args.Commands.ListApplications(searchAppName)
+	if err != nil {
+		return
+	}
+	live, previous, err := s.findVersions(searchAppName, apps)
+	if err != nil {
+		return
+	}
+	fmt.Printf("Rolling back %s to %s using %s\n", live, previous, s.args.Strategy)
+
+	if s.args.Strategy == RollbackStrategyBlueGreen {
+		err = s.flipRoutes(live, previous)
+	} else {
+		err = s.scaleover(live, previous)
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+		captureFailure(s.args, previous, live)
+		return
+	}
+
+	fmt.Printf("Removing app: %s\n", live)
+	if err = s.args.Commands.RemoveApplication(live); err != nil {
+		fmt.Printf("Unable to remove rolled back application: %s, error: %s\n", live, err.Error())
+		return
+	}
+	// A redeployment under the same name renamed the previous version, give it its name back
+	if previous == live+"-venerable" {
+		if err = s.args.Commands.RenameApplication(previous, live); err != nil {
+			return
+		}
+		previous = live
+	}
+	recordDeployment(s.args, previous, newDeploymentRecord(s.args, searchAppName, live))
+	return runHooks(s.args, HookOnRollback, previous, live)
+}
+
+// findVersions - the live version is the started application with routes, the previous version the one retained
+// stopped and without routes by a deployment run with -keep-previous, unless it is named with -old-app
+func (s *Rollback) findVersions(searchAppName string, apps []plugin_models.GetAppsModel) (live string, previous string, err error) {
+	var candidates []string
+
+	for _, app := range apps {
+		if app.State == "started" && len(app.Routes) > 0 {
+			if live != "" {
+				return "", "", fmt.Errorf("more than one live version of %s, a deployment may be in progress", searchAppName)
+			}
+			live = app.Name
+		} else if app.State != "started" && len(app.Routes) == 0 {
+			candidates = append(candidates, app.Name)
+		}
+	}
+	if live == "" {
+		return "", "", fmt.Errorf("no live version of %s found", searchAppName)
+	}
+
+	if s.args.OldApp != "" {
+		for _, app := range apps {
+			if app.Name == s.args.OldApp && app.Name != live {
+				return live, app.Name, nil
+			}
+		}
+		return "", "", fmt.Errorf("previous version %s not found", s.args.OldApp)
+	}
+
+	switch len(candidates) {
+	case 0:
+		err = fmt.Errorf("no previous version of %s retained, deploy with -keep-previous to allow rollbacks", searchAppName)
+	case 1:
+		previous = candidates[0]
+	default:
+		previous, err = s.mostRecent(searchAppName, candidates)
+	}
+	return
+}
+
+// mostRecent - the most recently deployed of several retained versions, according to their deployment metadata
+func (s *Rollback) mostRecent(searchAppName string, candidates []string) (string, error) {
+	versions, err := s.args.Commands.ListVersions(searchAppName)
+	if err != nil {
+		return "", err
+	}
+	for _, version := range versions {
+		for _, candidate := range candidates {
+			if version.Name == candidate {
+				return candidate, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("several previous versions of %s retained without deployment metadata, choose one with -old-app", searchAppName)
+}
+
+// scaleover - share the routes of the live version with the previous one and shift the instances back to it
+func (s *Rollback) scaleover(live string, previous string) (err error) {
+	if err = s.args.Commands.MapRoutes(live, previous); err != nil {
+		return
+	}
+	if s.args.Duration == "" {
+		s.args.Duration = DefaultDuration
+	}
+	s.args.OldApp = live
+	s.args.NewApp = previous
+	return s.ScaleoverCmd.DoScaleover()
+}
+
+// flipRoutes - start the previous version with as many instances as the live one, then move the routes over at once
+func (s *Rollback) flipRoutes(live string, previous string) (err error) {
+	liveApp, err := s.args.Conn.GetApp(live)
+	if err != nil {
+		return
+	}
+	if _, err = s.args.Conn.CliCommand("scale", previous, "-i", strconv.Itoa(liveApp.InstanceCount)); err != nil {
+		return
+	}
+	if _, err = s.args.Conn.CliCommand("start", previous); err != nil {
+		return
+	}
+
+	if err = waitForInstances(s.args, previous); err != nil {
+		return
+	}
+	fmt.Println("All instances started, remapping route.")
+	if err = s.args.Commands.RemapRoutes(live, previous); err != nil {
+		return
+	}
+	return VerifyCutover(s.args, liveApp.Routes, previous, live)
+}
+
+// retireVersion - remove the version replaced by a deployment, or keep it stopped and unrouted with -keep-previous or
+// -keep-versions, pruning the oldest versions beyond the number to keep
+func retireVersion(args *CfZddCmd, baseName string, live string, appName string) {
+	keep := versionsToKeep(args)
+	if keep == 0 {
+		fmt.Printf("Removing app: %s\n", appName)
+		if err := args.Commands.RemoveApplication(appName); err != nil {
+			fmt.Printf("Unable to remove old application: %s, error: %s\n", appName, err.Error())
+		}
+		return
+	}
+	fmt.Printf("Retaining app for rollback: %s\n", appName)
+	if err := args.Commands.RetainApplication(appName); err != nil {
+		fmt.Printf("Unable to retain old application: %s, error: %s\n", appName, err.Error())
+	}
+	pruneVersions(args, baseName, live, keep)
+}
+
+// clearVenerableName - a version retained by an earlier deployment holds the name the live version is renamed to. It
+// is removed when a single version is kept, otherwise it is renamed after the time it was moved aside.
+func clearVenerableName(args *CfZddCmd, venerable string) {
+	apps, err := args.Commands.ListApplications(venerable)
+	if err != nil {
+		return
+	}
+	for _, app := range apps {
+		if app.Name != venerable {
+			continue
+		}
+		if versionsToKeep(args) > 1 {
+			retained := venerable + "-" + time.Now().UTC().Format("20060102150405")
+			fmt.Printf("Renaming previously retained app %s to %s\n", venerable, retained)
+			err = args.Commands.RenameApplication(venerable, retained)
+		} else {
+			fmt.Printf("Removing previously retained app: %s\n", venerable)
+			err = args.Commands.RemoveApplication(venerable)
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+	}
+}
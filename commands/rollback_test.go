@@ -0,0 +1,192 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands_test
+
+import (
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/comcast/cf-zdd-plugin/commands"
+	"github.com/comcast/cf-zdd-plugin/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("rollback", func() {
+
+	Describe(".init", func() {
+		Context("when the package is imported", func() {
+			It("should then be registered with the command repo", func() {
+				_, ok := commands.GetRegistry()[commands.RollbackCmdName]
+				Expect(ok).Should(BeTrue())
+			})
+		})
+	})
+
+	Describe("with a valid arg and run method", func() {
+		var (
+			err            error
+			rollback       *commands.Rollback
+			cfZddCmd       *commands.CfZddCmd
+			fakeConnection *fakes.FakeCliConnection
+			fakeCommon     *fakes.FakeCommonCmd
+			fakeScaleover  *fakes.FakeScaleoverCommand
+			route          = plugin_models.GetAppsRouteSummary{Host: "myapp"}
+		)
+
+		BeforeEach(func() {
+			fakeConnection = new(fakes.FakeCliConnection)
+			fakeCommon = new(fakes.FakeCommonCmd)
+			fakeScaleover = new(fakes.FakeScaleoverCommand)
+			commands.InstancePollInterval = 0
+
+			cfZddCmd = &commands.CfZddCmd{
+				CmdName:     commands.RollbackCmdName,
+				NewApp:      "myapp-1.2.3",
+				BaseAppName: "myapp",
+				Conn:        fakeConnection,
+				Commands:    fakeCommon,
+			}
+			rollback = new(commands.Rollback)
+			rollback.SetArgs(cfZddCmd)
+			rollback.ScaleoverCmd = fakeScaleover
+		})
+
+		Context("when a previous version was retained", func() {
+			BeforeEach(func() {
+				fakeCommon.ListApplicationsReturns([]plugin_models.GetAppsModel{
+					{Name: "myapp-1.2.2", State: "stopped"},
+					{Name: "myapp-1.2.3", State: "started", Routes: []plugin_models.GetAppsRouteSummary{route}},
+				}, nil)
+			})
+
+			Context("and the scaleover strategy is used", func() {
+				BeforeEach(func() {
+					err = rollback.Run()
+				})
+				It("should share the routes and scale over to the previous version", func() {
+					Expect(err).ShouldNot(HaveOccurred())
+					from, to := fakeCommon.MapRoutesArgsForCall(0)
+					Expect(from).Should(Equal("myapp-1.2.3"))
+					Expect(to).Should(Equal("myapp-1.2.2"))
+					Expect(fakeScaleover.DoScaleoverCallCount()).Should(Equal(1))
+					Expect(cfZddCmd.OldApp).Should(Equal("myapp-1.2.3"))
+					Expect(cfZddCmd.NewApp).Should(Equal("myapp-1.2.2"))
+				})
+				It("should delete the bad version", func() {
+					Expect(fakeCommon.RemoveApplicationArgsForCall(0)).Should(Equal("myapp-1.2.3"))
+					Expect(fakeCommon.RenameApplicationCallCount()).Should(Equal(0))
+				})
+			})
+
+			Context("and the blue-green strategy is used", func() {
+				BeforeEach(func() {
+					cfZddCmd.Strategy = commands.RollbackStrategyBlueGreen
+					fakeConnection.GetAppReturns(plugin_models.GetAppModel{
+						InstanceCount:    3,
+						RunningInstances: 3,
+					}, nil)
+					err = rollback.Run()
+				})
+				It("should start the previous version with as many instances as the live version", func() {
+					Expect(err).ShouldNot(HaveOccurred())
+					Expect(fakeConnection.CliCommandArgsForCall(0)).Should(Equal([]string{"scale", "myapp-1.2.2", "-i", "3"}))
+					Expect(fakeConnection.CliCommandArgsForCall(1)).Should(Equal([]string{"start", "myapp-1.2.2"}))
+				})
+				It("should flip the routes and delete the bad version", func() {
+					from, to := fakeCommon.RemapRoutesArgsForCall(0)
+					Expect(from).Should(Equal("myapp-1.2.3"))
+					Expect(to).Should(Equal("myapp-1.2.2"))
+					Expect(fakeScaleover.DoScaleoverCallCount()).Should(Equal(0))
+					Expect(fakeCommon.RemoveApplicationArgsForCall(0)).Should(Equal("myapp-1.2.3"))
+				})
+			})
+		})
+
+		Context("when the previous version was renamed by a redeployment", func() {
+			BeforeEach(func() {
+				cfZddCmd.BaseAppName = ""
+				cfZddCmd.NewApp = "myapp"
+				fakeCommon.ListApplicationsReturns([]plugin_models.GetAppsModel{
+					{Name: "myapp", State: "started", Routes: []plugin_models.GetAppsRouteSummary{route}},
+					{Name: "myapp-venerable", State: "stopped"},
+				}, nil)
+				err = rollback.Run()
+			})
+			It("should give the previous version its name back", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(fakeCommon.RemoveApplicationArgsForCall(0)).Should(Equal("myapp"))
+				from, to := fakeCommon.RenameApplicationArgsForCall(0)
+				Expect(from).Should(Equal("myapp-venerable"))
+				Expect(to).Should(Equal("myapp"))
+			})
+		})
+
+		Context("when no previous version was retained", func() {
+			BeforeEach(func() {
+				fakeCommon.ListApplicationsReturns([]plugin_models.GetAppsModel{
+					{Name: "myapp-1.2.3", State: "started", Routes: []plugin_models.GetAppsRouteSummary{route}},
+				}, nil)
+				err = rollback.Run()
+			})
+			It("should return an error without touching the live version", func() {
+				Expect(err).Should(HaveOccurred())
+				Expect(fakeScaleover.DoScaleoverCallCount()).Should(Equal(0))
+				Expect(fakeCommon.RemoveApplicationCallCount()).Should(Equal(0))
+			})
+		})
+
+		Context("when several previous versions were retained", func() {
+			BeforeEach(func() {
+				fakeCommon.ListApplicationsReturns([]plugin_models.GetAppsModel{
+					{Name: "myapp-1.2.1", State: "stopped"},
+					{Name: "myapp-1.2.2", State: "stopped"},
+					{Name: "myapp-1.2.3", State: "started", Routes: []plugin_models.GetAppsRouteSummary{route}},
+				}, nil)
+			})
+			It("should restore the most recently deployed version", func() {
+				fakeCommon.ListVersionsReturns([]commands.AppVersion{
+					{Name: "myapp-1.2.3", State: "STARTED"},
+					{Name: "myapp-1.2.2", State: "STOPPED"},
+					{Name: "myapp-1.2.1", State: "STOPPED"},
+				}, nil)
+				err = rollback.Run()
+				Expect(err).ShouldNot(HaveOccurred())
+				_, to := fakeCommon.MapRoutesArgsForCall(0)
+				Expect(to).Should(Equal("myapp-1.2.2"))
+			})
+			It("should require the version to be named without deployment metadata", func() {
+				err = rollback.Run()
+				Expect(err).Should(HaveOccurred())
+			})
+			It("should restore the version named with old-app", func() {
+				cfZddCmd.OldApp = "myapp-1.2.1"
+				err = rollback.Run()
+				Expect(err).ShouldNot(HaveOccurred())
+				_, to := fakeCommon.MapRoutesArgsForCall(0)
+				Expect(to).Should(Equal("myapp-1.2.1"))
+			})
+		})
+
+		Context("when called with an unknown strategy", func() {
+			It("should return an error", func() {
+				cfZddCmd.Strategy = "canary"
+				err = rollback.Run()
+				Expect(err).Should(HaveOccurred())
+				Expect(fakeCommon.ListApplicationsCallCount()).Should(Equal(0))
+			})
+		})
+	})
+})
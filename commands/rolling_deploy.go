@@ -0,0 +1,288 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RollingDeploy - struct
+type RollingDeploy struct {
+	args        *CfZddCmd
+	FallbackCmd CommandRunnable
+	Client      clientDoer
+}
+
+// RollingDeployCmdName - constants
+const (
+	RollingDeployCmdName  = "deploy-rolling"
+	DefaultRollingTimeout = "10m"
+)
+
+// DeploymentPollInterval - time between checks on the state of a v3 deployment
+var DeploymentPollInterval = 10 * time.Second
+
+// ccDeployment - v3 deployment resource. Older cloud controllers only report 'state', newer ones report 'status'.
+type ccDeployment struct {
+	GUID   string `json:"guid"`
+	State  string `json:"state"`
+	Status struct {
+		Value  string `json:"value"`
+		Reason string `json:"reason"`
+	} `json:"status"`
+	NewProcesses []struct {
+		GUID string `json:"guid"`
+		Type string `json:"type"`
+	} `json:"new_processes"`
+}
+
+// outcome - normalize the deployment state to DEPLOYING, DEPLOYED, CANCELING or CANCELED
+func (d *ccDeployment) outcome() string {
+	switch d.Status.Value {
+	case "":
+		return d.State
+	case "FINALIZED":
+		return d.Status.Reason
+	default:
+		if d.Status.Reason == "CANCELING" {
+			return d.Status.Reason
+		}
+		return "DEPLOYING"
+	}
+}
+
+func init() {
+	Register(RollingDeployCmdName, new(RollingDeploy))
+}
+
+// Run - Run method
+func (s *RollingDeploy) Run() (err error) {
+	err = withDeploymentLock(s.args, lockFamily(s.args, s.args.NewApp), s.deploy)
+	return
+}
+
+// SetArgs - set command args
+func (s *RollingDeploy) SetArgs(args *CfZddCmd) {
+	s.args = args
+}
+
+func (s *RollingDeploy) deploy() (err error) {
+	var (
+		liveApplication string
+		isAppDeployed   bool
+		searchAppName   string
+		timeout         time.Duration
+	)
+
+	applicationToDeploy := s.args.NewApp
+	manifestPath := s.args.ManifestPath
+	artifactPath := s.args.ApplicationPath
+
+	fmt.Printf("Calling rolling deploy with args: Application=%s, manifestPath=%s, artifactPath=%s\n", applicationToDeploy, manifestPath, artifactPath)
+
+	if s.args.Timeout == "" {
+		s.args.Timeout = DefaultRollingTimeout
+	}
+	if timeout, err = time.ParseDuration(s.args.Timeout); err != nil {
+		return
+	}
+
+	if s.args.BaseAppName != "" {
+		searchAppName = s.args.BaseAppName
+	} else {
+		searchAppName = applicationToDeploy
+	}
+
+	liveApplication, isAppDeployed = s.args.Commands.IsApplicationDeployed(searchAppName)
+
+	if !isAppDeployed {
+		fmt.Printf("Initial deployment of %s\n", applicationToDeploy)
+		if err = runHooks(s.args, HookPrePush, applicationToDeploy, ""); err != nil {
+			captureFailure(s.args, applicationToDeploy, "")
+			return
+		}
+		if err = s.args.Commands.PushApplication(applicationToDeploy, artifactPath, manifestPath); err != nil {
+			fmt.Printf("Error occurred pushing application: %s\n", err.Error())
+			captureFailure(s.args, applicationToDeploy, "")
+			return
+		}
+		recordDeployment(s.args, applicationToDeploy, newDeploymentRecord(s.args, searchAppName, ""))
+		if err = runHooks(s.args, HookPostPush, applicationToDeploy, ""); err != nil {
+			captureFailure(s.args, applicationToDeploy, "")
+		}
+		return
+	}
+
+	supported, err := s.deploymentsSupported()
+	if err != nil {
+		return
+	}
+	if !supported {
+		fmt.Printf("Foundation does not support v3 deployments, falling back to %s\n", ZddDeployCmdName)
+		return s.fallback()
+	}
+	// A deployment only replaces the droplet, the configuration of the live application is left as it is
+	if manifestPath != "" {
+		return fmt.Errorf("%s does not apply a manifest to the running %s, deploy configuration changes with %s",
+			RollingDeployCmdName, liveApplication, ZddDeployCmdName)
+	}
+
+	app, err := s.args.Conn.GetApp(liveApplication)
+	if err != nil {
+		return
+	}
+
+	if err = runHooks(s.args, HookPrePush, applicationToDeploy, liveApplication); err != nil {
+		captureFailure(s.args, applicationToDeploy, liveApplication)
+		return
+	}
+	dropletGUID, err := s.stageDroplet(liveApplication, app.Guid)
+	if err != nil {
+		fmt.Printf("Error occurred staging application: %s\n", err.Error())
+		captureFailure(s.args, liveApplication, liveApplication)
+		return
+	}
+	// The new droplet is staged but not yet running, the deployment replaces the instances of the live application
+	for _, stage := range []string{HookPostPush, HookPreCutover} {
+		if err = runHooks(s.args, stage, applicationToDeploy, liveApplication); err != nil {
+			captureFailure(s.args, applicationToDeploy, liveApplication)
+			return
+		}
+	}
+
+	deployment := new(ccDeployment)
+	deploymentBody := map[string]interface{}{
+		"droplet": map[string]string{"guid": dropletGUID},
+		"relationships": map[string]interface{}{
+			"app": map[string]interface{}{"data": map[string]string{"guid": app.Guid}},
+		},
+	}
+	if err = CCCurl(s.args.Conn, "POST", "/v3/deployments", deploymentBody, deployment); err != nil {
+		captureFailure(s.args, liveApplication, liveApplication)
+		return
+	}
+	fmt.Printf("Created deployment %s for %s\n", deployment.GUID, liveApplication)
+
+	if err = s.waitForDeployment(deployment, timeout); err != nil {
+		fmt.Printf("Deployment failed: %s, cancelling and rolling back\n", err.Error())
+		captureFailure(s.args, liveApplication, liveApplication)
+		if cancelErr := s.cancelDeployment(deployment.GUID); cancelErr != nil {
+			fmt.Printf("Unable to cancel deployment %s: %s\n", deployment.GUID, cancelErr.Error())
+			return
+		}
+		// Cancelling returns the live application to its previous droplet
+		runHooks(s.args, HookOnRollback, liveApplication, liveApplication)
+		return
+	}
+
+	if liveApplication != applicationToDeploy {
+		if err = s.args.Commands.RenameApplication(liveApplication, applicationToDeploy); err != nil {
+			fmt.Println(err.Error())
+			recordDeployment(s.args, liveApplication, newDeploymentRecord(s.args, searchAppName, liveApplication))
+			return
+		}
+	}
+	recordDeployment(s.args, applicationToDeploy, newDeploymentRecord(s.args, searchAppName, liveApplication))
+	return runHooks(s.args, HookPostCutover, applicationToDeploy, liveApplication)
+}
+
+// deploymentsSupported - the deployments endpoint is unknown to cloud controllers that predate rolling deployments,
+// these answer with a not found error. Any other error is returned.
+func (s *RollingDeploy) deploymentsSupported() (supported bool, err error) {
+	err = CCCurl(s.args.Conn, "GET", "/v3/deployments?per_page=1", nil, nil)
+	if ccErrors, ok := err.(*CCErrors); ok && ccErrors.HasTitle("CF-NotFound") {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *RollingDeploy) fallback() error {
+	if s.FallbackCmd == nil {
+		s.FallbackCmd = new(ZddDeploy)
+	}
+	s.FallbackCmd.SetArgs(s.args)
+	return s.FallbackCmd.Run()
+}
+
+// stageDroplet - upload the artifact as a new package of the app and stage it, returning the resulting droplet
+func (s *RollingDeploy) stageDroplet(appName string, appGUID string) (dropletGUID string, err error) {
+	if s.Client == nil {
+		s.Client = uploadClient(s.args.Conn)
+	}
+	packageGUID, err := uploadPackage(s.args.Conn, s.Client, appName, appGUID, s.args.ApplicationPath, s.args.StagingTimeout)
+	if err != nil {
+		return
+	}
+	return stagePackage(s.args.Conn, appName, packageGUID, s.args.StagingTimeout)
+}
+
+// waitForDeployment - poll the deployment until it completes, reporting the progress of the new instances. An error is
+// returned when the deployment is cancelled, any new instance crashes, or the timeout elapses.
+func (s *RollingDeploy) waitForDeployment(deployment *ccDeployment, timeout time.Duration) (err error) {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		if err = CCCurl(s.args.Conn, "GET", "/v3/deployments/"+deployment.GUID, nil, deployment); err != nil {
+			return
+		}
+
+		switch deployment.outcome() {
+		case "DEPLOYED":
+			fmt.Printf("Deployment %s completed\n", deployment.GUID)
+			return
+		case "CANCELING", "CANCELED", "SUPERSEDED":
+			return fmt.Errorf("deployment %s was %s", deployment.GUID, deployment.outcome())
+		}
+
+		running, total, crashed := s.processProgress(deployment)
+		fmt.Printf("Deployment %s: %d of %d new instances running\n", deployment.GUID, running, total)
+		if crashed > 0 {
+			return fmt.Errorf("%d instance(s) of the new version crashed", crashed)
+		}
+
+		if time.Now().After(deadline) {
+			return errors.New("deployment did not complete within " + timeout.String())
+		}
+		time.Sleep(DeploymentPollInterval)
+	}
+}
+
+func (s *RollingDeploy) processProgress(deployment *ccDeployment) (running int, total int, crashed int) {
+	for _, process := range deployment.NewProcesses {
+		stats := new(ccResourceList)
+		if err := CCCurl(s.args.Conn, "GET", "/v3/processes/"+process.GUID+"/stats", nil, stats); err != nil {
+			fmt.Printf("Unable to read instance stats for process %s: %s\n", process.GUID, err.Error())
+			continue
+		}
+		for _, instance := range stats.Resources {
+			total++
+			switch instance.State {
+			case "RUNNING":
+				running++
+			case "CRASHED":
+				crashed++
+			}
+		}
+	}
+	return
+}
+
+func (s *RollingDeploy) cancelDeployment(deploymentGUID string) error {
+	return CCCurl(s.args.Conn, "POST", "/v3/deployments/"+deploymentGUID+"/actions/cancel", nil, nil)
+}
@@ -0,0 +1,263 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/comcast/cf-zdd-plugin/commands"
+	"github.com/comcast/cf-zdd-plugin/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("rollingDeploy", func() {
+
+	Describe(".init", func() {
+		Context("when the package is imported", func() {
+			It("should then be registered with the command repo", func() {
+				_, ok := commands.GetRegistry()[commands.RollingDeployCmdName]
+				Expect(ok).Should(BeTrue())
+			})
+		})
+	})
+
+	Describe("with a valid arg and run method", func() {
+		var (
+			err            error
+			rollingDeploy  *commands.RollingDeploy
+			cfZddCmd       *commands.CfZddCmd
+			fakeConnection *fakes.FakeCliConnection
+			fakeCommon     *fakes.FakeCommonCmd
+			fakeFallback   *fakes.FakeCmdRunner
+			uploadClient   *probeClient
+			responses      map[string]string
+		)
+
+		BeforeEach(func() {
+			commands.DeploymentPollInterval = 0
+			commands.PackagePollInterval = 0
+			commands.StagingPollInterval = 0
+
+			fakeConnection = new(fakes.FakeCliConnection)
+			fakeCommon = new(fakes.FakeCommonCmd)
+			fakeFallback = new(fakes.FakeCmdRunner)
+
+			fakeCommon.IsApplicationDeployedReturns("myTestApp#1.2.2-abcde", true)
+			fakeConnection.GetAppReturns(plugin_models.GetAppModel{Guid: "app-guid"}, nil)
+
+			responses = map[string]string{
+				"GET /v3/deployments?":                  `{"resources": []}`,
+				"POST /v3/packages":                     `{"guid": "package-guid", "state": "AWAITING_UPLOAD"}`,
+				"GET /v3/packages/package-guid":         `{"guid": "package-guid", "state": "READY"}`,
+				"POST /v3/builds":                       `{"guid": "build-guid", "state": "STAGING"}`,
+				"GET /v3/builds/build-guid":             `{"guid": "build-guid", "state": "STAGED", "droplet": {"guid": "droplet-guid"}}`,
+				"POST /v3/deployments":                  `{"guid": "deployment-guid", "state": "DEPLOYING"}`,
+				"GET /v3/deployments/deployment-guid":   `{"guid": "deployment-guid", "status": {"value": "FINALIZED", "reason": "DEPLOYED"}}`,
+				"POST /v3/deployments/deployment-guid/": `{}`,
+			}
+			fakeConnection.CliCommandWithoutTerminalOutputStub = curlResponder(responses)
+			fakeConnection.ApiEndpointReturns("https://api.example.com", nil)
+			fakeConnection.AccessTokenReturns("bearer token", nil)
+			uploadClient = &probeClient{statuses: map[string]int{"api.example.com": 201}}
+
+			cfZddCmd = &commands.CfZddCmd{
+				CmdName:         commands.RollingDeployCmdName,
+				NewApp:          "myTestApp#1.2.3-abcde",
+				BaseAppName:     "myTestApp",
+				ApplicationPath: "../fixtures",
+				Conn:            fakeConnection,
+				Commands:        fakeCommon,
+			}
+
+			rollingDeploy = &commands.RollingDeploy{FallbackCmd: fakeFallback, Client: uploadClient}
+			rollingDeploy.SetArgs(cfZddCmd)
+		})
+
+		Context("when called with an application not previously deployed", func() {
+			BeforeEach(func() {
+				fakeCommon.IsApplicationDeployedReturns("", false)
+				cfZddCmd.ManifestPath = "../fixtures/manifest.yml"
+				err = rollingDeploy.Run()
+			})
+			It("should push the application with the manifest and not return an error", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(fakeCommon.PushApplicationCallCount()).Should(Equal(1))
+				_, _, manifest, _ := fakeCommon.PushApplicationArgsForCall(0)
+				Expect(manifest).Should(Equal("../fixtures/manifest.yml"))
+				Expect(curlRequests(fakeConnection)).Should(BeEmpty())
+			})
+		})
+
+		Context("when a manifest is given for the live application", func() {
+			BeforeEach(func() {
+				cfZddCmd.ManifestPath = "../fixtures/manifest.yml"
+				err = rollingDeploy.Run()
+			})
+			It("should return an error rather than deploy without it", func() {
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).Should(ContainSubstring(commands.ZddDeployCmdName))
+				Expect(curlRequests(fakeConnection)).ShouldNot(ContainElement("POST /v3/packages"))
+				Expect(curlRequests(fakeConnection)).ShouldNot(ContainElement("POST /v3/deployments"))
+			})
+		})
+
+		Context("when the foundation does not support v3 deployments", func() {
+			BeforeEach(func() {
+				responses["GET /v3/deployments?"] = `{"errors": [{"code": 10000, "title": "CF-NotFound", "detail": "Unknown request"}]}`
+				err = rollingDeploy.Run()
+			})
+			It("should fall back to the zdd deployment", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(fakeFallback.RunSpy).Should(Equal(1))
+				Expect(fakeFallback.ArgsSpy).Should(Equal(cfZddCmd))
+			})
+		})
+
+		Context("when the cloud controller predates the v3 api", func() {
+			BeforeEach(func() {
+				notFound := `{"code": 10000, "description": "Unknown request", "error_code": "CF-NotFound"}`
+				fakeConnection.CliCommandWithoutTerminalOutputStub = curlResponder(map[string]string{
+					"GET /v3/":   notFound,
+					"POST /v3/":  notFound,
+					"PATCH /v3/": notFound,
+				})
+				fakeConnection.GetAppsReturns([]plugin_models.GetAppsModel{{Name: "myTestApp#1.2.2-abcde", State: "started"}}, nil)
+				cfZddCmd.Commands = commands.NewCommonCmd(fakeConnection)
+				cfZddCmd.ManifestPath = "../fixtures/manifest.yml"
+				err = rollingDeploy.Run()
+			})
+			It("should deploy without the lock and fall back to the zdd deployment with the manifest", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(fakeFallback.RunSpy).Should(Equal(1))
+				Expect(curlRequests(fakeConnection)).ShouldNot(ContainElement("POST /v3/packages"))
+			})
+		})
+
+		Context("when the deployments cannot be listed", func() {
+			BeforeEach(func() {
+				responses["GET /v3/deployments?"] = `{"errors": [{"code": 10003, "title": "CF-NotAuthorized", "detail": "You are not authorized to perform the requested action"}]}`
+				err = rollingDeploy.Run()
+			})
+			It("should return the error rather than fall back", func() {
+				Expect(err).Should(HaveOccurred())
+				Expect(fakeFallback.RunSpy).Should(Equal(0))
+				Expect(curlRequests(fakeConnection)).ShouldNot(ContainElement("POST /v3/packages"))
+			})
+		})
+
+		Context("when the deployment completes", func() {
+			BeforeEach(func() {
+				err = rollingDeploy.Run()
+			})
+			It("should upload the artifact as a new package of the live application and stage it", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(fakeConnection.CliCommandCallCount()).Should(Equal(0))
+				args := fakeConnection.CliCommandWithoutTerminalOutputArgsForCall(1)
+				Expect(args[:4]).Should(Equal([]string{"curl", "/v3/packages", "-X", "POST"}))
+				Expect(args[5]).Should(ContainSubstring(`"app":{"data":{"guid":"app-guid"}}`))
+				Expect(uploadClient.hosts).Should(Equal([]string{"api.example.com"}))
+				Expect(curlRequests(fakeConnection)).Should(ContainElement("POST /v3/builds"))
+			})
+			It("should deploy the staged droplet", func() {
+				args := fakeConnection.CliCommandWithoutTerminalOutputArgsForCall(6)
+				Expect(args[:4]).Should(Equal([]string{"curl", "/v3/deployments", "-X", "POST"}))
+				Expect(args[5]).Should(ContainSubstring(`"droplet":{"guid":"droplet-guid"}`))
+			})
+			It("should rename the live application to the new version", func() {
+				Expect(fakeCommon.RenameApplicationCallCount()).Should(Equal(1))
+				from, to := fakeCommon.RenameApplicationArgsForCall(0)
+				Expect(from).Should(Equal("myTestApp#1.2.2-abcde"))
+				Expect(to).Should(Equal("myTestApp#1.2.3-abcde"))
+			})
+			It("should not fall back or cancel", func() {
+				Expect(fakeFallback.RunSpy).Should(Equal(0))
+				Expect(curlRequests(fakeConnection)).ShouldNot(ContainElement("POST /v3/deployments/deployment-guid/actions/cancel"))
+			})
+		})
+
+		Context("when the upload is rejected", func() {
+			BeforeEach(func() {
+				uploadClient.statuses["api.example.com"] = 422
+				err = rollingDeploy.Run()
+			})
+			It("should return an error without staging or deploying", func() {
+				Expect(err).Should(HaveOccurred())
+				Expect(curlRequests(fakeConnection)).ShouldNot(ContainElement("POST /v3/builds"))
+				Expect(curlRequests(fakeConnection)).ShouldNot(ContainElement("POST /v3/deployments"))
+			})
+			It("should capture diagnostics and record the failure", func() {
+				appName, _ := fakeCommon.CaptureDiagnosticsArgsForCall(0)
+				Expect(appName).Should(Equal("myTestApp#1.2.2-abcde"))
+				_, record := fakeCommon.RecordFailureArgsForCall(0)
+				Expect(record.Outcome).Should(Equal(commands.OutcomeFailed))
+			})
+		})
+
+		Context("when an instance of the new droplet crashes", func() {
+			BeforeEach(func() {
+				responses["GET /v3/deployments/deployment-guid"] = `{"guid": "deployment-guid", "state": "DEPLOYING",
+					"new_processes": [{"guid": "new-process-guid", "type": "web"}]}`
+				responses["GET /v3/processes/new-process-guid/stats"] = `{"resources": [{"state": "RUNNING"}, {"state": "CRASHED"}]}`
+				err = rollingDeploy.Run()
+			})
+			It("should cancel the deployment and return an error", func() {
+				Expect(err).Should(HaveOccurred())
+				Expect(curlRequests(fakeConnection)).Should(ContainElement("POST /v3/deployments/deployment-guid/actions/cancel"))
+				Expect(fakeCommon.RenameApplicationCallCount()).Should(Equal(0))
+			})
+		})
+
+		Context("when a cancelled deployment has on-rollback hooks", func() {
+			var dir string
+
+			BeforeEach(func() {
+				dir, err = ioutil.TempDir("", "hooks")
+				Expect(err).ShouldNot(HaveOccurred())
+				cfZddCmd.HooksPath = filepath.Join(dir, "hooks.yml")
+				hooks := "on-rollback:\n- command: echo \"$ZDD_HOOK_STAGE $ZDD_APP\" >> " + filepath.Join(dir, "hooks.log") + "\n"
+				Expect(ioutil.WriteFile(cfZddCmd.HooksPath, []byte(hooks), 0644)).Should(Succeed())
+				cfZddCmd.Timeout = "1ns"
+				responses["GET /v3/deployments/deployment-guid"] = `{"guid": "deployment-guid", "status": {"value": "ACTIVE", "reason": "DEPLOYING"}}`
+				err = rollingDeploy.Run()
+			})
+			AfterEach(func() {
+				os.RemoveAll(dir)
+			})
+			It("should run them once the deployment is cancelled", func() {
+				Expect(err).Should(HaveOccurred())
+				log, _ := ioutil.ReadFile(filepath.Join(dir, "hooks.log"))
+				Expect(string(log)).Should(Equal("on-rollback myTestApp#1.2.2-abcde\n"))
+			})
+		})
+
+		Context("when the deployment does not complete within the timeout", func() {
+			BeforeEach(func() {
+				cfZddCmd.Timeout = "1ns"
+				responses["GET /v3/deployments/deployment-guid"] = `{"guid": "deployment-guid", "status": {"value": "ACTIVE", "reason": "DEPLOYING"}}`
+				err = rollingDeploy.Run()
+			})
+			It("should cancel the deployment and return an error", func() {
+				Expect(err).Should(HaveOccurred())
+				Expect(curlRequests(fakeConnection)).Should(ContainElement("POST /v3/deployments/deployment-guid/actions/cancel"))
+			})
+		})
+	})
+})
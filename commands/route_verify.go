@@ -0,0 +1,123 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+)
+
+// VerifyCutover - re-read both versions after the production routes moved and check the new version has every one of
+// the expected routes and the old version has none of them. An old version that no longer exists has no routes, any
+// other failure to read it is returned. On a mismatch the commands correcting it are run with -repair-routes, and
+// printed otherwise.
+func VerifyCutover(args *CfZddCmd, expected []plugin_models.GetApp_RouteSummary, newApp string, oldApp string) error {
+	fixes, err := cutoverFixes(args, expected, newApp, oldApp)
+	if err != nil || len(fixes) == 0 {
+		return err
+	}
+
+	if args.RepairRoutes {
+		fmt.Printf("Correcting the routes of %s and %s\n", newApp, oldApp)
+		for _, fix := range fixes {
+			if _, runErr := args.Conn.CliCommand(fix...); runErr != nil {
+				fmt.Printf("Unable to %s: %s\n", strings.Join(fix, " "), runErr.Error())
+			}
+		}
+		if fixes, err = cutoverFixes(args, expected, newApp, oldApp); err != nil || len(fixes) == 0 {
+			return err
+		}
+	}
+
+	fmt.Println("To correct the routes, run:")
+	for _, fix := range fixes {
+		fmt.Printf("\tcf %s\n", strings.Join(fix, " "))
+	}
+	return fmt.Errorf("routes were not cut over from %s to %s, correct them with the commands above or rerun with -repair-routes", oldApp, newApp)
+}
+
+// cutoverFixes - the map-route commands for the expected routes the new version lacks and the unmap-route commands
+// for those the old version kept
+func cutoverFixes(args *CfZddCmd, expected []plugin_models.GetApp_RouteSummary, newApp string, oldApp string) (fixes [][]string, err error) {
+	app, err := args.Conn.GetApp(newApp)
+	if err != nil {
+		return nil, fmt.Errorf("unable to verify the routes of %s: %s", newApp, err.Error())
+	}
+	newRoutes := make(map[string]bool)
+	for _, route := range app.Routes {
+		newRoutes[routeKey(route)] = true
+	}
+	oldRoutes := make(map[string]bool)
+	old, oldErr := args.Conn.GetApp(oldApp)
+	if oldErr != nil && !appNotFound(oldErr) {
+		return nil, fmt.Errorf("unable to verify the routes of %s: %s", oldApp, oldErr.Error())
+	}
+	for _, route := range old.Routes {
+		oldRoutes[routeKey(route)] = true
+	}
+
+	var missing, stale []string
+	for _, route := range expected {
+		if !newRoutes[routeKey(route)] {
+			missing = append(missing, routeKey(route))
+			fixes = append(fixes, routeCommand("map-route", newApp, route))
+		}
+		if oldRoutes[routeKey(route)] {
+			stale = append(stale, routeKey(route))
+			fixes = append(fixes, routeCommand("unmap-route", oldApp, route))
+		}
+	}
+	if len(missing) > 0 {
+		fmt.Printf("%s is missing routes %s\n", newApp, strings.Join(missing, " "))
+	}
+	if len(stale) > 0 {
+		fmt.Printf("%s still has routes %s\n", oldApp, strings.Join(stale, " "))
+	}
+	if len(fixes) == 0 {
+		fmt.Printf("Verified %d routes moved from %s to %s\n", len(expected), oldApp, newApp)
+	}
+	return
+}
+
+// appNotFound - true for the error GetApp returns for an application that does not exist
+func appNotFound(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "not found")
+}
+
+// routeCommand - the cli arguments mapping or unmapping a route of an application
+func routeCommand(verb string, appName string, route plugin_models.GetApp_RouteSummary) []string {
+	cliArgs := []string{verb, appName, route.Domain.Name}
+	if route.Host != "" {
+		cliArgs = append(cliArgs, "-n", route.Host)
+	}
+	if route.Path != "" {
+		cliArgs = append(cliArgs, "--path", strings.TrimPrefix(route.Path, "/"))
+	}
+	return cliArgs
+}
+
+// appRoutes - the routes of an application, expected on the other version after a cutover. Failing to read them is
+// an error, as the cutover could not be verified without them.
+func appRoutes(args *CfZddCmd, appName string) ([]plugin_models.GetApp_RouteSummary, error) {
+	app, err := args.Conn.GetApp(appName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the routes of %s: %s", appName, err.Error())
+	}
+	return app.Routes, nil
+}
@@ -0,0 +1,183 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands_test
+
+import (
+	"errors"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/comcast/cf-zdd-plugin/commands"
+	"github.com/comcast/cf-zdd-plugin/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// routeTable - the routes of each app of a fake space. GetApp returns the model with the name and routes of the app
+// asked for, and map-route, unmap-route and RemapRoutes change the routes as the cloud controller would.
+type routeTable struct {
+	model  *plugin_models.GetAppModel
+	routes map[string][]plugin_models.GetApp_RouteSummary
+}
+
+func newRouteTable(conn *fakes.FakeCliConnection, common *fakes.FakeCommonCmd, model *plugin_models.GetAppModel) *routeTable {
+	table := &routeTable{model: model, routes: map[string][]plugin_models.GetApp_RouteSummary{}}
+	conn.GetAppStub = func(name string) (plugin_models.GetAppModel, error) {
+		app := *table.model
+		app.Name = name
+		app.Routes = table.routes[name]
+		return app, nil
+	}
+	conn.CliCommandStub = func(args ...string) ([]string, error) {
+		if len(args) < 5 || (args[0] != "map-route" && args[0] != "unmap-route") {
+			return nil, nil
+		}
+		route := plugin_models.GetApp_RouteSummary{Host: args[4], Domain: plugin_models.GetApp_DomainFields{Name: args[2]}}
+		table.unmap(args[1], route)
+		if args[0] == "map-route" {
+			table.routes[args[1]] = append(table.routes[args[1]], route)
+		}
+		return nil, nil
+	}
+	common.RemapRoutesStub = table.remap
+	return table
+}
+
+func (t *routeTable) remap(from string, to string) error {
+	for _, route := range t.routes[from] {
+		t.unmap(to, route)
+		t.routes[to] = append(t.routes[to], route)
+	}
+	t.routes[from] = nil
+	return nil
+}
+
+func (t *routeTable) unmap(appName string, route plugin_models.GetApp_RouteSummary) {
+	var kept []plugin_models.GetApp_RouteSummary
+	for _, r := range t.routes[appName] {
+		if r.Host != route.Host || r.Domain.Name != route.Domain.Name {
+			kept = append(kept, r)
+		}
+	}
+	t.routes[appName] = kept
+}
+
+var _ = Describe("VerifyCutover", func() {
+	var (
+		cfZddCmd       *commands.CfZddCmd
+		fakeConnection *fakes.FakeCliConnection
+		table          *routeTable
+		www            = plugin_models.GetApp_RouteSummary{Host: "www", Domain: plugin_models.GetApp_DomainFields{Name: "example.com"}}
+		api            = plugin_models.GetApp_RouteSummary{Host: "api", Domain: plugin_models.GetApp_DomainFields{Name: "example.com"}}
+		expected       = []plugin_models.GetApp_RouteSummary{www, api}
+		err            error
+	)
+
+	BeforeEach(func() {
+		fakeConnection = new(fakes.FakeCliConnection)
+		table = newRouteTable(fakeConnection, new(fakes.FakeCommonCmd), &plugin_models.GetAppModel{})
+		cfZddCmd = &commands.CfZddCmd{Conn: fakeConnection}
+	})
+
+	Context("when the new version has every route and the old one none", func() {
+		BeforeEach(func() {
+			table.routes["myapp-2"] = expected
+			err = commands.VerifyCutover(cfZddCmd, expected, "myapp-2", "myapp-1")
+		})
+		It("should pass without changing any route", func() {
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(fakeConnection.CliCommandCallCount()).Should(Equal(0))
+		})
+	})
+
+	Context("when the old version kept a route the new one lacks", func() {
+		BeforeEach(func() {
+			table.routes["myapp-2"] = []plugin_models.GetApp_RouteSummary{www}
+			table.routes["myapp-1"] = []plugin_models.GetApp_RouteSummary{api}
+		})
+		It("should fail without changing any route", func() {
+			err = commands.VerifyCutover(cfZddCmd, expected, "myapp-2", "myapp-1")
+			Expect(err).Should(MatchError(ContainSubstring("routes were not cut over from myapp-1 to myapp-2")))
+			Expect(fakeConnection.CliCommandCallCount()).Should(Equal(0))
+		})
+		Context("and the routes are to be repaired", func() {
+			BeforeEach(func() {
+				cfZddCmd.RepairRoutes = true
+				err = commands.VerifyCutover(cfZddCmd, expected, "myapp-2", "myapp-1")
+			})
+			It("should move the route to the new version", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(fakeConnection.CliCommandArgsForCall(0)).Should(Equal([]string{"map-route", "myapp-2", "example.com", "-n", "api"}))
+				Expect(fakeConnection.CliCommandArgsForCall(1)).Should(Equal([]string{"unmap-route", "myapp-1", "example.com", "-n", "api"}))
+				Expect(table.routes["myapp-1"]).Should(BeEmpty())
+			})
+		})
+		Context("and the repair does not take", func() {
+			BeforeEach(func() {
+				cfZddCmd.RepairRoutes = true
+				fakeConnection.CliCommandStub = nil
+				fakeConnection.CliCommandReturns(nil, errors.New("not authorized"))
+				err = commands.VerifyCutover(cfZddCmd, expected, "myapp-2", "myapp-1")
+			})
+			It("should still fail", func() {
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+	})
+
+	Context("when the old version no longer exists", func() {
+		BeforeEach(func() {
+			table.routes["myapp-2"] = expected
+			fakeConnection.GetAppStub = func(name string) (plugin_models.GetAppModel, error) {
+				if name == "myapp-1" {
+					return plugin_models.GetAppModel{}, errors.New("App myapp-1 not found")
+				}
+				return plugin_models.GetAppModel{Name: name, Routes: table.routes[name]}, nil
+			}
+			err = commands.VerifyCutover(cfZddCmd, expected, "myapp-2", "myapp-1")
+		})
+		It("should only check the routes of the new version", func() {
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Context("when the old version cannot be read", func() {
+		BeforeEach(func() {
+			table.routes["myapp-2"] = expected
+			fakeConnection.GetAppStub = func(name string) (plugin_models.GetAppModel, error) {
+				if name == "myapp-1" {
+					return plugin_models.GetAppModel{}, errors.New("Server error, status code: 502")
+				}
+				return plugin_models.GetAppModel{Name: name, Routes: table.routes[name]}, nil
+			}
+			err = commands.VerifyCutover(cfZddCmd, expected, "myapp-2", "myapp-1")
+		})
+		It("should return an error rather than take it to have no routes", func() {
+			Expect(err).Should(MatchError(ContainSubstring("unable to verify the routes of myapp-1")))
+		})
+	})
+
+	Context("when the new version cannot be read", func() {
+		BeforeEach(func() {
+			fakeConnection.GetAppStub = nil
+			fakeConnection.GetAppReturns(plugin_models.GetAppModel{}, errors.New("timeout"))
+			err = commands.VerifyCutover(cfZddCmd, expected, "myapp-2", "myapp-1")
+		})
+		It("should return an error", func() {
+			Expect(err).Should(MatchError(ContainSubstring("unable to verify the routes of myapp-2")))
+		})
+	})
+})
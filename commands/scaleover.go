@@ -99,31 +99,26 @@ func (cmd *scaleoverCmd) DoScaleover() (err error) {
 	enforceRoutes := cmd.ShouldEnforceRoutes()
 
 	if err = cmd.Usage(cmd.Args); nil != err {
-		fmt.Println(err)
-		os.Exit(1)
+		return
 	}
 
 	rolloverTime, err := cmd.ParseTime(cmd.Args.Duration)
 	if nil != err {
-		fmt.Println(err)
-		os.Exit(1)
+		return
 	}
 
-	// The getAppStatus calls will exit with an error if the named apps don't exist
+	// The getAppStatus calls return an error if the named apps don't exist
 	if cmd.App1, err = cmd.GetAppStatus(cmd.Args.OldApp); nil != err {
-		fmt.Println(err)
-		os.Exit(1)
+		return
 	}
 
 	if cmd.App2, err = cmd.GetAppStatus(cmd.Args.NewApp); nil != err {
-		fmt.Println(err)
-		os.Exit(1)
+		return
 	}
 	fmt.Printf("App1: %+v\nApp2: %+v\n", cmd.App1, cmd.App2)
 	if enforceRoutes {
 		if err = cmd.ErrorIfNoSharedRoute(); err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+			return
 		}
 	}
 
@@ -132,7 +127,7 @@ func (cmd *scaleoverCmd) DoScaleover() (err error) {
 	count := cmd.App1.CountRequested
 	if count == 0 {
 		fmt.Println("There are no instances of the source app to scale over")
-		os.Exit(0)
+		return nil
 	}
 
 	//Standard scaleover using duration
@@ -141,9 +136,23 @@ func (cmd *scaleoverCmd) DoScaleover() (err error) {
 
 		for count > 0 {
 			count--
-			cmd.App2.ScaleUp(cmd.Args.Conn)
-			cmd.App1.ScaleDown(cmd.Args.Conn)
+			if err = cmd.App2.ScaleUp(cmd.Args.Conn); err != nil {
+				return
+			}
+			// The old version keeps its instances while any instance of the new version has crashed
+			if err = cmd.checkInstances(cmd.App2.Name); err != nil {
+				return
+			}
+			if err = cmd.App1.ScaleDown(cmd.Args.Conn); err != nil {
+				return
+			}
 			cmd.showStatus()
+			if cmd.Args.ScaleoverStep != nil {
+				cmd.Args.ScaleoverStep(cmd.App1, cmd.App2)
+			}
+			if err = extendDeploymentLock(cmd.Args); err != nil {
+				return
+			}
 			if count > 0 {
 				time.Sleep(sleepInterval)
 			}
@@ -153,6 +162,24 @@ func (cmd *scaleoverCmd) DoScaleover() (err error) {
 	return
 }
 
+// checkInstances - an error once any instance of the app has crashed
+func (cmd *scaleoverCmd) checkInstances(name string) error {
+	app, err := cmd.Args.Conn.GetApp(name)
+	if err != nil {
+		return fmt.Errorf("unable to read the instances of %s: %s", name, err.Error())
+	}
+	crashed := 0
+	for _, instance := range app.Instances {
+		if strings.EqualFold(instance.State, "crashed") {
+			crashed++
+		}
+	}
+	if crashed > 0 {
+		return fmt.Errorf("%d instance(s) of %s crashed, stopping the scaleover", crashed, name)
+	}
+	return nil
+}
+
 func (cmd *scaleoverCmd) GetAppStatus(name string) (*AppStatus, error) {
 	app, err := cmd.Args.Conn.GetApp(name)
 
@@ -179,25 +206,35 @@ func (cmd *scaleoverCmd) GetAppStatus(name string) (*AppStatus, error) {
 	return status, nil
 }
 
-func (app *AppStatus) ScaleUp(cliConnection plugin.CliConnection) {
+// ScaleUp - start the app when it is stopped and add an instance, the status is left as it was on a failure
+func (app *AppStatus) ScaleUp(cliConnection plugin.CliConnection) error {
 	// If not already started, start it
 	if app.State != "started" {
-		cliConnection.CliCommandWithoutTerminalOutput("start", app.Name)
+		if _, err := cliConnection.CliCommandWithoutTerminalOutput("start", app.Name); err != nil {
+			return fmt.Errorf("unable to start %s: %s", app.Name, err.Error())
+		}
 		app.State = "started"
 	}
+	if _, err := cliConnection.CliCommandWithoutTerminalOutput("scale", "-i", strconv.Itoa(app.CountRequested+1), app.Name); err != nil {
+		return fmt.Errorf("unable to scale %s up to %d instances: %s", app.Name, app.CountRequested+1, err.Error())
+	}
 	app.CountRequested++
-	cliConnection.CliCommandWithoutTerminalOutput("scale", "-i", strconv.Itoa(app.CountRequested), app.Name)
+	return nil
 }
 
-func (app *AppStatus) ScaleDown(cliConnection plugin.CliConnection) {
-	app.CountRequested--
+// ScaleDown - remove an instance of the app, stopping it at zero, the status is left as it was on a failure
+func (app *AppStatus) ScaleDown(cliConnection plugin.CliConnection) error {
 	// If going to zero, stop the app
-	if app.CountRequested == 0 {
-		cliConnection.CliCommandWithoutTerminalOutput("stop", app.Name)
+	if app.CountRequested == 1 {
+		if _, err := cliConnection.CliCommandWithoutTerminalOutput("stop", app.Name); err != nil {
+			return fmt.Errorf("unable to stop %s: %s", app.Name, err.Error())
+		}
 		app.State = "stopped"
-	} else {
-		cliConnection.CliCommandWithoutTerminalOutput("scale", "-i", strconv.Itoa(app.CountRequested), app.Name)
+	} else if _, err := cliConnection.CliCommandWithoutTerminalOutput("scale", "-i", strconv.Itoa(app.CountRequested-1), app.Name); err != nil {
+		return fmt.Errorf("unable to scale %s down to %d instances: %s", app.Name, app.CountRequested-1, err.Error())
 	}
+	app.CountRequested--
+	return nil
 }
 
 func (cmd *scaleoverCmd) showStatus() {
@@ -152,6 +152,92 @@ var _ = Describe("Scaleover", func() {
 
 	})
 
+	Describe("DoScaleover", func() {
+		var fakeCommon *fakes.FakeCommonCmd
+
+		BeforeEach(func() {
+			fakeCliConnection = &fakes.FakeCliConnection{}
+			fakeCommon = new(fakes.FakeCommonCmd)
+			args = &commands.CfZddCmd{
+				OldApp:   "app1",
+				NewApp:   "app2",
+				Duration: "0s",
+				Conn:     fakeCliConnection,
+				Commands: fakeCommon,
+			}
+			scaleoverCmdPlugin = commands.NewScaleoverCmd(args)
+		})
+
+		It("should return an error when an app does not exist", func() {
+			fakeCliConnection.GetAppReturns(plugin_models.GetAppModel{}, errors.New("App app1 not found"))
+			Expect(scaleoverCmdPlugin.DoScaleover()).Should(MatchError("App app1 not found"))
+		})
+		It("should do nothing when the old app has no instances", func() {
+			fakeCliConnection.GetAppReturns(plugin_models.GetAppModel{State: "stopped"}, nil)
+			Expect(scaleoverCmdPlugin.DoScaleover()).Should(Succeed())
+			Expect(fakeCliConnection.CliCommandCallCount()).Should(Equal(0))
+		})
+		Context("when the deployment lock nears its expiry", func() {
+			BeforeEach(func() {
+				fakeCliConnection.GetAppReturns(plugin_models.GetAppModel{State: "started", InstanceCount: 2, RunningInstances: 2}, nil)
+				args.LockTTL = time.Hour
+				args.LockedFamily = "app"
+				args.LockExpiresAt = time.Now().Add(time.Minute)
+				fakeCommon.ExtendDeploymentLockReturns(time.Now().Add(time.Hour), nil)
+			})
+			It("should extend the lock as it scales over", func() {
+				Expect(scaleoverCmdPlugin.DoScaleover()).Should(Succeed())
+				Expect(fakeCommon.ExtendDeploymentLockCallCount()).Should(Equal(1))
+				family, ttl := fakeCommon.ExtendDeploymentLockArgsForCall(0)
+				Expect(family).Should(Equal("app"))
+				Expect(ttl).Should(Equal(time.Hour))
+			})
+			It("should stop when the lock was taken over", func() {
+				fakeCommon.ExtendDeploymentLockReturns(time.Time{}, errors.New("app is being deployed by pipeline"))
+				Expect(scaleoverCmdPlugin.DoScaleover()).Should(MatchError(ContainSubstring("unable to extend the deployment lock of app")))
+			})
+		})
+		Context("when scaling an app fails", func() {
+			BeforeEach(func() {
+				fakeCliConnection.GetAppReturns(plugin_models.GetAppModel{State: "started", InstanceCount: 2, RunningInstances: 2}, nil)
+				fakeCliConnection.CliCommandWithoutTerminalOutputStub = func(args ...string) ([]string, error) {
+					if fakeCliConnection.CliCommandWithoutTerminalOutputCallCount() == 1 {
+						return nil, errors.New("Error executing cli core command")
+					}
+					return nil, nil
+				}
+			})
+			It("should stop the scaleover with the error", func() {
+				Expect(scaleoverCmdPlugin.DoScaleover()).Should(MatchError("unable to scale app2 up to 3 instances: Error executing cli core command"))
+				Expect(fakeCliConnection.CliCommandWithoutTerminalOutputCallCount()).Should(Equal(1))
+			})
+			It("should retry the failure when the connection retries transient failures", func() {
+				args.Conn = commands.NewRetryingCliConnection(fakeCliConnection, commands.RetryPolicy{Attempts: 3})
+				scaleoverCmdPlugin = commands.NewScaleoverCmd(args)
+				Expect(scaleoverCmdPlugin.DoScaleover()).Should(Succeed())
+				Expect(fakeCliConnection.CliCommandWithoutTerminalOutputArgsForCall(0)).Should(Equal([]string{"scale", "-i", "3", "app2"}))
+				Expect(fakeCliConnection.CliCommandWithoutTerminalOutputArgsForCall(1)).Should(Equal([]string{"scale", "-i", "3", "app2"}))
+				Expect(fakeCliConnection.CliCommandWithoutTerminalOutputCallCount()).Should(Equal(5))
+			})
+		})
+		Context("when an instance of the new version crashes", func() {
+			BeforeEach(func() {
+				fakeCliConnection.GetAppStub = func(name string) (plugin_models.GetAppModel, error) {
+					app := plugin_models.GetAppModel{Name: name, State: "started", InstanceCount: 2, RunningInstances: 2}
+					if name == "app2" {
+						app.Instances = []plugin_models.GetApp_AppInstanceFields{{State: "running"}, {State: "crashed"}}
+					}
+					return app, nil
+				}
+			})
+			It("should stop the scaleover before scaling the old version down", func() {
+				Expect(scaleoverCmdPlugin.DoScaleover()).Should(MatchError("1 instance(s) of app2 crashed, stopping the scaleover"))
+				Expect(fakeCliConnection.CliCommandWithoutTerminalOutputCallCount()).Should(Equal(1))
+				Expect(fakeCliConnection.CliCommandWithoutTerminalOutputArgsForCall(0)).Should(Equal([]string{"scale", "-i", "3", "app2"}))
+			})
+		})
+	})
+
 	Describe("It should handle weird time inputs", func() {
 		BeforeEach(func() {
 			scaleoverCmdPlugin = commands.NewScaleoverCmd(args)
@@ -203,6 +289,13 @@ var _ = Describe("Scaleover", func() {
 			Expect(appStatus.State).To(Equal("started"))
 		})
 
+		It("Returns the error and keeps the amount requested when scaling fails", func() {
+			appStatus.State = "started"
+			fakeCliConnection.CliCommandWithoutTerminalOutputReturns(nil, errors.New("quota exceeded"))
+			Expect(appStatus.ScaleUp(fakeCliConnection)).Should(MatchError(ContainSubstring("quota exceeded")))
+			Expect(appStatus.CountRequested).To(Equal(1))
+		})
+
 	})
 
 	Describe("scale down", func() {
@@ -242,6 +335,13 @@ var _ = Describe("Scaleover", func() {
 			Expect(appStatus.CountRunning).To(Equal(1))
 			Expect(fakeCliConnection.CliCommandWithoutTerminalOutputCallCount()).To(Equal(1))
 		})
+
+		It("Returns the error and keeps the app started when stopping fails", func() {
+			fakeCliConnection.CliCommandWithoutTerminalOutputReturns(nil, errors.New("not authorized"))
+			Expect(appStatus.ScaleDown(fakeCliConnection)).Should(MatchError(ContainSubstring("unable to stop foo")))
+			Expect(appStatus.State).To(Equal("started"))
+			Expect(appStatus.CountRequested).To(Equal(1))
+		})
 	})
 
 	//Describe("Usage", func() {
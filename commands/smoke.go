@@ -0,0 +1,154 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// DefaultSmokeTestTimeout - time the smoke test of a new version may take
+const DefaultSmokeTestTimeout = 5 * time.Minute
+
+// SmokeRouteSuffix - suffix of the hostname of the temporary route a new version is smoke tested on
+const SmokeRouteSuffix = "smoke"
+
+// SmokeTestRetryInterval - time between attempts of the http smoke test, as the test route takes a moment to be
+// reachable once mapped
+var SmokeTestRetryInterval = 5 * time.Second
+
+// smokeTestEnabled - true when a smoke test path or command is given
+func smokeTestEnabled(args *CfZddCmd) bool {
+	return args.SmokeTestPath != "" || args.SmokeTestCmd != ""
+}
+
+// ccDomain - v3 domain resource, tcp domains belong to a router group
+type ccDomain struct {
+	Name        string `json:"name"`
+	Internal    bool   `json:"internal"`
+	RouterGroup *struct {
+		GUID string `json:"guid"`
+	} `json:"router_group"`
+}
+
+// smokeTest - map a temporary test route to the new version, run the http check and the command of the smoke test
+// against it and delete the route again. The route is on the first http domain of the live version reachable from
+// outside the foundation, or on the default domain.
+func smokeTest(args *CfZddCmd, client clientDoer, appName string, liveApp string) (err error) {
+	domain := smokeTestDomain(args, liveApp)
+	if domain == "" {
+		domain = args.Commands.GetDefaultDomain()
+	}
+	host := routeSafeName(appName) + CanaryRouteSeparator + SmokeRouteSuffix
+	testURL := "https://" + host + "." + domain
+
+	fmt.Printf("Mapping test route %s.%s to %s\n", host, domain, appName)
+	if _, err = args.Conn.CliCommand("map-route", appName, domain, "-n", host); err != nil {
+		return fmt.Errorf("unable to map test route: %s", err.Error())
+	}
+	defer func() {
+		if _, deleteErr := args.Conn.CliCommand("delete-route", domain, "-n", host, "-f"); deleteErr != nil {
+			fmt.Printf("Unable to delete test route %s.%s: %s\n", host, domain, deleteErr.Error())
+		}
+	}()
+
+	timeout := args.SmokeTestTimeout
+	if timeout <= 0 {
+		timeout = DefaultSmokeTestTimeout
+	}
+	deadline := time.Now().Add(timeout)
+
+	if args.SmokeTestPath != "" {
+		if err = smokeTestHTTP(args, client, testURL, deadline); err != nil {
+			return
+		}
+	}
+	if args.SmokeTestCmd != "" {
+		err = smokeTestCommand(args, appName, testURL, deadline)
+	}
+	return
+}
+
+// smokeTestDomain - the first domain of the live routes the test route can be requested on, neither an internal domain
+// such as apps.internal nor a tcp domain
+func smokeTestDomain(args *CfZddCmd, liveApp string) string {
+	live, err := args.Conn.GetApp(liveApp)
+	if err != nil {
+		return ""
+	}
+	for _, route := range live.Routes {
+		if probeableDomain(args, route.Domain.Name) {
+			return route.Domain.Name
+		}
+	}
+	return ""
+}
+
+// probeableDomain - routes of the domain can be requested over http from outside the foundation, unlike those of an
+// internal domain such as apps.internal, a tcp domain or a domain that cannot be read
+func probeableDomain(args *CfZddCmd, name string) bool {
+	domains := new(struct {
+		Resources []ccDomain `json:"resources"`
+	})
+	if err := CCCurl(args.Conn, "GET", "/v3/domains?names="+url.QueryEscape(name), nil, domains); err != nil {
+		fmt.Printf("Unable to read domain %s: %s\n", name, err.Error())
+		return false
+	}
+	for _, domain := range domains.Resources {
+		if domain.Name == name {
+			return !domain.Internal && domain.RouterGroup == nil
+		}
+	}
+	return false
+}
+
+// smokeTestHTTP - request the smoke test path on the test route until it succeeds or the deadline passes. A response
+// succeeds on the -check-status and -check-body criteria of the probes.
+func smokeTestHTTP(args *CfZddCmd, client clientDoer, testURL string, deadline time.Time) error {
+	path := args.SmokeTestPath
+	if path[0] != '/' {
+		path = "/" + path
+	}
+	stats := &ProbeStats{URL: testURL + path}
+	fmt.Printf("Smoke testing %s\n", stats.URL)
+	for {
+		if probeRoute(client, args, stats); stats.Successes > 0 {
+			fmt.Printf("Smoke test of %s passed\n", stats.URL)
+			return nil
+		}
+		if time.Now().Add(SmokeTestRetryInterval).After(deadline) {
+			return fmt.Errorf("smoke test of %s failed after %d attempts", stats.URL, stats.Requests)
+		}
+		time.Sleep(SmokeTestRetryInterval)
+	}
+}
+
+// smokeTestCommand - run the smoke test command locally with the url of the test route in $SMOKE_TEST_URL and the
+// name of the new version in $SMOKE_TEST_APP. A command still running at the deadline is killed and fails.
+func smokeTestCommand(args *CfZddCmd, appName string, testURL string, deadline time.Time) error {
+	fmt.Printf("Running smoke test: %s\n", args.SmokeTestCmd)
+	err := runLocalCommand(args.SmokeTestCmd, []string{"SMOKE_TEST_URL=" + testURL, "SMOKE_TEST_APP=" + appName}, deadline)
+	if err == errCommandTimeout {
+		return fmt.Errorf("smoke test %q timed out", args.SmokeTestCmd)
+	}
+	if err != nil {
+		return fmt.Errorf("smoke test %q failed: %s", args.SmokeTestCmd, err.Error())
+	}
+	fmt.Println("Smoke test command passed")
+	return nil
+}
@@ -0,0 +1,114 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/cli/plugin"
+)
+
+// StagingPollInterval - time between checks on the state of a staging build
+var StagingPollInterval = 2 * time.Second
+
+// DefaultStagingTimeout - time staging may take
+const DefaultStagingTimeout = 15 * time.Minute
+
+// ccBuild - v3 build resource
+type ccBuild struct {
+	GUID    string `json:"guid"`
+	State   string `json:"state"`
+	Error   string `json:"error"`
+	Droplet *struct {
+		GUID string `json:"guid"`
+	} `json:"droplet"`
+}
+
+// StageApplication - stage the latest package of a stopped application and make the droplet current without starting
+// it. The staging logs are printed once staging finishes and a failed build returns the buildpack error, as does a
+// build still staging after the timeout.
+func (c *commonCmd) StageApplication(appName string, timeout time.Duration) (err error) {
+	app, err := c.cli.GetApp(appName)
+	if err != nil {
+		return
+	}
+
+	packages := new(ccResourceList)
+	if err = CCCurl(c.cli, "GET", "/v3/packages?app_guids="+app.Guid+"&states=READY&order_by=-created_at&per_page=1", nil, packages); err != nil {
+		return
+	}
+	if len(packages.Resources) == 0 {
+		return fmt.Errorf("no package ready to stage for %s", appName)
+	}
+
+	dropletGUID, err := stagePackage(c.cli, appName, packages.Resources[0].GUID, timeout)
+	if err != nil {
+		return
+	}
+
+	currentDropletBody := map[string]interface{}{"data": map[string]string{"guid": dropletGUID}}
+	return CCCurl(c.cli, "PATCH", "/v3/apps/"+app.Guid+"/relationships/current_droplet", currentDropletBody, nil)
+}
+
+// stagePackage - build a package of an application into a droplet, printing the staging logs once staging finishes.
+// A failed build returns the buildpack error, as does a build still staging after the timeout.
+func stagePackage(conn plugin.CliConnection, appName string, packageGUID string, timeout time.Duration) (dropletGUID string, err error) {
+	if timeout <= 0 {
+		timeout = DefaultStagingTimeout
+	}
+	fmt.Printf("Staging %s\n", appName)
+	build := new(ccBuild)
+	buildBody := map[string]interface{}{"package": map[string]string{"guid": packageGUID}}
+	if err = CCCurl(conn, "POST", "/v3/builds", buildBody, build); err != nil {
+		return
+	}
+
+	deadline := time.Now().Add(timeout)
+	for build.State != "STAGED" && build.State != "FAILED" {
+		if time.Now().After(deadline) {
+			printStagingLogs(conn, appName)
+			return "", fmt.Errorf("staging %s did not complete within %s, build %s is %s", appName, timeout, build.GUID, build.State)
+		}
+		time.Sleep(StagingPollInterval)
+		if err = CCCurl(conn, "GET", "/v3/builds/"+build.GUID, nil, build); err != nil {
+			return
+		}
+	}
+
+	printStagingLogs(conn, appName)
+
+	if build.State == "FAILED" || build.Droplet == nil {
+		return "", fmt.Errorf("staging %s failed: %s", appName, build.Error)
+	}
+	fmt.Printf("Staged %s, droplet %s\n", appName, build.Droplet.GUID)
+	return build.Droplet.GUID, nil
+}
+
+func printStagingLogs(conn plugin.CliConnection, appName string) {
+	logs, err := conn.CliCommandWithoutTerminalOutput("logs", appName, "--recent")
+	if err != nil {
+		fmt.Printf("Unable to read staging logs for %s: %s\n", appName, err.Error())
+		return
+	}
+	for _, line := range logs {
+		if strings.Contains(line, "[STG/") {
+			fmt.Println(line)
+		}
+	}
+}
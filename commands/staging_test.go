@@ -0,0 +1,98 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands_test
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/comcast/cf-zdd-plugin/commands"
+	"github.com/comcast/cf-zdd-plugin/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe(".StageApplication", func() {
+	var (
+		fakeCliConnection *fakes.FakeCliConnection
+		cmd               commands.CommonCmd
+		responses         map[string]string
+		err               error
+	)
+
+	BeforeEach(func() {
+		commands.StagingPollInterval = 0
+
+		fakeCliConnection = new(fakes.FakeCliConnection)
+		fakeCliConnection.GetAppReturns(plugin_models.GetAppModel{Guid: "app-guid"}, nil)
+		responses = map[string]string{
+			"GET /v3/packages?app_guids=app-guid": `{"resources": [{"guid": "package-guid", "state": "READY"}]}`,
+			"POST /v3/builds":                     `{"guid": "build-guid", "state": "STAGING"}`,
+			"GET /v3/builds/build-guid":           `{"guid": "build-guid", "state": "STAGED", "droplet": {"guid": "droplet-guid"}}`,
+		}
+		fakeCliConnection.CliCommandWithoutTerminalOutputStub = curlResponder(responses)
+
+		cmd = commands.NewCommonCmd(fakeCliConnection)
+	})
+
+	Context("when the package stages", func() {
+		BeforeEach(func() {
+			err = cmd.StageApplication("myapp", time.Minute)
+		})
+		It("should make the droplet current without starting the application", func() {
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(curlRequests(fakeCliConnection)).Should(ContainElement("PATCH /v3/apps/app-guid/relationships/current_droplet"))
+			Expect(fakeCliConnection.CliCommandCallCount()).Should(Equal(0))
+		})
+		It("should read the staging logs", func() {
+			Expect(fakeCliConnection.CliCommandWithoutTerminalOutputArgsForCall(3)).Should(Equal([]string{"logs", "myapp", "--recent"}))
+		})
+	})
+
+	Context("when staging fails", func() {
+		BeforeEach(func() {
+			responses["GET /v3/builds/build-guid"] = `{"guid": "build-guid", "state": "FAILED", "error": "BuildpackCompileFailed - App staging failed in the buildpack compile phase"}`
+			err = cmd.StageApplication("myapp", time.Minute)
+		})
+		It("should return the buildpack error", func() {
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).Should(ContainSubstring("BuildpackCompileFailed"))
+			Expect(curlRequests(fakeCliConnection)).ShouldNot(ContainElement("PATCH /v3/apps/app-guid/relationships/current_droplet"))
+		})
+	})
+
+	Context("when the build is still staging at the timeout", func() {
+		BeforeEach(func() {
+			responses["GET /v3/builds/build-guid"] = `{"guid": "build-guid", "state": "STAGING"}`
+			err = cmd.StageApplication("myapp", time.Nanosecond)
+		})
+		It("should return an error without making a droplet current", func() {
+			Expect(err).Should(MatchError(ContainSubstring("staging myapp did not complete within 1ns")))
+			Expect(curlRequests(fakeCliConnection)).ShouldNot(ContainElement("PATCH /v3/apps/app-guid/relationships/current_droplet"))
+		})
+	})
+
+	Context("when the application has no package", func() {
+		BeforeEach(func() {
+			responses["GET /v3/packages?app_guids=app-guid"] = `{"resources": []}`
+			err = cmd.StageApplication("myapp", time.Minute)
+		})
+		It("should return an error", func() {
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,206 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+)
+
+// Status - struct
+type Status struct {
+	args *CfZddCmd
+}
+
+// StatusCmdName - constants
+const (
+	StatusCmdName = "zdd-status"
+)
+
+// StatusOutput - where the status of the versions is written
+var StatusOutput io.Writer = os.Stdout
+
+// Roles of the versions of an application family
+const (
+	LiveRole      = "live"
+	CanaryRole    = "canary"
+	VenerableRole = "venerable"
+	RetainedRole  = "retained"
+	PushedRole    = "pushed"
+)
+
+// Deployment states reported for an application family
+const (
+	DeploymentIdle        = "idle"
+	DeploymentInProgress  = "in progress"
+	DeploymentInterrupted = "interrupted"
+)
+
+// VersionStatus - a version of an application and the role it plays in the family
+type VersionStatus struct {
+	Name             string
+	Role             string
+	State            string
+	RunningInstances int
+	TotalInstances   int
+	Routes           []string
+}
+
+func init() {
+	Register(StatusCmdName, new(Status))
+}
+
+// Run - Run method
+func (s *Status) Run() (err error) {
+	err = s.status()
+	return
+}
+
+// SetArgs - set command args
+func (s *Status) SetArgs(args *CfZddCmd) {
+	s.args = args
+}
+
+func (s *Status) status() (err error) {
+	baseName := s.args.BaseAppName
+	if baseName == "" && len(s.args.Arguments) > 0 {
+		baseName = s.args.Arguments[0]
+	}
+	if baseName == "" {
+		return errors.New("base name must be specified")
+	}
+
+	apps, err := s.args.Commands.ListApplications(baseName)
+	if err != nil {
+		return
+	}
+	if len(apps) == 0 {
+		return fmt.Errorf("no versions of %s found", baseName)
+	}
+
+	versions := make([]VersionStatus, len(apps))
+	for idx, app := range apps {
+		versions[idx] = versionStatus(app, isCanaryApp(s.args.Conn, app.Guid))
+	}
+
+	w := tabwriter.NewWriter(StatusOutput, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tROLE\tSTATE\tINSTANCES\tROUTES")
+	for _, version := range versions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d/%d\t%s\n", version.Name, version.Role, version.State, version.RunningInstances,
+			version.TotalInstances, strings.Join(version.Routes, ", "))
+	}
+	w.Flush()
+
+	state, reason := DeploymentState(versions)
+	if reason != "" {
+		fmt.Fprintf(StatusOutput, "\nDeployment: %s, %s\n", state, reason)
+	} else {
+		fmt.Fprintf(StatusOutput, "\nDeployment: %s\n", state)
+	}
+
+	if progress, progressErr := s.args.Commands.GetDeploymentProgress(baseName); progressErr != nil {
+		fmt.Fprintf(StatusOutput, "Unable to read the deployment progress: %s\n", progressErr.Error())
+	} else if progress != nil {
+		fmt.Fprintf(StatusOutput, "Unfinished %s of %s over %s, stopped while %s at %s with %d instances old and %d new\n",
+			progress.Strategy, progress.NewApp, progress.Venerable, progress.Phase, progress.UpdatedAt.Format(time.RFC3339),
+			progress.OldInstances, progress.NewInstances)
+	}
+
+	if lock, lockErr := s.args.Commands.GetDeploymentLock(baseName); lockErr != nil {
+		fmt.Fprintf(StatusOutput, "Unable to read the deployment lock: %s\n", lockErr.Error())
+	} else if lock != nil {
+		expiry := "expires"
+		if lock.Expired() {
+			expiry = "expired"
+		}
+		fmt.Fprintf(StatusOutput, "Locked by %s since %s, %s at %s\n", lock.Owner, lock.AcquiredAt.Format(time.RFC3339), expiry, lock.ExpiresAt.Format(time.RFC3339))
+	}
+	return
+}
+
+// versionStatus - the role of a version follows from its state and the routes mapped to it. A canary deployed with its
+// canary routes recorded stays a canary while it shares the live routes.
+func versionStatus(app plugin_models.GetAppsModel, canaryApp bool) VersionStatus {
+	version := VersionStatus{
+		Name:             app.Name,
+		State:            app.State,
+		RunningInstances: app.RunningInstances,
+		TotalInstances:   app.TotalInstances,
+	}
+
+	routed, canary := false, false
+	for _, route := range app.Routes {
+		version.Routes = append(version.Routes, route.Host+"."+route.Domain.Name)
+		if isCanaryRoute(route.Host) {
+			canary = true
+		} else {
+			routed = true
+		}
+	}
+
+	switch {
+	case strings.Contains(app.Name, "-venerable") && (routed || app.State == "started"):
+		version.Role = VenerableRole
+	case canaryApp:
+		version.Role = CanaryRole
+	case routed:
+		version.Role = LiveRole
+	case canary:
+		version.Role = CanaryRole
+	case app.State == "started":
+		version.Role = PushedRole
+	default:
+		version.Role = RetainedRole
+	}
+	return version
+}
+
+// DeploymentState - a deployment is in progress while more than one version serves the live routes, and appears
+// interrupted when a version was left started without routes or routed without running instances
+func DeploymentState(versions []VersionStatus) (state string, reason string) {
+	var serving, stranded []string
+
+	for _, version := range versions {
+		switch version.Role {
+		case LiveRole, VenerableRole:
+			if version.State == "started" && len(version.Routes) > 0 {
+				serving = append(serving, version.Name)
+			} else {
+				stranded = append(stranded, version.Name)
+			}
+		case PushedRole:
+			stranded = append(stranded, version.Name)
+		}
+	}
+
+	switch {
+	case len(serving) > 1:
+		return DeploymentInProgress, "traffic is shared by " + strings.Join(serving, " and ")
+	case len(stranded) > 0:
+		return DeploymentInterrupted, strings.Join(stranded, ", ") + " left between versions"
+	case len(serving) == 0:
+		return DeploymentInterrupted, "no version is serving the live routes"
+	}
+	return DeploymentIdle, ""
+}
@@ -0,0 +1,151 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands_test
+
+import (
+	"bytes"
+	"os"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/comcast/cf-zdd-plugin/commands"
+	"github.com/comcast/cf-zdd-plugin/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("zdd-status", func() {
+
+	Describe(".init", func() {
+		Context("when the package is imported", func() {
+			It("should then be registered with the command repo", func() {
+				_, ok := commands.GetRegistry()[commands.StatusCmdName]
+				Expect(ok).Should(BeTrue())
+			})
+		})
+	})
+
+	Describe("with a valid arg and run method", func() {
+		var (
+			err            error
+			status         *commands.Status
+			cfZddCmd       *commands.CfZddCmd
+			fakeConnection *fakes.FakeCliConnection
+			fakeCommon     *fakes.FakeCommonCmd
+		)
+
+		BeforeEach(func() {
+			fakeConnection = new(fakes.FakeCliConnection)
+			fakeCommon = new(fakes.FakeCommonCmd)
+			cfZddCmd = &commands.CfZddCmd{
+				CmdName:   commands.StatusCmdName,
+				Arguments: []string{"myapp"},
+				Conn:      fakeConnection,
+				Commands:  fakeCommon,
+			}
+			status = new(commands.Status)
+			status.SetArgs(cfZddCmd)
+		})
+
+		Context("when versions of the application are deployed", func() {
+			BeforeEach(func() {
+				fakeCommon.ListApplicationsReturns([]plugin_models.GetAppsModel{
+					{Name: "myapp-1.0.3", State: "started", RunningInstances: 2, TotalInstances: 2,
+						Routes: []plugin_models.GetAppsRouteSummary{{Host: "myapp", Domain: plugin_models.GetAppsDomainFields{Name: "example.com"}}}},
+				}, nil)
+				err = status.Run()
+			})
+			It("should look up the versions of the base name given as argument", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(fakeCommon.ListApplicationsArgsForCall(0)).Should(Equal("myapp"))
+			})
+		})
+
+		Context("when a canary shares the live routes", func() {
+			var output *bytes.Buffer
+
+			BeforeEach(func() {
+				liveRoute := plugin_models.GetAppsRouteSummary{Host: "myapp", Domain: plugin_models.GetAppsDomainFields{Name: "example.com"}}
+				canaryRoute := plugin_models.GetAppsRouteSummary{Host: "myapp-1-0-4-canary", Domain: plugin_models.GetAppsDomainFields{Name: "example.com"}}
+				fakeCommon.ListApplicationsReturns([]plugin_models.GetAppsModel{
+					{Name: "myapp-1.0.3", Guid: "live-guid", State: "started", RunningInstances: 2, TotalInstances: 2,
+						Routes: []plugin_models.GetAppsRouteSummary{liveRoute}},
+					{Name: "myapp-1.0.4", Guid: "canary-guid", State: "started", RunningInstances: 1, TotalInstances: 1,
+						Routes: []plugin_models.GetAppsRouteSummary{liveRoute, canaryRoute}},
+				}, nil)
+				fakeConnection.CliCommandWithoutTerminalOutputStub = curlResponder(map[string]string{
+					"GET /v3/apps/live-guid":   `{"guid": "live-guid"}`,
+					"GET /v3/apps/canary-guid": `{"guid": "canary-guid", "metadata": {"annotations": {"zdd.comcast.com/canary-routes": "[\"myapp-1-0-4-canary.example.com\"]"}}}`,
+				})
+				output = new(bytes.Buffer)
+				commands.StatusOutput = output
+				err = status.Run()
+			})
+			AfterEach(func() {
+				commands.StatusOutput = os.Stdout
+			})
+			It("should show it as a canary and the deployment as idle", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(output.String()).Should(MatchRegexp(`myapp-1.0.3\s+live`))
+				Expect(output.String()).Should(MatchRegexp(`myapp-1.0.4\s+canary`))
+				Expect(output.String()).Should(ContainSubstring("Deployment: idle"))
+			})
+		})
+
+		Context("when no versions are deployed", func() {
+			It("should return an error", func() {
+				err = status.Run()
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+
+		Context("when called without a base name", func() {
+			It("should return an error", func() {
+				cfZddCmd.Arguments = nil
+				err = status.Run()
+				Expect(err).Should(HaveOccurred())
+				Expect(fakeCommon.ListApplicationsCallCount()).Should(Equal(0))
+			})
+		})
+	})
+
+	Describe(".DeploymentState", func() {
+		It("should be idle with a single live version", func() {
+			state, _ := commands.DeploymentState([]commands.VersionStatus{
+				{Name: "myapp-1.0.3", Role: commands.LiveRole, State: "started", Routes: []string{"myapp.example.com"}},
+				{Name: "myapp-1.0.4", Role: commands.CanaryRole, State: "started", Routes: []string{"myapp-1-0-4-canary.example.com"}},
+				{Name: "myapp-1.0.2", Role: commands.RetainedRole, State: "stopped"},
+			})
+			Expect(state).Should(Equal(commands.DeploymentIdle))
+		})
+		It("should be in progress while two versions serve the live routes", func() {
+			state, reason := commands.DeploymentState([]commands.VersionStatus{
+				{Name: "myapp", Role: commands.LiveRole, State: "started", Routes: []string{"myapp.example.com"}},
+				{Name: "myapp-venerable", Role: commands.VenerableRole, State: "started", Routes: []string{"myapp.example.com"}},
+			})
+			Expect(state).Should(Equal(commands.DeploymentInProgress))
+			Expect(reason).Should(ContainSubstring("myapp-venerable"))
+		})
+		It("should be interrupted when a new version was left without routes", func() {
+			state, reason := commands.DeploymentState([]commands.VersionStatus{
+				{Name: "myapp-1.0.3", Role: commands.LiveRole, State: "started", Routes: []string{"myapp.example.com"}},
+				{Name: "myapp-1.0.4", Role: commands.PushedRole, State: "started"},
+			})
+			Expect(state).Should(Equal(commands.DeploymentInterrupted))
+			Expect(reason).Should(ContainSubstring("myapp-1.0.4"))
+		})
+	})
+})
@@ -0,0 +1,98 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultTaskTimeout - time the pre-cutover task may take
+const DefaultTaskTimeout = 30 * time.Minute
+
+// PreCutoverTaskName - name of the task run on the new version before the cutover
+const PreCutoverTaskName = "zdd-pre-cutover"
+
+// TaskPollInterval - time between checks on a running task
+var TaskPollInterval = 5 * time.Second
+
+// ccTask - the parts of a v3 task that are used
+type ccTask struct {
+	GUID       string `json:"guid"`
+	Name       string `json:"name"`
+	State      string `json:"state"`
+	SequenceID int    `json:"sequence_id"`
+	Result     struct {
+		FailureReason string `json:"failure_reason"`
+	} `json:"result"`
+}
+
+// runPreCutoverTask - run the -pre-cutover-task command as a task of the new version, as cf run-task would, and wait
+// for it to succeed. A task still running after -pre-cutover-task-timeout is cancelled and fails, as does one that
+// cannot be read until then.
+func runPreCutoverTask(args *CfZddCmd, appName string) (err error) {
+	if args.PreCutoverTask == "" {
+		return nil
+	}
+	timeout := args.TaskTimeout
+	if timeout <= 0 {
+		timeout = DefaultTaskTimeout
+	}
+
+	app, err := args.Conn.GetApp(appName)
+	if err != nil {
+		return
+	}
+	task := new(ccTask)
+	taskBody := map[string]string{"command": args.PreCutoverTask, "name": PreCutoverTaskName}
+	if err = CCCurl(args.Conn, "POST", "/v3/apps/"+app.Guid+"/tasks", taskBody, task); err != nil {
+		return fmt.Errorf("unable to run task on %s: %s", appName, err.Error())
+	}
+	if task.GUID == "" {
+		return fmt.Errorf("unable to run task on %s: no task was created", appName)
+	}
+	fmt.Printf("Running task %s #%d on %s: %s\n", task.Name, task.SequenceID, appName, args.PreCutoverTask)
+
+	deadline := time.Now().Add(timeout)
+	var readErr error
+	for {
+		switch task.State {
+		case "SUCCEEDED":
+			fmt.Printf("Task %s #%d succeeded\n", task.Name, task.SequenceID)
+			return nil
+		case "FAILED":
+			return fmt.Errorf("task %s #%d on %s failed: %s, see cf logs %s --recent", task.Name, task.SequenceID, appName,
+				task.Result.FailureReason, appName)
+		}
+
+		if time.Now().After(deadline) {
+			if cancelErr := CCCurl(args.Conn, "POST", "/v3/tasks/"+task.GUID+"/actions/cancel", nil, nil); cancelErr != nil {
+				fmt.Printf("Unable to cancel task %s: %s\n", task.GUID, cancelErr.Error())
+			}
+			if readErr != nil {
+				return fmt.Errorf("unable to read task %s #%d on %s within %s: %s", task.Name, task.SequenceID, appName,
+					timeout, readErr.Error())
+			}
+			return fmt.Errorf("task %s #%d on %s did not complete within %s", task.Name, task.SequenceID, appName, timeout)
+		}
+		time.Sleep(TaskPollInterval)
+		// The task keeps running when it cannot be read, reads are retried until the deadline cancels it
+		if readErr = CCCurl(args.Conn, "GET", "/v3/tasks/"+task.GUID, nil, task); readErr != nil {
+			fmt.Printf("Unable to read task %s: %s\n", task.GUID, readErr.Error())
+		}
+	}
+}
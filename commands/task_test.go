@@ -0,0 +1,197 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands_test
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/comcast/cf-zdd-plugin/commands"
+	"github.com/comcast/cf-zdd-plugin/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("pre-cutover task", func() {
+	var (
+		fakeConnection *fakes.FakeCliConnection
+		fakeCommands   *fakes.FakeCommonCmd
+		cfZddCmd       *commands.CfZddCmd
+		finalState     string
+		polls          int
+		readFailures   int
+		err            error
+	)
+
+	BeforeEach(func() {
+		commands.TaskPollInterval = 0
+		commands.InstancePollInterval = 0
+		polls = 0
+		readFailures = 0
+		fakeConnection = new(fakes.FakeCliConnection)
+		fakeConnection.GetAppStub = func(name string) (plugin_models.GetAppModel, error) {
+			return plugin_models.GetAppModel{Name: name, Guid: name + "-guid", InstanceCount: 1, RunningInstances: 1}, nil
+		}
+		finalState = "RUNNING"
+		respond := curlResponder(map[string]string{
+			"POST /v3/apps/myapp-2-guid/tasks": `{"guid":"task-guid","name":"zdd-pre-cutover","state":"PENDING","sequence_id":4}`,
+		})
+		// The task runs for two polls and then is in its final state
+		fakeConnection.CliCommandWithoutTerminalOutputStub = func(args ...string) ([]string, error) {
+			if len(args) == 4 && args[1] == "/v3/tasks/task-guid" && args[3] == "GET" {
+				if readFailures > 0 {
+					readFailures--
+					return nil, errors.New("connection reset by peer")
+				}
+				state := "RUNNING"
+				if polls++; polls > 2 {
+					state = finalState
+				}
+				return []string{fmt.Sprintf(`{"guid":"task-guid","name":"zdd-pre-cutover","state":"%s","sequence_id":4,`+
+					`"result":{"failure_reason":"Exited with status 1"}}`, state)}, nil
+			}
+			return respond(args...)
+		}
+		fakeCommands = new(fakes.FakeCommonCmd)
+		fakeCommands.IsApplicationDeployedReturns("myapp-1", true)
+
+		cfZddCmd = &commands.CfZddCmd{
+			NewApp:         "myapp-2",
+			BaseAppName:    "myapp",
+			PreCutoverTask: "bin/rake db:migrate",
+			Conn:           fakeConnection,
+			Commands:       fakeCommands,
+		}
+	})
+
+	Describe("a deploy-zdd deployment", func() {
+		var (
+			zddDeploy     *commands.ZddDeploy
+			fakeScaleover *fakes.FakeScaleoverCommand
+		)
+
+		BeforeEach(func() {
+			cfZddCmd.CmdName = commands.ZddDeployCmdName
+			fakeScaleover = new(fakes.FakeScaleoverCommand)
+			zddDeploy = &commands.ZddDeploy{ScalerOverCmd: fakeScaleover}
+			zddDeploy.SetArgs(cfZddCmd)
+		})
+
+		Context("when the task succeeds", func() {
+			BeforeEach(func() {
+				finalState = "SUCCEEDED"
+				err = zddDeploy.Run()
+			})
+			It("should run the task on the staged new version and wait for it", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(curlRequests(fakeConnection)).Should(Equal([]string{
+					"POST /v3/apps/myapp-2-guid/tasks",
+					"GET /v3/tasks/task-guid",
+					"GET /v3/tasks/task-guid",
+					"GET /v3/tasks/task-guid",
+				}))
+				args := fakeConnection.CliCommandWithoutTerminalOutputArgsForCall(0)
+				Expect(args[5]).Should(MatchJSON(`{"command":"bin/rake db:migrate","name":"zdd-pre-cutover"}`))
+			})
+			It("should scale over once the task succeeded", func() {
+				Expect(fakeCommands.StageApplicationCallCount()).Should(Equal(1))
+				Expect(fakeScaleover.DoScaleoverCallCount()).Should(Equal(1))
+			})
+		})
+
+		Context("when the task fails", func() {
+			BeforeEach(func() {
+				finalState = "FAILED"
+				err = zddDeploy.Run()
+			})
+			It("should abort the deployment leaving the old version serving", func() {
+				Expect(err).Should(MatchError(ContainSubstring("task zdd-pre-cutover #4 on myapp-2 failed: Exited with status 1")))
+				Expect(fakeScaleover.DoScaleoverCallCount()).Should(Equal(0))
+				Expect(fakeCommands.RemoveApplicationArgsForCall(0)).Should(Equal("myapp-2"))
+			})
+			It("should capture diagnostics of the new version", func() {
+				appName, _ := fakeCommands.CaptureDiagnosticsArgsForCall(0)
+				Expect(appName).Should(Equal("myapp-2"))
+			})
+		})
+
+		Context("when the task cannot be read for a while", func() {
+			BeforeEach(func() {
+				finalState = "SUCCEEDED"
+				readFailures = 2
+				err = zddDeploy.Run()
+			})
+			It("should keep waiting for the task", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(curlRequests(fakeConnection)).ShouldNot(ContainElement("POST /v3/tasks/task-guid/actions/cancel"))
+				Expect(fakeScaleover.DoScaleoverCallCount()).Should(Equal(1))
+			})
+		})
+
+		Context("when the task cannot be read until its timeout", func() {
+			BeforeEach(func() {
+				cfZddCmd.TaskTimeout = time.Millisecond
+				readFailures = 1 << 30
+				err = zddDeploy.Run()
+			})
+			It("should cancel the task and abort the deployment", func() {
+				Expect(err).Should(MatchError(ContainSubstring("unable to read task zdd-pre-cutover #4 on myapp-2")))
+				Expect(curlRequests(fakeConnection)).Should(ContainElement("POST /v3/tasks/task-guid/actions/cancel"))
+				Expect(fakeScaleover.DoScaleoverCallCount()).Should(Equal(0))
+			})
+		})
+
+		Context("when the task runs past its timeout", func() {
+			BeforeEach(func() {
+				cfZddCmd.TaskTimeout = time.Nanosecond
+				err = zddDeploy.Run()
+			})
+			It("should cancel the task and abort the deployment", func() {
+				Expect(err).Should(MatchError(ContainSubstring("did not complete within")))
+				Expect(curlRequests(fakeConnection)).Should(ContainElement("POST /v3/tasks/task-guid/actions/cancel"))
+				Expect(fakeScaleover.DoScaleoverCallCount()).Should(Equal(0))
+			})
+		})
+	})
+
+	Describe("a blue-green deployment", func() {
+		var bgDeploy *commands.BlueGreenDeploy
+
+		BeforeEach(func() {
+			cfZddCmd.CmdName = commands.BlueGreenCmdName
+			bgDeploy = new(commands.BlueGreenDeploy)
+			bgDeploy.SetArgs(cfZddCmd)
+		})
+
+		Context("when the task fails", func() {
+			BeforeEach(func() {
+				finalState = "FAILED"
+				err = bgDeploy.Run()
+			})
+			It("should not flip the routes", func() {
+				Expect(err).Should(HaveOccurred())
+				Expect(fakeCommands.RemapRoutesCallCount()).Should(Equal(0))
+				Expect(fakeCommands.RemoveApplicationArgsForCall(0)).Should(Equal("myapp-2"))
+				from, to := fakeCommands.RenameApplicationArgsForCall(1)
+				Expect(from).Should(Equal("myapp-1-venerable"))
+				Expect(to).Should(Equal("myapp-1"))
+			})
+		})
+	})
+})
@@ -0,0 +1,81 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Unlock - struct
+type Unlock struct {
+	args *CfZddCmd
+}
+
+// UnlockCmdName - constants
+const (
+	UnlockCmdName = "zdd-unlock"
+)
+
+func init() {
+	Register(UnlockCmdName, new(Unlock))
+}
+
+// Run - Run method
+func (s *Unlock) Run() (err error) {
+	err = s.unlock()
+	return
+}
+
+// SetArgs - set command args
+func (s *Unlock) SetArgs(args *CfZddCmd) {
+	s.args = args
+}
+
+// unlock - remove a stale deployment lock left by a deployment that did not finish, whoever holds it
+func (s *Unlock) unlock() (err error) {
+	// An app given by name locks the family resolved from its base name label, as the deployment commands do
+	appNames := []string{s.args.NewApp}
+	if len(s.args.Arguments) > 0 {
+		appNames = append(appNames, s.args.Arguments[0])
+	}
+	baseName := lockFamily(s.args, appNames...)
+	if baseName == "" {
+		return errors.New("base name must be specified")
+	}
+
+	lock, err := s.args.Commands.GetDeploymentLock(baseName)
+	if err != nil {
+		return
+	}
+	if lock == nil {
+		fmt.Printf("%s is not locked\n", baseName)
+		return
+	}
+
+	fmt.Printf("%s is locked by %s since %s\n", baseName, lock.Owner, lock.AcquiredAt.Format(time.RFC3339))
+	if !s.args.Force && !lock.Expired() && !confirm("The lock has not expired yet, remove it anyway?") {
+		fmt.Println("Lock kept")
+		return
+	}
+	if err = s.args.Commands.ReleaseDeploymentLock(baseName, true); err != nil {
+		return
+	}
+	fmt.Printf("Removed deployment lock of %s\n", baseName)
+	return
+}
@@ -0,0 +1,114 @@
+/*
+* Copyright 2016 Comcast Cable Communications Management, LLC
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+* http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package commands_test
+
+import (
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/cli/plugin/models"
+	"github.com/comcast/cf-zdd-plugin/commands"
+	"github.com/comcast/cf-zdd-plugin/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("zdd-unlock", func() {
+
+	Describe(".init", func() {
+		Context("when the package is imported", func() {
+			It("should then be registered with the command repo", func() {
+				_, ok := commands.GetRegistry()[commands.UnlockCmdName]
+				Expect(ok).Should(BeTrue())
+			})
+		})
+	})
+
+	Describe("with a valid arg and run method", func() {
+		var (
+			err            error
+			unlock         *commands.Unlock
+			cfZddCmd       *commands.CfZddCmd
+			fakeCommon     *fakes.FakeCommonCmd
+			fakeConnection *fakes.FakeCliConnection
+		)
+
+		BeforeEach(func() {
+			fakeCommon = new(fakes.FakeCommonCmd)
+			fakeConnection = new(fakes.FakeCliConnection)
+			cfZddCmd = &commands.CfZddCmd{
+				CmdName:   commands.UnlockCmdName,
+				Arguments: []string{"myapp"},
+				Conn:      fakeConnection,
+				Commands:  fakeCommon,
+			}
+			unlock = new(commands.Unlock)
+			unlock.SetArgs(cfZddCmd)
+		})
+
+		Context("when the lock expired", func() {
+			BeforeEach(func() {
+				fakeCommon.GetDeploymentLockReturns(&commands.DeploymentLock{Owner: "pipeline", ExpiresAt: time.Now().Add(-time.Minute)}, nil)
+				err = unlock.Run()
+			})
+			It("should remove the lock whoever holds it", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				baseName, force := fakeCommon.ReleaseDeploymentLockArgsForCall(0)
+				Expect(baseName).Should(Equal("myapp"))
+				Expect(force).Should(BeTrue())
+			})
+		})
+
+		Context("when a version of the family is given", func() {
+			BeforeEach(func() {
+				cfZddCmd.Arguments = []string{"myapp-v2"}
+				fakeConnection.GetAppReturns(plugin_models.GetAppModel{Name: "myapp-v2", Guid: "v2-guid"}, nil)
+				fakeConnection.CliCommandWithoutTerminalOutputStub = curlResponder(map[string]string{
+					"GET /v3/apps/v2-guid": `{"guid":"v2-guid","metadata":{"labels":{"zdd.comcast.com/base-name":"myapp"}}}`,
+				})
+				fakeCommon.GetDeploymentLockReturns(&commands.DeploymentLock{Owner: "pipeline", ExpiresAt: time.Now().Add(-time.Minute)}, nil)
+				err = unlock.Run()
+			})
+			It("should remove the lock of its family", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(fakeCommon.GetDeploymentLockArgsForCall(0)).Should(Equal("myapp"))
+				baseName, _ := fakeCommon.ReleaseDeploymentLockArgsForCall(0)
+				Expect(baseName).Should(Equal("myapp"))
+			})
+		})
+
+		Context("when the lock has not expired and removing it is not confirmed", func() {
+			BeforeEach(func() {
+				fakeCommon.GetDeploymentLockReturns(&commands.DeploymentLock{Owner: "pipeline", ExpiresAt: time.Now().Add(time.Hour)}, nil)
+				commands.ConfirmInput = strings.NewReader("\n")
+				err = unlock.Run()
+			})
+			It("should keep the lock", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(fakeCommon.ReleaseDeploymentLockCallCount()).Should(Equal(0))
+			})
+		})
+
+		Context("when the application is not locked", func() {
+			It("should not release anything", func() {
+				err = unlock.Run()
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(fakeCommon.ReleaseDeploymentLockCallCount()).Should(Equal(0))
+			})
+		})
+	})
+})
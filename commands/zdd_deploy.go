@@ -2,7 +2,6 @@ package commands
 
 import (
 	"fmt"
-	"os"
 )
 
 // ZddDeploy - struct
@@ -23,7 +22,7 @@ func init() {
 
 // Run method
 func (s *ZddDeploy) Run() (err error) {
-	err = s.deploy()
+	err = withDeploymentLock(s.args, lockFamily(s.args, s.args.NewApp), s.deploy)
 	return
 }
 
@@ -63,40 +62,227 @@ func (s *ZddDeploy) deploy() (err error) {
 	//Get the application list from cf
 	oldApplication, isAppDeployed = s.args.Commands.IsApplicationDeployed(searchAppName)
 
+	progress, err := s.args.Commands.GetDeploymentProgress(searchAppName)
+	if err != nil {
+		return
+	}
+	switch {
+	case progress != nil && s.args.Resume == "":
+		return &InterruptedError{BaseName: searchAppName, Progress: progress}
+	case progress != nil:
+		return s.resume(searchAppName, progress)
+	case s.args.Resume == ResumeRollback:
+		return fmt.Errorf("no interrupted deployment of %s to roll back", searchAppName)
+	}
+
 	if !isAppDeployed {
 		fmt.Printf("Initial deployment of %s\n", applicationToDeploy)
+		if err = runHooks(s.args, HookPrePush, applicationToDeploy, ""); err != nil {
+			captureFailure(s.args, applicationToDeploy, "")
+			return
+		}
 		if err = s.args.Commands.PushApplication(applicationToDeploy, artifactPath, manifestPath); err != nil {
 			fmt.Printf("Error occurred pushing application: %s\n", err.Error())
+			captureFailure(s.args, applicationToDeploy, "")
+			return
 		}
+		recordDeployment(s.args, applicationToDeploy, newDeploymentRecord(s.args, searchAppName, ""))
+		if err = runHooks(s.args, HookPostPush, applicationToDeploy, ""); err != nil {
+			captureFailure(s.args, applicationToDeploy, "")
+		}
+		return
+	}
+
+	//Check if redeployment and rename old app.
+	if oldApplication == applicationToDeploy {
+		venerable = oldApplication + "-venerable"
+		err = handleLeftovers(s.args, searchAppName, oldApplication, venerable, false)
 	} else {
-		//Check if redeployment and rename old app.
-		if oldApplication == applicationToDeploy {
-			venerable = oldApplication + "-venerable"
-			err = s.args.Commands.RenameApplication(oldApplication, venerable)
-			if err != nil {
-				fmt.Println(err.Error())
+		venerable = oldApplication
+		err = handleLeftovers(s.args, searchAppName, oldApplication, "", false)
+	}
+	if err != nil {
+		return
+	}
+	if err = runHooks(s.args, HookPrePush, applicationToDeploy, oldApplication); err != nil {
+		captureFailure(s.args, applicationToDeploy, oldApplication)
+		return
+	}
+	progress = &DeploymentProgress{
+		Strategy:  ZddDeployCmdName,
+		Phase:     PhasePushing,
+		OldApp:    oldApplication,
+		Venerable: venerable,
+		NewApp:    applicationToDeploy,
+		StartedAt: s.args.StartedAt,
+	}
+	saveProgress(s.args, searchAppName, progress)
+
+	return s.continueDeployment(searchAppName, progress, false)
+}
+
+// resume - continue or roll back a deployment interrupted part way, from the phase it had reached
+func (s *ZddDeploy) resume(baseName string, progress *DeploymentProgress) error {
+	fmt.Printf("Found deployment of %s over %s interrupted while %s\n", progress.NewApp, progress.Venerable, progress.Phase)
+	switch s.args.Resume {
+	case ResumeRollback:
+		return s.rollbackDeployment(baseName, progress)
+	case ResumeContinue:
+		if progress.Strategy != ZddDeployCmdName {
+			return fmt.Errorf("interrupted %s deployment of %s cannot be continued by %s", progress.Strategy, baseName, ZddDeployCmdName)
+		}
+		if s.args.NewApp != progress.NewApp {
+			return fmt.Errorf("interrupted deployment was of %s, not %s", progress.NewApp, s.args.NewApp)
+		}
+		return s.continueDeployment(baseName, progress, true)
+	}
+	return fmt.Errorf("unknown -resume %s, use %s or %s", s.args.Resume, ResumeContinue, ResumeRollback)
+}
+
+// continueDeployment - push, stage and scale over to the new version starting from the phase reached, saving the
+// progress as each phase is passed
+func (s *ZddDeploy) continueDeployment(baseName string, progress *DeploymentProgress, resuming bool) (err error) {
+	applicationToDeploy, venerable := progress.NewApp, progress.Venerable
+
+	switch progress.Phase {
+	case PhasePushing:
+		// A redeployment of the same version renames the old application first, unless it was renamed before the
+		// interruption
+		if venerable != progress.OldApp && !(resuming && s.appExists(venerable)) {
+			// Pushing over the live version would stop it and scale it to one instance
+			if err = s.args.Commands.RenameApplication(progress.OldApp, venerable); err != nil {
+				err = fmt.Errorf("unable to rename %s to %s: %s", progress.OldApp, venerable, err.Error())
+				captureFailure(s.args, applicationToDeploy, progress.OldApp)
+				saveProgress(s.args, baseName, nil)
+				return
 			}
-		} else {
-			venerable = oldApplication
 		}
 		fmt.Printf("Venerable version assigned to %s\n", venerable)
 
-		if err = s.args.Commands.PushApplication(applicationToDeploy, artifactPath, manifestPath, "-i", "1", "--no-start"); err != nil {
+		if err = s.args.Commands.PushApplication(applicationToDeploy, s.args.ApplicationPath, s.args.ManifestPath, "-i", "1", "--no-start"); err != nil {
 			fmt.Println(err.Error())
+			captureFailure(s.args, applicationToDeploy, venerable)
+			restoreVenerable(s.args.Commands, applicationToDeploy, progress.OldApp, venerable)
+			saveProgress(s.args, baseName, nil)
+			return
 		}
+		progress.Phase = PhaseStaging
+		saveProgress(s.args, baseName, progress)
+		fallthrough
 
+	case PhaseStaging:
+		// Stage before any instances are shifted so a failed build leaves the venerable version untouched
+		if err = s.args.Commands.StageApplication(applicationToDeploy, s.args.StagingTimeout); err != nil {
+			fmt.Println(err.Error())
+			captureFailure(s.args, applicationToDeploy, venerable)
+			restoreVenerable(s.args.Commands, applicationToDeploy, progress.OldApp, venerable)
+			saveProgress(s.args, baseName, nil)
+			return
+		}
+		// The hooks and the pre-cutover task run once the new version is staged, before any instance of the venerable
+		// version is shifted
+		for _, stage := range []string{HookPostPush, HookPreCutover} {
+			if err = runHooks(s.args, stage, applicationToDeploy, venerable); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = runPreCutoverTask(s.args, applicationToDeploy)
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+			captureFailure(s.args, applicationToDeploy, venerable)
+			restoreVenerable(s.args.Commands, applicationToDeploy, progress.OldApp, venerable)
+			saveProgress(s.args, baseName, nil)
+			return
+		}
+		progress.Phase = PhaseScaling
+		saveProgress(s.args, baseName, progress)
+		fallthrough
+
+	case PhaseScaling:
 		// Do the scaleover
 		s.args.OldApp = venerable
+		s.args.NewApp = applicationToDeploy
+		if resuming && !s.hasInstances(venerable) {
+			fmt.Printf("%s has no instances left to scale over\n", venerable)
+		} else {
+			s.args.ScaleoverStep = func(oldApp *AppStatus, newApp *AppStatus) {
+				progress.OldInstances, progress.NewInstances = oldApp.CountRequested, newApp.CountRequested
+				progress.Routes = newApp.Routes
+				saveProgress(s.args, baseName, progress)
+			}
+			err = s.ScalerOverCmd.DoScaleover()
+			s.args.ScaleoverStep = nil
+			if err != nil {
+				fmt.Println(err.Error())
+				captureFailure(s.args, applicationToDeploy, venerable)
+				return
+			}
+		}
+		progress.Phase = PhaseFinishing
+		saveProgress(s.args, baseName, progress)
+		fallthrough
 
-		if err = s.ScalerOverCmd.DoScaleover(); err != nil {
-			fmt.Println(err.Error())
-			os.Exit(1)
+	case PhaseFinishing:
+		// The routes of the venerable version are expected on the new version once the venerable version is retired.
+		// A venerable version removed before an interruption has none left to check.
+		expected, routesErr := appRoutes(s.args, venerable)
+		if routesErr != nil && !appNotFound(routesErr) {
+			err = routesErr
+			captureFailure(s.args, applicationToDeploy, venerable)
+			return
 		}
-		fmt.Printf("Removing app: %s\n", venerable)
-		if err = s.args.Commands.RemoveApplication(venerable); err != nil {
-			fmt.Printf("Unable to remove old application: %s, error: %s\n", venerable, err.Error())
+		recordDeployment(s.args, applicationToDeploy, newDeploymentRecord(s.args, baseName, venerable))
+		retireVersion(s.args, baseName, applicationToDeploy, venerable)
+		saveProgress(s.args, baseName, nil)
+		if err = VerifyCutover(s.args, expected, applicationToDeploy, venerable); err != nil {
+			fmt.Println(err.Error())
+			captureFailure(s.args, applicationToDeploy, venerable)
+			return
 		}
+		return runHooks(s.args, HookPostCutover, applicationToDeploy, venerable)
 	}
+	return fmt.Errorf("unknown deployment phase %s", progress.Phase)
+}
 
+// rollbackDeployment - hand the instances the new version took back to the venerable version, then remove the new
+// version and restore the name of the venerable one
+func (s *ZddDeploy) rollbackDeployment(baseName string, progress *DeploymentProgress) (err error) {
+	if progress.Phase == PhasePushing && progress.Venerable != progress.OldApp && !s.appExists(progress.Venerable) {
+		// Interrupted before the old application was renamed, it is still live under its own name
+		fmt.Printf("%s was left untouched\n", progress.OldApp)
+		saveProgress(s.args, baseName, nil)
+		return
+	}
+	if progress.Phase == PhaseScaling || progress.Phase == PhaseFinishing {
+		if _, err = s.ScalerOverCmd.GetAppStatus(progress.Venerable); err != nil {
+			return fmt.Errorf("unable to roll back to %s: %s", progress.Venerable, err.Error())
+		}
+		if s.hasInstances(progress.NewApp) {
+			fmt.Printf("Scaling back over to %s\n", progress.Venerable)
+			s.args.OldApp = progress.NewApp
+			s.args.NewApp = progress.Venerable
+			if err = s.ScalerOverCmd.DoScaleover(); err != nil {
+				return
+			}
+		}
+	}
+	restoreVenerable(s.args.Commands, progress.NewApp, progress.OldApp, progress.Venerable)
+	saveProgress(s.args, baseName, nil)
+	fmt.Printf("Rolled back to %s\n", progress.OldApp)
+	runHooks(s.args, HookOnRollback, progress.OldApp, progress.NewApp)
 	return
 }
+
+// appExists - true when the application can be found in the space
+func (s *ZddDeploy) appExists(appName string) bool {
+	_, err := s.ScalerOverCmd.GetAppStatus(appName)
+	return err == nil
+}
+
+// hasInstances - true when the application exists with instances requested
+func (s *ZddDeploy) hasInstances(appName string) bool {
+	status, err := s.ScalerOverCmd.GetAppStatus(appName)
+	return err == nil && status != nil && status.CountRequested > 0
+}
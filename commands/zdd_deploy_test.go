@@ -1,6 +1,8 @@
 package commands_test
 
 import (
+	"errors"
+
 	"code.cloudfoundry.org/cli/plugin/models"
 	"code.cloudfoundry.org/cli/plugin/pluginfakes"
 	"github.com/comcast/cf-zdd-plugin/commands"
@@ -79,6 +81,283 @@ var _ = Describe("zddDeploy", func() {
 			})
 		})
 
+		Context("when the new version fails to stage", func() {
+			BeforeEach(func() {
+				fakeCommands.IsApplicationDeployedReturns("myTestApp#1.2.3-abcde", true)
+				fakeCommands.StageApplicationReturns(errors.New("staging myTestApp#1.2.3-abcde failed: BuildpackCompileFailed"))
+				cfZddCmd.BaseAppName = "myTestApp"
+				err = zddDeploy.Run()
+			})
+			It("should return the staging error without scaling over", func() {
+				Expect(err).Should(HaveOccurred())
+				appName, _ := fakeCommands.StageApplicationArgsForCall(0)
+				Expect(appName).Should(Equal("myTestApp#1.2.3-abcde"))
+				Expect(fakeScaleover.DoScaleoverCallCount()).Should(Equal(0))
+			})
+			It("should capture diagnostics of the new version", func() {
+				appName, _ := fakeCommands.CaptureDiagnosticsArgsForCall(0)
+				Expect(appName).Should(Equal("myTestApp#1.2.3-abcde"))
+			})
+			It("should record the failure without touching the metadata of the version restored", func() {
+				appName, record := fakeCommands.RecordFailureArgsForCall(0)
+				Expect(appName).Should(Equal("myTestApp#1.2.3-abcde"))
+				Expect(record.BaseName).Should(Equal("myTestApp"))
+				Expect(record.Outcome).Should(Equal(commands.OutcomeFailed))
+				Expect(fakeCommands.RecordDeploymentCallCount()).Should(Equal(0))
+			})
+			It("should remove the new version and restore the venerable version", func() {
+				Expect(fakeCommands.RemoveApplicationArgsForCall(0)).Should(Equal("myTestApp#1.2.3-abcde"))
+				from, to := fakeCommands.RenameApplicationArgsForCall(1)
+				Expect(from).Should(Equal("myTestApp#1.2.3-abcde-venerable"))
+				Expect(to).Should(Equal("myTestApp#1.2.3-abcde"))
+			})
+		})
+
+		Context("when the new version fails to push", func() {
+			BeforeEach(func() {
+				fakeCommands.IsApplicationDeployedReturns("myTestApp#1.2.3-abcde", true)
+				fakeCommands.PushApplicationReturns(errors.New("Server error, status code: 502"))
+				cfZddCmd.BaseAppName = "myTestApp"
+				err = zddDeploy.Run()
+			})
+			It("should capture diagnostics and record the failure before restoring the venerable version", func() {
+				Expect(err).Should(HaveOccurred())
+				appName, _ := fakeCommands.CaptureDiagnosticsArgsForCall(0)
+				Expect(appName).Should(Equal("myTestApp#1.2.3-abcde"))
+				_, record := fakeCommands.RecordFailureArgsForCall(0)
+				Expect(record.Outcome).Should(Equal(commands.OutcomeFailed))
+				Expect(record.PreviousVersion).Should(Equal("myTestApp#1.2.3-abcde-venerable"))
+				from, to := fakeCommands.RenameApplicationArgsForCall(1)
+				Expect(from).Should(Equal("myTestApp#1.2.3-abcde-venerable"))
+				Expect(to).Should(Equal("myTestApp#1.2.3-abcde"))
+			})
+		})
+
+		Context("when the live version cannot be moved aside", func() {
+			BeforeEach(func() {
+				fakeCommands.IsApplicationDeployedReturns("myTestApp#1.2.3-abcde", true)
+				fakeCommands.RenameApplicationReturns(errors.New("Server error, status code: 502"))
+				cfZddCmd.BaseAppName = "myTestApp"
+				err = zddDeploy.Run()
+			})
+			It("should fail without pushing over or removing the live version", func() {
+				Expect(err).Should(MatchError(ContainSubstring("unable to rename myTestApp#1.2.3-abcde to myTestApp#1.2.3-abcde-venerable")))
+				Expect(fakeCommands.PushApplicationCallCount()).Should(Equal(0))
+				Expect(fakeCommands.RemoveApplicationCallCount()).Should(Equal(0))
+			})
+			It("should clear the progress of the deployment", func() {
+				baseName, progress := fakeCommands.SaveDeploymentProgressArgsForCall(fakeCommands.SaveDeploymentProgressCallCount() - 1)
+				Expect(baseName).Should(Equal("myTestApp"))
+				Expect(progress).Should(BeNil())
+			})
+		})
+
+		Context("when redeploying the same version and keeping the previous version", func() {
+			BeforeEach(func() {
+				fakeCommands.IsApplicationDeployedReturns("myTestApp#1.2.3-abcde", true)
+				fakeCommands.ListApplicationsReturns([]plugin_models.GetAppsModel{
+					{Name: "myTestApp#1.2.3-abcde", State: "started"},
+					{Name: "myTestApp#1.2.3-abcde-venerable", State: "stopped"},
+				}, nil)
+				cfZddCmd.KeepPrevious = true
+				err = zddDeploy.Run()
+			})
+			It("should remove the version retained by the earlier deployment before renaming", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(fakeCommands.RemoveApplicationCallCount()).Should(Equal(1))
+				Expect(fakeCommands.RemoveApplicationArgsForCall(0)).Should(Equal("myTestApp#1.2.3-abcde-venerable"))
+			})
+			It("should retain the replaced version after the scaleover", func() {
+				Expect(fakeScaleover.DoScaleoverCallCount()).Should(Equal(1))
+				Expect(fakeCommands.RetainApplicationArgsForCall(0)).Should(Equal("myTestApp#1.2.3-abcde-venerable"))
+			})
+		})
+
+		Context("when keeping several previous versions", func() {
+			BeforeEach(func() {
+				fakeCommands.IsApplicationDeployedReturns("myTestApp-1.2.2", true)
+				fakeCommands.ListVersionsReturns([]commands.AppVersion{
+					{Name: "myTestApp-1.2.3", State: "STARTED"},
+					{Name: "myTestApp-1.2.2", State: "STOPPED"},
+					{Name: "myTestApp-1.2.1", State: "STOPPED"},
+					{Name: "myTestApp-1.2.0", State: "STOPPED"},
+				}, nil)
+				cfZddCmd.NewApp = "myTestApp-1.2.3"
+				cfZddCmd.BaseAppName = "myTestApp"
+				cfZddCmd.KeepVersions = 2
+				err = zddDeploy.Run()
+			})
+			It("should record the deployment of the new version", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				appName, record := fakeCommands.RecordDeploymentArgsForCall(0)
+				Expect(appName).Should(Equal("myTestApp-1.2.3"))
+				Expect(record.BaseName).Should(Equal("myTestApp"))
+				Expect(record.Strategy).Should(Equal(commands.ZddDeployCmdName))
+				Expect(record.PreviousVersion).Should(Equal("myTestApp-1.2.2"))
+				Expect(record.Outcome).Should(Equal(commands.OutcomeSucceeded))
+			})
+			It("should retain the replaced version and prune the oldest beyond the number to keep", func() {
+				Expect(fakeCommands.RetainApplicationArgsForCall(0)).Should(Equal("myTestApp-1.2.2"))
+				Expect(fakeCommands.ListVersionsArgsForCall(0)).Should(Equal("myTestApp"))
+				Expect(fakeCommands.RemoveApplicationCallCount()).Should(Equal(1))
+				Expect(fakeCommands.RemoveApplicationArgsForCall(0)).Should(Equal("myTestApp-1.2.0"))
+			})
+		})
+
+		Context("when deploying over a live version", func() {
+			var phases []string
+
+			BeforeEach(func() {
+				phases = nil
+				fakeCommands.SaveDeploymentProgressStub = func(baseName string, progress *commands.DeploymentProgress) error {
+					if progress == nil {
+						phases = append(phases, "done")
+					} else {
+						phases = append(phases, progress.Phase)
+					}
+					return nil
+				}
+				fakeCommands.IsApplicationDeployedReturns("myTestApp-1.2.2", true)
+				cfZddCmd.NewApp = "myTestApp-1.2.3"
+				cfZddCmd.BaseAppName = "myTestApp"
+				err = zddDeploy.Run()
+			})
+			It("should save the progress as each phase is passed and remove it once finished", func() {
+				Expect(err).ShouldNot(HaveOccurred())
+				baseName, _ := fakeCommands.SaveDeploymentProgressArgsForCall(0)
+				Expect(baseName).Should(Equal("myTestApp"))
+				Expect(phases).Should(Equal([]string{commands.PhasePushing, commands.PhaseStaging, commands.PhaseScaling,
+					commands.PhaseFinishing, "done"}))
+			})
+		})
+
+		Context("when the routes of the live version are checked after the cutover", func() {
+			var table *routeTable
+			www := plugin_models.GetApp_RouteSummary{Host: "www", Domain: plugin_models.GetApp_DomainFields{Name: "example.com"}}
+
+			BeforeEach(func() {
+				table = newRouteTable(fakeConnection, fakeCommands, &plugin_models.GetAppModel{})
+				table.routes["myTestApp-1.2.2"] = []plugin_models.GetApp_RouteSummary{www}
+				fakeCommands.RemoveApplicationStub = func(name string) error {
+					delete(table.routes, name)
+					return nil
+				}
+				fakeCommands.IsApplicationDeployedReturns("myTestApp-1.2.2", true)
+				cfZddCmd.NewApp = "myTestApp-1.2.3"
+				cfZddCmd.BaseAppName = "myTestApp"
+			})
+			It("should pass when the new version serves them", func() {
+				table.routes["myTestApp-1.2.3"] = []plugin_models.GetApp_RouteSummary{www}
+				Expect(zddDeploy.Run()).Should(Succeed())
+				Expect(fakeCommands.RecordFailureCallCount()).Should(Equal(0))
+			})
+			It("should fail and record the failure when the new version lacks them", func() {
+				err = zddDeploy.Run()
+				Expect(err).Should(MatchError(ContainSubstring("routes were not cut over from myTestApp-1.2.2 to myTestApp-1.2.3")))
+				Expect(fakeCommands.RecordFailureCallCount()).Should(Equal(1))
+			})
+		})
+
+		Context("when an earlier deployment was interrupted", func() {
+			var progress *commands.DeploymentProgress
+
+			BeforeEach(func() {
+				fakeCommands.IsApplicationDeployedReturns("myTestApp-1.2.3", true)
+				progress = &commands.DeploymentProgress{
+					Strategy:  commands.ZddDeployCmdName,
+					Phase:     commands.PhaseScaling,
+					OldApp:    "myTestApp-1.2.2",
+					Venerable: "myTestApp-1.2.2",
+					NewApp:    "myTestApp-1.2.3",
+				}
+				fakeCommands.GetDeploymentProgressReturns(progress, nil)
+				fakeScaleover.GetAppStatusReturns(&commands.AppStatus{CountRequested: 2}, nil)
+				cfZddCmd.NewApp = "myTestApp-1.2.3"
+				cfZddCmd.BaseAppName = "myTestApp"
+			})
+
+			Context("and it is not resumed", func() {
+				It("should refuse to deploy", func() {
+					err = zddDeploy.Run()
+					Expect(err).Should(BeAssignableToTypeOf(&commands.InterruptedError{}))
+					Expect(fakeCommands.PushApplicationCallCount()).Should(Equal(0))
+					Expect(fakeScaleover.DoScaleoverCallCount()).Should(Equal(0))
+				})
+			})
+
+			Context("and it is continued", func() {
+				BeforeEach(func() {
+					cfZddCmd.Resume = commands.ResumeContinue
+					err = zddDeploy.Run()
+				})
+				It("should carry on with the scaleover without pushing again", func() {
+					Expect(err).ShouldNot(HaveOccurred())
+					Expect(fakeCommands.PushApplicationCallCount()).Should(Equal(0))
+					Expect(fakeCommands.RenameApplicationCallCount()).Should(Equal(0))
+					Expect(fakeScaleover.DoScaleoverCallCount()).Should(Equal(1))
+					Expect(cfZddCmd.OldApp).Should(Equal("myTestApp-1.2.2"))
+				})
+				It("should finish the deployment and remove its progress", func() {
+					appName, _ := fakeCommands.RecordDeploymentArgsForCall(0)
+					Expect(appName).Should(Equal("myTestApp-1.2.3"))
+					_, last := fakeCommands.SaveDeploymentProgressArgsForCall(fakeCommands.SaveDeploymentProgressCallCount() - 1)
+					Expect(last).Should(BeNil())
+				})
+			})
+
+			Context("and it is continued for another version", func() {
+				It("should return an error", func() {
+					cfZddCmd.Resume = commands.ResumeContinue
+					cfZddCmd.NewApp = "myTestApp-1.2.4"
+					err = zddDeploy.Run()
+					Expect(err).Should(HaveOccurred())
+					Expect(fakeScaleover.DoScaleoverCallCount()).Should(Equal(0))
+				})
+			})
+
+			Context("and it is rolled back", func() {
+				BeforeEach(func() {
+					cfZddCmd.Resume = commands.ResumeRollback
+					err = zddDeploy.Run()
+				})
+				It("should scale back over to the venerable version", func() {
+					Expect(err).ShouldNot(HaveOccurred())
+					Expect(fakeScaleover.DoScaleoverCallCount()).Should(Equal(1))
+					Expect(cfZddCmd.OldApp).Should(Equal("myTestApp-1.2.3"))
+					Expect(cfZddCmd.NewApp).Should(Equal("myTestApp-1.2.2"))
+				})
+				It("should remove the new version and the progress", func() {
+					Expect(fakeCommands.RemoveApplicationArgsForCall(0)).Should(Equal("myTestApp-1.2.3"))
+					_, last := fakeCommands.SaveDeploymentProgressArgsForCall(fakeCommands.SaveDeploymentProgressCallCount() - 1)
+					Expect(last).Should(BeNil())
+				})
+			})
+
+			Context("and it was interrupted before the old version was renamed", func() {
+				BeforeEach(func() {
+					progress.Phase = commands.PhasePushing
+					progress.OldApp, progress.Venerable, progress.NewApp = "myTestApp-1.2.3", "myTestApp-1.2.3-venerable", "myTestApp-1.2.3"
+					fakeScaleover.GetAppStatusReturns(nil, errors.New("App myTestApp-1.2.3-venerable not found"))
+				})
+				It("should rename it before pushing when continued", func() {
+					cfZddCmd.Resume = commands.ResumeContinue
+					err = zddDeploy.Run()
+					Expect(err).ShouldNot(HaveOccurred())
+					from, to := fakeCommands.RenameApplicationArgsForCall(0)
+					Expect(from).Should(Equal("myTestApp-1.2.3"))
+					Expect(to).Should(Equal("myTestApp-1.2.3-venerable"))
+					Expect(fakeCommands.PushApplicationCallCount()).Should(Equal(1))
+				})
+				It("should leave the live version alone when rolled back", func() {
+					cfZddCmd.Resume = commands.ResumeRollback
+					err = zddDeploy.Run()
+					Expect(err).ShouldNot(HaveOccurred())
+					Expect(fakeCommands.RemoveApplicationCallCount()).Should(Equal(0))
+					Expect(fakeCommands.RenameApplicationCallCount()).Should(Equal(0))
+				})
+			})
+		})
+
 	})
 	XDescribe("given: a valid run() method on a zdddeploy object which has been initialized with valid args", func() {
 		var zddDeploy *commands.ZddDeploy
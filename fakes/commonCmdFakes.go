@@ -3,7 +3,9 @@ package fakes
 
 import (
 	"sync"
+	"time"
 
+	"code.cloudfoundry.org/cli/plugin/models"
 	"github.com/comcast/cf-zdd-plugin/commands"
 )
 
@@ -21,6 +23,19 @@ type FakeCommonCmd struct {
 		result1 string
 		result2 bool
 	}
+	ListApplicationsStub        func(string) ([]plugin_models.GetAppsModel, error)
+	listApplicationsMutex       sync.RWMutex
+	listApplicationsArgsForCall []struct {
+		arg1 string
+	}
+	listApplicationsReturns struct {
+		result1 []plugin_models.GetAppsModel
+		result2 error
+	}
+	listApplicationsReturnsOnCall map[int]struct {
+		result1 []plugin_models.GetAppsModel
+		result2 error
+	}
 	PushApplicationStub        func(string, string, string, ...string) error
 	pushApplicationMutex       sync.RWMutex
 	pushApplicationArgsForCall []struct {
@@ -59,6 +74,168 @@ type FakeCommonCmd struct {
 	remapRoutesReturnsOnCall map[int]struct {
 		result1 error
 	}
+	MapRoutesStub        func(string, string) error
+	mapRoutesMutex       sync.RWMutex
+	mapRoutesArgsForCall []struct {
+		arg1 string
+		arg2 string
+	}
+	mapRoutesReturns struct {
+		result1 error
+	}
+	mapRoutesReturnsOnCall map[int]struct {
+		result1 error
+	}
+	StageApplicationStub        func(string, time.Duration) error
+	stageApplicationMutex       sync.RWMutex
+	stageApplicationArgsForCall []struct {
+		arg1 string
+		arg2 time.Duration
+	}
+	stageApplicationReturns struct {
+		result1 error
+	}
+	stageApplicationReturnsOnCall map[int]struct {
+		result1 error
+	}
+	CaptureDiagnosticsStub        func(string, string) error
+	captureDiagnosticsMutex       sync.RWMutex
+	captureDiagnosticsArgsForCall []struct {
+		arg1 string
+		arg2 string
+	}
+	captureDiagnosticsReturns struct {
+		result1 error
+	}
+	captureDiagnosticsReturnsOnCall map[int]struct {
+		result1 error
+	}
+	RetainApplicationStub        func(string) error
+	retainApplicationMutex       sync.RWMutex
+	retainApplicationArgsForCall []struct {
+		arg1 string
+	}
+	retainApplicationReturns struct {
+		result1 error
+	}
+	retainApplicationReturnsOnCall map[int]struct {
+		result1 error
+	}
+	RecordDeploymentStub        func(string, commands.DeploymentRecord) error
+	recordDeploymentMutex       sync.RWMutex
+	recordDeploymentArgsForCall []struct {
+		arg1 string
+		arg2 commands.DeploymentRecord
+	}
+	recordDeploymentReturns struct {
+		result1 error
+	}
+	recordDeploymentReturnsOnCall map[int]struct {
+		result1 error
+	}
+	RecordFailureStub        func(string, commands.DeploymentRecord) error
+	recordFailureMutex       sync.RWMutex
+	recordFailureArgsForCall []struct {
+		arg1 string
+		arg2 commands.DeploymentRecord
+	}
+	recordFailureReturns struct {
+		result1 error
+	}
+	recordFailureReturnsOnCall map[int]struct {
+		result1 error
+	}
+	ListVersionsStub        func(string) ([]commands.AppVersion, error)
+	listVersionsMutex       sync.RWMutex
+	listVersionsArgsForCall []struct {
+		arg1 string
+	}
+	listVersionsReturns struct {
+		result1 []commands.AppVersion
+		result2 error
+	}
+	listVersionsReturnsOnCall map[int]struct {
+		result1 []commands.AppVersion
+		result2 error
+	}
+	GetDeploymentLockStub        func(string) (*commands.DeploymentLock, error)
+	getDeploymentLockMutex       sync.RWMutex
+	getDeploymentLockArgsForCall []struct {
+		arg1 string
+	}
+	getDeploymentLockReturns struct {
+		result1 *commands.DeploymentLock
+		result2 error
+	}
+	getDeploymentLockReturnsOnCall map[int]struct {
+		result1 *commands.DeploymentLock
+		result2 error
+	}
+	AcquireDeploymentLockStub        func(string, time.Duration) (bool, error)
+	acquireDeploymentLockMutex       sync.RWMutex
+	acquireDeploymentLockArgsForCall []struct {
+		arg1 string
+		arg2 time.Duration
+	}
+	acquireDeploymentLockReturns struct {
+		result1 bool
+		result2 error
+	}
+	acquireDeploymentLockReturnsOnCall map[int]struct {
+		result1 bool
+		result2 error
+	}
+	ReleaseDeploymentLockStub        func(string, bool) error
+	releaseDeploymentLockMutex       sync.RWMutex
+	releaseDeploymentLockArgsForCall []struct {
+		arg1 string
+		arg2 bool
+	}
+	releaseDeploymentLockReturns struct {
+		result1 error
+	}
+	releaseDeploymentLockReturnsOnCall map[int]struct {
+		result1 error
+	}
+	ExtendDeploymentLockStub        func(string, time.Duration) (time.Time, error)
+	extendDeploymentLockMutex       sync.RWMutex
+	extendDeploymentLockArgsForCall []struct {
+		arg1 string
+		arg2 time.Duration
+	}
+	extendDeploymentLockReturns struct {
+		result1 time.Time
+		result2 error
+	}
+	extendDeploymentLockReturnsOnCall map[int]struct {
+		result1 time.Time
+		result2 error
+	}
+	GetDeploymentProgressStub        func(string) (*commands.DeploymentProgress, error)
+	getDeploymentProgressMutex       sync.RWMutex
+	getDeploymentProgressArgsForCall []struct {
+		arg1 string
+	}
+	getDeploymentProgressReturns struct {
+		result1 *commands.DeploymentProgress
+		result2 error
+	}
+	getDeploymentProgressReturnsOnCall map[int]struct {
+		result1 *commands.DeploymentProgress
+		result2 error
+	}
+	SaveDeploymentProgressStub        func(string, *commands.DeploymentProgress) error
+	saveDeploymentProgressMutex       sync.RWMutex
+	saveDeploymentProgressArgsForCall []struct {
+		arg1 string
+		arg2 *commands.DeploymentProgress
+	}
+	saveDeploymentProgressReturns struct {
+		result1 error
+	}
+	saveDeploymentProgressReturnsOnCall map[int]struct {
+		result1 error
+	}
 	RemoveApplicationStub        func(string) error
 	removeApplicationMutex       sync.RWMutex
 	removeApplicationArgsForCall []struct {
@@ -134,6 +311,57 @@ func (fake *FakeCommonCmd) IsApplicationDeployedReturnsOnCall(i int, result1 str
 	}{result1, result2}
 }
 
+func (fake *FakeCommonCmd) ListApplications(arg1 string) ([]plugin_models.GetAppsModel, error) {
+	fake.listApplicationsMutex.Lock()
+	ret, specificReturn := fake.listApplicationsReturnsOnCall[len(fake.listApplicationsArgsForCall)]
+	fake.listApplicationsArgsForCall = append(fake.listApplicationsArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	fake.recordInvocation("ListApplications", []interface{}{arg1})
+	fake.listApplicationsMutex.Unlock()
+	if fake.ListApplicationsStub != nil {
+		return fake.ListApplicationsStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fake.listApplicationsReturns.result1, fake.listApplicationsReturns.result2
+}
+
+func (fake *FakeCommonCmd) ListApplicationsCallCount() int {
+	fake.listApplicationsMutex.RLock()
+	defer fake.listApplicationsMutex.RUnlock()
+	return len(fake.listApplicationsArgsForCall)
+}
+
+func (fake *FakeCommonCmd) ListApplicationsArgsForCall(i int) string {
+	fake.listApplicationsMutex.RLock()
+	defer fake.listApplicationsMutex.RUnlock()
+	return fake.listApplicationsArgsForCall[i].arg1
+}
+
+func (fake *FakeCommonCmd) ListApplicationsReturns(result1 []plugin_models.GetAppsModel, result2 error) {
+	fake.ListApplicationsStub = nil
+	fake.listApplicationsReturns = struct {
+		result1 []plugin_models.GetAppsModel
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeCommonCmd) ListApplicationsReturnsOnCall(i int, result1 []plugin_models.GetAppsModel, result2 error) {
+	fake.ListApplicationsStub = nil
+	if fake.listApplicationsReturnsOnCall == nil {
+		fake.listApplicationsReturnsOnCall = make(map[int]struct {
+			result1 []plugin_models.GetAppsModel
+			result2 error
+		})
+	}
+	fake.listApplicationsReturnsOnCall[i] = struct {
+		result1 []plugin_models.GetAppsModel
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeCommonCmd) PushApplication(arg1 string, arg2 string, arg3 string, arg4 ...string) error {
 	fake.pushApplicationMutex.Lock()
 	ret, specificReturn := fake.pushApplicationReturnsOnCall[len(fake.pushApplicationArgsForCall)]
@@ -283,6 +511,654 @@ func (fake *FakeCommonCmd) RemapRoutesReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeCommonCmd) MapRoutes(arg1 string, arg2 string) error {
+	fake.mapRoutesMutex.Lock()
+	ret, specificReturn := fake.mapRoutesReturnsOnCall[len(fake.mapRoutesArgsForCall)]
+	fake.mapRoutesArgsForCall = append(fake.mapRoutesArgsForCall, struct {
+		arg1 string
+		arg2 string
+	}{arg1, arg2})
+	fake.recordInvocation("MapRoutes", []interface{}{arg1, arg2})
+	fake.mapRoutesMutex.Unlock()
+	if fake.MapRoutesStub != nil {
+		return fake.MapRoutesStub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.mapRoutesReturns.result1
+}
+
+func (fake *FakeCommonCmd) MapRoutesCallCount() int {
+	fake.mapRoutesMutex.RLock()
+	defer fake.mapRoutesMutex.RUnlock()
+	return len(fake.mapRoutesArgsForCall)
+}
+
+func (fake *FakeCommonCmd) MapRoutesArgsForCall(i int) (string, string) {
+	fake.mapRoutesMutex.RLock()
+	defer fake.mapRoutesMutex.RUnlock()
+	return fake.mapRoutesArgsForCall[i].arg1, fake.mapRoutesArgsForCall[i].arg2
+}
+
+func (fake *FakeCommonCmd) MapRoutesReturns(result1 error) {
+	fake.MapRoutesStub = nil
+	fake.mapRoutesReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCommonCmd) MapRoutesReturnsOnCall(i int, result1 error) {
+	fake.MapRoutesStub = nil
+	if fake.mapRoutesReturnsOnCall == nil {
+		fake.mapRoutesReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.mapRoutesReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCommonCmd) StageApplication(arg1 string, arg2 time.Duration) error {
+	fake.stageApplicationMutex.Lock()
+	ret, specificReturn := fake.stageApplicationReturnsOnCall[len(fake.stageApplicationArgsForCall)]
+	fake.stageApplicationArgsForCall = append(fake.stageApplicationArgsForCall, struct {
+		arg1 string
+		arg2 time.Duration
+	}{arg1, arg2})
+	fake.recordInvocation("StageApplication", []interface{}{arg1, arg2})
+	fake.stageApplicationMutex.Unlock()
+	if fake.StageApplicationStub != nil {
+		return fake.StageApplicationStub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.stageApplicationReturns.result1
+}
+
+func (fake *FakeCommonCmd) StageApplicationCallCount() int {
+	fake.stageApplicationMutex.RLock()
+	defer fake.stageApplicationMutex.RUnlock()
+	return len(fake.stageApplicationArgsForCall)
+}
+
+func (fake *FakeCommonCmd) StageApplicationArgsForCall(i int) (string, time.Duration) {
+	fake.stageApplicationMutex.RLock()
+	defer fake.stageApplicationMutex.RUnlock()
+	return fake.stageApplicationArgsForCall[i].arg1, fake.stageApplicationArgsForCall[i].arg2
+}
+
+func (fake *FakeCommonCmd) StageApplicationReturns(result1 error) {
+	fake.StageApplicationStub = nil
+	fake.stageApplicationReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCommonCmd) StageApplicationReturnsOnCall(i int, result1 error) {
+	fake.StageApplicationStub = nil
+	if fake.stageApplicationReturnsOnCall == nil {
+		fake.stageApplicationReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.stageApplicationReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCommonCmd) CaptureDiagnostics(arg1 string, arg2 string) error {
+	fake.captureDiagnosticsMutex.Lock()
+	ret, specificReturn := fake.captureDiagnosticsReturnsOnCall[len(fake.captureDiagnosticsArgsForCall)]
+	fake.captureDiagnosticsArgsForCall = append(fake.captureDiagnosticsArgsForCall, struct {
+		arg1 string
+		arg2 string
+	}{arg1, arg2})
+	fake.recordInvocation("CaptureDiagnostics", []interface{}{arg1, arg2})
+	fake.captureDiagnosticsMutex.Unlock()
+	if fake.CaptureDiagnosticsStub != nil {
+		return fake.CaptureDiagnosticsStub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.captureDiagnosticsReturns.result1
+}
+
+func (fake *FakeCommonCmd) CaptureDiagnosticsCallCount() int {
+	fake.captureDiagnosticsMutex.RLock()
+	defer fake.captureDiagnosticsMutex.RUnlock()
+	return len(fake.captureDiagnosticsArgsForCall)
+}
+
+func (fake *FakeCommonCmd) CaptureDiagnosticsArgsForCall(i int) (string, string) {
+	fake.captureDiagnosticsMutex.RLock()
+	defer fake.captureDiagnosticsMutex.RUnlock()
+	return fake.captureDiagnosticsArgsForCall[i].arg1, fake.captureDiagnosticsArgsForCall[i].arg2
+}
+
+func (fake *FakeCommonCmd) CaptureDiagnosticsReturns(result1 error) {
+	fake.CaptureDiagnosticsStub = nil
+	fake.captureDiagnosticsReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCommonCmd) CaptureDiagnosticsReturnsOnCall(i int, result1 error) {
+	fake.CaptureDiagnosticsStub = nil
+	if fake.captureDiagnosticsReturnsOnCall == nil {
+		fake.captureDiagnosticsReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.captureDiagnosticsReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCommonCmd) RetainApplication(arg1 string) error {
+	fake.retainApplicationMutex.Lock()
+	ret, specificReturn := fake.retainApplicationReturnsOnCall[len(fake.retainApplicationArgsForCall)]
+	fake.retainApplicationArgsForCall = append(fake.retainApplicationArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	fake.recordInvocation("RetainApplication", []interface{}{arg1})
+	fake.retainApplicationMutex.Unlock()
+	if fake.RetainApplicationStub != nil {
+		return fake.RetainApplicationStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.retainApplicationReturns.result1
+}
+
+func (fake *FakeCommonCmd) RetainApplicationCallCount() int {
+	fake.retainApplicationMutex.RLock()
+	defer fake.retainApplicationMutex.RUnlock()
+	return len(fake.retainApplicationArgsForCall)
+}
+
+func (fake *FakeCommonCmd) RetainApplicationArgsForCall(i int) string {
+	fake.retainApplicationMutex.RLock()
+	defer fake.retainApplicationMutex.RUnlock()
+	return fake.retainApplicationArgsForCall[i].arg1
+}
+
+func (fake *FakeCommonCmd) RetainApplicationReturns(result1 error) {
+	fake.RetainApplicationStub = nil
+	fake.retainApplicationReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCommonCmd) RetainApplicationReturnsOnCall(i int, result1 error) {
+	fake.RetainApplicationStub = nil
+	if fake.retainApplicationReturnsOnCall == nil {
+		fake.retainApplicationReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.retainApplicationReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCommonCmd) RecordDeployment(arg1 string, arg2 commands.DeploymentRecord) error {
+	fake.recordDeploymentMutex.Lock()
+	ret, specificReturn := fake.recordDeploymentReturnsOnCall[len(fake.recordDeploymentArgsForCall)]
+	fake.recordDeploymentArgsForCall = append(fake.recordDeploymentArgsForCall, struct {
+		arg1 string
+		arg2 commands.DeploymentRecord
+	}{arg1, arg2})
+	fake.recordInvocation("RecordDeployment", []interface{}{arg1, arg2})
+	fake.recordDeploymentMutex.Unlock()
+	if fake.RecordDeploymentStub != nil {
+		return fake.RecordDeploymentStub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.recordDeploymentReturns.result1
+}
+
+func (fake *FakeCommonCmd) RecordDeploymentCallCount() int {
+	fake.recordDeploymentMutex.RLock()
+	defer fake.recordDeploymentMutex.RUnlock()
+	return len(fake.recordDeploymentArgsForCall)
+}
+
+func (fake *FakeCommonCmd) RecordDeploymentArgsForCall(i int) (string, commands.DeploymentRecord) {
+	fake.recordDeploymentMutex.RLock()
+	defer fake.recordDeploymentMutex.RUnlock()
+	return fake.recordDeploymentArgsForCall[i].arg1, fake.recordDeploymentArgsForCall[i].arg2
+}
+
+func (fake *FakeCommonCmd) RecordDeploymentReturns(result1 error) {
+	fake.RecordDeploymentStub = nil
+	fake.recordDeploymentReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCommonCmd) RecordDeploymentReturnsOnCall(i int, result1 error) {
+	fake.RecordDeploymentStub = nil
+	if fake.recordDeploymentReturnsOnCall == nil {
+		fake.recordDeploymentReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.recordDeploymentReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCommonCmd) RecordFailure(arg1 string, arg2 commands.DeploymentRecord) error {
+	fake.recordFailureMutex.Lock()
+	ret, specificReturn := fake.recordFailureReturnsOnCall[len(fake.recordFailureArgsForCall)]
+	fake.recordFailureArgsForCall = append(fake.recordFailureArgsForCall, struct {
+		arg1 string
+		arg2 commands.DeploymentRecord
+	}{arg1, arg2})
+	fake.recordInvocation("RecordFailure", []interface{}{arg1, arg2})
+	fake.recordFailureMutex.Unlock()
+	if fake.RecordFailureStub != nil {
+		return fake.RecordFailureStub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.recordFailureReturns.result1
+}
+
+func (fake *FakeCommonCmd) RecordFailureCallCount() int {
+	fake.recordFailureMutex.RLock()
+	defer fake.recordFailureMutex.RUnlock()
+	return len(fake.recordFailureArgsForCall)
+}
+
+func (fake *FakeCommonCmd) RecordFailureArgsForCall(i int) (string, commands.DeploymentRecord) {
+	fake.recordFailureMutex.RLock()
+	defer fake.recordFailureMutex.RUnlock()
+	return fake.recordFailureArgsForCall[i].arg1, fake.recordFailureArgsForCall[i].arg2
+}
+
+func (fake *FakeCommonCmd) RecordFailureReturns(result1 error) {
+	fake.RecordFailureStub = nil
+	fake.recordFailureReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCommonCmd) RecordFailureReturnsOnCall(i int, result1 error) {
+	fake.RecordFailureStub = nil
+	if fake.recordFailureReturnsOnCall == nil {
+		fake.recordFailureReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.recordFailureReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCommonCmd) ListVersions(arg1 string) ([]commands.AppVersion, error) {
+	fake.listVersionsMutex.Lock()
+	ret, specificReturn := fake.listVersionsReturnsOnCall[len(fake.listVersionsArgsForCall)]
+	fake.listVersionsArgsForCall = append(fake.listVersionsArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	fake.recordInvocation("ListVersions", []interface{}{arg1})
+	fake.listVersionsMutex.Unlock()
+	if fake.ListVersionsStub != nil {
+		return fake.ListVersionsStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fake.listVersionsReturns.result1, fake.listVersionsReturns.result2
+}
+
+func (fake *FakeCommonCmd) ListVersionsCallCount() int {
+	fake.listVersionsMutex.RLock()
+	defer fake.listVersionsMutex.RUnlock()
+	return len(fake.listVersionsArgsForCall)
+}
+
+func (fake *FakeCommonCmd) ListVersionsArgsForCall(i int) string {
+	fake.listVersionsMutex.RLock()
+	defer fake.listVersionsMutex.RUnlock()
+	return fake.listVersionsArgsForCall[i].arg1
+}
+
+func (fake *FakeCommonCmd) ListVersionsReturns(result1 []commands.AppVersion, result2 error) {
+	fake.ListVersionsStub = nil
+	fake.listVersionsReturns = struct {
+		result1 []commands.AppVersion
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeCommonCmd) ListVersionsReturnsOnCall(i int, result1 []commands.AppVersion, result2 error) {
+	fake.ListVersionsStub = nil
+	if fake.listVersionsReturnsOnCall == nil {
+		fake.listVersionsReturnsOnCall = make(map[int]struct {
+			result1 []commands.AppVersion
+			result2 error
+		})
+	}
+	fake.listVersionsReturnsOnCall[i] = struct {
+		result1 []commands.AppVersion
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeCommonCmd) GetDeploymentLock(arg1 string) (*commands.DeploymentLock, error) {
+	fake.getDeploymentLockMutex.Lock()
+	ret, specificReturn := fake.getDeploymentLockReturnsOnCall[len(fake.getDeploymentLockArgsForCall)]
+	fake.getDeploymentLockArgsForCall = append(fake.getDeploymentLockArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	fake.recordInvocation("GetDeploymentLock", []interface{}{arg1})
+	fake.getDeploymentLockMutex.Unlock()
+	if fake.GetDeploymentLockStub != nil {
+		return fake.GetDeploymentLockStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fake.getDeploymentLockReturns.result1, fake.getDeploymentLockReturns.result2
+}
+
+func (fake *FakeCommonCmd) GetDeploymentLockCallCount() int {
+	fake.getDeploymentLockMutex.RLock()
+	defer fake.getDeploymentLockMutex.RUnlock()
+	return len(fake.getDeploymentLockArgsForCall)
+}
+
+func (fake *FakeCommonCmd) GetDeploymentLockArgsForCall(i int) string {
+	fake.getDeploymentLockMutex.RLock()
+	defer fake.getDeploymentLockMutex.RUnlock()
+	return fake.getDeploymentLockArgsForCall[i].arg1
+}
+
+func (fake *FakeCommonCmd) GetDeploymentLockReturns(result1 *commands.DeploymentLock, result2 error) {
+	fake.GetDeploymentLockStub = nil
+	fake.getDeploymentLockReturns = struct {
+		result1 *commands.DeploymentLock
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeCommonCmd) GetDeploymentLockReturnsOnCall(i int, result1 *commands.DeploymentLock, result2 error) {
+	fake.GetDeploymentLockStub = nil
+	if fake.getDeploymentLockReturnsOnCall == nil {
+		fake.getDeploymentLockReturnsOnCall = make(map[int]struct {
+			result1 *commands.DeploymentLock
+			result2 error
+		})
+	}
+	fake.getDeploymentLockReturnsOnCall[i] = struct {
+		result1 *commands.DeploymentLock
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeCommonCmd) AcquireDeploymentLock(arg1 string, arg2 time.Duration) (bool, error) {
+	fake.acquireDeploymentLockMutex.Lock()
+	ret, specificReturn := fake.acquireDeploymentLockReturnsOnCall[len(fake.acquireDeploymentLockArgsForCall)]
+	fake.acquireDeploymentLockArgsForCall = append(fake.acquireDeploymentLockArgsForCall, struct {
+		arg1 string
+		arg2 time.Duration
+	}{arg1, arg2})
+	fake.recordInvocation("AcquireDeploymentLock", []interface{}{arg1, arg2})
+	fake.acquireDeploymentLockMutex.Unlock()
+	if fake.AcquireDeploymentLockStub != nil {
+		return fake.AcquireDeploymentLockStub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fake.acquireDeploymentLockReturns.result1, fake.acquireDeploymentLockReturns.result2
+}
+
+func (fake *FakeCommonCmd) AcquireDeploymentLockCallCount() int {
+	fake.acquireDeploymentLockMutex.RLock()
+	defer fake.acquireDeploymentLockMutex.RUnlock()
+	return len(fake.acquireDeploymentLockArgsForCall)
+}
+
+func (fake *FakeCommonCmd) AcquireDeploymentLockArgsForCall(i int) (string, time.Duration) {
+	fake.acquireDeploymentLockMutex.RLock()
+	defer fake.acquireDeploymentLockMutex.RUnlock()
+	return fake.acquireDeploymentLockArgsForCall[i].arg1, fake.acquireDeploymentLockArgsForCall[i].arg2
+}
+
+func (fake *FakeCommonCmd) AcquireDeploymentLockReturns(result1 bool, result2 error) {
+	fake.AcquireDeploymentLockStub = nil
+	fake.acquireDeploymentLockReturns = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeCommonCmd) AcquireDeploymentLockReturnsOnCall(i int, result1 bool, result2 error) {
+	fake.AcquireDeploymentLockStub = nil
+	if fake.acquireDeploymentLockReturnsOnCall == nil {
+		fake.acquireDeploymentLockReturnsOnCall = make(map[int]struct {
+			result1 bool
+			result2 error
+		})
+	}
+	fake.acquireDeploymentLockReturnsOnCall[i] = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeCommonCmd) ReleaseDeploymentLock(arg1 string, arg2 bool) error {
+	fake.releaseDeploymentLockMutex.Lock()
+	ret, specificReturn := fake.releaseDeploymentLockReturnsOnCall[len(fake.releaseDeploymentLockArgsForCall)]
+	fake.releaseDeploymentLockArgsForCall = append(fake.releaseDeploymentLockArgsForCall, struct {
+		arg1 string
+		arg2 bool
+	}{arg1, arg2})
+	fake.recordInvocation("ReleaseDeploymentLock", []interface{}{arg1, arg2})
+	fake.releaseDeploymentLockMutex.Unlock()
+	if fake.ReleaseDeploymentLockStub != nil {
+		return fake.ReleaseDeploymentLockStub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.releaseDeploymentLockReturns.result1
+}
+
+func (fake *FakeCommonCmd) ReleaseDeploymentLockCallCount() int {
+	fake.releaseDeploymentLockMutex.RLock()
+	defer fake.releaseDeploymentLockMutex.RUnlock()
+	return len(fake.releaseDeploymentLockArgsForCall)
+}
+
+func (fake *FakeCommonCmd) ReleaseDeploymentLockArgsForCall(i int) (string, bool) {
+	fake.releaseDeploymentLockMutex.RLock()
+	defer fake.releaseDeploymentLockMutex.RUnlock()
+	return fake.releaseDeploymentLockArgsForCall[i].arg1, fake.releaseDeploymentLockArgsForCall[i].arg2
+}
+
+func (fake *FakeCommonCmd) ReleaseDeploymentLockReturns(result1 error) {
+	fake.ReleaseDeploymentLockStub = nil
+	fake.releaseDeploymentLockReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCommonCmd) ReleaseDeploymentLockReturnsOnCall(i int, result1 error) {
+	fake.ReleaseDeploymentLockStub = nil
+	if fake.releaseDeploymentLockReturnsOnCall == nil {
+		fake.releaseDeploymentLockReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.releaseDeploymentLockReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCommonCmd) ExtendDeploymentLock(arg1 string, arg2 time.Duration) (time.Time, error) {
+	fake.extendDeploymentLockMutex.Lock()
+	ret, specificReturn := fake.extendDeploymentLockReturnsOnCall[len(fake.extendDeploymentLockArgsForCall)]
+	fake.extendDeploymentLockArgsForCall = append(fake.extendDeploymentLockArgsForCall, struct {
+		arg1 string
+		arg2 time.Duration
+	}{arg1, arg2})
+	fake.recordInvocation("ExtendDeploymentLock", []interface{}{arg1, arg2})
+	fake.extendDeploymentLockMutex.Unlock()
+	if fake.ExtendDeploymentLockStub != nil {
+		return fake.ExtendDeploymentLockStub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fake.extendDeploymentLockReturns.result1, fake.extendDeploymentLockReturns.result2
+}
+
+func (fake *FakeCommonCmd) ExtendDeploymentLockCallCount() int {
+	fake.extendDeploymentLockMutex.RLock()
+	defer fake.extendDeploymentLockMutex.RUnlock()
+	return len(fake.extendDeploymentLockArgsForCall)
+}
+
+func (fake *FakeCommonCmd) ExtendDeploymentLockArgsForCall(i int) (string, time.Duration) {
+	fake.extendDeploymentLockMutex.RLock()
+	defer fake.extendDeploymentLockMutex.RUnlock()
+	return fake.extendDeploymentLockArgsForCall[i].arg1, fake.extendDeploymentLockArgsForCall[i].arg2
+}
+
+func (fake *FakeCommonCmd) ExtendDeploymentLockReturns(result1 time.Time, result2 error) {
+	fake.ExtendDeploymentLockStub = nil
+	fake.extendDeploymentLockReturns = struct {
+		result1 time.Time
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeCommonCmd) ExtendDeploymentLockReturnsOnCall(i int, result1 time.Time, result2 error) {
+	fake.ExtendDeploymentLockStub = nil
+	if fake.extendDeploymentLockReturnsOnCall == nil {
+		fake.extendDeploymentLockReturnsOnCall = make(map[int]struct {
+			result1 time.Time
+			result2 error
+		})
+	}
+	fake.extendDeploymentLockReturnsOnCall[i] = struct {
+		result1 time.Time
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeCommonCmd) GetDeploymentProgress(arg1 string) (*commands.DeploymentProgress, error) {
+	fake.getDeploymentProgressMutex.Lock()
+	ret, specificReturn := fake.getDeploymentProgressReturnsOnCall[len(fake.getDeploymentProgressArgsForCall)]
+	fake.getDeploymentProgressArgsForCall = append(fake.getDeploymentProgressArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	fake.recordInvocation("GetDeploymentProgress", []interface{}{arg1})
+	fake.getDeploymentProgressMutex.Unlock()
+	if fake.GetDeploymentProgressStub != nil {
+		return fake.GetDeploymentProgressStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fake.getDeploymentProgressReturns.result1, fake.getDeploymentProgressReturns.result2
+}
+
+func (fake *FakeCommonCmd) GetDeploymentProgressCallCount() int {
+	fake.getDeploymentProgressMutex.RLock()
+	defer fake.getDeploymentProgressMutex.RUnlock()
+	return len(fake.getDeploymentProgressArgsForCall)
+}
+
+func (fake *FakeCommonCmd) GetDeploymentProgressArgsForCall(i int) string {
+	fake.getDeploymentProgressMutex.RLock()
+	defer fake.getDeploymentProgressMutex.RUnlock()
+	return fake.getDeploymentProgressArgsForCall[i].arg1
+}
+
+func (fake *FakeCommonCmd) GetDeploymentProgressReturns(result1 *commands.DeploymentProgress, result2 error) {
+	fake.GetDeploymentProgressStub = nil
+	fake.getDeploymentProgressReturns = struct {
+		result1 *commands.DeploymentProgress
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeCommonCmd) GetDeploymentProgressReturnsOnCall(i int, result1 *commands.DeploymentProgress, result2 error) {
+	fake.GetDeploymentProgressStub = nil
+	if fake.getDeploymentProgressReturnsOnCall == nil {
+		fake.getDeploymentProgressReturnsOnCall = make(map[int]struct {
+			result1 *commands.DeploymentProgress
+			result2 error
+		})
+	}
+	fake.getDeploymentProgressReturnsOnCall[i] = struct {
+		result1 *commands.DeploymentProgress
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeCommonCmd) SaveDeploymentProgress(arg1 string, arg2 *commands.DeploymentProgress) error {
+	fake.saveDeploymentProgressMutex.Lock()
+	ret, specificReturn := fake.saveDeploymentProgressReturnsOnCall[len(fake.saveDeploymentProgressArgsForCall)]
+	fake.saveDeploymentProgressArgsForCall = append(fake.saveDeploymentProgressArgsForCall, struct {
+		arg1 string
+		arg2 *commands.DeploymentProgress
+	}{arg1, arg2})
+	fake.recordInvocation("SaveDeploymentProgress", []interface{}{arg1, arg2})
+	fake.saveDeploymentProgressMutex.Unlock()
+	if fake.SaveDeploymentProgressStub != nil {
+		return fake.SaveDeploymentProgressStub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.saveDeploymentProgressReturns.result1
+}
+
+func (fake *FakeCommonCmd) SaveDeploymentProgressCallCount() int {
+	fake.saveDeploymentProgressMutex.RLock()
+	defer fake.saveDeploymentProgressMutex.RUnlock()
+	return len(fake.saveDeploymentProgressArgsForCall)
+}
+
+func (fake *FakeCommonCmd) SaveDeploymentProgressArgsForCall(i int) (string, *commands.DeploymentProgress) {
+	fake.saveDeploymentProgressMutex.RLock()
+	defer fake.saveDeploymentProgressMutex.RUnlock()
+	return fake.saveDeploymentProgressArgsForCall[i].arg1, fake.saveDeploymentProgressArgsForCall[i].arg2
+}
+
+func (fake *FakeCommonCmd) SaveDeploymentProgressReturns(result1 error) {
+	fake.SaveDeploymentProgressStub = nil
+	fake.saveDeploymentProgressReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCommonCmd) SaveDeploymentProgressReturnsOnCall(i int, result1 error) {
+	fake.SaveDeploymentProgressStub = nil
+	if fake.saveDeploymentProgressReturnsOnCall == nil {
+		fake.saveDeploymentProgressReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.saveDeploymentProgressReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
 func (fake *FakeCommonCmd) RemoveApplication(arg1 string) error {
 	fake.removeApplicationMutex.Lock()
 	ret, specificReturn := fake.removeApplicationReturnsOnCall[len(fake.removeApplicationArgsForCall)]
@@ -376,12 +1252,40 @@ func (fake *FakeCommonCmd) Invocations() map[string][][]interface{} {
 	defer fake.invocationsMutex.RUnlock()
 	fake.isApplicationDeployedMutex.RLock()
 	defer fake.isApplicationDeployedMutex.RUnlock()
+	fake.listApplicationsMutex.RLock()
+	defer fake.listApplicationsMutex.RUnlock()
 	fake.pushApplicationMutex.RLock()
 	defer fake.pushApplicationMutex.RUnlock()
 	fake.renameApplicationMutex.RLock()
 	defer fake.renameApplicationMutex.RUnlock()
 	fake.remapRoutesMutex.RLock()
 	defer fake.remapRoutesMutex.RUnlock()
+	fake.mapRoutesMutex.RLock()
+	defer fake.mapRoutesMutex.RUnlock()
+	fake.stageApplicationMutex.RLock()
+	defer fake.stageApplicationMutex.RUnlock()
+	fake.captureDiagnosticsMutex.RLock()
+	defer fake.captureDiagnosticsMutex.RUnlock()
+	fake.retainApplicationMutex.RLock()
+	defer fake.retainApplicationMutex.RUnlock()
+	fake.recordDeploymentMutex.RLock()
+	defer fake.recordDeploymentMutex.RUnlock()
+	fake.recordFailureMutex.RLock()
+	defer fake.recordFailureMutex.RUnlock()
+	fake.listVersionsMutex.RLock()
+	defer fake.listVersionsMutex.RUnlock()
+	fake.getDeploymentLockMutex.RLock()
+	defer fake.getDeploymentLockMutex.RUnlock()
+	fake.acquireDeploymentLockMutex.RLock()
+	defer fake.acquireDeploymentLockMutex.RUnlock()
+	fake.releaseDeploymentLockMutex.RLock()
+	defer fake.releaseDeploymentLockMutex.RUnlock()
+	fake.extendDeploymentLockMutex.RLock()
+	defer fake.extendDeploymentLockMutex.RUnlock()
+	fake.getDeploymentProgressMutex.RLock()
+	defer fake.getDeploymentProgressMutex.RUnlock()
+	fake.saveDeploymentProgressMutex.RLock()
+	defer fake.saveDeploymentProgressMutex.RUnlock()
 	fake.removeApplicationMutex.RLock()
 	defer fake.removeApplicationMutex.RUnlock()
 	fake.getDefaultDomainMutex.RLock()
@@ -16,9 +16,12 @@
 
 package fakes
 
+import "github.com/comcast/cf-zdd-plugin/commands"
+
 type FakeCmdRunner struct {
 	CmdSpy     []string
 	RunSpy     int
+	ArgsSpy    *commands.CfZddCmd
 	ErrRunFake error
 }
 
@@ -26,3 +29,7 @@ func (s *FakeCmdRunner) Run() error {
 	s.RunSpy++
 	return s.ErrRunFake
 }
+
+func (s *FakeCmdRunner) SetArgs(args *commands.CfZddCmd) {
+	s.ArgsSpy = args
+}